@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/common/broker"
+	"github.com/common/registry"
+	entry "github.com/entry/application"
+	"github.com/entry/quota"
+	"github.com/entry/repository/execution"
+	"github.com/entry/repository/result"
+	entryworkers "github.com/entry/repository/worker"
+	worker "github.com/worker/application"
+	"github.com/worker/model"
+	workerrepo "github.com/worker/repository/worker"
+)
+
+/*
+The all-in-one mode runs the entry and its workers in a single process, without
+RabbitMQ nor Redis: the tasks go through an in-memory broker and the workers
+register in an in-memory registry. Nothing survives a restart, it is meant for
+development and integration tests.
+
+The entry and the workers read their usual env vars (and .env file), plus:
+	- ALL_IN_ONE_WORKERS: the number of workers, 2 by default
+*/
+
+const defaultWorkers = 2
+
+func main() {
+	// the workers re-execute the binary to set up the isolated executor sandboxes
+	model.RunSandboxInit()
+
+	entryConfig := entry.LoadConfig()
+	workerConfig := worker.LoadConfig()
+
+	// the entry serves the metrics of the whole process
+	workerConfig.MetricsAddr = ""
+
+	workersNum := defaultWorkers
+	if env, exists := os.LookupEnv("ALL_IN_ONE_WORKERS"); exists {
+		number, err := strconv.Atoi(env)
+		if err != nil || number < 1 {
+			log.Fatalf("Invalid ALL_IN_ONE_WORKERS: %q", env)
+		}
+
+		workersNum = number
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	b := broker.NewMemoryMessageBroker()
+	workers := registry.NewMemoryWorkerRegistry()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workersNum+1)
+
+	for i := 0; i < workersNum; i++ {
+		config := workerConfig
+		config.ID = uuid.New()
+
+		app := worker.NewInProcess(config, b, &workerrepo.MemoryWorkerRepository{Registry: workers})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- app.Start(ctx)
+		}()
+	}
+
+	app := entry.NewInProcess(entryConfig, entry.Backends{
+		Broker:     b,
+		Workers:    &entryworkers.MemoryWorkerRepository{Registry: workers},
+		Limiter:    &quota.MemoryLimiter{Defaults: entryConfig.Quota},
+		Executions: &execution.MemoryExecutionRepository{},
+		Results:    &result.MemoryResultRepository{},
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- app.Start(ctx)
+	}()
+
+	log.Printf("Running the entry with %d workers in-process", workersNum)
+
+	// the first component to stop takes the others down
+	err := <-errs
+	cancel()
+	wg.Wait()
+
+	if err != nil {
+		log.Panicf("Failed to run: %s", err)
+	}
+}
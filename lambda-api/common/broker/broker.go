@@ -5,6 +5,19 @@ package broker
 
 type DeliveryMessage struct {
 	Body string
+
+	// set for the messages consumed with manual acknowledgements
+	ack func() error
+}
+
+// Ack tells the broker the message was handled. A message consumed with
+// ConsumeAcked is delivered again when its consumer goes away before acking it.
+func (msg DeliveryMessage) Ack() error {
+	if msg.ack == nil {
+		return nil
+	}
+
+	return msg.ack()
 }
 
 type MessageBroker interface {
@@ -14,6 +27,16 @@ type MessageBroker interface {
 
 	Consume(string) (<-chan DeliveryMessage, error)
 
+	// ConsumeAcked consumes the queue with manual acknowledgements, with at most
+	// prefetch messages delivered and not acked yet
+	ConsumeAcked(queueName string, prefetch int) (<-chan DeliveryMessage, error)
+
+	// Get pulls a single message, the bool is false when the queue is empty
+	Get(string) (DeliveryMessage, bool, error)
+
+	// QueueDepth returns the number of messages waiting in the queue
+	QueueDepth(string) (int, error)
+
 	SendMessageToQueue(string, string) error
 
 	Close() error
@@ -0,0 +1,143 @@
+package broker
+
+import (
+	"sync"
+)
+
+// MemoryMessageBroker keeps the queues in the process, for the all-in-one mode
+// where the entry and the workers share a single broker. Nothing is persisted.
+type MemoryMessageBroker struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type memoryQueue struct {
+	messages []DeliveryMessage
+	notify   chan struct{} // signaled when a message is published
+}
+
+func NewMemoryMessageBroker() *MemoryMessageBroker {
+	return &MemoryMessageBroker{
+		queues: make(map[string]*memoryQueue),
+		done:   make(chan struct{}),
+	}
+}
+
+// Connect does nothing, the broker is shared by everyone in the process
+func (broker *MemoryMessageBroker) Connect(string) error {
+	return nil
+}
+
+func (broker *MemoryMessageBroker) CreateQueue(queueName string) error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	broker.queue(queueName)
+	return nil
+}
+
+// queue returns the named queue, creating it if needed; the lock must be held
+func (broker *MemoryMessageBroker) queue(queueName string) *memoryQueue {
+	q, exists := broker.queues[queueName]
+	if !exists {
+		q = &memoryQueue{notify: make(chan struct{}, 1)}
+		broker.queues[queueName] = q
+	}
+
+	return q
+}
+
+func (broker *MemoryMessageBroker) Consume(queueName string) (<-chan DeliveryMessage, error) {
+	msgs := make(chan DeliveryMessage)
+
+	broker.mu.Lock()
+	q := broker.queue(queueName)
+	broker.mu.Unlock()
+
+	go func() {
+		defer close(msgs)
+
+		for {
+			msg, found, _ := broker.Get(queueName)
+			if !found {
+				select {
+				case <-q.notify:
+					continue
+				case <-broker.done:
+					return
+				}
+			}
+
+			select {
+			case msgs <- msg:
+			case <-broker.done:
+				return
+			}
+		}
+	}()
+
+	return msgs, nil
+}
+
+// ConsumeAcked consumes like Consume, the messages are gone once taken since
+// nothing outlives the process anyway
+func (broker *MemoryMessageBroker) ConsumeAcked(queueName string, _ int) (<-chan DeliveryMessage, error) {
+	return broker.Consume(queueName)
+}
+
+func (broker *MemoryMessageBroker) Get(queueName string) (DeliveryMessage, bool, error) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	q := broker.queue(queueName)
+	if len(q.messages) == 0 {
+		return DeliveryMessage{}, false, nil
+	}
+
+	msg := q.messages[0]
+	q.messages = q.messages[1:]
+
+	// wake up another consumer for the rest
+	if len(q.messages) > 0 {
+		q.signal()
+	}
+
+	return msg, true, nil
+}
+
+func (broker *MemoryMessageBroker) QueueDepth(queueName string) (int, error) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	return len(broker.queue(queueName).messages), nil
+}
+
+func (broker *MemoryMessageBroker) SendMessageToQueue(queueName, message string) error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	q := broker.queue(queueName)
+	q.messages = append(q.messages, DeliveryMessage{Body: message})
+	q.signal()
+
+	return nil
+}
+
+// Close stops every consumer, it may be called by each user of the broker
+func (broker *MemoryMessageBroker) Close() error {
+	broker.closeOnce.Do(func() {
+		close(broker.done)
+	})
+
+	return nil
+}
+
+func (q *memoryQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
@@ -13,6 +13,9 @@ type RabbitMQMessageBroker struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
 	queue   amqp.Queue
+
+	// the channels of the consumers acking their messages, closed with the broker
+	consumers []*amqp.Channel
 }
 
 func (broker *RabbitMQMessageBroker) Connect(connectionUrl string) error {
@@ -86,6 +89,92 @@ func (broker *RabbitMQMessageBroker) Consume(queueName string) (<-chan DeliveryM
 	return dMsgs, err
 }
 
+func (broker *RabbitMQMessageBroker) ConsumeAcked(queueName string, prefetch int) (<-chan DeliveryMessage, error) {
+	if broker.conn == nil {
+		return nil, errors.New("connection is nil")
+	}
+
+	// the prefetch and the acks belong to a channel, each consumer gets its own
+	ch, err := broker.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ch.Qos(prefetch, 0, false)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	msgs, err := ch.Consume(
+		queueName, // queue
+		"",        // consumer
+		false,     // auto-ack
+		false,     // exclusive
+		false,     // no-local
+		false,     // no-wait
+		nil,       // args
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	broker.consumers = append(broker.consumers, ch)
+
+	out := make(chan DeliveryMessage)
+
+	go func() {
+		defer close(out)
+
+		for msg := range msgs {
+			delivery := msg
+			out <- DeliveryMessage{
+				Body: string(delivery.Body),
+				ack:  func() error { return delivery.Ack(false) },
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (broker *RabbitMQMessageBroker) Get(queueName string) (DeliveryMessage, bool, error) {
+	if broker.channel == nil {
+		return DeliveryMessage{}, false, errors.New("channel is nil")
+	}
+
+	msg, ok, err := broker.channel.Get(queueName, true)
+	if err != nil || !ok {
+		return DeliveryMessage{}, false, err
+	}
+
+	return DeliveryMessage{Body: string(msg.Body)}, true, nil
+}
+
+func (broker *RabbitMQMessageBroker) QueueDepth(queueName string) (int, error) {
+	// a failed passive declare closes the channel, so don't use the shared one
+	ch, err := broker.conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(
+		queueName, // name
+		false,     // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return q.Messages, nil
+}
+
 func (broker *RabbitMQMessageBroker) SendMessageToQueue(queueName, message string) error {
 	// TODO we shouldn't open and close the channel within this function
 	ch, err := broker.conn.Channel()
@@ -136,6 +225,13 @@ func (broker *RabbitMQMessageBroker) SendMessageToQueue(queueName, message strin
 }
 
 func (broker *RabbitMQMessageBroker) Close() error {
+	// the messages delivered to the consumers and not acked go back to their queues
+	for _, ch := range broker.consumers {
+		if err := ch.Close(); err != nil {
+			log.Printf("Error closing a rabbitmq consumer channel: %s", err)
+		}
+	}
+
 	defer func(channel *amqp.Channel) {
 		err := channel.Close()
 		if err != nil {
@@ -1,9 +1,11 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"regexp"
 
 	"gopkg.in/yaml.v2"
 )
@@ -15,6 +17,26 @@ type Language struct {
 
 	CompileCmds []string `yaml:"compile,omitempty"`
 	RunCmds     []string `yaml:"run"`
+
+	// how the processes are run: host (default), isolated or wasm
+	Executor string `yaml:"executor,omitempty"`
+
+	// limits of the wasm executor, the defaults are used when missing
+	Wasm WasmLimits `yaml:"wasm,omitempty"`
+
+	// the toolchain installed on the workers, and programs to check it
+	NixPkgs []string       `yaml:"nix_pkgs,omitempty"`
+	Tests   []LanguageTest `yaml:"tests,omitempty"`
+}
+
+type LanguageTest struct {
+	Code   string `yaml:"code"`
+	Output string `yaml:"output"`
+}
+
+type WasmLimits struct {
+	MemoryPages uint32 `yaml:"memory_pages,omitempty"` // of 64 KiB
+	Fuel        uint64 `yaml:"fuel,omitempty"`         // function calls
 }
 
 func NewLanguage(runtimeFile fs.DirEntry, dir string) (Language, error) {
@@ -25,17 +47,75 @@ func NewLanguage(runtimeFile fs.DirEntry, dir string) (Language, error) {
 		return Language{}, err
 	}
 
+	lang, err := ParseLanguage(data)
+	if err != nil {
+		return Language{}, fmt.Errorf("%s: %w", runtimeFile.Name(), err)
+	}
+
+	return lang, nil
+}
+
+// ParseLanguage decodes a runtime definition, unknown keys are rejected
+func ParseLanguage(data []byte) (Language, error) {
 	var lang Language
-	err = yaml.Unmarshal(data, &lang)
+	err := yaml.UnmarshalStrict(data, &lang)
 	if err != nil {
 		return Language{}, err
 	}
 
-	return lang, nil
+	return lang, lang.Validate()
 }
 
 /*
 	Two special keywords in the compile & run commands arrays:
-		- <entry>: the main source file (usually ./worker/tasks/exec_id/main)
+		- <entry>: the main source file, relative to the task directory (main.<extension>)
 		- <output>: the compiled binary after the compilation phase
 */
+
+var placeholderPattern = regexp.MustCompile(`<[^<>]*>`)
+
+func (l Language) Validate() error {
+	switch {
+	case l.Name == "":
+		return errors.New("the name is required")
+	case len(l.Versions) == 0:
+		return errors.New("at least one version is required")
+	case l.Extension == "":
+		return errors.New("the extension is required")
+	case len(l.RunCmds) == 0:
+		return errors.New("the run command is required")
+	}
+
+	if err := checkPlaceholders(l.CompileCmds, "<entry>", "<output>"); err != nil {
+		return fmt.Errorf("compile: %w", err)
+	}
+
+	// the output only exists after a compilation
+	runPlaceholders := []string{"<entry>"}
+	if len(l.CompileCmds) > 0 {
+		runPlaceholders = append(runPlaceholders, "<output>")
+	}
+
+	if err := checkPlaceholders(l.RunCmds, runPlaceholders...); err != nil {
+		return fmt.Errorf("run: %w", err)
+	}
+
+	return nil
+}
+
+func checkPlaceholders(commands []string, allowed ...string) error {
+	for _, arg := range commands {
+		for _, placeholder := range placeholderPattern.FindAllString(arg, -1) {
+			valid := false
+			for _, name := range allowed {
+				valid = valid || placeholder == name
+			}
+
+			if !valid {
+				return fmt.Errorf("unexpected placeholder %s", placeholder)
+			}
+		}
+	}
+
+	return nil
+}
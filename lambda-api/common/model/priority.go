@@ -0,0 +1,32 @@
+package model
+
+import "fmt"
+
+// every worker consumes one queue per priority, named <worker id>.<priority>
+
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Priorities lists the lanes from the most to the least urgent
+var Priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ParsePriority validates a requested priority, an empty one is normal
+func ParsePriority(value string) (Priority, error) {
+	switch Priority(value) {
+	case "":
+		return PriorityNormal, nil
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return Priority(value), nil
+	default:
+		return "", fmt.Errorf("unknown priority %q, expected high, normal or low", value)
+	}
+}
+
+func PriorityQueue(workerID string, priority Priority) string {
+	return fmt.Sprintf("%s.%s", workerID, priority)
+}
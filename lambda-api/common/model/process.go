@@ -11,6 +11,14 @@ type ProcessResult struct {
 	Memory uint64 `json:"memory"` // bytes
 
 	ExitCode int32 `json:"exit_code"`
+	TimedOut bool  `json:"timed_out,omitempty"` // killed after exceeding the cpu time limit
+
+	// the streams are cut at the output limits, the sizes are the ones written by the process
+	StdoutBytes     int64 `json:"stdout_bytes"`
+	StderrBytes     int64 `json:"stderr_bytes"`
+	StdoutTruncated bool  `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool  `json:"stderr_truncated,omitempty"`
+	OutputKilled    bool  `json:"output_killed,omitempty"` // killed after exceeding an output limit
 }
 
 type WorkerResponse struct {
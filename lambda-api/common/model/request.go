@@ -1,6 +1,10 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type File struct {
 	Name     string `json:"name"`
@@ -28,9 +32,38 @@ type ProcessInfo struct {
 
 	EnvironmentVars map[string]string `json:"env,omitempty"`
 
+	// lowered to the caps of the worker, which are used when missing
+	OutputLimits OutputLimits `json:"output_limits,omitempty"`
+
 	WorkingDirectory string `json:"-"`
 }
 
+// OutputLimits caps the bytes kept from each output stream of a process
+type OutputLimits struct {
+	Stdout int64 `json:"stdout,omitempty"`
+	Stderr int64 `json:"stderr,omitempty"`
+
+	// kill the process at the cap, instead of discarding the rest of its output
+	Kill bool `json:"kill,omitempty"`
+}
+
+// Within returns the requested limits, bounded by max
+func (l OutputLimits) Within(max OutputLimits) OutputLimits {
+	bounded := max
+
+	if l.Stdout > 0 && l.Stdout < max.Stdout {
+		bounded.Stdout = l.Stdout
+	}
+
+	if l.Stderr > 0 && l.Stderr < max.Stderr {
+		bounded.Stderr = l.Stderr
+	}
+
+	bounded.Kill = l.Kill || max.Kill
+
+	return bounded
+}
+
 type ExecutionRequest struct {
 	Runtime struct {
 		Name    string `json:"name"`
@@ -41,11 +74,26 @@ type ExecutionRequest struct {
 		Files []File `json:"files"`
 	} `json:"project"`
 	Process ProcessInfo `json:"process,omitempty"`
+
+	// high, normal or low, the queue lane of the task, normal by default
+	Priority string `json:"priority,omitempty"`
+
+	// opt-in, byte-identical requests get the cached response of the first run
+	Memoize bool `json:"memoize,omitempty"`
 }
 
 type ExecutionRequestWrapper struct {
 	Id  uuid.UUID
 	Req ExecutionRequest
+
+	// set by the entry right before publishing, used to measure queue wait time
+	QueuedAt time.Time `json:"queued_at"`
+
+	// the tenant the execution is attributed to, resolved by the entry
+	Tenant string `json:"tenant,omitempty"`
+
+	// W3C trace context of the entry span that published the task
+	TraceContext map[string]string `json:"trace_context,omitempty"`
 }
 
 /*
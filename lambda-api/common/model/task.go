@@ -1,5 +1,7 @@
 package model
 
+import "github.com/google/uuid"
+
 type ExecutionTaskStatus string
 
 const (
@@ -9,6 +11,7 @@ const (
 )
 
 type ResponseTask struct {
+	Id     uuid.UUID           `json:"id"`
 	Status ExecutionTaskStatus `json:"status"`
 	Output WorkerResponse      `json:"output"`
 }
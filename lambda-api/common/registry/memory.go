@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryWorkerRegistry replaces the worker entries kept in Redis when the entry
+// and the workers run in the same process. The workers publish the same json
+// documents as in Redis, the entry decodes only the fields it needs.
+type MemoryWorkerRegistry struct {
+	mu      sync.RWMutex
+	workers map[string][]byte
+}
+
+func NewMemoryWorkerRegistry() *MemoryWorkerRegistry {
+	return &MemoryWorkerRegistry{
+		workers: make(map[string][]byte),
+	}
+}
+
+func (r *MemoryWorkerRegistry) Set(id string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.workers[id] = data
+}
+
+func (r *MemoryWorkerRegistry) Delete(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.workers, id)
+}
+
+// List returns the documents of every worker, ordered by id
+func (r *MemoryWorkerRegistry) List() [][]byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.workers))
+	for id := range r.workers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	documents := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		documents = append(documents, r.workers[id])
+	}
+
+	return documents
+}
+
+func (r *MemoryWorkerRegistry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.workers)
+}
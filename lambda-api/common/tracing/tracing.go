@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// shared tracing setup for the entry and the workers,
+// the trace context crosses the broker inside the request wrapper
+
+type ShutdownFunc func(context.Context) error
+
+// Setup installs the global tracer provider and the W3C trace context propagator.
+// With an empty endpoint nothing is exported, but the trace context is still
+// propagated so the spans of the other services stay connected.
+func Setup(ctx context.Context, serviceName, endpoint string) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exporterOptions(endpoint)...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// the endpoint is either host:port or a full http(s) url of the collector
+func exporterOptions(endpoint string) []otlptracehttp.Option {
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		return []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(strings.TrimPrefix(endpoint, "https://")),
+		}
+	case strings.HasPrefix(endpoint, "http://"):
+		return []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(strings.TrimPrefix(endpoint, "http://")),
+			otlptracehttp.WithInsecure(),
+		}
+	default:
+		return []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithInsecure(),
+		}
+	}
+}
+
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Inject serializes the trace context of ctx, to be carried inside a broker message
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier
+}
+
+// Extract restores a trace context serialized with Inject
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
@@ -5,28 +5,37 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
-	common "github.com/common/model"
-
 	"github.com/common/broker"
+	"github.com/common/tracing"
+	"github.com/entry/auth"
+	"github.com/entry/metrics"
 	"github.com/entry/model"
+	"github.com/entry/quota"
+	"github.com/entry/repository/execution"
+	"github.com/entry/repository/result"
+	"github.com/entry/repository/worker"
 	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
 )
 
 type ExecutionContext struct {
-	incomingMessages []common.WorkerResponseWrapper
-	backgroundCtx    context.Context
-	messageMutex     sync.Mutex
+	backgroundCtx context.Context
 }
 
 type App struct {
 	router http.Handler
 
-	redisDB *redis.Client
+	redisDB *redis.Client // nil when running in-process
 	broker  broker.MessageBroker
 	reply   *model.ReplyQueue
+	workers worker.Registry
+
+	authenticator *auth.Authenticator
+	limiter       quota.Limiter
+	executions    execution.Repository
+	results       result.Repository
 
 	ctx ExecutionContext
 
@@ -34,14 +43,58 @@ type App struct {
 }
 
 func New(config Config) *App {
+	redisDB := redis.NewClient(&redis.Options{
+		Addr: config.RedisAddress,
+	})
+
+	app := newApp(config, Backends{
+		Broker: &broker.RabbitMQMessageBroker{},
+		Workers: &worker.RedisWorkerRepository{
+			Client: redisDB,
+		},
+		Limiter: &quota.RedisLimiter{
+			Client:   redisDB,
+			Defaults: config.Quota,
+		},
+		Executions: &execution.RedisExecutionRepository{
+			Client:    redisDB,
+			Retention: config.ExecutionRetention,
+		},
+		Results: &result.RedisResultRepository{
+			Client: redisDB,
+		},
+	})
+
+	app.redisDB = redisDB
+
+	return app
+}
+
+// Backends are the services shared with the workers, Redis and RabbitMQ
+// unless the entry runs in the same process as its workers
+type Backends struct {
+	Broker     broker.MessageBroker
+	Workers    worker.Registry
+	Limiter    quota.Limiter
+	Executions execution.Repository
+	Results    result.Repository
+}
+
+// NewInProcess creates an entry without Redis, used by the all-in-one mode
+func NewInProcess(config Config, backends Backends) *App {
+	return newApp(config, backends)
+}
+
+func newApp(config Config, backends Backends) *App {
 	app := &App{
-		redisDB: redis.NewClient(&redis.Options{
-			Addr: config.RedisAddress,
-		}),
-		broker: &broker.RabbitMQMessageBroker{},
+		broker:        backends.Broker,
+		workers:       backends.Workers,
+		authenticator: auth.NewAuthenticator(config.APIKeys, config.JWTSecret),
+		limiter:       backends.Limiter,
+		executions:    backends.Executions,
+		results:       backends.Results,
 		ctx: ExecutionContext{
-			incomingMessages: make([]common.WorkerResponseWrapper, 0),
-			backgroundCtx:    context.Background(),
+			backgroundCtx: context.Background(),
 		},
 		config: config,
 	}
@@ -52,7 +105,18 @@ func New(config Config) *App {
 }
 
 func (a *App) Start(ctx context.Context) error {
-	err := a.broker.Connect(a.config.RabbitMQAddress)
+	shutdownTracing, err := tracing.Setup(ctx, "lambda-entry", a.config.OTLPEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to setup tracing: %w", err)
+	}
+
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("Failed to flush traces: %s", err)
+		}
+	}()
+
+	err = a.broker.Connect(a.config.RabbitMQAddress)
 	if err != nil {
 		return err
 	}
@@ -62,22 +126,31 @@ func (a *App) Start(ctx context.Context) error {
 		return err
 	}
 
+	a.registerMetrics()
+	a.setupCronJobs()
+
+	if !a.authenticator.Enabled() {
+		log.Println("No API_KEYS or JWT_SECRET configured, every execution request will be rejected")
+	}
+
 	server := &http.Server{
 		Addr:    a.config.ServerAddr,
 		Handler: a.router,
 	}
 
-	err = a.redisDB.Ping(ctx).Err()
-	if err != nil {
-		return fmt.Errorf("failed to connect to redis: %w", err)
-	}
-
-	defer func() {
-		if err := a.redisDB.Close(); err != nil {
-			fmt.Println("failed to close redis", err)
+	if a.redisDB != nil {
+		err = a.redisDB.Ping(ctx).Err()
+		if err != nil {
+			return fmt.Errorf("failed to connect to redis: %w", err)
 		}
-		fmt.Println("closed redis!")
-	}()
+
+		defer func() {
+			if err := a.redisDB.Close(); err != nil {
+				fmt.Println("failed to close redis", err)
+			}
+			fmt.Println("closed redis!")
+		}()
+	}
 
 	log.Printf("Starting the code execution service on http://%s\n", a.config.ServerAddr)
 
@@ -106,3 +179,44 @@ func (a *App) Start(ctx context.Context) error {
 		return server.Shutdown(timeout)
 	}
 }
+
+func (a *App) registerMetrics() {
+	metrics.RegisterReplyBacklog(func() float64 {
+		return float64(a.reply.Backlog())
+	})
+
+	metrics.RegisterWorkerCount(func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		count, err := a.workers.CountWorkers(ctx)
+		if err != nil {
+			return 0
+		}
+
+		return float64(count)
+	})
+}
+
+func (a *App) setupCronJobs() {
+	c := cron.New()
+
+	// the records expire on their own, only the indexes need to be trimmed
+	_, err := c.AddFunc("@every 1h", func() {
+		cutoff := time.Now().Add(-a.config.ExecutionRetention)
+
+		removed, err := a.executions.Purge(context.Background(), cutoff)
+		if err != nil {
+			log.Printf("Failed to purge the execution history: %s", err)
+			return
+		}
+
+		log.Printf("Purged %d executions older than %s", removed, cutoff.Format(time.RFC3339))
+	})
+	if err != nil {
+		log.Printf("Failed to create the retention function.")
+		return
+	}
+
+	c.Start()
+}
@@ -0,0 +1,246 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	common "github.com/common/model"
+	"github.com/common/tracing"
+	"github.com/entry/auth"
+	"github.com/entry/quota"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const defaultBatchConcurrency = 8
+
+type BatchRequest struct {
+	Requests    []json.RawMessage `json:"requests"`
+	Concurrency int               `json:"concurrency,omitempty"`
+	StopOnError bool              `json:"stop_on_error,omitempty"` // skip the items not started yet after a failure
+}
+
+// the statuses of the batch items that never ran, next to the usual task statuses
+const (
+	StatusThrottled common.ExecutionTaskStatus = "throttled"
+	StatusSkipped   common.ExecutionTaskStatus = "skipped"
+)
+
+type BatchItemResult struct {
+	Index  int                        `json:"index"`
+	Status common.ExecutionTaskStatus `json:"status"`
+	Cached bool                       `json:"cached,omitempty"`
+	Result *common.ResponseTask       `json:"result,omitempty"`
+	Error  string                     `json:"error,omitempty"`
+}
+
+type BatchSummary struct {
+	Total      int   `json:"total"`
+	Succeeded  int   `json:"succeeded"`
+	Errored    int   `json:"errored"`
+	Failed     int   `json:"failed"`
+	Throttled  int   `json:"throttled"`
+	Skipped    int   `json:"skipped"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+/*
+The response is a stream of JSON lines, one per item in completion order,
+followed by the summary line: {"summary": {...}}.
+A failed item never fails the whole batch, the status is always 200 once streaming started.
+*/
+
+func (a *App) ExecuteBatchRequest(w http.ResponseWriter, r *http.Request) {
+	var batch BatchRequest
+	err := json.NewDecoder(r.Body).Decode(&batch)
+	if err != nil {
+		FailWithStatus(w, http.StatusBadRequest, fmt.Sprintf("Failed to decode the request body: %s", err))
+		return
+	}
+
+	if len(batch.Requests) == 0 || len(batch.Requests) > a.config.BatchMaxItems {
+		FailWithStatus(w, http.StatusBadRequest, fmt.Sprintf("a batch must have 1 to %d requests", a.config.BatchMaxItems))
+		return
+	}
+
+	concurrency := batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	if concurrency > a.config.BatchMaxConcurrency {
+		concurrency = a.config.BatchMaxConcurrency
+	}
+
+	identity, _ := auth.FromContext(r.Context())
+
+	ctx, span := tracing.Tracer("entry").Start(r.Context(), "entry.batch")
+	span.SetAttributes(
+		attribute.String("lambda.tenant", identity.Tenant),
+		attribute.Int("lambda.batch_size", len(batch.Requests)),
+		attribute.Int("lambda.batch_concurrency", concurrency),
+	)
+	defer span.End()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	startTime := time.Now()
+	results := a.runBatch(ctx, identity.Tenant, batch, concurrency)
+
+	summary := BatchSummary{Total: len(batch.Requests)}
+	encoder := json.NewEncoder(w)
+
+	for item := range results {
+		summary.add(item)
+
+		err = encoder.Encode(item)
+		if err != nil {
+			log.Printf("Failed to write a batch item: %s", err)
+			continue
+		}
+		w.(http.Flusher).Flush()
+	}
+
+	summary.DurationMs = time.Since(startTime).Milliseconds()
+
+	err = encoder.Encode(struct {
+		Summary BatchSummary `json:"summary"`
+	}{summary})
+	if err != nil {
+		log.Printf("Failed to write the batch summary: %s", err)
+	}
+	w.(http.Flusher).Flush()
+}
+
+// runBatch fans the items out with at most concurrency running at once,
+// the results are sent as they complete and the channel is closed at the end
+func (a *App) runBatch(ctx context.Context, tenant string, batch BatchRequest, concurrency int) <-chan BatchItemResult {
+	results := make(chan BatchItemResult)
+	slots := make(chan struct{}, concurrency)
+
+	var stopped atomic.Bool
+	var wg sync.WaitGroup
+
+	// the retries of the items throttled on concurrency are capped by the requests the
+	// tenant has left in the minute, so a large batch gives up instead of spinning
+	retries := a.retryBudget(ctx, tenant)
+
+	go func() {
+		for i, raw := range batch.Requests {
+			slots <- struct{}{}
+			wg.Add(1)
+
+			go func(index int, raw json.RawMessage) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+
+				if stopped.Load() || ctx.Err() != nil {
+					results <- BatchItemResult{Index: index, Status: StatusSkipped}
+					return
+				}
+
+				item := a.runBatchItem(ctx, tenant, index, raw, retries)
+				if batch.StopOnError && item.Status != common.StatusDone {
+					stopped.Store(true)
+				}
+
+				results <- item
+			}(i, raw)
+		}
+
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// retryBudget returns the number of retries a batch may make, nil when they are not capped
+func (a *App) retryBudget(ctx context.Context, tenant string) *atomic.Int64 {
+	remaining, err := a.limiter.RemainingRequests(ctx, tenant)
+	if err != nil {
+		log.Printf("Failed to get the remaining requests of %s: %s", tenant, err)
+		remaining = 0
+	}
+
+	if remaining < 0 {
+		return nil
+	}
+
+	retries := &atomic.Int64{}
+	retries.Store(remaining)
+
+	return retries
+}
+
+func (a *App) runBatchItem(ctx context.Context, tenant string, index int, raw json.RawMessage, retries *atomic.Int64) BatchItemResult {
+	item := BatchItemResult{Index: index}
+
+	var req common.ExecutionRequest
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		item.Status = common.StatusFailed
+		item.Error = fmt.Sprintf("invalid request: %s", err)
+		return item
+	}
+
+	// bulk work must not delay the interactive calls
+	if req.Priority == "" {
+		req.Priority = string(common.PriorityLow)
+	}
+
+	for {
+		res, hit, err := a.executeOnce(ctx, tenant, "", requestHash(raw), req)
+
+		// the batch competes with the other requests of the tenant for its slots,
+		// the limiter refunds the rate of a request rejected on concurrency
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) && exceeded.Kind == quota.KindConcurrency && (retries == nil || retries.Add(-1) >= 0) {
+			select {
+			case <-time.After(exceeded.RetryAfter):
+				continue
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+
+		switch {
+		case errors.As(err, &exceeded):
+			item.Status = StatusThrottled
+			item.Error = err.Error()
+		case err != nil:
+			item.Status = common.StatusFailed
+			item.Error = err.Error()
+		default:
+			item.Status = res.Status
+			item.Cached = hit != CacheMiss
+			item.Result = &res
+		}
+
+		return item
+	}
+}
+
+func (s *BatchSummary) add(item BatchItemResult) {
+	switch item.Status {
+	case common.StatusDone:
+		s.Succeeded++
+	case common.StatusError:
+		s.Errored++
+	case StatusThrottled:
+		s.Throttled++
+	case StatusSkipped:
+		s.Skipped++
+	default:
+		s.Failed++
+	}
+}
@@ -1,42 +1,41 @@
 package application
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"time"
 
 	common "github.com/common/model"
+	"github.com/common/tracing"
+	"github.com/entry/auth"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
-func (a *App) ExecuteCode(req common.ExecutionRequest) (common.ResponseTask, error) {
-	workerId, err := ChooseWorker(a.redisDB, a.ctx.backgroundCtx)
-	if err != nil {
-		fmtErr := fmt.Errorf("failed to choose a worker: %s", err)
-		return common.ResponseTask{}, fmtErr
-	}
-
-	// send task to worker
-	wrapperMsg := common.ExecutionRequestWrapper{
-		Id:  uuid.New(),
-		Req: req,
-	}
+// how long a request waits for the worker reply
+const replyTimeout = 2 * time.Minute
 
-	brokerMsg, err := json.Marshal(wrapperMsg)
-	err = a.broker.SendMessageToQueue(workerId, string(brokerMsg))
+func (a *App) ExecuteCode(ctx context.Context, req common.ExecutionRequest) (common.ResponseTask, error) {
+	wrapperMsg, err := a.dispatchTask(ctx, req)
 	if err != nil {
-		fmtErr := fmt.Errorf("failed to send message to the queue: %s", err)
-		return common.ResponseTask{}, fmtErr
+		return common.ResponseTask{}, err
 	}
 
 	// listen to the reply queue and wait for the right message to come
-	a.ctx.messageMutex.Lock()
-	workerResponse, err := a.getBackMessage(wrapperMsg.Id)
-	a.ctx.messageMutex.Unlock()
+	waitCtx, span := tracing.Tracer("entry").Start(ctx, "entry.await_reply")
+	waitCtx, cancel := context.WithTimeout(waitCtx, replyTimeout)
+
+	workerResponse, err := a.reply.Wait(waitCtx, wrapperMsg.Id)
+
+	cancel()
+	span.End()
 
 	if err != nil {
 		fmtErr := fmt.Errorf("failed to get back the worker message: %s", err)
 		return common.ResponseTask{
+			Id:     wrapperMsg.Id,
 			Status: common.StatusFailed,
 			Output: common.WorkerResponse{},
 		}, fmtErr
@@ -44,6 +43,7 @@ func (a *App) ExecuteCode(req common.ExecutionRequest) (common.ResponseTask, err
 
 	// write the response
 	task := common.ResponseTask{
+		Id:     wrapperMsg.Id,
 		Status: common.StatusDone,
 		Output: workerResponse,
 	}
@@ -55,47 +55,51 @@ func (a *App) ExecuteCode(req common.ExecutionRequest) (common.ResponseTask, err
 	return task, nil
 }
 
-// TODO: use generics
-func (a *App) getBackMessage(id uuid.UUID) (common.WorkerResponse, error) {
-	for _, msg := range a.ctx.incomingMessages {
-		if msg.Id == id {
-			return a.unwrapWorkerMessage(msg)
-		}
+// dispatchTask chooses a worker and publishes the task to its queue
+func (a *App) dispatchTask(ctx context.Context, req common.ExecutionRequest) (common.ExecutionRequestWrapper, error) {
+	ctx, span := tracing.Tracer("entry").Start(ctx, "entry.dispatch")
+	defer span.End()
+
+	workerId, err := ChooseWorker(a.workers, a.ctx.backgroundCtx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		fmtErr := fmt.Errorf("failed to choose a worker: %s", err)
+		return common.ExecutionRequestWrapper{}, fmtErr
 	}
 
-	// loop until we get the right message
-	for limit := 0; limit < 5; limit++ {
-		for _, msg := range a.ctx.incomingMessages {
-			if msg.Id == id {
-				return a.unwrapWorkerMessage(msg)
-			}
-		}
-
-		msg, err := a.reply.GetNewMessage()
-		if err != nil {
-			fmtErr := fmt.Errorf("failed to read a new message from the queue: %s", err)
-			return common.WorkerResponse{}, fmtErr
-		}
-
-		// deserialize into a wrapper and add that to the msg array of the context
-		workerResponseWrapper := common.WorkerResponseWrapper{}
-		err = json.Unmarshal([]byte(msg), &workerResponseWrapper)
-		if err != nil {
-			fmtErr := fmt.Errorf("failed to deserialize the worker response: %s", err)
-			return common.WorkerResponse{}, fmtErr
-		}
-
-		if workerResponseWrapper.Id == id {
-			return a.unwrapWorkerMessage(workerResponseWrapper)
-		}
-
-		a.ctx.incomingMessages = append(a.ctx.incomingMessages, workerResponseWrapper)
+	span.SetAttributes(attribute.String("lambda.worker_id", workerId))
+
+	identity, _ := auth.FromContext(ctx)
+
+	// send task to worker
+	wrapperMsg := common.ExecutionRequestWrapper{
+		Id:           uuid.New(),
+		Req:          req,
+		QueuedAt:     time.Now(),
+		Tenant:       identity.Tenant,
+		TraceContext: tracing.Inject(ctx),
 	}
 
-	return common.WorkerResponse{}, errors.New("the message ain't coming")
-}
+	span.SetAttributes(attribute.String("lambda.task_id", wrapperMsg.Id.String()))
+
+	brokerMsg, err := json.Marshal(wrapperMsg)
+	if err != nil {
+		return common.ExecutionRequestWrapper{}, err
+	}
+
+	priority, err := common.ParsePriority(req.Priority)
+	if err != nil {
+		return common.ExecutionRequestWrapper{}, err
+	}
+
+	span.SetAttributes(attribute.String("lambda.priority", string(priority)))
+
+	err = a.broker.SendMessageToQueue(common.PriorityQueue(workerId, priority), string(brokerMsg))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		fmtErr := fmt.Errorf("failed to send message to the queue: %s", err)
+		return common.ExecutionRequestWrapper{}, fmtErr
+	}
 
-func (a *App) unwrapWorkerMessage(msg common.WorkerResponseWrapper) (common.WorkerResponse, error) {
-	// return the response within the wrapper
-	return msg.Res, nil
+	return wrapperMsg, nil
 }
@@ -0,0 +1,115 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/entry/auth"
+	"github.com/entry/repository/execution"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type ExecutionsPage struct {
+	Executions []execution.Record `json:"executions"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+/*
+Query parameters, all optional:
+	- tenant: only admin tenants may query other tenants, defaults to the caller
+	- runtime, status
+	- from, to: RFC 3339 timestamps, bounds of the start time
+	- limit: page size, 50 by default
+	- cursor: next_cursor of the previous page
+*/
+
+func (a *App) ListExecutions(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+
+	filter, err := parseExecutionFilter(r)
+	if err != nil {
+		FailWithStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	isAdmin := a.config.AdminTenants[identity.Tenant]
+	if filter.Tenant == "" && !isAdmin {
+		filter.Tenant = identity.Tenant
+	}
+
+	if filter.Tenant != identity.Tenant && !isAdmin {
+		FailWithStatus(w, http.StatusForbidden, "cannot query the executions of another tenant")
+		return
+	}
+
+	records, next, err := a.executions.Query(r.Context(), filter)
+	if err != nil {
+		FailWithStatus(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query the executions: %s", err))
+		return
+	}
+
+	page := ExecutionsPage{
+		Executions: records,
+	}
+	if next != nil {
+		page.NextCursor = next.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		log.Printf("Failed to write a response: %s", err)
+	}
+}
+
+func parseExecutionFilter(r *http.Request) (execution.Filter, error) {
+	query := r.URL.Query()
+
+	filter := execution.Filter{
+		Tenant:  query.Get("tenant"),
+		Runtime: query.Get("runtime"),
+		Status:  query.Get("status"),
+		Limit:   defaultPageSize,
+	}
+
+	var err error
+
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxPageSize {
+			return filter, fmt.Errorf("invalid limit, expected 1 to %d", maxPageSize)
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		filter.Cursor, err = execution.ParseCursor(cursor)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
@@ -1,11 +1,30 @@
 package application
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	common "github.com/common/model"
+	"github.com/common/tracing"
+	"github.com/entry/auth"
+	"github.com/entry/metrics"
+	"github.com/entry/quota"
+	"github.com/entry/repository/execution"
+	"github.com/entry/repository/result"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (a *App) ExecuteRequest(w http.ResponseWriter, r *http.Request) {
@@ -15,30 +34,121 @@ func (a *App) ExecuteRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// read the body JSON
+	// read the body JSON, the raw body identifies the request for idempotency and memoization
+	body, err := io.ReadAll(r.Body)
+	if FailIfError(err, w, "Failed to read the request body") {
+		return
+	}
+
 	var execReq common.ExecutionRequest
-	err = json.NewDecoder(r.Body).Decode(&execReq)
+	err = json.Unmarshal(body, &execReq)
 	if FailIfError(err, w, "Failed to decode the request body") {
 		return
 	}
 
-	execRes, err := a.ExecuteCode(execReq)
+	_, err = common.ParsePriority(execReq.Priority)
+	if err != nil {
+		FailWithStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	identity, _ := auth.FromContext(r.Context())
+
+	// continue the trace started by the caller, if any
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracing.Tracer("entry").Start(ctx, "entry.execute",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("lambda.runtime", execReq.Runtime.Name),
+			attribute.String("lambda.tenant", identity.Tenant),
+		),
+	)
+	defer span.End()
+
+	execRes, hit, err := a.executeOnce(ctx, identity.Tenant, r.Header.Get("Idempotency-Key"), requestHash(body), execReq)
+
+	switch hit {
+	case CacheMemo:
+		w.Header().Set("X-Cache", "HIT")
+	case CacheIdempotency:
+		w.Header().Set("Idempotency-Replayed", "true")
+	}
+
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		span.SetAttributes(attribute.String("lambda.throttled", string(exceeded.Kind)))
+		Throttle(w, exceeded)
+		return
+	}
+
+	if errors.Is(err, result.ErrKeyReused) {
+		FailWithStatus(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if errors.Is(err, result.ErrOutcomeUnknown) {
+		FailWithStatus(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.String("lambda.status", string(execRes.Status)))
+
 	if FailIfError(err, w, "Failed to execute code") {
 		return
 	}
 
-	responseTask, err := json.Marshal(execRes)
+	err = WriteResponse(w, execRes)
 	if FailIfError(err, w, "Failed to write the response") {
 		return
 	}
+}
 
-	// flush the stream to send immediate data
-	_, err = fmt.Fprintf(w, string(responseTask))
-	if FailIfError(err, w, "Failed to send the request") {
-		return
+// runExecution executes the request on behalf of the tenant within its quotas,
+// a *quota.ExceededError is returned when the tenant is throttled
+func (a *App) runExecution(ctx context.Context, tenant string, req common.ExecutionRequest) (common.ResponseTask, error) {
+	release, err := a.limiter.Acquire(ctx, tenant)
+	if err != nil {
+		return common.ResponseTask{}, err
+	}
+	defer release()
+
+	startTime := time.Now()
+
+	metrics.InFlightRequests.Inc()
+	execRes, err := a.ExecuteCode(ctx, req)
+	metrics.InFlightRequests.Dec()
+
+	observeRequest(req, execRes, err, startTime)
+	a.recordExecution(ctx, tenant, req, execRes, err, startTime)
+
+	if err == nil {
+		cpuErr := a.limiter.RecordCPU(ctx, tenant, cpuSeconds(execRes.Output))
+		if cpuErr != nil {
+			log.Printf("Failed to record the cpu time of %s: %s", tenant, cpuErr)
+		}
+	}
+
+	return execRes, err
+}
+
+// WriteResponse sends the task and flushes the stream to send immediate data
+func WriteResponse(w http.ResponseWriter, task common.ResponseTask) error {
+	responseTask, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(responseTask)
+	if err != nil {
+		return err
 	}
 
 	w.(http.Flusher).Flush()
+
+	return nil
 }
 
 func (a *App) TestRequest(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +184,45 @@ func (a *App) TestRequest(w http.ResponseWriter, r *http.Request) {
 	w.(http.Flusher).Flush()
 }
 
+func (a *App) recordExecution(ctx context.Context, tenant string, req common.ExecutionRequest, res common.ResponseTask, execErr error, startTime time.Time) {
+	id := res.Id
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+
+	record := execution.NewRecord(id, tenant, req, res, execErr, startTime)
+
+	err := a.executions.Save(ctx, record)
+	if err != nil {
+		log.Printf("Failed to record the execution %s: %s", id, err)
+	}
+}
+
+// Throttle rejects a request over quota, the caller may retry after the given delay
+func Throttle(w http.ResponseWriter, exceeded *quota.ExceededError) {
+	metrics.ThrottledRequests.WithLabelValues(string(exceeded.Kind)).Inc()
+
+	retryAfter := int(math.Ceil(exceeded.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	FailWithStatus(w, http.StatusTooManyRequests, exceeded.Error())
+}
+
+// cpuSeconds is the time charged to the tenant for an execution
+func cpuSeconds(res common.WorkerResponse) float64 {
+	return float64(res.Compile.Time+res.Run.Time) / 1000
+}
+
+func observeRequest(req common.ExecutionRequest, res common.ResponseTask, err error, startTime time.Time) {
+	status := string(res.Status)
+	if err != nil {
+		status = common.StatusFailed
+	}
+
+	metrics.RequestsTotal.WithLabelValues(req.Runtime.Name, status).Inc()
+	metrics.RequestDuration.WithLabelValues(req.Runtime.Name).Observe(time.Since(startTime).Seconds())
+}
+
 /*
 Known issues:
 	- don't copy large objects at every request
@@ -0,0 +1,114 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	common "github.com/common/model"
+	"github.com/entry/metrics"
+	"github.com/entry/repository/result"
+	"github.com/google/uuid"
+)
+
+// CacheHit tells how a request was answered without running
+type CacheHit string
+
+const (
+	CacheMiss        CacheHit = ""
+	CacheMemo        CacheHit = "memo"
+	CacheIdempotency CacheHit = "idempotency"
+)
+
+// a reservation outlives the execution it covers, until then the retries wait for its outcome;
+// the key of an entry which crashed before storing the outcome is taken over once it expires
+const idempotencyLease = replyTimeout + time.Minute
+
+// executeOnce runs the request unless an identical one was already answered,
+// either under the same Idempotency-Key or, when opted in, with the same body
+func (a *App) executeOnce(ctx context.Context, tenant, key, hash string, req common.ExecutionRequest) (common.ResponseTask, CacheHit, error) {
+	if req.Memoize {
+		res, hit, err := a.results.Memoized(ctx, tenant, hash)
+		if err != nil {
+			log.Printf("Failed to look up the memoized response: %s", err)
+		} else if hit {
+			metrics.CacheHits.WithLabelValues(string(CacheMemo)).Inc()
+			return res, CacheMemo, nil
+		}
+	}
+
+	if key == "" {
+		res, err := a.runExecution(ctx, tenant, req)
+		if err == nil {
+			a.memoize(ctx, tenant, hash, req, res)
+		}
+		return res, CacheMiss, err
+	}
+
+	entry, reserved, err := a.results.Reserve(ctx, tenant, key, hash, idempotencyLease)
+	if err != nil {
+		return common.ResponseTask{}, CacheMiss, err
+	}
+
+	// a retry, attach to the original execution
+	if !reserved {
+		metrics.CacheHits.WithLabelValues(string(CacheIdempotency)).Inc()
+
+		if entry.State != result.StatePending {
+			res, err := entry.Outcome()
+			return res, CacheIdempotency, err
+		}
+
+		res, err := a.results.Wait(ctx, tenant, key)
+		return res, CacheIdempotency, err
+	}
+
+	res, err := a.runExecution(ctx, tenant, req)
+
+	// the task gets its id when it's dispatched, without one nothing ran
+	// and the client may retry with the same key
+	if err != nil && res.Id == uuid.Nil {
+		releaseErr := a.results.Release(context.Background(), tenant, key)
+		if releaseErr != nil {
+			log.Printf("Failed to release the idempotency key %s: %s", key, releaseErr)
+		}
+		return res, CacheMiss, err
+	}
+
+	// a worker may still run it, the retries must not run it again
+	if err != nil {
+		failErr := a.results.Fail(context.Background(), tenant, key, hash, res, err.Error(), a.config.IdempotencyWindow)
+		if failErr != nil {
+			log.Printf("Failed to store the failure of the idempotency key %s: %s", key, failErr)
+		}
+		return res, CacheMiss, err
+	}
+
+	err = a.results.Complete(ctx, tenant, key, hash, res, a.config.IdempotencyWindow)
+	if err != nil {
+		log.Printf("Failed to store the response of the idempotency key %s: %s", key, err)
+	}
+
+	a.memoize(ctx, tenant, hash, req, res)
+
+	return res, CacheMiss, nil
+}
+
+// only complete runs are memoized, a timeout or a worker error may not happen again
+func (a *App) memoize(ctx context.Context, tenant, hash string, req common.ExecutionRequest, res common.ResponseTask) {
+	if !req.Memoize || res.Status != common.StatusDone || res.Output.Compile.TimedOut || res.Output.Run.TimedOut {
+		return
+	}
+
+	err := a.results.Memoize(ctx, tenant, hash, res, a.config.MemoTTL)
+	if err != nil {
+		log.Printf("Failed to memoize the response: %s", err)
+	}
+}
+
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,22 @@
+package application
+
+import (
+	"net/http"
+
+	"github.com/entry/auth"
+)
+
+// Authenticate rejects the requests without valid credentials
+// and stores the identity of the caller in the request context
+func (a *App) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := a.authenticator.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			FailWithStatus(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	})
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 
 	"github.com/entry/repository/worker"
-	"github.com/redis/go-redis/v9"
 )
 
 type FailedMessage struct {
@@ -36,6 +35,25 @@ func FailIfError(err error, w http.ResponseWriter, msg string) bool {
 	return true
 }
 
+// FailWithStatus writes a failed message with a specific status code
+func FailWithStatus(w http.ResponseWriter, status int, msg string) {
+	sMsg, err := json.Marshal(FailedMessage{
+		Status:  "failed",
+		Message: msg,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal a response: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_, err = w.Write(sMsg)
+	if err != nil {
+		log.Printf("Failed to write a response: %s", err)
+	}
+}
+
 func SetupStreamingResponse(w http.ResponseWriter) error {
 	w.Header().Set("Content-Type", "application/stream+json")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -44,19 +62,15 @@ func SetupStreamingResponse(w http.ResponseWriter) error {
 	return nil
 }
 
-func ChooseWorker(rdb *redis.Client, c context.Context) (string, error) {
-	// get all workers from redis
-	workersRepo := worker.RedisWorkerRepository{
-		Client: rdb,
-	}
-
-	workers, err := workersRepo.QueryWorkers(c)
+func ChooseWorker(registry worker.Registry, c context.Context) (string, error) {
+	// get all workers from the registry
+	workers, err := registry.QueryWorkers(c)
 	if err != nil {
 		return "", err
 	}
 
 	// choose the best one, the one with the least work at the moment
-	workerId, err := workersRepo.GetBestWorker(workers)
+	workerId, err := worker.GetBestWorker(workers)
 	if err != nil {
 		return "", err
 	}
@@ -3,6 +3,7 @@ package application
 import (
 	"net/http"
 
+	"github.com/entry/metrics"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -23,9 +24,19 @@ func (a *App) loadRoutes() {
 		}
 	})
 
-	router.Post(ApiPrefix+"execute", a.ExecuteRequest)
+	router.Handle("/metrics", metrics.Handler())
 
-	router.Post(ApiPrefix+"test", a.TestRequest)
+	router.Group(func(r chi.Router) {
+		r.Use(a.Authenticate)
+
+		r.Post(ApiPrefix+"execute", a.ExecuteRequest)
+
+		r.Post(ApiPrefix+"test", a.TestRequest)
+
+		r.Get(ApiPrefix+"executions", a.ListExecutions)
+
+		r.Post(ApiPrefix+"executions/batch", a.ExecuteBatchRequest)
+	})
 
 	a.router = router
 }
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// callers authenticate either with a static API key or with the JWT issued by unicorn-api,
+// every execution is attributed to the tenant resolved here
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+type Method string
+
+const (
+	MethodAPIKey Method = "api_key"
+	MethodJWT    Method = "jwt"
+)
+
+type Identity struct {
+	Tenant string
+	Method Method
+}
+
+// Claims mirrors the claims signed by unicorn-api, the account is the tenant
+type Claims struct {
+	AccountID string `json:"account_id"`
+	RoleID    string `json:"role_id"`
+	jwt.RegisteredClaims
+}
+
+type Authenticator struct {
+	apiKeys   map[string]string // key -> tenant
+	jwtSecret []byte
+}
+
+func NewAuthenticator(apiKeys map[string]string, jwtSecret string) *Authenticator {
+	return &Authenticator{
+		apiKeys:   apiKeys,
+		jwtSecret: []byte(jwtSecret),
+	}
+}
+
+// ParseAPIKeys reads a list of keys in the "key:tenant,key:tenant" format
+func ParseAPIKeys(value string) (map[string]string, error) {
+	keys := make(map[string]string)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, tenant, found := strings.Cut(entry, ":")
+		if !found || key == "" || tenant == "" {
+			return nil, fmt.Errorf("invalid api key entry %q, expected key:tenant", entry)
+		}
+
+		keys[key] = tenant
+	}
+
+	return keys, nil
+}
+
+// Enabled reports whether any credential source is configured,
+// without one every request is rejected
+func (a *Authenticator) Enabled() bool {
+	return len(a.apiKeys) > 0 || len(a.jwtSecret) > 0
+}
+
+// Authenticate resolves the tenant from the X-API-Key header or the bearer token,
+// a bearer token is first looked up as an API key and then verified as a JWT
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.fromAPIKey(key)
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return Identity{}, ErrMissingCredentials
+	}
+
+	if identity, err := a.fromAPIKey(token); err == nil {
+		return identity, nil
+	}
+
+	return a.fromJWT(token)
+}
+
+func (a *Authenticator) fromAPIKey(key string) (Identity, error) {
+	tenant, exists := a.apiKeys[key]
+	if !exists {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return Identity{Tenant: tenant, Method: MethodAPIKey}, nil
+}
+
+func (a *Authenticator) fromJWT(tokenString string) (Identity, error) {
+	if len(a.jwtSecret) == 0 {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return a.jwtSecret, nil
+	})
+	if err != nil || !token.Valid || claims.AccountID == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return Identity{Tenant: claims.AccountID, Method: MethodJWT}, nil
+}
+
+type contextKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func signToken(t *testing.T, secret string, claims Claims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign the token: %s", err)
+	}
+
+	return token
+}
+
+func TestAuthenticate(t *testing.T) {
+	authenticator := NewAuthenticator(map[string]string{"key-1": "tenant-1"}, "secret")
+
+	valid := signToken(t, "secret", Claims{
+		AccountID: "account-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	expired := signToken(t, "secret", Claims{
+		AccountID: "account-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		},
+	})
+	forged := signToken(t, "other", Claims{AccountID: "account-1"})
+
+	var tests = []struct {
+		name    string
+		header  string
+		value   string
+		tenant  string
+		wantErr error
+	}{
+		{"api key header", "X-API-Key", "key-1", "tenant-1", nil},
+		{"api key bearer", "Authorization", "Bearer key-1", "tenant-1", nil},
+		{"unknown api key", "X-API-Key", "key-2", "", ErrInvalidCredentials},
+		{"valid jwt", "Authorization", "Bearer " + valid, "account-1", nil},
+		{"expired jwt", "Authorization", "Bearer " + expired, "", ErrInvalidCredentials},
+		{"forged jwt", "Authorization", "Bearer " + forged, "", ErrInvalidCredentials},
+		{"no credentials", "", "", "", ErrMissingCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodPost, "/api/v1/execute", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			identity, err := authenticator.Authenticate(r)
+			if err != tt.wantErr {
+				t.Fatalf("Bad error: %v, want %v", err, tt.wantErr)
+			}
+
+			if identity.Tenant != tt.tenant {
+				t.Errorf("Bad tenant: %q, want %q", identity.Tenant, tt.tenant)
+			}
+		})
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys("key-1:tenant-1, key-2:tenant-2,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(keys) != 2 || keys["key-2"] != "tenant-2" {
+		t.Errorf("Bad keys: %v", keys)
+	}
+
+	if _, err := ParseAPIKeys("key-without-tenant"); err == nil {
+		t.Errorf("Expected an error for an entry without a tenant")
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// all the metrics exposed by the entry on /metrics,
+// the worker side of the pipeline is measured by the workers themselves
+
+var (
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lambda",
+		Subsystem: "entry",
+		Name:      "requests_total",
+		Help:      "Execution requests handled by the entry, by runtime and final status.",
+	}, []string{"runtime", "status"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lambda",
+		Subsystem: "entry",
+		Name:      "request_duration_seconds",
+		Help:      "Time from receiving an execution request until the worker reply is available.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"runtime"})
+
+	ThrottledRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lambda",
+		Subsystem: "entry",
+		Name:      "throttled_requests_total",
+		Help:      "Execution requests rejected because a tenant quota was exceeded.",
+	}, []string{"quota"})
+
+	CacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lambda",
+		Subsystem: "entry",
+		Name:      "cache_hits_total",
+		Help:      "Execution requests answered without running, by idempotency key or memoization.",
+	}, []string{"kind"})
+
+	InFlightRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lambda",
+		Subsystem: "entry",
+		Name:      "in_flight_requests",
+		Help:      "Execution requests currently waiting for a worker reply.",
+	})
+)
+
+// RegisterReplyBacklog exposes the number of worker replies buffered and not yet claimed
+func RegisterReplyBacklog(backlog func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "lambda",
+		Subsystem: "entry",
+		Name:      "reply_queue_backlog",
+		Help:      "Worker replies received on the reply queue and not yet claimed by a request.",
+	}, backlog)
+}
+
+// RegisterWorkerCount exposes the number of workers present in the registry
+func RegisterWorkerCount(count func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "lambda",
+		Subsystem: "entry",
+		Name:      "registered_workers",
+		Help:      "Workers currently registered in the worker registry.",
+	}, count)
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
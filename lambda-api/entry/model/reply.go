@@ -1,27 +1,43 @@
 package model
 
 import (
+	"context"
+	"encoding/json"
+	"log"
 	"sync"
+	"time"
 
 	"github.com/common/broker"
+	common "github.com/common/model"
+	"github.com/google/uuid"
 )
 
+// replies nobody waits for anymore (the request timed out) are dropped after this
+const unclaimedReplyTTL = 5 * time.Minute
+
+type unclaimedReply struct {
+	res        common.WorkerResponse
+	receivedAt time.Time
+}
+
+// ReplyQueue hands the worker replies to the requests waiting for them,
+// every reply is matched by the id of its task so many requests can wait at once
 type ReplyQueue struct {
-	Broker        broker.MessageBroker
-	msgs          <-chan broker.DeliveryMessage
-	messageBuffer []string
-	msgMutex      sync.Mutex
-	cond          *sync.Cond
+	Broker broker.MessageBroker
+	msgs   <-chan broker.DeliveryMessage
+
+	unclaimed map[uuid.UUID]unclaimedReply
+	waiters   map[uuid.UUID]chan common.WorkerResponse
+	mutex     sync.Mutex
 }
 
 func NewReplyQueue(b broker.MessageBroker) (*ReplyQueue, error) {
 	r := &ReplyQueue{
-		Broker:        b,
-		messageBuffer: make([]string, 0), // Pass the mutex to NewCond
+		Broker:    b,
+		unclaimed: make(map[uuid.UUID]unclaimedReply),
+		waiters:   make(map[uuid.UUID]chan common.WorkerResponse),
 	}
 
-	r.cond = sync.NewCond(&r.msgMutex)
-
 	if err := r.Setup(); err != nil {
 		return nil, err
 	}
@@ -51,30 +67,76 @@ func (r *ReplyQueue) Setup() error {
 
 func (r *ReplyQueue) consumeMessages() {
 	for msg := range r.msgs {
-		r.msgMutex.Lock()
-		r.messageBuffer = append(r.messageBuffer, msg.Body)
-		r.msgMutex.Unlock()
-		r.cond.Signal() // Signal that a new message is available
+		// deserialize into a wrapper to find out which task it answers
+		var wrapper common.WorkerResponseWrapper
+		err := json.Unmarshal([]byte(msg.Body), &wrapper)
+		if err != nil {
+			log.Printf("Failed to deserialize the worker response: %s", err)
+			continue
+		}
+
+		r.mutex.Lock()
+
+		if waiter, exists := r.waiters[wrapper.Id]; exists {
+			delete(r.waiters, wrapper.Id)
+			waiter <- wrapper.Res
+		} else {
+			r.unclaimed[wrapper.Id] = unclaimedReply{res: wrapper.Res, receivedAt: time.Now()}
+			r.dropExpired()
+		}
+
+		r.mutex.Unlock()
 	}
 }
 
-func (r *ReplyQueue) GetNewMessage() (string, error) {
-	r.msgMutex.Lock()
+// Wait blocks until the reply of the task arrives or the context is done
+func (r *ReplyQueue) Wait(ctx context.Context, id uuid.UUID) (common.WorkerResponse, error) {
+	r.mutex.Lock()
 
-	for len(r.messageBuffer) == 0 {
-		// TODO: don't block the main thread
-		r.cond.Wait() // Wait for a new message
+	if reply, exists := r.unclaimed[id]; exists {
+		delete(r.unclaimed, id)
+		r.mutex.Unlock()
+		return reply.res, nil
 	}
 
-	// Return the latest unhandled message (first in the buffer)
-	msg := r.messageBuffer[0]
+	waiter := make(chan common.WorkerResponse, 1)
+	r.waiters[id] = waiter
+
+	r.mutex.Unlock()
+
+	select {
+	case res := <-waiter:
+		return res, nil
+	case <-ctx.Done():
+		r.mutex.Lock()
+		delete(r.waiters, id)
+		r.mutex.Unlock()
+
+		// the reply may have been delivered in the meantime
+		select {
+		case res := <-waiter:
+			return res, nil
+		default:
+			return common.WorkerResponse{}, ctx.Err()
+		}
+	}
+}
 
-	// Remove the message from the buffer
-	r.messageBuffer = r.messageBuffer[1:]
+// must be called with the mutex held
+func (r *ReplyQueue) dropExpired() {
+	for id, reply := range r.unclaimed {
+		if time.Since(reply.receivedAt) > unclaimedReplyTTL {
+			delete(r.unclaimed, id)
+		}
+	}
+}
 
-	r.msgMutex.Unlock()
+// Backlog returns the number of replies received and not yet claimed
+func (r *ReplyQueue) Backlog() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 
-	return msg, nil
+	return len(r.unclaimed)
 }
 
 func (r *ReplyQueue) Close() error {
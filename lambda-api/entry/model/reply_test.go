@@ -0,0 +1,109 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/common/broker"
+	common "github.com/common/model"
+	"github.com/google/uuid"
+)
+
+type fakeBroker struct {
+	msgs chan broker.DeliveryMessage
+}
+
+func (b *fakeBroker) Connect(string) error                    { return nil }
+func (b *fakeBroker) CreateQueue(string) error                { return nil }
+func (b *fakeBroker) SendMessageToQueue(string, string) error { return nil }
+func (b *fakeBroker) Close() error                            { return nil }
+
+func (b *fakeBroker) Get(string) (broker.DeliveryMessage, bool, error) {
+	return broker.DeliveryMessage{}, false, nil
+}
+
+func (b *fakeBroker) QueueDepth(string) (int, error) {
+	return 0, nil
+}
+
+func (b *fakeBroker) Consume(string) (<-chan broker.DeliveryMessage, error) {
+	return b.msgs, nil
+}
+
+func (b *fakeBroker) ConsumeAcked(string, int) (<-chan broker.DeliveryMessage, error) {
+	return b.msgs, nil
+}
+
+func (b *fakeBroker) reply(t *testing.T, id uuid.UUID, exitCode int32) {
+	body, err := json.Marshal(common.WorkerResponseWrapper{
+		Id:  id,
+		Res: common.WorkerResponse{Run: common.ProcessResult{ExitCode: exitCode}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal the reply: %s", err)
+	}
+
+	b.msgs <- broker.DeliveryMessage{Body: string(body)}
+}
+
+func TestReplyQueueOutOfOrder(t *testing.T) {
+	b := &fakeBroker{msgs: make(chan broker.DeliveryMessage)}
+
+	r, err := NewReplyQueue(b)
+	if err != nil {
+		t.Fatalf("Failed to create the reply queue: %s", err)
+	}
+
+	ids := make([]uuid.UUID, 10)
+	results := make(chan error, len(ids))
+
+	for i := range ids {
+		ids[i] = uuid.New()
+
+		go func(id uuid.UUID, exitCode int32) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			res, err := r.Wait(ctx, id)
+			if err == nil && res.Run.ExitCode != exitCode {
+				err = fmt.Errorf("got the reply with exit code %d, want %d", res.Run.ExitCode, exitCode)
+			}
+			results <- err
+		}(ids[i], int32(i))
+	}
+
+	// answer in reverse order, some replies arrive before their request waits
+	for i := len(ids) - 1; i >= 0; i-- {
+		b.reply(t, ids[i], int32(i))
+	}
+
+	for range ids {
+		if err := <-results; err != nil {
+			t.Errorf("Bad reply: %s", err)
+		}
+	}
+
+	if backlog := r.Backlog(); backlog != 0 {
+		t.Errorf("Expected every reply to be claimed, %d left", backlog)
+	}
+}
+
+func TestReplyQueueTimeout(t *testing.T) {
+	b := &fakeBroker{msgs: make(chan broker.DeliveryMessage)}
+
+	r, err := NewReplyQueue(b)
+	if err != nil {
+		t.Fatalf("Failed to create the reply queue: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = r.Wait(ctx, uuid.New())
+	if err != context.DeadlineExceeded {
+		t.Errorf("Bad error: %v, want %v", err, context.DeadlineExceeded)
+	}
+}
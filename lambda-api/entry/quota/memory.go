@@ -0,0 +1,114 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter enforces the default limits in the process, for the all-in-one mode
+type MemoryLimiter struct {
+	Defaults Limits
+
+	mu      sync.Mutex
+	tenants map[string]*tenantUsage
+}
+
+type tenantUsage struct {
+	running  int64
+	minute   int64 // unix minute of the requests count
+	requests int64
+	day      string
+	cpu      float64
+}
+
+func (l *MemoryLimiter) Acquire(_ context.Context, tenant string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	usage := l.usage(tenant, now)
+	limits := l.Defaults
+
+	if limits.DailyCPUSeconds > 0 && usage.cpu >= limits.DailyCPUSeconds {
+		return nil, &ExceededError{Kind: KindCPU, RetryAfter: untilNextDay(now)}
+	}
+
+	if limits.RequestsPerMinute > 0 && usage.requests >= limits.RequestsPerMinute {
+		return nil, &ExceededError{Kind: KindRate, RetryAfter: untilNextMinute(now)}
+	}
+
+	// a request rejected on its concurrency doesn't count toward the rate
+	if limits.Concurrency > 0 && usage.running >= limits.Concurrency {
+		return nil, &ExceededError{Kind: KindConcurrency, RetryAfter: time.Second}
+	}
+
+	usage.requests++
+	usage.running++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			usage.running--
+		})
+	}
+
+	return release, nil
+}
+
+func (l *MemoryLimiter) RecordCPU(_ context.Context, tenant string, seconds float64) error {
+	if seconds <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.usage(tenant, time.Now()).cpu += seconds
+
+	return nil
+}
+
+func (l *MemoryLimiter) RemainingRequests(_ context.Context, tenant string) (int64, error) {
+	if l.Defaults.RequestsPerMinute <= 0 {
+		return -1, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	remaining := l.Defaults.RequestsPerMinute - l.usage(tenant, time.Now()).requests
+	if remaining < 0 {
+		return 0, nil
+	}
+
+	return remaining, nil
+}
+
+// usage returns the counters of the tenant, reset when their period is over; the lock must be held
+func (l *MemoryLimiter) usage(tenant string, now time.Time) *tenantUsage {
+	if l.tenants == nil {
+		l.tenants = make(map[string]*tenantUsage)
+	}
+
+	usage, exists := l.tenants[tenant]
+	if !exists {
+		usage = &tenantUsage{}
+		l.tenants[tenant] = usage
+	}
+
+	if minute := now.Unix() / 60; usage.minute != minute {
+		usage.minute = minute
+		usage.requests = 0
+	}
+
+	if day := now.UTC().Format("20060102"); usage.day != day {
+		usage.day = day
+		usage.cpu = 0
+	}
+
+	return usage
+}
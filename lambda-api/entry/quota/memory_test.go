@@ -0,0 +1,58 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := &MemoryLimiter{Defaults: Limits{Concurrency: 1, RequestsPerMinute: 3, DailyCPUSeconds: 10}}
+
+	release, err := limiter.Acquire(ctx, "tenant")
+	if err != nil {
+		t.Fatalf("Failed to acquire a slot: %s", err)
+	}
+
+	var exceeded *ExceededError
+	if _, err := limiter.Acquire(ctx, "tenant"); !errors.As(err, &exceeded) || exceeded.Kind != KindConcurrency {
+		t.Errorf("Expected the concurrency quota to be exceeded, got %v", err)
+	}
+
+	// other tenants have their own quotas
+	if _, err := limiter.Acquire(ctx, "other"); err != nil {
+		t.Errorf("Unexpected error for another tenant: %s", err)
+	}
+
+	release()
+	release()
+
+	// the rejected request doesn't count toward the rate
+	for i := 0; i < 2; i++ {
+		release, err = limiter.Acquire(ctx, "tenant")
+		if err != nil {
+			t.Fatalf("Failed to acquire the released slot: %s", err)
+		}
+		release()
+	}
+
+	if _, err := limiter.Acquire(ctx, "tenant"); !errors.As(err, &exceeded) || exceeded.Kind != KindRate {
+		t.Errorf("Expected the rate quota to be exceeded, got %v", err)
+	}
+
+	if remaining, _ := limiter.RemainingRequests(ctx, "tenant"); remaining != 0 {
+		t.Errorf("Expected no requests left in the minute, got %d", remaining)
+	}
+	if remaining, _ := limiter.RemainingRequests(ctx, "other"); remaining != 2 {
+		t.Errorf("Expected 2 requests left for another tenant, got %d", remaining)
+	}
+	if remaining, _ := (&MemoryLimiter{}).RemainingRequests(ctx, "tenant"); remaining != -1 {
+		t.Errorf("Expected an unlimited rate without a limit, got %d", remaining)
+	}
+
+	_ = limiter.RecordCPU(ctx, "other", 12)
+	if _, err := limiter.Acquire(ctx, "other"); !errors.As(err, &exceeded) || exceeded.Kind != KindCPU {
+		t.Errorf("Expected the cpu quota to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// per-tenant limits enforced by the entry before a task is dispatched,
+// a zero value disables the corresponding limit
+
+type Limits struct {
+	Concurrency       int64   // executions running at the same time
+	RequestsPerMinute int64   // executions started in the current minute
+	DailyCPUSeconds   float64 // compile + run time consumed in the current UTC day
+}
+
+type Kind string
+
+const (
+	KindConcurrency Kind = "concurrency"
+	KindRate        Kind = "requests_per_minute"
+	KindCPU         Kind = "daily_cpu_seconds"
+)
+
+type ExceededError struct {
+	Kind       Kind
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded, retry after %s", e.Kind, e.RetryAfter)
+}
+
+type Limiter interface {
+	// Acquire reserves an execution slot for the tenant, the returned
+	// release func must be called once the execution is over
+	Acquire(ctx context.Context, tenant string) (release func(), err error)
+
+	// RecordCPU charges the cpu time of a finished execution to the tenant
+	RecordCPU(ctx context.Context, tenant string, seconds float64) error
+
+	// RemainingRequests is how many executions the tenant may still start in the
+	// current minute, -1 when its rate is not limited
+	RemainingRequests(ctx context.Context, tenant string) (int64, error)
+}
+
+func untilNextMinute(now time.Time) time.Duration {
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+func untilNextDay(now time.Time) time.Duration {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	return midnight.Sub(now)
+}
@@ -0,0 +1,191 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+Redis keys:
+	- quota:<tenant>:slots           sorted set of the executions in flight, scored by the
+	                                 unix milliseconds their slot expires at
+	- quota:<tenant>:rpm:<minute>    executions started in a given minute
+	- quota:<tenant>:cpu:<yyyymmdd>  cpu seconds consumed in a given day
+	- quota:limits:<tenant>          optional hash overriding the default limits
+*/
+
+// an entry crashing mid execution must not leak concurrency slots forever: a slot expires
+// this long after it was taken, well after the reply timeout of any execution
+const concurrencyTTL = 10 * time.Minute
+
+type RedisLimiter struct {
+	Client   *redis.Client
+	Defaults Limits
+}
+
+func (l *RedisLimiter) Acquire(ctx context.Context, tenant string) (func(), error) {
+	limits, err := l.limitsFor(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if limits.DailyCPUSeconds > 0 {
+		used, err := l.Client.Get(ctx, cpuKey(tenant, now)).Float64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		if used >= limits.DailyCPUSeconds {
+			return nil, &ExceededError{Kind: KindCPU, RetryAfter: untilNextDay(now)}
+		}
+	}
+
+	// a request rejected on its concurrency gives its request of the minute back,
+	// or the retries of a busy tenant would use up its rate
+	refund := func() {}
+
+	if limits.RequestsPerMinute > 0 {
+		key := rateKey(tenant, now)
+
+		pipe := l.Client.TxPipeline()
+		count := pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, 2*time.Minute)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+
+		if count.Val() > limits.RequestsPerMinute {
+			return nil, &ExceededError{Kind: KindRate, RetryAfter: untilNextMinute(now)}
+		}
+
+		refund = func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			if err := l.Client.Decr(ctx, key).Err(); err != nil {
+				log.Printf("Failed to refund the request of %s: %s", tenant, err)
+			}
+		}
+	}
+
+	if limits.Concurrency <= 0 {
+		return func() {}, nil
+	}
+
+	key := concurrencyKey(tenant)
+	slot := uuid.NewString()
+
+	// the slots left by the entries which crashed are pruned before the running ones are counted
+	pipe := l.Client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(concurrencyTTL).UnixMilli()), Member: slot})
+	running := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, concurrencyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		refund()
+		return nil, err
+	}
+
+	release := func() {
+		// the request context may be gone already
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := l.Client.ZRem(ctx, key, slot).Err(); err != nil {
+			log.Printf("Failed to release the concurrency slot of %s: %s", tenant, err)
+		}
+	}
+
+	if running.Val() > limits.Concurrency {
+		release()
+		refund()
+		return nil, &ExceededError{Kind: KindConcurrency, RetryAfter: time.Second}
+	}
+
+	return release, nil
+}
+
+func (l *RedisLimiter) RecordCPU(ctx context.Context, tenant string, seconds float64) error {
+	if seconds <= 0 {
+		return nil
+	}
+
+	key := cpuKey(tenant, time.Now())
+
+	pipe := l.Client.TxPipeline()
+	pipe.IncrByFloat(ctx, key, seconds)
+	pipe.Expire(ctx, key, 48*time.Hour)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (l *RedisLimiter) RemainingRequests(ctx context.Context, tenant string) (int64, error) {
+	limits, err := l.limitsFor(ctx, tenant)
+	if err != nil {
+		return 0, err
+	}
+
+	if limits.RequestsPerMinute <= 0 {
+		return -1, nil
+	}
+
+	count, err := l.Client.Get(ctx, rateKey(tenant, time.Now())).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	remaining := limits.RequestsPerMinute - count
+	if remaining < 0 {
+		return 0, nil
+	}
+
+	return remaining, nil
+}
+
+// limitsFor applies the tenant overrides, if any, on top of the defaults
+func (l *RedisLimiter) limitsFor(ctx context.Context, tenant string) (Limits, error) {
+	limits := l.Defaults
+
+	overrides, err := l.Client.HGetAll(ctx, "quota:limits:"+tenant).Result()
+	if err != nil {
+		return Limits{}, err
+	}
+
+	if value, exists := overrides["concurrency"]; exists {
+		limits.Concurrency, err = strconv.ParseInt(value, 10, 64)
+	}
+	if value, exists := overrides["rpm"]; exists && err == nil {
+		limits.RequestsPerMinute, err = strconv.ParseInt(value, 10, 64)
+	}
+	if value, exists := overrides["cpu"]; exists && err == nil {
+		limits.DailyCPUSeconds, err = strconv.ParseFloat(value, 64)
+	}
+
+	if err != nil {
+		return Limits{}, fmt.Errorf("invalid quota override for %s: %w", tenant, err)
+	}
+
+	return limits, nil
+}
+
+func concurrencyKey(tenant string) string {
+	return fmt.Sprintf("quota:%s:slots", tenant)
+}
+
+func rateKey(tenant string, now time.Time) string {
+	return fmt.Sprintf("quota:%s:rpm:%d", tenant, now.Unix()/60)
+}
+
+func cpuKey(tenant string, now time.Time) string {
+	return fmt.Sprintf("quota:%s:cpu:%s", tenant, now.UTC().Format("20060102"))
+}
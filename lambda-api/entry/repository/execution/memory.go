@@ -0,0 +1,81 @@
+package execution
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryExecutionRepository keeps the history in the process, for the all-in-one mode.
+// The records are kept newest first, then by id like in Redis, the cursor is the last record of a page.
+type MemoryExecutionRepository struct {
+	mu      sync.RWMutex
+	records []Record
+}
+
+func (m *MemoryExecutionRepository) Save(_ context.Context, record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	position := cursorOf(record)
+	index := sort.Search(len(m.records), func(i int) bool {
+		return position.before(m.records[i].StartedAt.UnixMilli(), m.records[i].ID.String())
+	})
+
+	m.records = append(m.records, Record{})
+	copy(m.records[index+1:], m.records[index:])
+	m.records[index] = record
+
+	return nil
+}
+
+func (m *MemoryExecutionRepository) Query(_ context.Context, filter Filter) ([]Record, *Cursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := make([]Record, 0, filter.Limit)
+
+	start := 0
+	if filter.Cursor != nil {
+		start = sort.Search(len(m.records), func(i int) bool {
+			return filter.Cursor.before(m.records[i].StartedAt.UnixMilli(), m.records[i].ID.String())
+		})
+	}
+
+	for _, record := range m.records[start:] {
+		if !filter.From.IsZero() && record.StartedAt.Before(filter.From) {
+			continue
+		}
+
+		if !filter.To.IsZero() && record.StartedAt.After(filter.To) {
+			continue
+		}
+
+		if !filter.matches(record) {
+			continue
+		}
+
+		records = append(records, record)
+		if len(records) == filter.Limit {
+			return records, cursorOf(record), nil
+		}
+	}
+
+	return records, nil, nil
+}
+
+func (m *MemoryExecutionRepository) Purge(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the oldest records are at the end
+	index := sort.Search(len(m.records), func(i int) bool {
+		return m.records[i].StartedAt.UnixMilli() < before.UnixMilli()
+	})
+
+	removed := int64(len(m.records) - index)
+	m.records = m.records[:index]
+
+	return removed, nil
+}
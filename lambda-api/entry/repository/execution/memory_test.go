@@ -0,0 +1,66 @@
+package execution
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryQueryPages(t *testing.T) {
+	ctx := context.Background()
+	repository := &MemoryExecutionRepository{}
+
+	// several records share a millisecond, the pages must split them by id
+	now := time.Now().Truncate(time.Millisecond)
+	for i := 0; i < 5; i++ {
+		_ = repository.Save(ctx, Record{ID: uuid.New(), StartedAt: now.Add(-time.Duration(i/2) * time.Millisecond)})
+	}
+
+	seen := map[uuid.UUID]bool{}
+
+	first, cursor, err := repository.Query(ctx, Filter{Limit: 2})
+	if err != nil || len(first) != 2 || cursor == nil {
+		t.Fatalf("Bad first page: %d records, cursor %v, error %v", len(first), cursor, err)
+	}
+	for _, record := range first {
+		seen[record.ID] = true
+	}
+
+	// the records saved while paging come before the cursor and don't shift the next pages
+	_ = repository.Save(ctx, Record{ID: uuid.New(), StartedAt: now.Add(time.Millisecond)})
+	_ = repository.Save(ctx, Record{ID: uuid.New(), StartedAt: now})
+
+	parsed, err := ParseCursor(cursor.String())
+	if err != nil || *parsed != *cursor {
+		t.Fatalf("The cursor %s doesn't round trip: %v, %v", cursor, parsed, err)
+	}
+
+	for cursor != nil {
+		var page []Record
+		page, cursor, err = repository.Query(ctx, Filter{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Failed to query a page: %s", err)
+		}
+
+		for _, record := range page {
+			if seen[record.ID] {
+				t.Errorf("The record %s is on two pages", record.ID)
+			}
+			seen[record.ID] = true
+		}
+	}
+
+	if len(seen) < 5 {
+		t.Errorf("Expected the 5 records saved before paging, got %d", len(seen))
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	for _, value := range []string{"", "12", "-1:" + uuid.NewString(), "12:not-an-id"} {
+		if _, err := ParseCursor(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
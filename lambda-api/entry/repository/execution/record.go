@@ -0,0 +1,166 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	common "github.com/common/model"
+	"github.com/google/uuid"
+)
+
+// outputs are kept only for inspection, the full output is returned to the caller
+const maxOutputSize = 4 * 1024
+
+type ProcessSummary struct {
+	ExitCode  int32  `json:"exit_code"`
+	Time      int32  `json:"time"`   // ms
+	Memory    uint64 `json:"memory"` // bytes
+	TimedOut  bool   `json:"timed_out,omitempty"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type Record struct {
+	ID     uuid.UUID `json:"id"`
+	Tenant string    `json:"tenant"`
+
+	Runtime        string `json:"runtime"`
+	RuntimeVersion string `json:"runtime_version,omitempty"`
+	Files          int    `json:"files"`
+
+	Status common.ExecutionTaskStatus `json:"status"`
+	Error  string                     `json:"error,omitempty"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+
+	Compile ProcessSummary `json:"compile"`
+	Run     ProcessSummary `json:"run"`
+}
+
+type Repository interface {
+	Save(ctx context.Context, record Record) error
+	// Query returns the newest records matching the filter and the cursor of the next page,
+	// a nil cursor means there are no more records
+	Query(ctx context.Context, filter Filter) ([]Record, *Cursor, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Filter struct {
+	Tenant  string
+	Runtime string
+	Status  string
+	From    time.Time // inclusive, zero means unbounded
+	To      time.Time // inclusive, zero means unbounded
+
+	Limit  int
+	Cursor *Cursor // last entry of the previous page, nil for the first page
+}
+
+// Cursor is the position of a record in the history, which is ordered by start time
+// then id, newest first. Pages start after it, so the records saved meanwhile don't
+// shift them.
+type Cursor struct {
+	StartedAt int64 // unix ms
+	ID        string
+}
+
+func cursorOf(record Record) *Cursor {
+	return &Cursor{StartedAt: record.StartedAt.UnixMilli(), ID: record.ID.String()}
+}
+
+// before tells whether the entry comes after the cursor, in the newest first order
+func (c *Cursor) before(startedAt int64, id string) bool {
+	return startedAt < c.StartedAt || (startedAt == c.StartedAt && id < c.ID)
+}
+
+func (c *Cursor) String() string {
+	return fmt.Sprintf("%d:%s", c.StartedAt, c.ID)
+}
+
+func ParseCursor(value string) (*Cursor, error) {
+	startedAt, id, found := strings.Cut(value, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	ms, err := strconv.ParseInt(startedAt, 10, 64)
+	if err != nil || ms < 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &Cursor{StartedAt: ms, ID: id}, nil
+}
+
+func NewRecord(id uuid.UUID, tenant string, req common.ExecutionRequest, res common.ResponseTask, err error, startedAt time.Time) Record {
+	finishedAt := time.Now()
+
+	record := Record{
+		ID:             id,
+		Tenant:         tenant,
+		Runtime:        req.Runtime.Name,
+		RuntimeVersion: req.Runtime.Version,
+		Files:          len(req.Project.Files),
+		Status:         res.Status,
+		StartedAt:      startedAt,
+		FinishedAt:     finishedAt,
+		DurationMs:     finishedAt.Sub(startedAt).Milliseconds(),
+		Compile:        summarize(res.Output.Compile),
+		Run:            summarize(res.Output.Run),
+	}
+
+	if err != nil {
+		record.Status = common.StatusFailed
+		record.Error = err.Error()
+	}
+
+	return record
+}
+
+func summarize(res common.ProcessResult) ProcessSummary {
+	stdout, stdoutTruncated := truncate(res.Stdout)
+	stderr, stderrTruncated := truncate(res.Stderr)
+
+	return ProcessSummary{
+		ExitCode:  res.ExitCode,
+		Time:      res.Time,
+		Memory:    res.Memory,
+		TimedOut:  res.TimedOut,
+		Stdout:    stdout,
+		Stderr:    stderr,
+		Truncated: stdoutTruncated || stderrTruncated,
+	}
+}
+
+func truncate(output string) (string, bool) {
+	if len(output) <= maxOutputSize {
+		return output, false
+	}
+
+	return output[:maxOutputSize], true
+}
+
+func (f Filter) matches(record Record) bool {
+	if f.Tenant != "" && record.Tenant != f.Tenant {
+		return false
+	}
+
+	if f.Runtime != "" && record.Runtime != f.Runtime {
+		return false
+	}
+
+	if f.Status != "" && string(record.Status) != f.Status {
+		return false
+	}
+
+	return true
+}
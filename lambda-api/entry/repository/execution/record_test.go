@@ -0,0 +1,63 @@
+package execution
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	common "github.com/common/model"
+	"github.com/google/uuid"
+)
+
+func TestNewRecord(t *testing.T) {
+	var req common.ExecutionRequest
+	req.Runtime.Name = "python3"
+
+	res := common.ResponseTask{
+		Status: common.StatusDone,
+		Output: common.WorkerResponse{
+			Run: common.ProcessResult{
+				Stdout:   strings.Repeat("a", maxOutputSize+1),
+				ExitCode: 0,
+			},
+		},
+	}
+
+	record := NewRecord(uuid.New(), "tenant-1", req, res, nil, time.Now())
+
+	if len(record.Run.Stdout) != maxOutputSize || !record.Run.Truncated {
+		t.Errorf("Expected the stdout to be truncated to %d bytes, got %d", maxOutputSize, len(record.Run.Stdout))
+	}
+
+	if record.Compile.Truncated {
+		t.Errorf("Expected the empty compile output not to be truncated")
+	}
+
+	failed := NewRecord(uuid.New(), "tenant-1", req, common.ResponseTask{}, errors.New("no workers"), time.Now())
+
+	if failed.Status != common.StatusFailed || failed.Error != "no workers" {
+		t.Errorf("Bad failed record: status %q, error %q", failed.Status, failed.Error)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	record := Record{Tenant: "tenant-1", Runtime: "go", Status: common.StatusDone}
+
+	var tests = []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{Tenant: "tenant-1", Runtime: "go", Status: "successful"}, true},
+		{Filter{Tenant: "tenant-2"}, false},
+		{Filter{Runtime: "python3"}, false},
+		{Filter{Status: "failed"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.matches(record); got != tt.want {
+			t.Errorf("%+v: got %t, want %t", tt.filter, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+Redis keys:
+	- execution:<id>               the JSON record, expires after the retention period
+	- executions                   sorted set of all the ids, scored by start time (unix ms)
+	- executions:tenant:<tenant>   same, for a single tenant
+	- executions:tenants           set of the tenants with an index
+*/
+
+// how many index entries are fetched at once while filtering
+const scanBatch = 100
+
+type RedisExecutionRepository struct {
+	Client    *redis.Client
+	Retention time.Duration
+}
+
+func (rdb *RedisExecutionRepository) Save(ctx context.Context, record Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	member := redis.Z{
+		Score:  float64(record.StartedAt.UnixMilli()),
+		Member: record.ID.String(),
+	}
+
+	pipe := rdb.Client.TxPipeline()
+	pipe.Set(ctx, recordKey(record.ID.String()), value, rdb.Retention)
+	pipe.ZAdd(ctx, indexKey(""), member)
+	if record.Tenant != "" {
+		pipe.ZAdd(ctx, indexKey(record.Tenant), member)
+		pipe.SAdd(ctx, "executions:tenants", record.Tenant)
+	}
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// Query walks the index newest first from the cursor, the ties on the start time are
+// ordered by id so a page always resumes right after the last entry of the previous one
+func (rdb *RedisExecutionRepository) Query(ctx context.Context, filter Filter) ([]Record, *Cursor, error) {
+	records := make([]Record, 0, filter.Limit)
+	position := filter.Cursor
+
+	for len(records) < filter.Limit {
+		entries, err := rdb.nextEntries(ctx, filter, position)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(entries) == 0 {
+			return records, nil, nil
+		}
+
+		keys := make([]string, len(entries))
+		for i, entry := range entries {
+			keys[i] = recordKey(entry.Member.(string))
+		}
+
+		values, err := rdb.Client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, value := range values {
+			position = &Cursor{StartedAt: int64(entries[i].Score), ID: entries[i].Member.(string)}
+
+			// expired, the index entry is removed by the next purge
+			str, ok := value.(string)
+			if !ok {
+				continue
+			}
+
+			var record Record
+			err = json.Unmarshal([]byte(str), &record)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !filter.matches(record) {
+				continue
+			}
+
+			records = append(records, record)
+			if len(records) == filter.Limit {
+				break
+			}
+		}
+	}
+
+	return records, position, nil
+}
+
+// nextEntries returns the index entries following the position: first the remaining ones
+// started in the same millisecond, then a batch of the older ones
+func (rdb *RedisExecutionRepository) nextEntries(ctx context.Context, filter Filter, position *Cursor) ([]redis.Z, error) {
+	key := indexKey(filter.Tenant)
+
+	scoreRange := &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "+inf",
+		Count: scanBatch,
+	}
+	if !filter.From.IsZero() {
+		scoreRange.Min = strconv.FormatInt(filter.From.UnixMilli(), 10)
+	}
+	if !filter.To.IsZero() {
+		scoreRange.Max = strconv.FormatInt(filter.To.UnixMilli(), 10)
+	}
+
+	if position != nil {
+		score := strconv.FormatInt(position.StartedAt, 10)
+
+		// the members of a score come in reverse lexical order, like the ids of the cursor
+		ties, err := rdb.Client.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: score, Max: score}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := ties[:0]
+		for _, tie := range ties {
+			if position.before(int64(tie.Score), tie.Member.(string)) {
+				remaining = append(remaining, tie)
+			}
+		}
+		if len(remaining) > 0 {
+			return remaining, nil
+		}
+
+		if filter.To.IsZero() || position.StartedAt <= filter.To.UnixMilli() {
+			scoreRange.Max = "(" + score
+		}
+	}
+
+	return rdb.Client.ZRevRangeByScoreWithScores(ctx, key, scoreRange).Result()
+}
+
+// Purge removes the index entries older than the cutoff, the records themselves expire on their own
+func (rdb *RedisExecutionRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	maxScore := fmt.Sprintf("(%d", before.UnixMilli())
+
+	removed, err := rdb.Client.ZRemRangeByScore(ctx, indexKey(""), "-inf", maxScore).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	tenants, err := rdb.Client.SMembers(ctx, "executions:tenants").Result()
+	if err != nil {
+		return removed, err
+	}
+
+	for _, tenant := range tenants {
+		err = rdb.Client.ZRemRangeByScore(ctx, indexKey(tenant), "-inf", maxScore).Err()
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+func recordKey(id string) string {
+	return fmt.Sprintf("execution:%s", id)
+}
+
+func indexKey(tenant string) string {
+	if tenant == "" {
+		return "executions"
+	}
+
+	return fmt.Sprintf("executions:tenant:%s", tenant)
+}
@@ -0,0 +1,153 @@
+package result
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	common "github.com/common/model"
+)
+
+// MemoryResultRepository keeps the idempotency keys and the memoized responses
+// in the process, for the all-in-one mode
+type MemoryResultRepository struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	memos   map[string]memoryMemo
+}
+
+type memoryEntry struct {
+	Entry
+	expiresAt time.Time
+}
+
+type memoryMemo struct {
+	response  common.ResponseTask
+	expiresAt time.Time
+}
+
+func (m *MemoryResultRepository) Reserve(_ context.Context, tenant, key, hash string, lease time.Duration) (Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, exists := m.entry(idempotencyKey(tenant, key))
+	if !exists {
+		m.entries[idempotencyKey(tenant, key)] = memoryEntry{
+			Entry:     Entry{State: StatePending, RequestHash: hash},
+			expiresAt: time.Now().Add(lease),
+		}
+
+		return Entry{}, true, nil
+	}
+
+	if entry.RequestHash != hash {
+		return Entry{}, false, ErrKeyReused
+	}
+
+	return entry, false, nil
+}
+
+func (m *MemoryResultRepository) Complete(_ context.Context, tenant, key, hash string, res common.ResponseTask, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.init()
+	m.entries[idempotencyKey(tenant, key)] = memoryEntry{
+		Entry:     Entry{State: StateDone, RequestHash: hash, Response: res},
+		expiresAt: time.Now().Add(window),
+	}
+
+	return nil
+}
+
+func (m *MemoryResultRepository) Fail(_ context.Context, tenant, key, hash string, res common.ResponseTask, reason string, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.init()
+	m.entries[idempotencyKey(tenant, key)] = memoryEntry{
+		Entry:     Entry{State: StateFailed, RequestHash: hash, Response: res, Error: reason},
+		expiresAt: time.Now().Add(window),
+	}
+
+	return nil
+}
+
+func (m *MemoryResultRepository) Release(_ context.Context, tenant, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, idempotencyKey(tenant, key))
+
+	return nil
+}
+
+func (m *MemoryResultRepository) Wait(ctx context.Context, tenant, key string) (common.ResponseTask, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.mu.Lock()
+		entry, exists := m.entry(idempotencyKey(tenant, key))
+		m.mu.Unlock()
+
+		if !exists {
+			return common.ResponseTask{}, ErrAbandoned
+		}
+
+		if entry.State != StatePending {
+			return entry.Outcome()
+		}
+
+		select {
+		case <-ctx.Done():
+			return common.ResponseTask{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *MemoryResultRepository) Memoized(_ context.Context, tenant, hash string) (common.ResponseTask, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.init()
+
+	memo, exists := m.memos[memoKey(tenant, hash)]
+	if !exists || time.Now().After(memo.expiresAt) {
+		delete(m.memos, memoKey(tenant, hash))
+		return common.ResponseTask{}, false, nil
+	}
+
+	return memo.response, true, nil
+}
+
+func (m *MemoryResultRepository) Memoize(_ context.Context, tenant, hash string, res common.ResponseTask, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.init()
+	m.memos[memoKey(tenant, hash)] = memoryMemo{response: res, expiresAt: time.Now().Add(ttl)}
+
+	return nil
+}
+
+// entry returns an idempotency entry unless it expired; the lock must be held
+func (m *MemoryResultRepository) entry(key string) (Entry, bool) {
+	m.init()
+
+	entry, exists := m.entries[key]
+	if !exists || time.Now().After(entry.expiresAt) {
+		delete(m.entries, key)
+		return Entry{}, false
+	}
+
+	return entry.Entry, true
+}
+
+func (m *MemoryResultRepository) init() {
+	if m.entries == nil {
+		m.entries = make(map[string]memoryEntry)
+		m.memos = make(map[string]memoryMemo)
+	}
+}
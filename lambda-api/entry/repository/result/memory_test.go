@@ -0,0 +1,71 @@
+package result
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	common "github.com/common/model"
+	"github.com/google/uuid"
+)
+
+func TestMemoryFailedKeyIsKept(t *testing.T) {
+	ctx := context.Background()
+	repository := &MemoryResultRepository{}
+
+	if _, reserved, err := repository.Reserve(ctx, "tenant", "key", "hash", time.Minute); err != nil || !reserved {
+		t.Fatalf("Failed to reserve the key: reserved %t, error %v", reserved, err)
+	}
+
+	dispatched := common.ResponseTask{Id: uuid.New(), Status: common.StatusFailed}
+	if err := repository.Fail(ctx, "tenant", "key", "hash", dispatched, "no reply", time.Minute); err != nil {
+		t.Fatalf("Failed to fail the key: %s", err)
+	}
+
+	// a retry doesn't get the key back, so the task doesn't run twice
+	entry, reserved, err := repository.Reserve(ctx, "tenant", "key", "hash", time.Minute)
+	if err != nil || reserved {
+		t.Fatalf("Expected the failed key to stay reserved: reserved %t, error %v", reserved, err)
+	}
+
+	if res, err := entry.Outcome(); !errors.Is(err, ErrOutcomeUnknown) || res.Id != dispatched.Id {
+		t.Errorf("Expected the outcome to be unknown for task %s, got %s, %v", dispatched.Id, res.Id, err)
+	}
+
+	if _, err := repository.Wait(ctx, "tenant", "key"); !errors.Is(err, ErrOutcomeUnknown) {
+		t.Errorf("Expected the waiters to get the failure, got %v", err)
+	}
+
+	_ = repository.Release(ctx, "tenant", "key")
+	if _, err := repository.Wait(ctx, "tenant", "key"); !errors.Is(err, ErrAbandoned) {
+		t.Errorf("Expected the released key to be abandoned, got %v", err)
+	}
+}
+
+func TestMemoryPendingKeyIsTakenOver(t *testing.T) {
+	ctx := context.Background()
+	repository := &MemoryResultRepository{}
+
+	if _, reserved, err := repository.Reserve(ctx, "tenant", "key", "hash", 50*time.Millisecond); err != nil || !reserved {
+		t.Fatalf("Failed to reserve the key: reserved %t, error %v", reserved, err)
+	}
+
+	// the entry holding the key crashed, the retries wait until its lease expires
+	if _, err := repository.Wait(ctx, "tenant", "key"); !errors.Is(err, ErrAbandoned) {
+		t.Errorf("Expected the expired reservation to be abandoned, got %v", err)
+	}
+
+	if _, reserved, err := repository.Reserve(ctx, "tenant", "key", "hash", time.Minute); err != nil || !reserved {
+		t.Fatalf("Expected a retry to take the key over: reserved %t, error %v", reserved, err)
+	}
+
+	// the outcome is kept for the window, past the lease of the reservation
+	done := common.ResponseTask{Id: uuid.New(), Status: common.StatusDone}
+	if err := repository.Complete(ctx, "tenant", "key", "hash", done, time.Hour); err != nil {
+		t.Fatalf("Failed to complete the key: %s", err)
+	}
+	if entry, reserved, err := repository.Reserve(ctx, "tenant", "key", "hash", time.Millisecond); err != nil || reserved || entry.Response.Id != done.Id {
+		t.Errorf("Expected the response of task %s, got %s: reserved %t, error %v", done.Id, entry.Response.Id, reserved, err)
+	}
+}
@@ -0,0 +1,194 @@
+package result
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	common "github.com/common/model"
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+Redis keys:
+	- idempotency:<tenant>:<key>  the state of the request sent with an Idempotency-Key
+	- memo:<tenant>:<hash>        the response of a memoized request
+*/
+
+var (
+	ErrKeyReused = errors.New("the idempotency key was already used with a different request")
+	ErrAbandoned = errors.New("the original request with this idempotency key failed, retry it")
+	// the task reached a worker but its response was lost, running it again could run it twice
+	ErrOutcomeUnknown = errors.New("the original request with this idempotency key was dispatched without a response, retry with a new key")
+)
+
+const pollInterval = 200 * time.Millisecond
+
+type State string
+
+const (
+	StatePending State = "pending"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+)
+
+type Entry struct {
+	State       State               `json:"state"`
+	RequestHash string              `json:"request_hash"`
+	Response    common.ResponseTask `json:"response,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// Outcome is the response of a finished entry, or the error of a failed one
+func (e Entry) Outcome() (common.ResponseTask, error) {
+	if e.State == StateFailed {
+		return e.Response, fmt.Errorf("%w: %s", ErrOutcomeUnknown, e.Error)
+	}
+
+	return e.Response, nil
+}
+
+type Repository interface {
+	// Reserve claims the key for a new execution for the lease, when the key is already taken
+	// it returns false and the existing entry instead. The outcome is kept for the window by
+	// Complete or Fail, a reservation left pending by a crashed entry expires with its lease
+	// and the next retry takes the key over.
+	Reserve(ctx context.Context, tenant, key, hash string, lease time.Duration) (Entry, bool, error)
+	Complete(ctx context.Context, tenant, key, hash string, res common.ResponseTask, window time.Duration) error
+	// Fail keeps the key of a dispatched execution whose response was lost, so it doesn't run again
+	Fail(ctx context.Context, tenant, key, hash string, res common.ResponseTask, reason string, window time.Duration) error
+	// Release frees the key of an execution which was never dispatched
+	Release(ctx context.Context, tenant, key string) error
+	// Wait blocks until the execution holding the key is done or failed
+	Wait(ctx context.Context, tenant, key string) (common.ResponseTask, error)
+
+	Memoized(ctx context.Context, tenant, hash string) (common.ResponseTask, bool, error)
+	Memoize(ctx context.Context, tenant, hash string, res common.ResponseTask, ttl time.Duration) error
+}
+
+type RedisResultRepository struct {
+	Client *redis.Client
+}
+
+func (rdb *RedisResultRepository) Reserve(ctx context.Context, tenant, key, hash string, lease time.Duration) (Entry, bool, error) {
+	pending, err := json.Marshal(Entry{State: StatePending, RequestHash: hash})
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	reserved, err := rdb.Client.SetNX(ctx, idempotencyKey(tenant, key), pending, lease).Result()
+	if err != nil || reserved {
+		return Entry{}, reserved, err
+	}
+
+	entry, err := rdb.get(ctx, idempotencyKey(tenant, key))
+	if errors.Is(err, redis.Nil) {
+		// released or expired in the meantime, try again
+		return rdb.Reserve(ctx, tenant, key, hash, lease)
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	if entry.RequestHash != hash {
+		return Entry{}, false, ErrKeyReused
+	}
+
+	return entry, false, nil
+}
+
+func (rdb *RedisResultRepository) Complete(ctx context.Context, tenant, key, hash string, res common.ResponseTask, window time.Duration) error {
+	done, err := json.Marshal(Entry{State: StateDone, RequestHash: hash, Response: res})
+	if err != nil {
+		return err
+	}
+
+	return rdb.Client.Set(ctx, idempotencyKey(tenant, key), done, window).Err()
+}
+
+func (rdb *RedisResultRepository) Fail(ctx context.Context, tenant, key, hash string, res common.ResponseTask, reason string, window time.Duration) error {
+	failed, err := json.Marshal(Entry{State: StateFailed, RequestHash: hash, Response: res, Error: reason})
+	if err != nil {
+		return err
+	}
+
+	return rdb.Client.Set(ctx, idempotencyKey(tenant, key), failed, window).Err()
+}
+
+func (rdb *RedisResultRepository) Release(ctx context.Context, tenant, key string) error {
+	return rdb.Client.Del(ctx, idempotencyKey(tenant, key)).Err()
+}
+
+func (rdb *RedisResultRepository) Wait(ctx context.Context, tenant, key string) (common.ResponseTask, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		entry, err := rdb.get(ctx, idempotencyKey(tenant, key))
+		if errors.Is(err, redis.Nil) {
+			return common.ResponseTask{}, ErrAbandoned
+		}
+		if err != nil {
+			return common.ResponseTask{}, err
+		}
+
+		if entry.State != StatePending {
+			return entry.Outcome()
+		}
+
+		select {
+		case <-ctx.Done():
+			return common.ResponseTask{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (rdb *RedisResultRepository) Memoized(ctx context.Context, tenant, hash string) (common.ResponseTask, bool, error) {
+	value, err := rdb.Client.Get(ctx, memoKey(tenant, hash)).Result()
+	if errors.Is(err, redis.Nil) {
+		return common.ResponseTask{}, false, nil
+	}
+	if err != nil {
+		return common.ResponseTask{}, false, err
+	}
+
+	var res common.ResponseTask
+	err = json.Unmarshal([]byte(value), &res)
+	if err != nil {
+		return common.ResponseTask{}, false, err
+	}
+
+	return res, true, nil
+}
+
+func (rdb *RedisResultRepository) Memoize(ctx context.Context, tenant, hash string, res common.ResponseTask, ttl time.Duration) error {
+	value, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	return rdb.Client.Set(ctx, memoKey(tenant, hash), value, ttl).Err()
+}
+
+func (rdb *RedisResultRepository) get(ctx context.Context, key string) (Entry, error) {
+	value, err := rdb.Client.Get(ctx, key).Result()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var entry Entry
+	err = json.Unmarshal([]byte(value), &entry)
+
+	return entry, err
+}
+
+func idempotencyKey(tenant, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", tenant, key)
+}
+
+func memoKey(tenant, hash string) string {
+	return fmt.Sprintf("memo:%s:%s", tenant, hash)
+}
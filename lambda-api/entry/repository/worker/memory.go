@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/common/registry"
+)
+
+// MemoryWorkerRepository reads the workers running in the same process, for the all-in-one mode
+type MemoryWorkerRepository struct {
+	Registry *registry.MemoryWorkerRegistry
+}
+
+func (m *MemoryWorkerRepository) QueryWorkers(context.Context) ([]SimplifiedWorker, error) {
+	var workers []SimplifiedWorker
+
+	for _, data := range m.Registry.List() {
+		var worker SimplifiedWorker
+
+		err := json.Unmarshal(data, &worker)
+		if err != nil {
+			return nil, err
+		}
+
+		workers = append(workers, worker)
+	}
+
+	return workers, nil
+}
+
+func (m *MemoryWorkerRepository) CountWorkers(context.Context) (int64, error) {
+	return int64(m.Registry.Count()), nil
+}
@@ -10,18 +10,26 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// Registry lists the workers available to run tasks
+type Registry interface {
+	QueryWorkers(ctx context.Context) ([]SimplifiedWorker, error)
+	CountWorkers(ctx context.Context) (int64, error)
+}
+
 type RedisWorkerRepository struct {
 	Client *redis.Client
 }
 
 type SimplifiedWorker struct {
-	ID       uuid.UUID `json:"id"`
-	CPUUsage float64   `json:"cpu_usage"`
+	ID         uuid.UUID      `json:"id"`
+	CPUUsage   float64        `json:"cpu_usage"`
+	QueueDepth map[string]int `json:"queue_depth"`
+
+	RuntimesVersion string `json:"runtimes_version"`
 }
 
 func (rdb *RedisWorkerRepository) QueryWorkers(ctx context.Context) ([]SimplifiedWorker, error) {
 	var workers []SimplifiedWorker
-	worker := SimplifiedWorker{}
 
 	// get a list of all worker IDs
 	ids, err := rdb.Client.SMembers(ctx, "workers").Result()
@@ -38,7 +46,8 @@ func (rdb *RedisWorkerRepository) QueryWorkers(ctx context.Context) ([]Simplifie
 			return nil, err
 		}
 
-		// unmarshal the value
+		// unmarshal the value, in a new struct since it holds a map
+		var worker SimplifiedWorker
 		err = json.Unmarshal([]byte(value), &worker)
 		if err != nil {
 			return nil, err
@@ -50,7 +59,12 @@ func (rdb *RedisWorkerRepository) QueryWorkers(ctx context.Context) ([]Simplifie
 	return workers, nil
 }
 
-func (rdb *RedisWorkerRepository) GetBestWorker(workers []SimplifiedWorker) (string, error) {
+func (rdb *RedisWorkerRepository) CountWorkers(ctx context.Context) (int64, error) {
+	return rdb.Client.SCard(ctx, "workers").Result()
+}
+
+// GetBestWorker returns the id of the least loaded worker
+func GetBestWorker(workers []SimplifiedWorker) (string, error) {
 	if len(workers) == 0 {
 		return "", fmt.Errorf("empty workers array")
 	}
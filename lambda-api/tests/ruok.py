@@ -1,5 +1,6 @@
 import requests
 import json
+import os
 
 
 def payload(msg):
@@ -21,7 +22,7 @@ def payload(msg):
 
 
 def send_req(msg):
-    headers = {'Content-Type': 'application/json'}
+    headers = {'Content-Type': 'application/json', 'X-API-Key': os.getenv('API_KEY', 'dev-key')}
     url = "http://localhost:3000/api/v1/execute"
 
     try:
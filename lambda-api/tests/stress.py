@@ -1,5 +1,6 @@
 import requests
 import json
+import os
 import concurrent.futures
 import time
 
@@ -24,7 +25,7 @@ def payload(msg):
 
 def execute_request(request_num, msg):
     start_time = time.time()
-    headers = {'Content-Type': 'application/json'}
+    headers = {'Content-Type': 'application/json', 'X-API-Key': os.getenv('API_KEY', 'dev-key')}
     url = "http://localhost:3000/api/v1/execute"
 
     try:
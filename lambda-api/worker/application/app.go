@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 
@@ -11,45 +12,81 @@ import (
 	"github.com/robfig/cron/v3"
 
 	"github.com/common/broker"
+	common "github.com/common/model"
+	"github.com/common/tracing"
+	"github.com/worker/metrics"
 	"github.com/worker/model"
 	"github.com/worker/repository/worker"
 )
 
+// how long the tasks in flight may take to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
 type App struct {
-	config Config
-	rdb    *redis.Client
-	broker broker.MessageBroker
-	worker model.Worker
+	config  Config
+	rdb     *redis.Client // nil when running in-process
+	broker  broker.MessageBroker
+	workers worker.WorkerRepository
+	worker  model.Worker
 }
 
 func New(config Config) *App {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: config.RedisAddress,
+	})
+
 	app := &App{
 		config: config,
-		rdb: redis.NewClient(&redis.Options{
-			Addr: config.RedisAddress,
-		}),
+		rdb:    rdb,
 		broker: &broker.RabbitMQMessageBroker{},
+		workers: &worker.RedisWorkerRepository{
+			Client: rdb,
+		},
 	}
 
 	return app
 }
 
+// NewInProcess creates a worker sharing the broker and the registry of the
+// process, used by the all-in-one mode
+func NewInProcess(config Config, broker broker.MessageBroker, workers worker.WorkerRepository) *App {
+	return &App{
+		config:  config,
+		broker:  broker,
+		workers: workers,
+	}
+}
+
 func (app *App) Start(ctx context.Context) error {
-	err := app.broker.Connect(app.config.RabbitMQAddress)
+	shutdownTracing, err := tracing.Setup(ctx, "lambda-worker", app.config.OTLPEndpoint)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to setup tracing: %w", err)
 	}
 
-	err = app.broker.CreateQueue(app.config.ID.String())
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("Failed to flush traces: %s", err)
+		}
+	}()
+
+	err = app.broker.Connect(app.config.RabbitMQAddress)
 	if err != nil {
 		return err
 	}
 
-	msgs, err := app.broker.Consume(app.config.ID.String())
+	// create multiple threads to handle messages
+	threadsNum := 10
+
+	// a lane can keep every thread busy, the tasks it delivered stay unacked until they are replied to
+	lanes := model.NewLaneScheduler(app.broker, app.config.ID.String(), model.DefaultLaneWeights, threadsNum)
+
+	err = lanes.Setup()
 	if err != nil {
 		return err
 	}
 
+	msgs := lanes.Run(ctx)
+
 	// start the redis connection
 	err = app.setupRedis(ctx)
 	if err != nil {
@@ -66,12 +103,16 @@ func (app *App) Start(ctx context.Context) error {
 
 	app.setupCronJobs()
 
+	// the new definitions are published with the next heartbeat
+	go app.worker.Runtimes.Watch(ctx, model.RegistryPollInterval)
+
+	if app.config.MetricsAddr != "" {
+		go app.serveMetrics()
+	}
+
 	log.Printf("Started worker: %s", app.config.ID.String())
 	log.Printf("[*] Waiting for messages. To exit press CTRL+C")
 
-	// create multiple threads to handle messages
-	threadsNum := 10
-
 	// start a communication channel for the error
 	var wg sync.WaitGroup
 	ch := make(chan error, threadsNum)
@@ -95,44 +136,72 @@ func (app *App) Start(ctx context.Context) error {
 		}(i)
 	}
 
+	// the threads are done once the lanes are closed, on shutdown or when the broker is lost
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
 	// graceful shutdown
 	select {
 	case err := <-ch:
 		return err
 
-	case <-ctx.Done():
-		close(ch)
+	case <-done:
+		if err := lanes.Err(); err != nil {
+			// let the supervisor or the orchestrator restart the worker with a new connection
+			return err
+		}
+
+		return app.broker.Close()
 
-		_, cancel := context.WithTimeout(context.Background(), time.Second*10)
-		defer cancel()
+	case <-ctx.Done():
+		// the lanes stop handing out tasks, the tasks already taken are finished and replied to,
+		// the others go back to their queues when the broker is closed
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+			log.Printf("Tasks still running after %s, stopping anyway", shutdownTimeout)
+		}
 
 		return app.broker.Close()
 	}
 }
 
-func (app *App) setupRedis(ctx context.Context) error {
-	err := app.rdb.Ping(ctx).Err()
+func (app *App) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	log.Printf("Serving metrics on http://%s/metrics", app.config.MetricsAddr)
 
+	err := http.ListenAndServe(app.config.MetricsAddr, mux)
 	if err != nil {
-		log.Panicf("Failed to connect to redis: %s", err)
-		return err
+		log.Printf("Failed to serve metrics: %s", err)
 	}
+}
+
+func (app *App) setupRedis(ctx context.Context) error {
+	if app.rdb != nil {
+		err := app.rdb.Ping(ctx).Err()
 
-	repo := worker.RedisWorkerRepository{
-		Client: app.rdb,
+		if err != nil {
+			log.Panicf("Failed to connect to redis: %s", err)
+			return err
+		}
 	}
 
-	app.worker = repo.RegisterWorker(ctx, app.config.ID, app.config.RuntimesDir)
+	app.worker = app.workers.RegisterWorker(ctx, app.config.ID, app.config.RuntimesDir)
 
 	return nil
 }
 
 func (app *App) closeRedis() error {
-	repo := worker.RedisWorkerRepository{
-		Client: app.rdb,
-	}
+	app.workers.UnregisterWorker(context.Background(), app.worker)
 
-	repo.UnregisterWorker(context.Background(), app.worker)
+	if app.rdb == nil {
+		return nil
+	}
 
 	if err := app.rdb.Close(); err != nil {
 		log.Panicf("Failed to close redis: %s", err)
@@ -145,17 +214,14 @@ func (app *App) closeRedis() error {
 }
 
 func (app *App) setupCronJobs() {
-	repo := worker.RedisWorkerRepository{
-		Client: app.rdb,
-	}
-
 	heartbeatInterval := 30
 	timeInterval := fmt.Sprintf("@every %ds", heartbeatInterval)
 
 	c := cron.New()
 
 	_, err := c.AddFunc(timeInterval, func() {
-		repo.Heartbeat(context.Background(), &app.worker)
+		app.updateQueueDepth()
+		app.workers.Heartbeat(context.Background(), &app.worker)
 	})
 	if err != nil {
 		log.Printf("Failed to create the heardbeat function.")
@@ -164,3 +230,18 @@ func (app *App) setupCronJobs() {
 
 	c.Start()
 }
+
+// updateQueueDepth reads the number of tasks waiting in every lane,
+// published in the worker registry with the next heartbeat
+func (app *App) updateQueueDepth() {
+	for _, priority := range common.Priorities {
+		depth, err := app.broker.QueueDepth(common.PriorityQueue(app.config.ID.String(), priority))
+		if err != nil {
+			log.Printf("Failed to read the depth of the %s queue: %s", priority, err)
+			continue
+		}
+
+		app.worker.QueueDepth[string(priority)] = depth
+		metrics.QueueDepth.WithLabelValues(string(priority)).Set(float64(depth))
+	}
+}
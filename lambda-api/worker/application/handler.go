@@ -1,12 +1,19 @@
 package application
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/common/broker"
 	common "github.com/common/model"
+	"github.com/common/tracing"
+	"github.com/worker/metrics"
 	"github.com/worker/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (app *App) HandleQueueMessage(msg broker.DeliveryMessage) error {
@@ -15,17 +22,29 @@ func (app *App) HandleQueueMessage(msg broker.DeliveryMessage) error {
 	// get the struct out of the json
 	err := json.Unmarshal([]byte(msg.Body), &execReq)
 	if err != nil {
+		ack(msg)
 		return err
 	}
 
-	languages, err := model.QuerySupportedLanguages(app.config.RuntimesDir)
-	if err != nil {
-		log.Printf("Failed to query languages: %s", err)
-		return err
+	metrics.ActiveTasks.Inc()
+	defer metrics.ActiveTasks.Dec()
+
+	runtimeName := execReq.Req.Runtime.Name
+	if !execReq.QueuedAt.IsZero() {
+		metrics.QueueWait.WithLabelValues(runtimeName).Observe(time.Since(execReq.QueuedAt).Seconds())
 	}
 
-	task, err := model.NewTask(execReq, languages)
+	// continue the trace of the entry that published the task
+	ctx := tracing.Extract(context.Background(), execReq.TraceContext)
+	ctx, span := startTaskSpans(ctx, execReq)
+	defer span.End()
+
+	execReq.Req.Process.OutputLimits = execReq.Req.Process.OutputLimits.Within(app.config.OutputLimits)
+
+	task, err := model.NewTask(execReq, app.worker.Runtimes.Languages())
 	if err != nil {
+		metrics.TasksTotal.WithLabelValues(runtimeName, common.StatusError).Inc()
+
 		errMsg := common.WorkerResponseWrapper{
 			Id: execReq.Id,
 			Res: common.WorkerResponse{
@@ -36,21 +55,28 @@ func (app *App) HandleQueueMessage(msg broker.DeliveryMessage) error {
 			},
 		}
 
-		msg, _ := json.Marshal(errMsg)
+		reply, _ := json.Marshal(errMsg)
 
-		err = app.broker.SendMessageToQueue("reply", string(msg))
+		err = app.broker.SendMessageToQueue("reply", string(reply))
 		if err != nil {
 			return err
 		}
 
+		ack(msg)
 		return nil
 	}
 
-	result, err := task.Execute()
+	result, err := task.Execute(ctx)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		metrics.TasksTotal.WithLabelValues(runtimeName, common.StatusError).Inc()
+		// it would fail the same way when delivered again
+		ack(msg)
 		return err
 	}
 
+	observeTask(task, result)
+
 	resultWrapper := common.WorkerResponseWrapper{
 		Id:  task.ID,
 		Res: result,
@@ -61,10 +87,80 @@ func (app *App) HandleQueueMessage(msg broker.DeliveryMessage) error {
 		return err
 	}
 
+	// without a reply the task stays unacked, and runs again once the connection is back
 	err = app.broker.SendMessageToQueue("reply", string(jsonResult))
 	if err != nil {
 		return err
 	}
 
+	ack(msg)
+
+	// followed by the supervisor to scale the workers
+	if !execReq.QueuedAt.IsZero() {
+		app.worker.Latency.Observe(time.Since(execReq.QueuedAt))
+	}
+
 	return nil
 }
+
+// ack takes a handled task out of its queue for good
+func ack(msg broker.DeliveryMessage) {
+	if err := msg.Ack(); err != nil {
+		log.Printf("Failed to ack a task: %s", err)
+	}
+}
+
+// startTaskSpans records the time spent in the queue and opens the span of the task itself
+func startTaskSpans(ctx context.Context, execReq common.ExecutionRequestWrapper) (context.Context, trace.Span) {
+	tracer := tracing.Tracer("worker")
+	attrs := trace.WithAttributes(
+		attribute.String("lambda.task_id", execReq.Id.String()),
+		attribute.String("lambda.runtime", execReq.Req.Runtime.Name),
+	)
+
+	if !execReq.QueuedAt.IsZero() {
+		_, queueSpan := tracer.Start(ctx, "worker.queue",
+			trace.WithTimestamp(execReq.QueuedAt),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			attrs,
+		)
+		queueSpan.End()
+	}
+
+	return tracer.Start(ctx, "worker.task", attrs)
+}
+
+func observeTask(task model.Task, result common.WorkerResponse) {
+	runtimeName := task.Language.Name
+
+	compiled := len(task.Language.CompileCmds) > 0
+	if compiled {
+		observeProcess(runtimeName, "compile", result.Compile)
+		metrics.CompileDuration.WithLabelValues(runtimeName).Observe(msToSeconds(result.Compile.Time))
+	}
+
+	// the run phase is skipped when the compilation fails
+	if result.Compile.ExitCode == 0 {
+		observeProcess(runtimeName, "run", result.Run)
+		metrics.RunDuration.WithLabelValues(runtimeName).Observe(msToSeconds(result.Run.Time))
+	}
+
+	status := string(common.StatusDone)
+	if result.Compile.ExitCode != 0 || result.Run.ExitCode != 0 {
+		status = common.StatusFailed
+	}
+
+	metrics.TasksTotal.WithLabelValues(runtimeName, status).Inc()
+}
+
+func observeProcess(runtimeName, phase string, p common.ProcessResult) {
+	metrics.ExitCodes.WithLabelValues(runtimeName, phase, metrics.ExitCode(p.ExitCode)).Inc()
+
+	if p.TimedOut {
+		metrics.Timeouts.WithLabelValues(runtimeName, phase).Inc()
+	}
+}
+
+func msToSeconds(ms int32) float64 {
+	return float64(ms) / 1000
+}
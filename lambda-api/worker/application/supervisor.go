@@ -0,0 +1,33 @@
+package application
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/common/broker"
+	"github.com/worker/supervisor"
+)
+
+// Supervise runs the workers of the host as child processes, until the context is done
+func Supervise(ctx context.Context, config Config) error {
+	b := &broker.RabbitMQMessageBroker{}
+
+	err := b.Connect(config.RabbitMQAddress)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: config.RedisAddress,
+	})
+	defer rdb.Close()
+
+	err = rdb.Ping(ctx).Err()
+	if err != nil {
+		return err
+	}
+
+	return supervisor.New(config.Supervisor, b, rdb).Run(ctx)
+}
@@ -7,14 +7,27 @@ import (
 	"os/signal"
 
 	"github.com/worker/application"
+	"github.com/worker/model"
 )
 
 func main() {
-	app := application.New(application.LoadConfig())
+	// the worker re-executes itself to set up the isolated executor sandboxes
+	model.RunSandboxInit()
+
+	config := application.LoadConfig()
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	if config.Mode == application.ModeSupervisor {
+		if err := application.Supervise(ctx, config); err != nil {
+			log.Panicf("Failed to supervise the workers: %s", err)
+		}
+		return
+	}
+
+	app := application.New(config)
+
 	err := app.Start(ctx)
 	if err != nil {
 		log.Panicf("Failed to start the app: %s", err)
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// all the metrics exposed by a worker on /metrics
+
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	TasksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "tasks_total",
+		Help:      "Tasks handled by the worker, by runtime and final status.",
+	}, []string{"runtime", "status"})
+
+	QueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "queue_wait_seconds",
+		Help:      "Time a task spent in the broker between being published by the entry and picked up by the worker.",
+		Buckets:   durationBuckets,
+	}, []string{"runtime"})
+
+	CompileDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "compile_duration_seconds",
+		Help:      "Duration of the compile phase, only for runtimes with compile commands.",
+		Buckets:   durationBuckets,
+	}, []string{"runtime"})
+
+	RunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "run_duration_seconds",
+		Help:      "Duration of the run phase.",
+		Buckets:   durationBuckets,
+	}, []string{"runtime"})
+
+	ExitCodes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "exit_codes_total",
+		Help:      "Exit codes of the compile and run processes.",
+	}, []string{"runtime", "phase", "code"})
+
+	Timeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "timeouts_total",
+		Help:      "Processes killed after exceeding their time limit.",
+	}, []string{"runtime", "phase"})
+
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "queue_depth",
+		Help:      "Tasks waiting in the queue of each priority lane, sampled with the heartbeat.",
+	}, []string{"priority"})
+
+	ActiveTasks = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lambda",
+		Subsystem: "worker",
+		Name:      "active_tasks",
+		Help:      "Tasks currently being executed by the worker.",
+	})
+)
+
+func ExitCode(code int32) string {
+	return strconv.Itoa(int(code))
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -1,13 +1,14 @@
 package model
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/common/model"
@@ -16,19 +17,43 @@ import (
 )
 
 func ExecuteSystemCommand(command []string, spec model.ProcessInfo) (model.ProcessResult, error) {
+	// a host process is trusted, like the compilers, and inherits the worker environment
+	env := append(os.Environ(), ParseEnv(spec.EnvironmentVars)...)
+	return executeProcess(command, spec, env, nil)
+}
+
+// executeProcess runs the command with the limits of the spec and exactly the given environment,
+// attr sets up the isolation, if any
+func executeProcess(command []string, spec model.ProcessInfo, env []string, attr *syscall.SysProcAttr) (model.ProcessResult, error) {
 	p := model.ProcessResult{}
 
 	ctx, cancel, err := LaunchProcessWithLimits(spec)
 	defer cancel()
 
+	// the process is killed before its time limit when it writes too much
+	ctx, kill := context.WithCancel(ctx)
+	defer kill()
+
 	cmdResult := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmdResult.SysProcAttr = attr
 	cmdResult.Dir = spec.WorkingDirectory
-	cmdResult.Env = append(os.Environ(), ParseEnv(spec.EnvironmentVars)...)
+	cmdResult.Env = env
 	cmdResult.Stdin = strings.NewReader(spec.StandardInput)
 
-	var stdout, stderr bytes.Buffer
-	cmdResult.Stdout = &stdout
-	cmdResult.Stderr = &stderr
+	limits := outputLimits(spec)
+
+	var killed atomic.Bool
+	exceeded := func() {
+		if limits.Kill {
+			killed.Store(true)
+			kill()
+		}
+	}
+
+	stdout := newCappedBuffer(limits.Stdout, exceeded)
+	stderr := newCappedBuffer(limits.Stderr, exceeded)
+	cmdResult.Stdout = stdout
+	cmdResult.Stderr = stderr
 
 	startTime := time.Now()
 	err = cmdResult.Start()
@@ -41,9 +66,8 @@ func ExecuteSystemCommand(command []string, spec model.ProcessInfo) (model.Proce
 	endTime := time.Now()
 	elapsedTime := endTime.Sub(startTime).Milliseconds()
 
-	p.Stdout = stdout.String()
-	p.Stderr = stderr.String()
-	p.Output = p.Stdout + p.Stderr
+	captureOutput(&p, stdout, stderr)
+	p.OutputKilled = killed.Load()
 	p.Time = int32(elapsedTime)
 	p.Memory = kbMem
 
@@ -54,6 +78,10 @@ func ExecuteSystemCommand(command []string, spec model.ProcessInfo) (model.Proce
 		}
 	}
 
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		p.TimedOut = true
+	}
+
 	return p, err
 }
 
@@ -31,3 +31,53 @@ func TestExecuteSystemCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteSystemCommandTimeout(t *testing.T) {
+	ans, _ := ExecuteSystemCommand([]string{"sleep", "5"}, model.ProcessInfo{CPUTime: "50ms"})
+
+	if !ans.TimedOut {
+		t.Errorf("Expected the process to time out, got exit code %d", ans.ExitCode)
+	}
+
+	ans, _ = ExecuteSystemCommand([]string{"echo", "test"}, model.ProcessInfo{CPUTime: "5s"})
+
+	if ans.TimedOut {
+		t.Errorf("Did not expect the process to time out")
+	}
+}
+
+func TestExecuteSystemCommandOutputLimits(t *testing.T) {
+	script := []string{"sh", "-c", "head -c 100 /dev/zero; echo err >&2"}
+
+	ans, _ := ExecuteSystemCommand(script, model.ProcessInfo{
+		OutputLimits: model.OutputLimits{Stdout: 10, Stderr: 10},
+	})
+
+	if len(ans.Stdout) != 10 || !ans.StdoutTruncated || ans.StdoutBytes != 100 {
+		t.Errorf("Bad truncated stdout: %d bytes kept of %d, truncated %t", len(ans.Stdout), ans.StdoutBytes, ans.StdoutTruncated)
+	}
+
+	if ans.Stderr != "err\n" || ans.StderrTruncated || ans.OutputKilled {
+		t.Errorf("Expected stderr to be complete, got %q", ans.Stderr)
+	}
+
+	// an endless output is stopped long before the time limit
+	ans, _ = ExecuteSystemCommand([]string{"yes"}, model.ProcessInfo{
+		CPUTime:      "10s",
+		OutputLimits: model.OutputLimits{Stdout: 1024, Kill: true},
+	})
+
+	if !ans.OutputKilled || ans.TimedOut || len(ans.Stdout) != 1024 {
+		t.Errorf("Expected the process to be killed at the output limit, got %d bytes, killed %t", len(ans.Stdout), ans.OutputKilled)
+	}
+}
+
+func TestCappedBufferRunes(t *testing.T) {
+	buf := newCappedBuffer(4, nil)
+	_, _ = buf.Write([]byte("abcé"))
+
+	// the cap falls in the middle of é
+	if buf.String() != "abc" || !buf.Truncated() {
+		t.Errorf("Expected the partial character to be dropped, got %q", buf.String())
+	}
+}
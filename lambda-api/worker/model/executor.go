@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/common/model"
+)
+
+// Executor runs a single process of a task, either the compile or the run phase.
+// A runtime chooses its executor with the `executor` key of its definition.
+type Executor interface {
+	Execute(ctx context.Context, command []string, spec model.ProcessInfo) (model.ProcessResult, error)
+}
+
+const (
+	ExecutorHost     = "host"     // a plain process of the worker
+	ExecutorIsolated = "isolated" // user namespaces and a chroot, see executor_isolated_linux.go
+	ExecutorWasm     = "wasm"     // a WASI module run in-process, see executor_wasi.go
+)
+
+func NewExecutor(lang model.Language) (Executor, error) {
+	switch lang.Executor {
+	case "", ExecutorHost:
+		return HostExecutor{}, nil
+	case ExecutorIsolated:
+		return newIsolatedExecutor()
+	case ExecutorWasm:
+		return newWasmExecutor(lang.Wasm), nil
+	default:
+		return nil, fmt.Errorf("unknown executor %q", lang.Executor)
+	}
+}
+
+// NewCompileExecutor returns the executor of the compile phase,
+// the toolchains producing wasm modules are regular host processes
+func NewCompileExecutor(lang model.Language) (Executor, error) {
+	if lang.Executor == ExecutorWasm {
+		return HostExecutor{}, nil
+	}
+
+	return NewExecutor(lang)
+}
+
+type HostExecutor struct{}
+
+func (HostExecutor) Execute(_ context.Context, command []string, spec model.ProcessInfo) (model.ProcessResult, error) {
+	return ExecuteSystemCommand(command, spec)
+}
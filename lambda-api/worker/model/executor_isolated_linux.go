@@ -0,0 +1,286 @@
+//go:build linux
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/common/model"
+)
+
+/*
+The isolated executor runs every process in new user, mount, pid, ipc, uts
+and (unless the request has network access) network namespaces. No privileges
+are needed, the worker user is mapped to root inside the user namespace.
+
+Mounts can't be set up between fork and exec from Go, so the worker re-executes
+itself with sandboxInitArg: the copy builds a root filesystem on a tmpfs, made of
+read-only bind mounts of the host toolchains and of the task directory on /task,
+chroots into it and finally execs the command.
+*/
+
+const sandboxInitArg = "__sandbox_init"
+
+// host directories visible read-only inside the sandbox, the runtimes are installed there.
+// Only the files of /etc needed to resolve names, verify certificates and load libraries
+// are bound, the rest of the host configuration stays hidden.
+var sandboxReadOnlyPaths = []string{
+	"/bin", "/sbin", "/usr", "/lib", "/lib64", "/nix",
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/ssl/certs",
+	"/etc/ld.so.cache", "/etc/alternatives", "/etc/localtime",
+}
+
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+type IsolatedExecutor struct{}
+
+func newIsolatedExecutor() (Executor, error) {
+	return IsolatedExecutor{}, nil
+}
+
+func (IsolatedExecutor) Execute(_ context.Context, command []string, spec model.ProcessInfo) (model.ProcessResult, error) {
+	workDir, err := filepath.Abs(spec.WorkingDirectory)
+	if err != nil {
+		return model.ProcessResult{}, err
+	}
+
+	// only a mount point, the tmpfs is mounted in the namespace of the sandbox
+	rootDir, err := os.MkdirTemp("", "sandbox-")
+	if err != nil {
+		return model.ProcessResult{}, err
+	}
+	defer os.RemoveAll(rootDir)
+
+	command, err = resolveCommand(command)
+	if err != nil {
+		return model.ProcessResult{}, err
+	}
+
+	initCommand := append([]string{
+		"/proc/self/exe", sandboxInitArg,
+		rootDir, workDir, strconv.FormatBool(spec.Permissions.CanWrite), "--",
+	}, command...)
+
+	spec.WorkingDirectory = workDir
+
+	return executeProcess(initCommand, spec, sandboxEnv(spec.EnvironmentVars), sandboxAttributes(spec.Permissions))
+}
+
+func sandboxAttributes(permissions model.Permissions) *syscall.SysProcAttr {
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+
+	if !permissions.NetworkAccess {
+		flags |= syscall.CLONE_NEWNET
+	}
+
+	return &syscall.SysProcAttr{
+		Cloneflags: uintptr(flags),
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// sandboxEnv is the whole environment of the sandboxed process: the worker one holds
+// the broker and redis credentials, so only PATH and LANG are taken from it.
+// The host home and temp dirs don't exist in the sandbox.
+func sandboxEnv(env map[string]string) []string {
+	vars := map[string]string{
+		"PATH":   lookupEnvOr("PATH", "/usr/local/bin:/usr/bin:/bin"),
+		"LANG":   lookupEnvOr("LANG", "C.UTF-8"),
+		"HOME":   "/tmp",
+		"TMPDIR": "/tmp",
+	}
+
+	for key, value := range env {
+		vars[key] = value
+	}
+
+	return ParseEnv(vars)
+}
+
+func lookupEnvOr(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+
+	return fallback
+}
+
+// resolveCommand looks up the binary on the host, since the PATH may point to
+// directories (like the nix profile) that are not mounted in the sandbox
+func resolveCommand(command []string) ([]string, error) {
+	if strings.Contains(command[0], "/") {
+		return command, nil
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return nil, err
+	}
+
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := append([]string{path}, command[1:]...)
+	return resolved, nil
+}
+
+// RunSandboxInit must be called first thing in main, when the worker is
+// re-executed as the init of a sandbox it sets it up and never returns
+func RunSandboxInit() {
+	if len(os.Args) < 7 || os.Args[1] != sandboxInitArg || os.Args[5] != "--" {
+		return
+	}
+
+	// the init is started with the sandbox environment only, and hands it over as is
+	err := sandboxInit(os.Args[2], os.Args[3], os.Args[4] == "true", os.Args[6:], os.Environ())
+
+	// only reached on failure
+	fmt.Fprintf(os.Stderr, "Failed to setup the sandbox: %s\n", err)
+	os.Exit(126)
+}
+
+func sandboxInit(rootDir, workDir string, writable bool, command, env []string) error {
+	// keep every mount below out of the host namespace
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("failed to make the mounts private: %w", err)
+	}
+
+	err = syscall.Mount("tmpfs", rootDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=64m,mode=0755")
+	if err != nil {
+		return fmt.Errorf("failed to mount the root: %w", err)
+	}
+
+	for _, path := range sandboxReadOnlyPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		err = bindMount(path, filepath.Join(rootDir, path), true)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, device := range sandboxDevices {
+		err = bindMount(device, filepath.Join(rootDir, device), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = bindMount(workDir, filepath.Join(rootDir, "task"), !writable)
+	if err != nil {
+		return err
+	}
+
+	procDir := filepath.Join(rootDir, "proc")
+	if err = os.MkdirAll(procDir, 0555); err != nil {
+		return err
+	}
+
+	err = syscall.Mount("proc", procDir, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	if err != nil {
+		return fmt.Errorf("failed to mount /proc: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Join(rootDir, "tmp"), 01777); err != nil {
+		return err
+	}
+
+	if err = syscall.Chroot(rootDir); err != nil {
+		return fmt.Errorf("failed to chroot: %w", err)
+	}
+
+	if err = os.Chdir("/task"); err != nil {
+		return err
+	}
+
+	return syscall.Exec(command[0], command, env)
+}
+
+func bindMount(source, target string, readOnly bool) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0755)
+	} else {
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err == nil {
+			err = os.WriteFile(target, nil, 0644)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, "")
+	if err != nil {
+		return fmt.Errorf("failed to bind %s: %w", source, err)
+	}
+
+	if !readOnly {
+		return nil
+	}
+
+	// a remount inside a user namespace must keep the flags locked by the host mount
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(source, &stat); err != nil {
+		return err
+	}
+
+	flags := uintptr(syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY) | lockedMountFlags(stat.Flags)
+
+	err = syscall.Mount("", target, "", flags, "")
+	if err != nil {
+		return fmt.Errorf("failed to make %s read-only: %w", source, err)
+	}
+
+	return nil
+}
+
+func lockedMountFlags(statFlags int64) uintptr {
+	const (
+		stNoSuid     = 0x2
+		stNoDev      = 0x4
+		stNoExec     = 0x8
+		stNoAtime    = 0x400
+		stNoDirAtime = 0x800
+		stRelAtime   = 0x1000
+	)
+
+	var flags uintptr
+	for statFlag, mountFlag := range map[int64]uintptr{
+		stNoSuid:     syscall.MS_NOSUID,
+		stNoDev:      syscall.MS_NODEV,
+		stNoExec:     syscall.MS_NOEXEC,
+		stNoAtime:    syscall.MS_NOATIME,
+		stNoDirAtime: syscall.MS_NODIRATIME,
+		stRelAtime:   syscall.MS_RELATIME,
+	} {
+		if statFlags&statFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+
+	return flags
+}
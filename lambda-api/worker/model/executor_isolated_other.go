@@ -0,0 +1,14 @@
+//go:build !linux
+
+package model
+
+import "errors"
+
+type IsolatedExecutor struct{}
+
+func newIsolatedExecutor() (Executor, error) {
+	return nil, errors.New("the isolated executor requires linux")
+}
+
+// RunSandboxInit is a no-op outside linux, there is no sandbox to set up
+func RunSandboxInit() {}
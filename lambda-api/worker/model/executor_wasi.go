@@ -0,0 +1,259 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing/fstest"
+	"time"
+
+	"github.com/common/model"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+/*
+The wasm executor runs WASI modules inside the worker with wazero, no host process is started.
+	- the module is the first command argument, either a binary module or its base64 encoding
+	- the filesystem is an in-memory, read-only copy of the task directory
+	- memory is capped in pages of 64 KiB
+	- fuel is the number of function calls allowed, tight loops without calls
+	  are still bounded by the time limit of the process
+*/
+
+var DefaultWasmLimits = model.WasmLimits{
+	MemoryPages: 1024, // 64 MiB
+	Fuel:        100_000_000,
+}
+
+var wasmMagic = []byte("\x00asm")
+
+// the exit code reported when the module runs out of fuel
+const exitCodeOutOfFuel = 137
+
+var errOutOfFuel = errors.New("the module ran out of fuel")
+
+type WasmExecutor struct {
+	limits model.WasmLimits
+}
+
+func newWasmExecutor(limits model.WasmLimits) WasmExecutor {
+	if limits.MemoryPages == 0 {
+		limits.MemoryPages = DefaultWasmLimits.MemoryPages
+	}
+
+	if limits.Fuel == 0 {
+		limits.Fuel = DefaultWasmLimits.Fuel
+	}
+
+	return WasmExecutor{limits: limits}
+}
+
+func (e WasmExecutor) Execute(_ context.Context, command []string, spec model.ProcessInfo) (model.ProcessResult, error) {
+	modulePath := filepath.Join(spec.WorkingDirectory, command[0])
+
+	binary, err := readModule(modulePath)
+	if err != nil {
+		return model.ProcessResult{}, err
+	}
+
+	files, err := loadFiles(spec.WorkingDirectory, modulePath)
+	if err != nil {
+		return model.ProcessResult{}, err
+	}
+
+	ctx, cancel, err := LaunchProcessWithLimits(spec)
+	defer cancel()
+	if err != nil {
+		return model.ProcessResult{}, err
+	}
+
+	fuel := &fuelMeter{remaining: int64(e.limits.Fuel), exhausted: cancel}
+	ctx = context.WithValue(ctx, experimental.FunctionListenerFactoryKey{}, fuel)
+
+	// function listeners need the interpreter
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter().
+		WithMemoryLimitPages(e.limits.MemoryPages).
+		WithCloseOnContextDone(true))
+	defer runtime.Close(context.Background())
+
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	limits := outputLimits(spec)
+
+	var killed atomic.Bool
+	exceeded := func() {
+		if limits.Kill {
+			killed.Store(true)
+			cancel()
+		}
+	}
+
+	stdout := newCappedBuffer(limits.Stdout, exceeded)
+	stderr := newCappedBuffer(limits.Stderr, exceeded)
+
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(command...).
+		WithStdin(strings.NewReader(spec.StandardInput)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithFSConfig(wazero.NewFSConfig().WithFSMount(files, "/")).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+
+	for key, value := range spec.EnvironmentVars {
+		config = config.WithEnv(key, value)
+	}
+
+	startTime := time.Now()
+
+	compiled, err := runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return model.ProcessResult{
+			Stderr:   err.Error(),
+			Output:   err.Error(),
+			ExitCode: 1,
+		}, nil
+	}
+
+	mod, err := runtime.InstantiateModule(ctx, compiled, config)
+	if mod != nil {
+		fuel.observeMemory(mod)
+	}
+
+	p := model.ProcessResult{
+		Time:   int32(time.Since(startTime).Milliseconds()),
+		Memory: fuel.peakMemory(),
+	}
+
+	var exitErr *sys.ExitError
+	switch {
+	case fuel.isExhausted():
+		stderr.Write([]byte(errOutOfFuel.Error()))
+		p.ExitCode = exitCodeOutOfFuel
+	case killed.Load():
+		p.OutputKilled = true
+		p.ExitCode = -1
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		p.TimedOut = true
+		p.ExitCode = -1
+	case errors.As(err, &exitErr):
+		p.ExitCode = int32(exitErr.ExitCode())
+	case err != nil:
+		// a trap, like an out of bounds memory access
+		stderr.Write([]byte(err.Error()))
+		p.ExitCode = 1
+	}
+
+	captureOutput(&p, stdout, stderr)
+
+	return p, nil
+}
+
+// readModule accepts both binary modules and base64 encoded ones,
+// since the request files are text
+func readModule(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, wasmMagic) {
+		return data, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || !bytes.HasPrefix(decoded, wasmMagic) {
+		return nil, fmt.Errorf("%s is not a wasm module", filepath.Base(path))
+	}
+
+	return decoded, nil
+}
+
+// loadFiles copies the task directory, without the module itself, in memory
+func loadFiles(dir, modulePath string) (fstest.MapFS, error) {
+	files := fstest.MapFS{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || path == modulePath {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files[filepath.ToSlash(name)] = &fstest.MapFile{Data: data, Mode: 0444}
+		return nil
+	})
+
+	return files, err
+}
+
+// fuelMeter counts the function calls of a module and stops it once the fuel runs out
+type fuelMeter struct {
+	remaining int64
+	exhausted context.CancelFunc
+	outOfFuel atomic.Bool
+	memory    atomic.Uint64
+}
+
+func (f *fuelMeter) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return f
+}
+
+func (f *fuelMeter) Before(_ context.Context, mod api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	if atomic.AddInt64(&f.remaining, -1) == 0 {
+		f.outOfFuel.Store(true)
+		f.exhausted()
+	}
+
+	f.observeMemory(mod)
+}
+
+func (f *fuelMeter) After(context.Context, api.Module, api.FunctionDefinition, []uint64) {}
+
+func (f *fuelMeter) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
+
+func (f *fuelMeter) observeMemory(mod api.Module) {
+	// WASI modules export their memory, Memory() is a typed nil without one
+	memory := mod.ExportedMemory("memory")
+	if memory == nil {
+		return
+	}
+
+	size := uint64(memory.Size())
+	for {
+		peak := f.memory.Load()
+		if size <= peak || f.memory.CompareAndSwap(peak, size) {
+			return
+		}
+	}
+}
+
+func (f *fuelMeter) peakMemory() uint64 {
+	return f.memory.Load()
+}
+
+func (f *fuelMeter) isExhausted() bool {
+	return f.outOfFuel.Load()
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/common/model"
+)
+
+// a tiny assembler, just enough to build the test modules by hand
+
+func leb(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	return append(leb(len(items)), bytes.Join(items, nil)...)
+}
+
+func section(id byte, items ...[]byte) []byte {
+	body := vec(items...)
+	return append(append([]byte{id}, leb(len(body))...), body...)
+}
+
+func name(s string) []byte {
+	return append(leb(len(s)), s...)
+}
+
+func funcBody(code ...byte) []byte {
+	body := append([]byte{0x00}, append(code, 0x0b)...) // no locals
+	return append(leb(len(body)), body...)
+}
+
+func wasmModule(sections ...[]byte) []byte {
+	header := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	return append(header, bytes.Join(sections, nil)...)
+}
+
+// writes "hello\n" to stdout with fd_write
+func helloModule(memoryPages int) []byte {
+	i32 := byte(0x7f)
+
+	return wasmModule(
+		section(1,
+			[]byte{0x60, 0x04, i32, i32, i32, i32, 0x01, i32}, // fd_write
+			[]byte{0x60, 0x00, 0x00},                          // _start
+		),
+		section(2, bytes.Join([][]byte{name("wasi_snapshot_preview1"), name("fd_write"), {0x00, 0x00}}, nil)),
+		section(3, []byte{0x01}),
+		section(5, append([]byte{0x00}, leb(memoryPages)...)),
+		section(7,
+			append(name("memory"), 0x02, 0x00),
+			append(name("_start"), 0x00, 0x01),
+		),
+		section(10, funcBody(
+			0x41, 0x01, // fd 1
+			0x41, 0x00, // iovs
+			0x41, 0x01, // iovs len
+			0x41, 0x14, // nwritten
+			0x10, 0x00, // call fd_write
+			0x1a, // drop
+		)),
+		section(11, bytes.Join([][]byte{
+			{0x00, 0x41, 0x00, 0x0b},                        // active, offset 0
+			name("\x08\x00\x00\x00\x06\x00\x00\x00hello\n"), // iovec {8, 6}, then the text
+		}, nil)),
+	)
+}
+
+// calls an empty function forever
+func spinModule() []byte {
+	return wasmModule(
+		section(1, []byte{0x60, 0x00, 0x00}),
+		section(3, []byte{0x00}, []byte{0x00}),
+		section(7, append(name("_start"), 0x00, 0x00)),
+		section(10,
+			funcBody(0x03, 0x40, 0x10, 0x01, 0x0c, 0x00, 0x0b), // loop { call 1; br 0 }
+			funcBody(),
+		),
+	)
+}
+
+func runWasm(t *testing.T, module []byte, limits model.WasmLimits) model.ProcessResult {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.wasm"), module, 0644); err != nil {
+		t.Fatalf("Failed to write the module: %s", err)
+	}
+
+	executor, err := NewExecutor(model.Language{Executor: ExecutorWasm, Wasm: limits})
+	if err != nil {
+		t.Fatalf("Failed to create the executor: %s", err)
+	}
+
+	res, err := executor.Execute(context.Background(), []string{"main.wasm"}, model.ProcessInfo{
+		CPUTime:          "5s",
+		WorkingDirectory: dir,
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute the module: %s", err)
+	}
+
+	return res
+}
+
+func TestWasmExecutor(t *testing.T) {
+	res := runWasm(t, helloModule(1), model.WasmLimits{})
+	if res.ExitCode != 0 || res.Stdout != "hello\n" {
+		t.Errorf("Bad result: exit code %d, stdout %q, stderr %q", res.ExitCode, res.Stdout, res.Stderr)
+	}
+
+	// the request files are text, so modules may be base64 encoded
+	encoded := []byte(base64.StdEncoding.EncodeToString(helloModule(1)))
+	res = runWasm(t, encoded, model.WasmLimits{})
+	if res.ExitCode != 0 || res.Stdout != "hello\n" {
+		t.Errorf("Bad result for the base64 module: exit code %d, stderr %q", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestWasmExecutorLimits(t *testing.T) {
+	res := runWasm(t, spinModule(), model.WasmLimits{Fuel: 1000})
+	if res.ExitCode != exitCodeOutOfFuel || res.TimedOut {
+		t.Errorf("Expected the module to run out of fuel: exit code %d, stderr %q", res.ExitCode, res.Stderr)
+	}
+
+	res = runWasm(t, helloModule(4), model.WasmLimits{MemoryPages: 2})
+	if res.ExitCode == 0 {
+		t.Errorf("Expected the module to exceed the memory limit")
+	}
+}
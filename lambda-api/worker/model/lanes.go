@@ -0,0 +1,172 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/common/broker"
+	"github.com/common/model"
+)
+
+// share of the tasks taken from each lane while all of them are busy,
+// an empty lane gives its turn to the next one so no time is wasted
+var DefaultLaneWeights = map[model.Priority]int{
+	model.PriorityHigh:   6,
+	model.PriorityNormal: 3,
+	model.PriorityLow:    1,
+}
+
+// LaneScheduler takes the tasks of a worker out of its priority queues with weighted fairness.
+// Every lane is consumed with at most prefetch tasks delivered and not acked, the others stay
+// in the broker and count in the queue depth. A task is acked once its result is published,
+// so the tasks of a worker which stopped before are delivered again.
+type LaneScheduler struct {
+	broker   broker.MessageBroker
+	workerID string
+	schedule []model.Priority
+	prefetch int
+	turn     int
+	lanes    map[model.Priority]<-chan broker.DeliveryMessage
+	err      error
+}
+
+func NewLaneScheduler(b broker.MessageBroker, workerID string, weights map[model.Priority]int, prefetch int) *LaneScheduler {
+	schedule := weightedSchedule(weights)
+	if len(schedule) == 0 {
+		schedule = model.Priorities
+	}
+
+	return &LaneScheduler{
+		broker:   b,
+		workerID: workerID,
+		schedule: schedule,
+		prefetch: prefetch,
+		lanes:    make(map[model.Priority]<-chan broker.DeliveryMessage),
+	}
+}
+
+// Setup creates the queue of every lane and starts consuming it
+func (s *LaneScheduler) Setup() error {
+	for _, priority := range model.Priorities {
+		queue := model.PriorityQueue(s.workerID, priority)
+
+		err := s.broker.CreateQueue(queue)
+		if err != nil {
+			return err
+		}
+
+		s.lanes[priority], err = s.broker.ConsumeAcked(queue, s.prefetch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run hands out the tasks until the context is done, the returned channel is unbuffered
+// so a task is only taken from its lane once a thread is free to handle it.
+// The channel is also closed when the broker closes a lane, Err then tells why.
+func (s *LaneScheduler) Run(ctx context.Context) <-chan broker.DeliveryMessage {
+	out := make(chan broker.DeliveryMessage)
+
+	go func() {
+		defer close(out)
+
+		for {
+			msg, err := s.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.err = err
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// not acked, the broker delivers it again once the worker is gone
+				return
+			case out <- msg:
+			}
+		}
+	}()
+
+	return out
+}
+
+// Err returns the error which stopped the scheduler, once the channel of Run is closed
+func (s *LaneScheduler) Err() error {
+	return s.err
+}
+
+// Next takes a task from the lane whose turn it is, falling back to the other lanes from
+// the most urgent one, and waits for the first task of any lane when all of them are empty
+func (s *LaneScheduler) Next(ctx context.Context) (broker.DeliveryMessage, error) {
+	lane := s.schedule[s.turn]
+	s.turn = (s.turn + 1) % len(s.schedule)
+
+	select {
+	case msg, ok := <-s.lanes[lane]:
+		return received(lane, msg, ok)
+	default:
+	}
+
+	for _, priority := range model.Priorities {
+		if priority == lane {
+			continue
+		}
+
+		select {
+		case msg, ok := <-s.lanes[priority]:
+			return received(priority, msg, ok)
+		default:
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return broker.DeliveryMessage{}, ctx.Err()
+	case msg, ok := <-s.lanes[model.PriorityHigh]:
+		return received(model.PriorityHigh, msg, ok)
+	case msg, ok := <-s.lanes[model.PriorityNormal]:
+		return received(model.PriorityNormal, msg, ok)
+	case msg, ok := <-s.lanes[model.PriorityLow]:
+		return received(model.PriorityLow, msg, ok)
+	}
+}
+
+// received returns the task taken from a lane, a closed lane means the broker connection is lost
+func received(priority model.Priority, msg broker.DeliveryMessage, ok bool) (broker.DeliveryMessage, error) {
+	if !ok {
+		return broker.DeliveryMessage{}, fmt.Errorf("the broker closed the %s lane", priority)
+	}
+
+	return msg, nil
+}
+
+// weightedSchedule spreads the turns of each lane evenly (smooth weighted round-robin),
+// e.g. 2:1 gives high, normal, high instead of high, high, normal
+func weightedSchedule(weights map[model.Priority]int) []model.Priority {
+	total := 0
+	for _, priority := range model.Priorities {
+		total += weights[priority]
+	}
+
+	current := make(map[model.Priority]int)
+	schedule := make([]model.Priority, 0, total)
+
+	for i := 0; i < total; i++ {
+		var best model.Priority
+		for _, priority := range model.Priorities {
+			current[priority] += weights[priority]
+			if best == "" || current[priority] > current[best] {
+				best = priority
+			}
+		}
+
+		current[best] -= total
+		schedule = append(schedule, best)
+	}
+
+	return schedule
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/common/broker"
+	"github.com/common/model"
+)
+
+type fakeBroker struct {
+	queues map[string]chan broker.DeliveryMessage
+}
+
+func (b *fakeBroker) Connect(string) error { return nil }
+func (b *fakeBroker) Close() error         { return nil }
+
+func (b *fakeBroker) CreateQueue(name string) error {
+	b.queues[name] = make(chan broker.DeliveryMessage, 100)
+	return nil
+}
+
+func (b *fakeBroker) Consume(string) (<-chan broker.DeliveryMessage, error) {
+	return nil, nil
+}
+
+func (b *fakeBroker) ConsumeAcked(name string, _ int) (<-chan broker.DeliveryMessage, error) {
+	return b.queues[name], nil
+}
+
+func (b *fakeBroker) SendMessageToQueue(name, msg string) error {
+	b.queues[name] <- broker.DeliveryMessage{Body: msg}
+	return nil
+}
+
+func (b *fakeBroker) Get(string) (broker.DeliveryMessage, bool, error) {
+	return broker.DeliveryMessage{}, false, nil
+}
+
+func (b *fakeBroker) QueueDepth(name string) (int, error) {
+	return len(b.queues[name]), nil
+}
+
+func TestWeightedSchedule(t *testing.T) {
+	schedule := weightedSchedule(DefaultLaneWeights)
+
+	counts := make(map[model.Priority]int)
+	for _, priority := range schedule {
+		counts[priority]++
+	}
+
+	for priority, weight := range DefaultLaneWeights {
+		if counts[priority] != weight {
+			t.Errorf("Bad number of %s turns: %d, want %d", priority, counts[priority], weight)
+		}
+	}
+
+	// the most urgent lane never waits for more than one other turn
+	for i := 1; i < len(schedule); i++ {
+		if schedule[i] != model.PriorityHigh && schedule[i-1] != model.PriorityHigh {
+			t.Errorf("Two turns in a row without the high lane: %v", schedule)
+			break
+		}
+	}
+}
+
+func TestLaneSchedulerFairness(t *testing.T) {
+	ctx := context.Background()
+	b := &fakeBroker{queues: make(map[string]chan broker.DeliveryMessage)}
+
+	scheduler := NewLaneScheduler(b, "worker", DefaultLaneWeights, 10)
+	if err := scheduler.Setup(); err != nil {
+		t.Fatalf("Failed to setup the lanes: %s", err)
+	}
+
+	for _, priority := range model.Priorities {
+		for i := 0; i < 20; i++ {
+			_ = b.SendMessageToQueue(model.PriorityQueue("worker", priority), string(priority))
+		}
+	}
+
+	// while all the lanes are busy, the tasks are taken by weight
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		msg, err := scheduler.Next(ctx)
+		if err != nil {
+			t.Fatalf("Expected a task: %s", err)
+		}
+		counts[msg.Body]++
+	}
+
+	for priority, weight := range DefaultLaneWeights {
+		if counts[string(priority)] != weight {
+			t.Errorf("Bad number of %s tasks: %d, want %d", priority, counts[string(priority)], weight)
+		}
+	}
+
+	// once the busier lanes are empty, the low lane gets every turn
+	for len(b.queues["worker.high"])+len(b.queues["worker.normal"]) > 0 {
+		_, _ = scheduler.Next(ctx)
+	}
+
+	msg, err := scheduler.Next(ctx)
+	if err != nil || msg.Body != string(model.PriorityLow) {
+		t.Errorf("Expected a low priority task, got %q, %v", msg.Body, err)
+	}
+}
+
+func TestLaneSchedulerWaitsForTasks(t *testing.T) {
+	b := &fakeBroker{queues: make(map[string]chan broker.DeliveryMessage)}
+
+	scheduler := NewLaneScheduler(b, "worker", DefaultLaneWeights, 10)
+	if err := scheduler.Setup(); err != nil {
+		t.Fatalf("Failed to setup the lanes: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs := scheduler.Run(ctx)
+
+	// the empty lanes are waited on, not polled
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = b.SendMessageToQueue(model.PriorityQueue("worker", model.PriorityLow), "task")
+	}()
+
+	select {
+	case msg := <-msgs:
+		if msg.Body != "task" {
+			t.Errorf("Expected the task, got %q", msg.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the task to be handed out")
+	}
+
+	cancel()
+	if _, open := <-msgs; open {
+		t.Errorf("Expected the scheduler to stop with its context")
+	}
+	if err := scheduler.Err(); err != nil {
+		t.Errorf("Expected no error on shutdown, got %s", err)
+	}
+}
+
+func TestLaneSchedulerLostLane(t *testing.T) {
+	b := &fakeBroker{queues: make(map[string]chan broker.DeliveryMessage)}
+
+	scheduler := NewLaneScheduler(b, "worker", DefaultLaneWeights, 10)
+	if err := scheduler.Setup(); err != nil {
+		t.Fatalf("Failed to setup the lanes: %s", err)
+	}
+
+	// the broker closes the consumers when the connection is lost
+	close(b.queues[model.PriorityQueue("worker", model.PriorityNormal)])
+
+	msgs := scheduler.Run(context.Background())
+	if _, open := <-msgs; open {
+		t.Fatalf("Expected the scheduler to stop")
+	}
+	if scheduler.Err() == nil {
+		t.Errorf("Expected the lost lane to be reported")
+	}
+}
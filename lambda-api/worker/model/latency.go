@@ -0,0 +1,44 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// the weight of the newest reply in the moving average
+const latencySmoothing = 0.2
+
+// an idle worker is not slow, old observations are dropped after this delay
+const latencyIdleAfter = time.Minute
+
+// LatencyTracker keeps a moving average of the time between the publication
+// of a task and its reply, it is published with the heartbeats
+type LatencyTracker struct {
+	mu       sync.Mutex
+	average  time.Duration
+	observed time.Time
+}
+
+func (l *LatencyTracker) Observe(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.observed.IsZero() || time.Since(l.observed) > latencyIdleAfter {
+		l.average = latency
+	} else {
+		l.average += time.Duration(latencySmoothing * float64(latency-l.average))
+	}
+
+	l.observed = time.Now()
+}
+
+func (l *LatencyTracker) Value() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.observed) > latencyIdleAfter {
+		return 0
+	}
+
+	return l.average
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"bytes"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/common/model"
+)
+
+// DefaultOutputLimits are the caps of a worker without OUTPUT_* settings
+var DefaultOutputLimits = model.OutputLimits{
+	Stdout: 1 << 20, // 1 MiB
+	Stderr: 1 << 20,
+	Kill:   true,
+}
+
+// cappedBuffer keeps the first limit bytes written to it, the rest is counted
+// and dropped. Writes never fail, so the process is not stopped by a broken pipe.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	written  int64
+	exceeded func() // called once, when the limit is first exceeded
+	once     sync.Once
+}
+
+func newCappedBuffer(limit int64, exceeded func()) *cappedBuffer {
+	return &cappedBuffer{limit: limit, exceeded: exceeded}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.written += int64(len(p))
+
+	if room := b.limit - int64(b.buf.Len()); room > 0 {
+		if int64(len(p)) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+
+	if b.written > b.limit && b.exceeded != nil {
+		b.once.Do(b.exceeded)
+	}
+
+	return len(p), nil
+}
+
+func (b *cappedBuffer) Truncated() bool {
+	return b.written > b.limit
+}
+
+// String returns the kept output, without a multi-byte character cut at the limit
+func (b *cappedBuffer) String() string {
+	data := b.buf.Bytes()
+
+	if b.Truncated() {
+		for i := 0; i < utf8.UTFMax-1 && len(data) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(data); r != utf8.RuneError || size != 1 {
+				break
+			}
+			data = data[:len(data)-1]
+		}
+	}
+
+	return string(data)
+}
+
+// outputLimits fills the limits missing from the spec with the defaults
+func outputLimits(spec model.ProcessInfo) model.OutputLimits {
+	limits := spec.OutputLimits
+
+	if limits.Stdout <= 0 {
+		limits.Stdout = DefaultOutputLimits.Stdout
+	}
+
+	if limits.Stderr <= 0 {
+		limits.Stderr = DefaultOutputLimits.Stderr
+	}
+
+	return limits
+}
+
+// captureOutput sets the streams and sizes of a result from the buffers of the process
+func captureOutput(p *model.ProcessResult, stdout, stderr *cappedBuffer) {
+	p.Stdout = stdout.String()
+	p.Stderr = stderr.String()
+	p.Output = p.Stdout + p.Stderr
+
+	p.StdoutBytes = stdout.written
+	p.StderrBytes = stderr.written
+	p.StdoutTruncated = stdout.Truncated()
+	p.StderrTruncated = stderr.Truncated()
+}
@@ -0,0 +1,166 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/common/model"
+)
+
+/*
+The runtime registry holds the runtime definitions of the worker, they are read
+and validated once instead of on every task. Watch polls the runtimes directory
+and swaps the whole set of definitions when a file changes: an invalid set is
+rejected and the previous one keeps serving the tasks.
+*/
+
+// how often the runtimes directory is checked for changes
+const RegistryPollInterval = 5 * time.Second
+
+type RuntimeRegistry struct {
+	dir      string
+	snapshot atomic.Pointer[registrySnapshot]
+}
+
+type registrySnapshot struct {
+	version   string
+	languages []model.Language
+}
+
+func LoadRegistry(dir string) (*RuntimeRegistry, error) {
+	registry := &RuntimeRegistry{dir: dir}
+
+	if err := registry.Reload(); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// Languages returns the current definitions, the slice must not be modified
+func (r *RuntimeRegistry) Languages() []model.Language {
+	return r.snapshot.Load().languages
+}
+
+// Version identifies the loaded definitions, it changes with their contents
+func (r *RuntimeRegistry) Version() string {
+	return r.snapshot.Load().version
+}
+
+// Reload reads the runtimes directory again, the registry is only updated when
+// every definition is valid
+func (r *RuntimeRegistry) Reload() error {
+	files, version, err := readRuntimeFiles(r.dir)
+	if err != nil {
+		return err
+	}
+
+	if current := r.snapshot.Load(); current != nil && current.version == version {
+		return nil
+	}
+
+	languages := make([]model.Language, 0, len(files))
+	names := make(map[string]string)
+
+	for _, file := range files {
+		lang, err := model.ParseLanguage(file.data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.name, err)
+		}
+
+		if other, exists := names[lang.Name]; exists {
+			return fmt.Errorf("%s: runtime %q is already defined in %s", file.name, lang.Name, other)
+		}
+
+		if _, err := NewExecutor(lang); err != nil {
+			return fmt.Errorf("%s: %w", file.name, err)
+		}
+
+		names[lang.Name] = file.name
+		languages = append(languages, lang)
+	}
+
+	r.snapshot.Store(&registrySnapshot{version: version, languages: languages})
+
+	return nil
+}
+
+// Watch reloads the registry whenever the definitions change, until the context is done
+func (r *RuntimeRegistry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		previous := r.Version()
+
+		if err := r.Reload(); err != nil {
+			log.Printf("Rejected the runtime definitions, keeping version %s: %s", previous, err)
+			continue
+		}
+
+		if version := r.Version(); version != previous {
+			log.Printf("Reloaded the runtime definitions: version %s", version)
+		}
+	}
+}
+
+type runtimeFile struct {
+	name string
+	data []byte
+}
+
+// readRuntimeFiles returns the yaml files sorted by name, and a hash of their contents
+func readRuntimeFiles(dir string) ([]runtimeFile, string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", errors.New("runtimes directory is not present")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	var files []runtimeFile
+	hash := sha256.New()
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yaml") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, "", err
+		}
+
+		fmt.Fprintf(hash, "%s\x00%d\x00", entry.Name(), len(data))
+		hash.Write(data)
+
+		files = append(files, runtimeFile{name: entry.Name(), data: data})
+	}
+
+	if len(files) == 0 {
+		return nil, "", errors.New("no runtime definitions found")
+	}
+
+	return files, hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pythonRuntime = `name: python3
+versions: [3.12]
+extension: py
+run: ["python3", "<entry>"]
+`
+
+func writeRuntime(t *testing.T, dir, name, contents string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %s", name, err)
+	}
+}
+
+func TestRegistryValidation(t *testing.T) {
+	var tests = []struct {
+		name       string
+		definition string
+		errMsg     string
+	}{
+		{"valid", pythonRuntime, ""},
+		{"unknown key", pythonRuntime + "timeout: 5\n", "not found in type"},
+		{"missing name", strings.Replace(pythonRuntime, "name: python3\n", "", 1), "name is required"},
+		{"missing run", strings.Replace(pythonRuntime, `run: ["python3", "<entry>"]`, "", 1), "run command is required"},
+		{"unknown placeholder", strings.Replace(pythonRuntime, "<entry>", "<main>", 1), "unexpected placeholder <main>"},
+		{"output without compile", strings.Replace(pythonRuntime, "<entry>", "<output>", 1), "unexpected placeholder <output>"},
+		{"unknown executor", pythonRuntime + "executor: vm\n", `unknown executor "vm"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeRuntime(t, dir, "runtime.yaml", tt.definition)
+
+			_, err := LoadRegistry(dir)
+			if tt.errMsg == "" && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)) {
+				t.Errorf("Expected an error with %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	dir := t.TempDir()
+	writeRuntime(t, dir, "python3.yaml", pythonRuntime)
+
+	registry, err := LoadRegistry(dir)
+	if err != nil {
+		t.Fatalf("Failed to load the registry: %s", err)
+	}
+
+	version := registry.Version()
+
+	// an invalid definition is rejected as a whole
+	writeRuntime(t, dir, "broken.yaml", "name: [")
+
+	if err := registry.Reload(); err == nil {
+		t.Errorf("Expected the broken definition to be rejected")
+	}
+
+	if registry.Version() != version || len(registry.Languages()) != 1 {
+		t.Errorf("Expected the previous definitions to be kept")
+	}
+
+	writeRuntime(t, dir, "broken.yaml", strings.Replace(pythonRuntime, "python3\n", "python2\n", 1))
+
+	if err := registry.Reload(); err != nil {
+		t.Fatalf("Failed to reload the registry: %s", err)
+	}
+
+	if registry.Version() == version || len(registry.Languages()) != 2 {
+		t.Errorf("Expected the new definitions, got version %s with %d runtimes", registry.Version(), len(registry.Languages()))
+	}
+
+	// a runtime can't be defined twice
+	writeRuntime(t, dir, "copy.yaml", pythonRuntime)
+
+	if err := registry.Reload(); err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Errorf("Expected the duplicated runtime to be rejected, got %v", err)
+	}
+}
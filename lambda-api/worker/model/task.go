@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -10,7 +11,9 @@ import (
 	"time"
 
 	"github.com/common/model"
+	"github.com/common/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Task struct {
@@ -19,6 +22,9 @@ type Task struct {
 	Language model.Language         `json:"language"`
 
 	WorkingDir string
+
+	executor        Executor
+	compileExecutor Executor
 }
 
 type CommandSpec struct {
@@ -48,10 +54,22 @@ func NewTask(req model.ExecutionRequestWrapper, langsRepo []model.Language) (Tas
 		return task, errors.New("language not found")
 	}
 
+	var err error
+
+	task.executor, err = NewExecutor(task.Language)
+	if err != nil {
+		return task, err
+	}
+
+	task.compileExecutor, err = NewCompileExecutor(task.Language)
+	if err != nil {
+		return task, err
+	}
+
 	return task, nil
 }
 
-func (t *Task) Execute() (model.WorkerResponse, error) {
+func (t *Task) Execute(ctx context.Context) (model.WorkerResponse, error) {
 	execDir, err := t.initWorkingDir()
 	if err != nil {
 		_ = t.cleanup()
@@ -75,17 +93,15 @@ func (t *Task) Execute() (model.WorkerResponse, error) {
 		return model.WorkerResponse{}, err
 	}
 
-	entryFullFilename := fmt.Sprintf("%s/%s", execDir, entryFilename)
-	outputFilename := fmt.Sprintf("%s/%s", execDir, "main")
-
-	// setup the cmd spec, used to run & compile
+	// setup the cmd spec, used to run & compile, the paths are relative
+	// to the task directory so they also resolve inside a sandbox
 	cmdSpec := CommandSpec{
-		EntryFilename: entryFullFilename,
-		OutFilename:   outputFilename,
+		EntryFilename: entryFilename,
+		OutFilename:   "main",
 		ProcLimits:    t.Request.Process,
 	}
 
-	compileProcess, err := t.compileFile(&cmdSpec)
+	compileProcess, err := t.compileFile(ctx, &cmdSpec)
 
 	if err != nil || compileProcess.ExitCode != 0 {
 		_ = t.cleanup()
@@ -98,7 +114,7 @@ func (t *Task) Execute() (model.WorkerResponse, error) {
 	cmdSpec.EntryFilename = entryFilename
 	cmdSpec.OutFilename = "./main" // TODO
 	cmdSpec.ProcLimits.WorkingDirectory = execDir
-	runProcess, err := t.runFile(cmdSpec)
+	runProcess, err := t.runFile(ctx, cmdSpec)
 
 	//	return model.WorkerResponse{Compile: model.ProcessResult{ExitCode: 1}}, nil
 
@@ -123,27 +139,56 @@ func (t *Task) Execute() (model.WorkerResponse, error) {
 	}, err
 }
 
-func (t *Task) compileFile(spec *CommandSpec) (model.ProcessResult, error) {
+func (t *Task) compileFile(ctx context.Context, spec *CommandSpec) (model.ProcessResult, error) {
 	if len(t.Language.CompileCmds) == 0 {
 		spec.OutFilename = spec.EntryFilename
 		return model.ProcessResult{}, nil
 	}
 
+	_, span := tracing.Tracer("worker").Start(ctx, "worker.compile")
+	defer span.End()
+
 	compileCommands := t.processCommands(spec.EntryFilename, spec.OutFilename, t.Language.CompileCmds)
 
-	result, err := ExecuteSystemCommand(compileCommands, DefaultLimits())
+	limits := DefaultLimits()
+	limits.WorkingDirectory = t.WorkingDir
+	limits.OutputLimits = spec.ProcLimits.OutputLimits
+
+	result, err := t.compileExecutor.Execute(ctx, compileCommands, limits)
+
+	span.SetAttributes(
+		attribute.String("process.executor", t.executorName()),
+		attribute.Int("process.exit_code", int(result.ExitCode)),
+	)
 
 	return result, err
 }
 
-func (t *Task) runFile(spec CommandSpec) (model.ProcessResult, error) {
+func (t *Task) runFile(ctx context.Context, spec CommandSpec) (model.ProcessResult, error) {
+	_, span := tracing.Tracer("worker").Start(ctx, "worker.run")
+	defer span.End()
+
 	runCommands := t.processCommands(spec.EntryFilename, spec.OutFilename, t.Language.RunCmds)
 
-	result, err := ExecuteSystemCommand(runCommands, spec.ProcLimits)
+	result, err := t.executor.Execute(ctx, runCommands, spec.ProcLimits)
+
+	span.SetAttributes(
+		attribute.String("process.executor", t.executorName()),
+		attribute.Int("process.exit_code", int(result.ExitCode)),
+		attribute.Bool("process.timed_out", result.TimedOut),
+	)
 
 	return result, err
 }
 
+func (t *Task) executorName() string {
+	if t.Language.Executor == "" {
+		return ExecutorHost
+	}
+
+	return t.Language.Executor
+}
+
 // replace <entry> and <output> within the run/compile commands
 func (t *Task) processCommands(entry, output string, commands []string) []string {
 	resultCmds := make([]string, len(commands))
@@ -1,10 +1,7 @@
 package model
 
 import (
-	"errors"
 	"log"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/common/model"
@@ -14,23 +11,35 @@ import (
 )
 
 type Worker struct {
-	ID          uuid.UUID        `json:"id"`
-	CPUUsage    float64          `json:"cpu_usage"`
-	LastUpdated uint64           `json:"last_updated"`
-	Languages   []model.Language `json:"-"`
+	ID          uuid.UUID      `json:"id"`
+	CPUUsage    float64        `json:"cpu_usage"`
+	LastUpdated uint64         `json:"last_updated"`
+	QueueDepth  map[string]int `json:"queue_depth"` // tasks waiting, by priority
+
+	Runtimes        *RuntimeRegistry `json:"-"`
+	RuntimesVersion string           `json:"runtimes_version"`
+
+	Latency        *LatencyTracker `json:"-"`
+	ReplyLatencyMs int64           `json:"reply_latency_ms"`
 }
 
 func NewWorker(id uuid.UUID, runtimesDir string) Worker {
 	worker := Worker{
-		ID: id,
+		ID:         id,
+		QueueDepth: make(map[string]int),
+		Latency:    &LatencyTracker{},
+	}
+
+	for _, priority := range model.Priorities {
+		worker.QueueDepth[string(priority)] = 0
 	}
 
-	languages, err := QuerySupportedLanguages(runtimesDir)
+	runtimes, err := LoadRegistry(runtimesDir)
 	if err != nil {
 		log.Panicf("Failed to build worker: %s", err)
 	}
 
-	worker.Languages = languages
+	worker.Runtimes = runtimes
 
 	worker.Update()
 
@@ -39,6 +48,8 @@ func NewWorker(id uuid.UUID, runtimesDir string) Worker {
 
 func (w *Worker) Update() {
 	w.SetCPUUsage()
+	w.RuntimesVersion = w.Runtimes.Version()
+	w.ReplyLatencyMs = w.Latency.Value().Milliseconds()
 	w.LastUpdated = uint64(time.Now().UnixMilli())
 }
 
@@ -61,33 +72,3 @@ func (w *Worker) SetCPUUsage() {
 
 	w.CPUUsage = totalUsage / float64(len(percent))
 }
-
-func QuerySupportedLanguages(runtimesDir string) ([]model.Language, error) {
-	var languages []model.Language
-
-	if _, err := os.Stat(runtimesDir); os.IsNotExist(err) {
-		return []model.Language{}, errors.New("runtimes directory is not present")
-	}
-
-	entries, err := os.ReadDir(runtimesDir)
-	if err != nil {
-		return []model.Language{}, err
-	}
-
-	for _, entry := range entries {
-		if info, err := entry.Info(); err == nil {
-			if !strings.HasSuffix(info.Name(), ".yaml") {
-				continue
-			}
-		}
-
-		newLang, err := model.NewLanguage(entry, runtimesDir)
-		if err != nil {
-			return []model.Language{}, err
-		}
-
-		languages = append(languages, newLang)
-	}
-
-	return languages, nil
-}
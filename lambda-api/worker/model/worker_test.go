@@ -29,7 +29,7 @@ func TestNewWorker(t *testing.T) {
 			assert.Greater(t, worker.LastUpdated, uint64(0), "The worker should have a valid timestamp")
 			assert.Less(t, worker.LastUpdated, uint64(time.Now().UnixMilli()+1), "The worker should have been created in the past")
 
-			assert.Greater(t, len(worker.Languages), 1, "The worker should have at least one language")
+			assert.Greater(t, len(worker.Runtimes.Languages()), 1, "The worker should have at least one language")
 
 			assert.Greaterf(t, worker.CPUUsage, 0.0, "The CPU usage should be greater than 0.0f")
 		})
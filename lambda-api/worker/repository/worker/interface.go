@@ -8,7 +8,7 @@ import (
 )
 
 type WorkerRepository interface {
-	RegisterWorker(ctx context.Context, id uuid.UUID) model.Worker
+	RegisterWorker(ctx context.Context, id uuid.UUID, runtimesDir string) model.Worker
 
 	Heartbeat(ctx context.Context, worker *model.Worker)
 
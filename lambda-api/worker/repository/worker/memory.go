@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/common/registry"
+	"github.com/google/uuid"
+	"github.com/worker/model"
+)
+
+// MemoryWorkerRepository registers the worker in the process, for the all-in-one mode
+type MemoryWorkerRepository struct {
+	Registry *registry.MemoryWorkerRegistry
+}
+
+func (m *MemoryWorkerRepository) RegisterWorker(_ context.Context, id uuid.UUID, runtimesDir string) model.Worker {
+	worker := model.NewWorker(id, runtimesDir)
+
+	m.publish(&worker)
+
+	return worker
+}
+
+func (m *MemoryWorkerRepository) Heartbeat(_ context.Context, worker *model.Worker) {
+	worker.Update()
+
+	m.publish(worker)
+}
+
+func (m *MemoryWorkerRepository) UnregisterWorker(_ context.Context, worker model.Worker) {
+	m.Registry.Delete(worker.ID.String())
+}
+
+func (m *MemoryWorkerRepository) publish(worker *model.Worker) {
+	data, err := json.Marshal(worker)
+	if err != nil {
+		log.Panicf("Failed to encode the worker: %s", err)
+	}
+
+	m.Registry.Set(worker.ID.String(), data)
+}
@@ -91,3 +91,27 @@ func (rdb *RedisWorkerRepository) UnregisterWorker(ctx context.Context, worker m
 		log.Panicf("Failed to exec the transaction: %s", err)
 	}
 }
+
+// GetWorker reads the last heartbeat of a worker
+func (rdb *RedisWorkerRepository) GetWorker(ctx context.Context, id uuid.UUID) (model.Worker, error) {
+	var worker model.Worker
+
+	value, err := rdb.Client.Get(ctx, fmt.Sprintf("worker:%s", id.String())).Result()
+	if err != nil {
+		return worker, err
+	}
+
+	err = json.Unmarshal([]byte(value), &worker)
+	return worker, err
+}
+
+// RemoveWorker unregisters a worker that died without doing it itself
+func (rdb *RedisWorkerRepository) RemoveWorker(ctx context.Context, id uuid.UUID) error {
+	txn := rdb.Client.TxPipeline()
+
+	txn.Del(ctx, fmt.Sprintf("worker:%s", id.String()))
+	txn.SRem(ctx, "workers", id.String())
+
+	_, err := txn.Exec(ctx)
+	return err
+}
@@ -0,0 +1,67 @@
+package supervisor
+
+import (
+	"runtime"
+	"time"
+)
+
+type Config struct {
+	MinWorkers int
+	MaxWorkers int
+
+	Interval time.Duration // between two scaling decisions
+	Cooldown time.Duration // minimum delay between two changes
+
+	// a worker is added when any target is exceeded, unless the host CPU is saturated
+	TargetQueueDepth int           // tasks waiting per worker
+	TargetLatency    time.Duration // average reply latency
+	MaxCPU           float64       // percent
+
+	// base address of the metrics endpoints, worker n listens on port + n
+	MetricsAddr string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MinWorkers:       1,
+		MaxWorkers:       runtime.NumCPU(),
+		Interval:         15 * time.Second,
+		Cooldown:         30 * time.Second,
+		TargetQueueDepth: 5,
+		TargetLatency:    2 * time.Second,
+		MaxCPU:           85,
+	}
+}
+
+// Signals are the measures a scaling decision is based on
+type Signals struct {
+	Workers      int
+	QueueDepth   int           // tasks waiting in the queues of every worker
+	ReplyLatency time.Duration // the highest average of the workers
+	CPU          float64       // host usage, in percent
+}
+
+// Desired returns the number of workers to run, at most one more or one less than now
+func (c Config) Desired(s Signals) int {
+	desired := s.Workers
+
+	busy := s.QueueDepth > c.TargetQueueDepth*s.Workers || s.ReplyLatency > c.TargetLatency
+	idle := s.QueueDepth == 0 && s.ReplyLatency < c.TargetLatency/2
+
+	switch {
+	case busy && s.CPU < c.MaxCPU:
+		desired++
+	case idle:
+		desired--
+	}
+
+	if desired < c.MinWorkers {
+		desired = c.MinWorkers
+	}
+
+	if desired > c.MaxWorkers {
+		desired = c.MaxWorkers
+	}
+
+	return desired
+}
@@ -0,0 +1,49 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDesired(t *testing.T) {
+	config := Config{
+		MinWorkers:       1,
+		MaxWorkers:       4,
+		TargetQueueDepth: 5,
+		TargetLatency:    2 * time.Second,
+		MaxCPU:           85,
+	}
+
+	var tests = []struct {
+		name    string
+		signals Signals
+		want    int
+	}{
+		{"steady", Signals{Workers: 2, QueueDepth: 4, ReplyLatency: 1500 * time.Millisecond, CPU: 50}, 2},
+		{"deep queues", Signals{Workers: 2, QueueDepth: 11, ReplyLatency: time.Second, CPU: 50}, 3},
+		{"slow replies", Signals{Workers: 2, QueueDepth: 1, ReplyLatency: 3 * time.Second, CPU: 50}, 3},
+		{"saturated host", Signals{Workers: 2, QueueDepth: 50, ReplyLatency: 3 * time.Second, CPU: 95}, 2},
+		{"idle", Signals{Workers: 3, QueueDepth: 0, ReplyLatency: 0, CPU: 5}, 2},
+		{"at the maximum", Signals{Workers: 4, QueueDepth: 50, CPU: 50}, 4},
+		{"at the minimum", Signals{Workers: 1, CPU: 5}, 1},
+		{"below the minimum", Signals{Workers: 0, CPU: 95}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.Desired(tt.signals); got != tt.want {
+				t.Errorf("Desired(%+v) = %d, want %d", tt.signals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChildMetricsAddr(t *testing.T) {
+	if addr := childMetricsAddr("0.0.0.0:9100", 2); addr != "0.0.0.0:9102" {
+		t.Errorf("Bad metrics address: %s", addr)
+	}
+
+	if addr := childMetricsAddr("", 2); addr != "" {
+		t.Errorf("Expected the metrics to stay disabled, got %s", addr)
+	}
+}
@@ -0,0 +1,411 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/shirou/gopsutil/cpu"
+
+	"github.com/common/broker"
+	common "github.com/common/model"
+	"github.com/worker/repository/worker"
+)
+
+/*
+The supervisor runs the workers of a host as child processes of the same binary,
+and scales their number between the configured bounds. Every child keeps its
+id for its whole life, so a crashed child is restarted on the same queues and
+registers again once its stale entry is removed.
+*/
+
+const (
+	maxRestartDelay = 30 * time.Second
+	stableAfter     = time.Minute // a child running this long is not crash looping
+	stopTimeout     = 15 * time.Second
+)
+
+type Supervisor struct {
+	config Config
+	broker broker.MessageBroker
+	repo   worker.RedisWorkerRepository
+
+	mu         sync.Mutex
+	children   map[uuid.UUID]*child
+	lastScaled time.Time
+	wg         sync.WaitGroup
+}
+
+type child struct {
+	id       uuid.UUID
+	slot     int // metrics port offset
+	cmd      *exec.Cmd
+	started  time.Time
+	restarts int
+
+	retiring   bool // stopped on purpose, not restarted
+	draining   bool // retired on a scale down, its queues are requeued when it exits
+	restarting bool // waiting to be restarted after a crash
+}
+
+func New(config Config, broker broker.MessageBroker, rdb *redis.Client) *Supervisor {
+	return &Supervisor{
+		config:   config,
+		broker:   broker,
+		repo:     worker.RedisWorkerRepository{Client: rdb},
+		children: make(map[uuid.UUID]*child),
+	}
+}
+
+func (s *Supervisor) Run(ctx context.Context) error {
+	log.Printf("Supervising %d to %d workers", s.config.MinWorkers, s.config.MaxWorkers)
+
+	s.mu.Lock()
+	for i := 0; i < s.config.MinWorkers; i++ {
+		if err := s.spawn(ctx, &child{id: uuid.New(), slot: s.freeSlot()}); err != nil {
+			s.mu.Unlock()
+			s.stopAll()
+			return err
+		}
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.stopAll()
+			return nil
+		case <-ticker.C:
+			s.scale(ctx)
+		}
+	}
+}
+
+func (s *Supervisor) scale(ctx context.Context) {
+	signals, depths := s.collect(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	desired := s.config.Desired(signals)
+	if desired == signals.Workers || time.Since(s.lastScaled) < s.config.Cooldown {
+		return
+	}
+
+	log.Printf("Scaling from %d to %d workers: %d tasks waiting, %s reply latency, %.1f%% CPU",
+		signals.Workers, desired, signals.QueueDepth, signals.ReplyLatency, signals.CPU)
+
+	s.lastScaled = time.Now()
+
+	if desired > signals.Workers {
+		if err := s.spawn(ctx, &child{id: uuid.New(), slot: s.freeSlot()}); err != nil {
+			log.Printf("Failed to start a worker: %s", err)
+		}
+		return
+	}
+
+	// retire the child with the fewest tasks waiting, its queues are moved to the others once it exits
+	var idlest *child
+	for _, c := range s.children {
+		if c.active() && (idlest == nil || depths[c.id] < depths[idlest.id]) {
+			idlest = c
+		}
+	}
+
+	if idlest != nil {
+		s.retire(idlest)
+	}
+}
+
+// retire stops routing tasks to a child and asks it to stop, the caller must hold the lock.
+// The child stops pulling and finishes its tasks in flight, the tasks left in its queues
+// are requeued when it exits.
+func (s *Supervisor) retire(c *child) {
+	// the heartbeats of the child don't add it back to the set the entry chooses from
+	if err := s.repo.RemoveWorker(context.Background(), c.id); err != nil {
+		log.Printf("Failed to unregister worker %s: %s", c.id, err)
+	}
+
+	c.draining = true
+	s.stop(c)
+}
+
+// requeue moves the tasks left in the queues of a retired child to the active children,
+// the caller must hold the lock
+func (s *Supervisor) requeue(c *child) {
+	var targets []*child
+	for _, other := range s.children {
+		if other.active() {
+			targets = append(targets, other)
+		}
+	}
+
+	// no worker left to take them, they wait for a worker to take this id again
+	if len(targets) == 0 {
+		log.Printf("No worker to requeue the tasks of worker %s", c.id)
+		return
+	}
+
+	moved := 0
+
+	for _, priority := range common.Priorities {
+		queue := common.PriorityQueue(c.id.String(), priority)
+
+		for {
+			msg, found, err := s.broker.Get(queue)
+			if err != nil {
+				log.Printf("Failed to drain the %s queue of worker %s: %s", priority, c.id, err)
+				break
+			}
+			if !found {
+				break
+			}
+
+			target := common.PriorityQueue(targets[moved%len(targets)].id.String(), priority)
+
+			if err := s.broker.SendMessageToQueue(target, msg.Body); err != nil {
+				log.Printf("Failed to requeue a task of worker %s: %s", c.id, err)
+				break
+			}
+
+			moved++
+		}
+	}
+
+	if moved > 0 {
+		log.Printf("Requeued %d tasks of worker %s", moved, c.id)
+	}
+}
+
+// collect measures the load of the running children, and their queue depths
+func (s *Supervisor) collect(ctx context.Context) (Signals, map[uuid.UUID]int) {
+	s.mu.Lock()
+	var ids []uuid.UUID
+	restarting := 0
+	for id, c := range s.children {
+		if c.active() {
+			ids = append(ids, id)
+		} else if c.restarting && !c.retiring {
+			restarting++
+		}
+	}
+	s.mu.Unlock()
+
+	// the crashed children will be back, they still count toward the bounds
+	signals := Signals{Workers: len(ids) + restarting}
+	depths := make(map[uuid.UUID]int)
+
+	for _, id := range ids {
+		for _, priority := range common.Priorities {
+			// the queues don't exist until the child is started
+			depth, err := s.broker.QueueDepth(common.PriorityQueue(id.String(), priority))
+			if err == nil {
+				depths[id] += depth
+				signals.QueueDepth += depth
+			}
+		}
+
+		state, err := s.repo.GetWorker(ctx, id)
+		if err != nil {
+			continue
+		}
+
+		latency := time.Duration(state.ReplyLatencyMs) * time.Millisecond
+		if latency > signals.ReplyLatency {
+			signals.ReplyLatency = latency
+		}
+	}
+
+	percent, err := cpu.Percent(time.Second, false)
+	if err == nil && len(percent) > 0 {
+		signals.CPU = percent[0]
+	}
+
+	return signals, depths
+}
+
+// spawn starts a child process, the caller must hold the lock
+func (s *Supervisor) spawn(ctx context.Context, c *child) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executable)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"WORKER_MODE=worker",
+		"WORKER_ID="+c.id.String(),
+		"METRICS_ADDR="+childMetricsAddr(s.config.MetricsAddr, c.slot),
+	)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start worker %s: %w", c.id, err)
+	}
+
+	c.cmd = cmd
+	c.started = time.Now()
+	s.children[c.id] = c
+
+	log.Printf("Started worker %s (pid %d)", c.id, cmd.Process.Pid)
+
+	s.wg.Add(1)
+	go s.monitor(ctx, c)
+
+	return nil
+}
+
+// monitor waits for a child to exit, and restarts it unless it was retired
+func (s *Supervisor) monitor(ctx context.Context, c *child) {
+	defer s.wg.Done()
+
+	err := c.cmd.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.children, c.id)
+
+	if c.retiring {
+		log.Printf("Worker %s stopped", c.id)
+
+		if c.draining {
+			s.requeue(c)
+		}
+		return
+	}
+
+	log.Printf("Worker %s crashed: %v", c.id, err)
+
+	// the child couldn't unregister itself, don't route tasks to it meanwhile
+	if err := s.repo.RemoveWorker(context.Background(), c.id); err != nil {
+		log.Printf("Failed to unregister worker %s: %s", c.id, err)
+	}
+
+	if time.Since(c.started) > stableAfter {
+		c.restarts = 0
+	}
+
+	delay := time.Second << c.restarts
+	if delay > maxRestartDelay {
+		delay = maxRestartDelay
+	} else {
+		c.restarts++
+	}
+
+	// keep the slot while waiting, so the restarted child gets the same port
+	s.children[c.id] = c
+	c.restarting = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		c.restarting = false
+		if c.retiring || ctx.Err() != nil {
+			delete(s.children, c.id)
+			return
+		}
+
+		if err := s.spawn(ctx, c); err != nil {
+			delete(s.children, c.id)
+			log.Printf("Failed to restart worker %s: %s", c.id, err)
+		}
+	}()
+}
+
+// stop asks a child to shut down gracefully, it unregisters itself
+func (s *Supervisor) stop(c *child) {
+	c.retiring = true
+
+	if c.restarting {
+		return
+	}
+
+	err := c.cmd.Process.Signal(os.Interrupt)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		log.Printf("Failed to stop worker %s: %s", c.id, err)
+	}
+}
+
+func (s *Supervisor) stopAll() {
+	s.mu.Lock()
+	for _, c := range s.children {
+		s.stop(c)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		log.Printf("Workers still running after %s, killing them", stopTimeout)
+
+		s.mu.Lock()
+		for _, c := range s.children {
+			_ = c.cmd.Process.Kill()
+		}
+		s.mu.Unlock()
+
+		<-done
+	}
+}
+
+func (s *Supervisor) freeSlot() int {
+	used := make(map[int]bool)
+	for _, c := range s.children {
+		used[c.slot] = true
+	}
+
+	slot := 0
+	for used[slot] {
+		slot++
+	}
+
+	return slot
+}
+
+// childMetricsAddr gives every child its own port, an empty address disables the metrics
+func childMetricsAddr(base string, slot int) string {
+	host, port, err := net.SplitHostPort(base)
+	if err != nil {
+		return ""
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return ""
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(number+slot))
+}
+
+func (c *child) active() bool {
+	return !c.retiring && !c.restarting
+}
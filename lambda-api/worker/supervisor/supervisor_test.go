@@ -0,0 +1,57 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/common/broker"
+	common "github.com/common/model"
+)
+
+func TestRequeueRetiredChild(t *testing.T) {
+	b := broker.NewMemoryMessageBroker()
+
+	retired := &child{id: uuid.New(), retiring: true, draining: true}
+	first := &child{id: uuid.New()}
+	second := &child{id: uuid.New()}
+
+	s := &Supervisor{
+		broker: b,
+		children: map[uuid.UUID]*child{
+			first.id:  first,
+			second.id: second,
+			// a crashed child waiting for its restart doesn't take tasks
+			uuid.New(): {restarting: true},
+		},
+	}
+
+	for i := 0; i < 4; i++ {
+		_ = b.SendMessageToQueue(common.PriorityQueue(retired.id.String(), common.PriorityHigh), "high")
+	}
+	_ = b.SendMessageToQueue(common.PriorityQueue(retired.id.String(), common.PriorityLow), "low")
+
+	s.requeue(retired)
+
+	for _, priority := range common.Priorities {
+		if depth, _ := b.QueueDepth(common.PriorityQueue(retired.id.String(), priority)); depth != 0 {
+			t.Errorf("Expected the %s queue of the retired worker to be drained, %d tasks left", priority, depth)
+		}
+	}
+
+	// the tasks keep their lane and are spread over the active workers
+	for _, c := range []*child{first, second} {
+		if depth, _ := b.QueueDepth(common.PriorityQueue(c.id.String(), common.PriorityHigh)); depth != 2 {
+			t.Errorf("Expected 2 high priority tasks on worker %s, got %d", c.id, depth)
+		}
+	}
+
+	low := 0
+	for _, c := range []*child{first, second} {
+		depth, _ := b.QueueDepth(common.PriorityQueue(c.id.String(), common.PriorityLow))
+		low += depth
+	}
+	if low != 1 {
+		t.Errorf("Expected the low priority task to be requeued once, got %d", low)
+	}
+}
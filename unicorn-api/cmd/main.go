@@ -21,16 +21,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"unicorn-api/internal/config"
+	"unicorn-api/internal/containers"
 	"unicorn-api/internal/handlers"
 	"unicorn-api/internal/middleware"
 	"unicorn-api/internal/routes"
 	"unicorn-api/internal/services"
 	"unicorn-api/internal/stores"
+	"unicorn-api/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -46,8 +54,12 @@ var (
 	BuildTime = "unknown"
 )
 
-// setupServices initializes all services and handlers
-func setupServices(cfg *config.Config) (*handlers.IAMHandler, *handlers.StorageHandler, *handlers.ComputeHandler, *handlers.LambdaHandler, *handlers.SecretsHandler, *handlers.RDBHandler, *handlers.MonitoringHandler) {
+// how long the requests in progress may take to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// setupServices initializes all services and handlers, the returned function stops the
+// background services
+func setupServices(cfg *config.Config) (routes.Handlers, func()) {
 	// Get database path from environment or use default
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
@@ -94,19 +106,98 @@ func setupServices(cfg *config.Config) (*handlers.IAMHandler, *handlers.StorageH
 		log.Fatal("Failed to initialize monitoring store:", err)
 	}
 
+	// Setup function store
+	functionStore, err := stores.NewGORMFunctionStore(dbPath)
+	if err != nil {
+		log.Fatal("Failed to initialize function store:", err)
+	}
+
+	// Setup storage event store
+	storageEventStore, err := stores.NewGORMStorageEventStore(dbPath)
+	if err != nil {
+		log.Fatal("Failed to initialize storage event store:", err)
+	}
+
+	// Setup workflow store
+	workflowStore, err := stores.NewGORMWorkflowStore(dbPath)
+	if err != nil {
+		log.Fatal("Failed to initialize workflow store:", err)
+	}
+
+	// Setup compute store
+	computeStore, err := stores.NewGORMComputeStore(dbPath)
+	if err != nil {
+		log.Fatal("Failed to initialize compute store:", err)
+	}
+
+	// Setup schedule store
+	scheduleStore, err := stores.NewGORMScheduleStore(dbPath)
+	if err != nil {
+		log.Fatal("Failed to initialize schedule store:", err)
+	}
+
+	// Setup container runtime, shared by the compute and RDB services
+	runtime, err := containers.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize container runtime:", err)
+	}
+
 	// Create monitoring service
 	monitoringService := services.NewMonitoringService(monitoringStore, iamStore)
+	monitoringService.LambdaBillingGranularity = cfg.LambdaBillingGranularity
+
+	// The compute containers are reconciled with their inventory in the background
+	computeService := services.NewComputeService(runtime, computeStore, iamStore)
+	computeReconciler := services.NewComputeReconciler(cfg, computeService, monitoringService)
 
 	// Create handlers
 	iamHandler := handlers.NewIAMHandler(iamStore, cfg)
 	secretsHandler := handlers.NewSecretsHandler(secretsStore, iamStore, cfg)
 	storageHandler := handlers.NewStorageHandler(storageStore, iamStore, cfg)
-	computeHandler := handlers.NewComputeHandler(cfg, iamStore, monitoringService)
-	lambdaHandler := handlers.NewLambdaHandler(cfg, iamStore)
-	rdbHandler := handlers.NewRDBHandler(cfg, iamStore)
+	computeHandler := handlers.NewComputeHandler(cfg, iamStore, monitoringService, computeService)
+
+	// The function store also holds the layers and the concurrency limits
+	functionService := services.NewFunctionService(cfg, functionStore, functionStore, functionStore)
+	lambdaHandler := handlers.NewLambdaHandler(cfg, iamStore, monitoringService, functionService)
+	functionHandler := handlers.NewFunctionHandler(cfg, iamStore, functionService, lambdaHandler)
+
+	// The files created and deleted invoke the functions of the bucket notifications
+	storageEventService := services.NewStorageEventService(cfg, storageEventStore, functionService, iamStore, lambdaHandler)
+	storageStore.SetEventSink(storageEventService)
+	storageEventHandler := handlers.NewStorageEventHandler(cfg, iamStore, storageStore, storageEventService)
+
+	// The workflows run their state machines in the background
+	workflowService := services.NewWorkflowService(cfg, workflowStore, functionService, iamStore, lambdaHandler)
+	workflowHandler := handlers.NewWorkflowHandler(cfg, iamStore, workflowService)
+
+	// The schedules invoke functions and start or stop containers at their occurrences, they
+	// follow the containers recreated by an update
+	scheduleService := services.NewScheduleService(cfg, scheduleStore, functionService, iamStore, lambdaHandler, computeHandler)
+	computeService.SetReplacementSink(scheduleService)
+	scheduleHandler := handlers.NewScheduleHandler(cfg, iamStore, scheduleService)
+	rdbHandler := handlers.NewRDBHandler(cfg, iamStore, services.NewRDBService(runtime))
 	monitoringHandler := handlers.NewMonitoringHandler(cfg, iamStore, monitoringStore)
 
-	return iamHandler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler
+	closeServices := func() {
+		storageEventService.Close()
+		workflowService.Close()
+		scheduleService.Close()
+		computeReconciler.Close()
+	}
+
+	return routes.Handlers{
+		IAM:          iamHandler,
+		Storage:      storageHandler,
+		StorageEvent: storageEventHandler,
+		Compute:      computeHandler,
+		Lambda:       lambdaHandler,
+		Function:     functionHandler,
+		Workflow:     workflowHandler,
+		Schedule:     scheduleHandler,
+		Secrets:      secretsHandler,
+		RDB:          rdbHandler,
+		Monitoring:   monitoringHandler,
+	}, closeServices
 }
 
 func main() {
@@ -120,6 +211,13 @@ func main() {
 	// Initialize configuration
 	cfg := config.New()
 
+	// Setup tracing, spans are propagated to the Lambda API
+	shutdownTracing, err := tracing.Setup(context.Background(), "unicorn-api", cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatal("Failed to setup tracing:", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Set Gin mode
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -134,11 +232,11 @@ func main() {
 	router.Use(middleware.CORS())
 
 	// Setup services
-	iamHandler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler := setupServices(cfg)
+	h, closeServices := setupServices(cfg)
 
 	// Setup routes
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	routes.SetupRoutes(router, iamHandler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler, cfg)
+	routes.SetupRoutes(router, h, cfg)
 	router.GET("/health", handlers.HealthCheck)
 
 	// Get port from environment or use default
@@ -152,8 +250,25 @@ func main() {
 	log.Printf("Environment: %s", cfg.Environment)
 	log.Printf("Swagger UI available at: http://localhost:%s/swagger/index.html", port)
 
-	// Start server
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Start server, until it is interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down Unicorn API...")
+
+	// the requests in progress finish before the background services stop
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down the server gracefully: %v", err)
 	}
+	closeServices()
 }
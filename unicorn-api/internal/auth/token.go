@@ -10,10 +10,15 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ScopeInvoke is the scope of the tokens only running functions on the Lambda API.
+const ScopeInvoke = "lambda:invoke"
+
 // claims represents the claims in our JWT token.
 type Claims struct {
 	AccountID string `json:"account_id"`
 	RoleID    string `json:"role_id"`
+	// Scope restricts the token, the tokens of the API have none
+	Scope string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -38,8 +43,43 @@ func GenerateToken(accountID, roleID string, cfg *config.Config) (string, error)
 	return tokenString, nil
 }
 
-// parses and validates a JWT token.
+// creates a token running functions on behalf of an account for the given time, it holds
+// no role and the API rejects it.
+func GenerateInvocationToken(accountID string, lifetime time.Duration, cfg *config.Config) (string, error) {
+	claims := &Claims{
+		AccountID: accountID,
+		Scope:     ScopeInvoke,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+// parses and validates a JWT token of the API, the scoped tokens are rejected.
 func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
+	claims, err := ValidateInvocationToken(tokenString, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Scope != "" {
+		return nil, models.ErrTokenInvalid
+	}
+
+	return claims, nil
+}
+
+// parses and validates a token allowed to run functions, a token of the API or an invocation token.
+func ValidateInvocationToken(tokenString string, cfg *config.Config) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -50,6 +50,9 @@ const (
 	ErrCodeBadRequest          = "BAD_REQUEST"
 	ErrCodeConflict            = "CONFLICT"
 	ErrCodeUnprocessableEntity = "UNPROCESSABLE_ENTITY"
+	ErrCodePayloadTooLarge     = "PAYLOAD_TOO_LARGE"
+	ErrCodeTooManyRequests     = "TOO_MANY_REQUESTS"
+	ErrCodeBadGateway          = "BAD_GATEWAY"
 )
 
 // Common errors
@@ -65,6 +68,9 @@ var (
 	ErrBadRequest          = New(ErrCodeBadRequest, "Bad request", http.StatusBadRequest)
 	ErrConflict            = New(ErrCodeConflict, "Conflict", http.StatusConflict)
 	ErrUnprocessableEntity = New(ErrCodeUnprocessableEntity, "Unprocessable entity", http.StatusUnprocessableEntity)
+	ErrPayloadTooLarge     = New(ErrCodePayloadTooLarge, "Payload too large", http.StatusRequestEntityTooLarge)
+	ErrTooManyRequests     = New(ErrCodeTooManyRequests, "Too many requests", http.StatusTooManyRequests)
+	ErrBadGateway          = New(ErrCodeBadGateway, "Bad gateway", http.StatusBadGateway)
 )
 
 // RespondWithError sends a standardized error response
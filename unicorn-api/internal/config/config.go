@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -19,6 +20,38 @@ type Config struct {
 
 	// Service URLs
 	LambdaURL string
+
+	// Lambda API client: the timeout of a request, the retries of the requests answered 503,
+	// and the consecutive failures opening the circuit breaker for its cooldown
+	LambdaTimeout          time.Duration
+	LambdaMaxRetries       int
+	LambdaBreakerThreshold int
+	LambdaBreakerCooldown  time.Duration
+
+	// Unit the execution time of the lambda invocations is billed in
+	LambdaBillingGranularity time.Duration
+
+	// Function invocations an organization can run at once unless set otherwise, the most the
+	// admins can set for one, and how long an invocation waits for capacity before it is throttled
+	LambdaOrgConcurrency    int
+	LambdaOrgConcurrencyMax int
+	LambdaConcurrencyWait   time.Duration
+
+	// How often the scheduler looks for the due schedules, and how long a replica holds the
+	// scheduler lease without renewing it
+	SchedulerInterval      time.Duration
+	SchedulerLeaseDuration time.Duration
+
+	// Runtime of the compute and RDB containers, docker or fake, and the Docker daemon it uses,
+	// empty for the DOCKER_HOST environment variable or the default socket
+	ContainerRuntime string
+	DockerHost       string
+
+	// How often the compute containers are compared with their inventory to detect drift
+	ComputeReconcileInterval time.Duration
+
+	// OTLP collector endpoint for traces, empty disables exporting
+	OTLPEndpoint string
 }
 
 // New creates a new Config instance
@@ -32,7 +65,28 @@ func New() *Config {
 		JWTSecret:       getEnv("JWTSecret", "lmao"),
 
 		// Service URLs
-		LambdaURL: getEnv("LAMBDA_URL", "http://localhost:8081"),
+		LambdaURL: getEnv("LAMBDA_URL", "http://localhost:6900"),
+
+		LambdaTimeout:          getDurationEnv("LAMBDA_TIMEOUT", 60*time.Second),
+		LambdaMaxRetries:       getIntEnv("LAMBDA_MAX_RETRIES", 2),
+		LambdaBreakerThreshold: getIntEnv("LAMBDA_BREAKER_THRESHOLD", 5),
+		LambdaBreakerCooldown:  getDurationEnv("LAMBDA_BREAKER_COOLDOWN", 30*time.Second),
+
+		LambdaBillingGranularity: getDurationEnv("LAMBDA_BILLING_GRANULARITY", 100*time.Millisecond),
+
+		LambdaOrgConcurrency:    getIntEnv("LAMBDA_ORG_CONCURRENCY", 100),
+		LambdaOrgConcurrencyMax: getIntEnv("LAMBDA_ORG_CONCURRENCY_MAX", 1000),
+		LambdaConcurrencyWait:   getDurationEnv("LAMBDA_CONCURRENCY_WAIT", 0),
+
+		SchedulerInterval:      getDurationEnv("SCHEDULER_INTERVAL", 10*time.Second),
+		SchedulerLeaseDuration: getDurationEnv("SCHEDULER_LEASE_DURATION", 30*time.Second),
+
+		ContainerRuntime: getEnv("CONTAINER_RUNTIME", "docker"),
+		DockerHost:       getEnv("DOCKER_HOST", ""),
+
+		ComputeReconcileInterval: getDurationEnv("COMPUTE_RECONCILE_INTERVAL", 30*time.Second),
+
+		OTLPEndpoint: getEnv("OTLP_ENDPOINT", ""),
 	}
 }
 
@@ -43,3 +97,19 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getIntEnv gets an integer environment variable or returns a default value
+func getIntEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// getDurationEnv gets a duration environment variable or returns a default value
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
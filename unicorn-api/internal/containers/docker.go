@@ -0,0 +1,219 @@
+package containers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+)
+
+// Docker runs the containers on a Docker daemon
+type Docker struct {
+	client *client.Client
+}
+
+// NewDocker creates a runtime on the Docker daemon at host, like unix:///var/run/docker.sock.
+// An empty host uses the DOCKER_HOST environment variable, or the default socket.
+func NewDocker(host string) (*Docker, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	return &Docker{client: cli}, nil
+}
+
+// Close closes the connections to the daemon
+func (d *Docker) Close() error {
+	return d.client.Close()
+}
+
+// PullImage pulls an image, waiting for the pull to end
+func (d *Docker) PullImage(ctx context.Context, image string) error {
+	progress, err := d.client.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer progress.Close()
+
+	// the pull goes on while its progress is read
+	_, err = io.Copy(io.Discard, progress)
+	return err
+}
+
+// CreateContainer creates a container
+func (d *Docker) CreateContainer(ctx context.Context, spec ContainerSpec) (string, error) {
+	exposedPorts := nat.PortSet{}
+	portBindings := nat.PortMap{}
+	for _, binding := range spec.Ports {
+		port, err := nat.NewPort(protocol(binding), binding.ContainerPort)
+		if err != nil {
+			return "", err
+		}
+		exposedPorts[port] = struct{}{}
+		portBindings[port] = append(portBindings[port], nat.PortBinding{HostPort: binding.HostPort})
+	}
+
+	var mounts []mount.Mount
+	for _, volume := range spec.Volumes {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: volume.Name,
+			Target: volume.Target,
+		})
+	}
+
+	resp, err := d.client.ContainerCreate(ctx, &container.Config{
+		Image:        spec.Image,
+		Cmd:          spec.Command,
+		Env:          spec.Env,
+		ExposedPorts: exposedPorts,
+		Labels:       spec.Labels,
+	}, &container.HostConfig{
+		PortBindings: portBindings,
+		Resources:    container.Resources{NanoCPUs: spec.NanoCPUs, Memory: spec.Memory},
+		Mounts:       mounts,
+	}, nil, nil, spec.Name)
+	if errdefs.IsConflict(err) {
+		return "", fmt.Errorf("%w: %s", ErrNameConflict, spec.Name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// StartContainer starts a container
+func (d *Docker) StartContainer(ctx context.Context, id string) error {
+	return d.notFound(d.client.ContainerStart(ctx, id, container.StartOptions{}))
+}
+
+// StopContainer stops a container
+func (d *Docker) StopContainer(ctx context.Context, id string) error {
+	return d.notFound(d.client.ContainerStop(ctx, id, container.StopOptions{}))
+}
+
+// RemoveContainer removes a container
+func (d *Docker) RemoveContainer(ctx context.Context, id string) error {
+	return d.notFound(d.client.ContainerRemove(ctx, id, container.RemoveOptions{}))
+}
+
+// InspectContainer returns a container
+func (d *Docker) InspectContainer(ctx context.Context, id string) (*Container, error) {
+	info, err := d.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, d.notFound(err)
+	}
+
+	c := &Container{
+		ID:     info.ID,
+		Name:   strings.TrimPrefix(info.Name, "/"),
+		Labels: map[string]string{},
+	}
+	if info.Config != nil {
+		c.Image = info.Config.Image
+		c.Command = info.Config.Cmd
+		c.Env = info.Config.Env
+		c.Labels = info.Config.Labels
+	}
+	if info.State != nil {
+		c.State = ContainerState(info.State.Status)
+		c.Status = info.State.Status
+	}
+	if info.HostConfig != nil {
+		c.NanoCPUs = info.HostConfig.NanoCPUs
+		c.Memory = info.HostConfig.Memory
+
+		// the bindings are configured on the host, the network settings only have the ports
+		// of a running container, with the host ports the daemon chose
+		for port, bindings := range info.HostConfig.PortBindings {
+			for i, binding := range bindings {
+				hostPort := binding.HostPort
+				if hostPort == "" && info.NetworkSettings != nil && len(info.NetworkSettings.Ports[port]) > i {
+					hostPort = info.NetworkSettings.Ports[port][i].HostPort
+				}
+				c.Ports = append(c.Ports, PortBinding{ContainerPort: port.Port(), Protocol: port.Proto(), HostPort: hostPort})
+			}
+		}
+	}
+	for _, m := range info.Mounts {
+		if m.Type == mount.TypeVolume {
+			c.Volumes = append(c.Volumes, VolumeMount{Name: m.Name, Target: m.Destination})
+		}
+	}
+	c.CreatedAt, _ = time.Parse(time.RFC3339Nano, info.Created)
+
+	return c, nil
+}
+
+// ListContainers returns the containers having all the labels
+func (d *Docker) ListContainers(ctx context.Context, labels map[string]string) ([]Container, error) {
+	filter := filters.NewArgs()
+	for key, value := range labels {
+		filter.Add("label", key+"="+value)
+	}
+
+	list, err := d.client.ContainerList(ctx, container.ListOptions{All: true, Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Container, 0, len(list))
+	for _, ctr := range list {
+		c := Container{
+			ID:        ctr.ID,
+			Image:     ctr.Image,
+			Labels:    ctr.Labels,
+			State:     ContainerState(ctr.State),
+			Status:    ctr.Status,
+			CreatedAt: time.Unix(ctr.Created, 0),
+		}
+		if len(ctr.Names) > 0 {
+			c.Name = strings.TrimPrefix(ctr.Names[0], "/")
+		}
+		for _, p := range ctr.Ports {
+			if p.PublicPort != 0 {
+				c.Ports = append(c.Ports, PortBinding{
+					ContainerPort: fmt.Sprintf("%d", p.PrivatePort),
+					Protocol:      p.Type,
+					HostPort:      fmt.Sprintf("%d", p.PublicPort),
+				})
+			}
+		}
+		for _, m := range ctr.Mounts {
+			if m.Type == mount.TypeVolume {
+				c.Volumes = append(c.Volumes, VolumeMount{Name: m.Name, Target: m.Destination})
+			}
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// notFound maps the errors of the containers missing from the daemon to ErrContainerNotFound
+func (d *Docker) notFound(err error) error {
+	if errdefs.IsNotFound(err) {
+		return fmt.Errorf("%w: %v", ErrContainerNotFound, err)
+	}
+	return err
+}
+
+func protocol(binding PortBinding) string {
+	if binding.Protocol == "" {
+		return "tcp"
+	}
+	return binding.Protocol
+}
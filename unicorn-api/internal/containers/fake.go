@@ -0,0 +1,308 @@
+package containers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fakeFirstHostPort is the first host port allocated to the bindings without one
+const fakeFirstHostPort = 10000
+
+// Fake runs the containers in memory, for the tests and the development without Docker.
+// It keeps the state, labels, ports and volumes of the containers, nothing runs.
+type Fake struct {
+	mu         sync.Mutex
+	containers map[string]*Container
+	names      map[string]string
+	images     map[string]bool
+	// volumes maps the volumes to the containers which mounted them last
+	volumes  map[string]string
+	nextPort int
+}
+
+// NewFake creates an empty in-memory runtime
+func NewFake() *Fake {
+	return &Fake{
+		containers: map[string]*Container{},
+		names:      map[string]string{},
+		images:     map[string]bool{},
+		volumes:    map[string]string{},
+		nextPort:   fakeFirstHostPort,
+	}
+}
+
+// PullImage records the image as pulled
+func (f *Fake) PullImage(ctx context.Context, image string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[image] = true
+	return nil
+}
+
+// CreateContainer creates a container, allocating the host ports left empty
+func (f *Fake) CreateContainer(ctx context.Context, spec ContainerSpec) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.images[spec.Image] {
+		return "", fmt.Errorf("no such image: %s", spec.Image)
+	}
+
+	id := randomID()
+	name := spec.Name
+	if name == "" {
+		name = id[:12]
+	}
+	if _, ok := f.names[name]; ok {
+		return "", fmt.Errorf("%w: %s", ErrNameConflict, name)
+	}
+
+	c := &Container{
+		ID:        id,
+		Name:      name,
+		Image:     spec.Image,
+		Command:   append([]string(nil), spec.Command...),
+		Env:       append([]string(nil), spec.Env...),
+		Labels:    map[string]string{},
+		Volumes:   append([]VolumeMount(nil), spec.Volumes...),
+		State:     StateCreated,
+		Status:    "Created",
+		NanoCPUs:  spec.NanoCPUs,
+		Memory:    spec.Memory,
+		CreatedAt: time.Now(),
+	}
+	for key, value := range spec.Labels {
+		c.Labels[key] = value
+	}
+	for _, binding := range spec.Ports {
+		binding.Protocol = protocol(binding)
+		if binding.HostPort == "" {
+			binding.HostPort = strconv.Itoa(f.nextPort)
+			f.nextPort++
+		}
+		c.Ports = append(c.Ports, binding)
+	}
+	for _, volume := range spec.Volumes {
+		f.volumes[volume.Name] = id
+	}
+
+	f.containers[id] = c
+	f.names[name] = id
+	return id, nil
+}
+
+// StartContainer starts a container, it fails when another running container holds one of its host ports
+func (f *Fake) StartContainer(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	if c.Running() {
+		return nil
+	}
+
+	for _, other := range f.containers {
+		if other.ID == c.ID || !other.Running() {
+			continue
+		}
+		for _, binding := range c.Ports {
+			for _, taken := range other.Ports {
+				if binding.HostPort == taken.HostPort && binding.Protocol == taken.Protocol {
+					return fmt.Errorf("%w: %s/%s", ErrPortAllocated, binding.HostPort, binding.Protocol)
+				}
+			}
+		}
+	}
+
+	c.State = StateRunning
+	c.Status = "Up"
+	return nil
+}
+
+// StopContainer stops a container
+func (f *Fake) StopContainer(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	if c.Running() {
+		c.State = StateExited
+		c.Status = "Exited (0)"
+	}
+	return nil
+}
+
+// RemoveContainer removes a stopped container
+func (f *Fake) RemoveContainer(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	if c.Running() {
+		return fmt.Errorf("cannot remove running container %s, stop it first", c.Name)
+	}
+
+	delete(f.containers, c.ID)
+	delete(f.names, c.Name)
+	return nil
+}
+
+// InspectContainer returns a copy of a container
+func (f *Fake) InspectContainer(ctx context.Context, id string) (*Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := c.copy()
+	return &copied, nil
+}
+
+// ListContainers returns copies of the containers having all the labels, the oldest first
+func (f *Fake) ListContainers(ctx context.Context, labels map[string]string) ([]Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []Container{}
+	for _, c := range f.containers {
+		if hasLabels(c, labels) {
+			result = append(result, c.copy())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// AlterContainer changes a container in place, the way an operator would outside the API
+func (f *Fake) AlterContainer(id string, alter func(c *Container)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	alter(c)
+	return nil
+}
+
+// Images returns the pulled images
+func (f *Fake) Images() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	images := make([]string, 0, len(f.images))
+	for image := range f.images {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// Volumes returns the volumes, including the ones of the removed containers
+func (f *Fake) Volumes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	volumes := make([]string, 0, len(f.volumes))
+	for volume := range f.volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Strings(volumes)
+	return volumes
+}
+
+// lookup finds a container by ID, ID prefix or name
+func (f *Fake) lookup(id string) (*Container, error) {
+	if c, ok := f.containers[id]; ok {
+		return c, nil
+	}
+	if full, ok := f.names[id]; ok {
+		return f.containers[full], nil
+	}
+	if len(id) >= 12 {
+		for full, c := range f.containers {
+			if full[:len(id)] == id {
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, id)
+}
+
+func (c *Container) copy() Container {
+	copied := *c
+	copied.Command = append([]string(nil), c.Command...)
+	copied.Env = append([]string(nil), c.Env...)
+	copied.Ports = append([]PortBinding(nil), c.Ports...)
+	copied.Volumes = append([]VolumeMount(nil), c.Volumes...)
+	copied.Labels = make(map[string]string, len(c.Labels))
+	for key, value := range c.Labels {
+		copied.Labels[key] = value
+	}
+	return copied
+}
+
+func hasLabels(c *Container, labels map[string]string) bool {
+	for key, value := range labels {
+		if c.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func randomID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,88 @@
+package containers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeContainerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewFake()
+
+	spec := ContainerSpec{
+		Name:    "web",
+		Image:   "nginx:alpine",
+		Labels:  map[string]string{"owner": "alice"},
+		Ports:   []PortBinding{{ContainerPort: "80", HostPort: "8080"}, {ContainerPort: "443"}},
+		Volumes: []VolumeMount{{Name: "web-data", Target: "/data"}},
+	}
+	_, err := runtime.CreateContainer(ctx, spec)
+	assert.Error(t, err, "the image isn't pulled")
+
+	require.NoError(t, runtime.PullImage(ctx, "nginx:alpine"))
+	id, err := runtime.CreateContainer(ctx, spec)
+	require.NoError(t, err)
+
+	_, err = runtime.CreateContainer(ctx, spec)
+	assert.ErrorIs(t, err, ErrNameConflict)
+
+	c, err := runtime.InspectContainer(ctx, "web")
+	require.NoError(t, err)
+	assert.Equal(t, id, c.ID)
+	assert.Equal(t, StateCreated, c.State)
+	assert.Equal(t, []PortBinding{
+		{ContainerPort: "80", Protocol: "tcp", HostPort: "8080"},
+		{ContainerPort: "443", Protocol: "tcp", HostPort: "10000"},
+	}, c.Ports, "the empty host ports are allocated")
+
+	require.NoError(t, runtime.StartContainer(ctx, id))
+	c, err = runtime.InspectContainer(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, c.Running())
+
+	assert.Error(t, runtime.RemoveContainer(ctx, id), "a running container isn't removed")
+
+	// a second container publishing the same host port doesn't start
+	other, err := runtime.CreateContainer(ctx, ContainerSpec{
+		Name:  "web-2",
+		Image: "nginx:alpine",
+		Ports: []PortBinding{{ContainerPort: "80", HostPort: "8080"}},
+	})
+	require.NoError(t, err)
+	assert.ErrorIs(t, runtime.StartContainer(ctx, other), ErrPortAllocated)
+
+	list, err := runtime.ListContainers(ctx, map[string]string{"owner": "alice"})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "web", list[0].Name)
+
+	require.NoError(t, runtime.StopContainer(ctx, id))
+	require.NoError(t, runtime.StartContainer(ctx, other), "the host port was released")
+	require.NoError(t, runtime.RemoveContainer(ctx, id))
+
+	_, err = runtime.InspectContainer(ctx, id)
+	assert.ErrorIs(t, err, ErrContainerNotFound)
+	assert.ErrorIs(t, runtime.StartContainer(ctx, id), ErrContainerNotFound)
+	assert.Equal(t, []string{"web-data"}, runtime.Volumes(), "the volumes outlive their containers")
+}
+
+func TestFakeCopiesContainers(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewFake()
+	require.NoError(t, runtime.PullImage(ctx, "busybox"))
+
+	id, err := runtime.CreateContainer(ctx, ContainerSpec{Image: "busybox", Labels: map[string]string{"owner": "bob"}})
+	require.NoError(t, err)
+
+	c, err := runtime.InspectContainer(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, id[:12], c.Name, "the unnamed containers are named after their ID")
+	c.Labels["owner"] = "mallory"
+
+	list, err := runtime.ListContainers(ctx, map[string]string{"owner": "bob"})
+	require.NoError(t, err)
+	assert.Len(t, list, 1, "the containers returned don't change the runtime")
+}
@@ -0,0 +1,116 @@
+// Package containers runs the containers of the compute and RDB services, on Docker or in memory.
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/config"
+)
+
+// Errors returned by the runtimes
+var (
+	ErrContainerNotFound = errors.New("container not found")
+	ErrNameConflict      = errors.New("container name already in use")
+	ErrPortAllocated     = errors.New("host port already allocated")
+)
+
+// Runtime names accepted by New
+const (
+	RuntimeDocker = "docker"
+	RuntimeFake   = "fake"
+)
+
+// ContainerState is the lifecycle state of a container
+type ContainerState string
+
+const (
+	StateCreated ContainerState = "created"
+	StateRunning ContainerState = "running"
+	StateExited  ContainerState = "exited"
+)
+
+// PortBinding publishes a port of a container on a port of the host
+type PortBinding struct {
+	ContainerPort string
+	// tcp unless set
+	Protocol string
+	HostPort string
+}
+
+// VolumeMount mounts a named volume in a container, the volume is created when missing
+// and outlives the container
+type VolumeMount struct {
+	Name   string
+	Target string
+}
+
+// ContainerSpec describes a container to create
+type ContainerSpec struct {
+	Name    string
+	Image   string
+	Command []string
+	Env     []string
+	Labels  map[string]string
+	Ports   []PortBinding
+	Volumes []VolumeMount
+	// NanoCPUs and Memory, in bytes, limit the resources of the container, 0 for no limit
+	NanoCPUs int64
+	Memory   int64
+}
+
+// Container is a container as seen by the runtime
+type Container struct {
+	ID      string
+	Name    string
+	Image   string
+	Command []string
+	Env     []string
+	Labels  map[string]string
+	Ports   []PortBinding
+	Volumes []VolumeMount
+	State   ContainerState
+	// Status describes the state for people, like "Up 5 minutes"
+	Status   string
+	NanoCPUs int64
+	Memory   int64
+	// CreatedAt is zero when the runtime doesn't tell
+	CreatedAt time.Time
+}
+
+// Running reports whether the container runs
+func (c *Container) Running() bool {
+	return c.State == StateRunning
+}
+
+// ContainerRuntime creates and runs containers. The containers are addressed by ID or name.
+type ContainerRuntime interface {
+	// PullImage makes an image available to the containers
+	PullImage(ctx context.Context, image string) error
+	// CreateContainer creates a container without starting it and returns its ID
+	CreateContainer(ctx context.Context, spec ContainerSpec) (string, error)
+	// StartContainer starts a container, it does nothing when it runs
+	StartContainer(ctx context.Context, id string) error
+	// StopContainer stops a container, it does nothing when it doesn't run
+	StopContainer(ctx context.Context, id string) error
+	// RemoveContainer removes a stopped container, its volumes are kept
+	RemoveContainer(ctx context.Context, id string) error
+	// InspectContainer returns a container, or ErrContainerNotFound
+	InspectContainer(ctx context.Context, id string) (*Container, error)
+	// ListContainers returns the containers, running or not, having all the labels
+	ListContainers(ctx context.Context, labels map[string]string) ([]Container, error)
+}
+
+// New creates the container runtime set in the configuration
+func New(cfg *config.Config) (ContainerRuntime, error) {
+	switch cfg.ContainerRuntime {
+	case "", RuntimeDocker:
+		return NewDocker(cfg.DockerHost)
+	case RuntimeFake:
+		return NewFake(), nil
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q", cfg.ContainerRuntime)
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 
@@ -28,9 +27,9 @@ type ComputeHandler struct {
 }
 
 // NewComputeHandler creates a new compute handler
-func NewComputeHandler(cfg *config.Config, iamStore stores.IAMStore, monitoringService *services.MonitoringService) *ComputeHandler {
+func NewComputeHandler(cfg *config.Config, iamStore stores.IAMStore, monitoringService *services.MonitoringService, service *services.ComputeService) *ComputeHandler {
 	return &ComputeHandler{
-		service:           services.NewComputeService(),
+		service:           service,
 		monitoringService: monitoringService,
 		validator:         validation.NewValidator(),
 		config:            cfg,
@@ -110,7 +109,7 @@ func (h *ComputeHandler) CreateCompute(c *gin.Context) {
 		// Get account to get organization ID
 		account, err := h.iamStore.GetAccountByID(claims.AccountID)
 		if err == nil {
-			configuration := fmt.Sprintf(`{"image":"%s","preset":"%s"}`, req.Image, req.Preset)
+			configuration := services.ComputeResourceConfiguration(req.Image, req.Preset)
 			err = h.monitoringService.TrackResourceCreation(
 				userID,
 				account.OrganizationID,
@@ -223,3 +222,305 @@ func (h *ComputeHandler) DeleteCompute(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// GetCompute godoc
+// @Summary Get a compute container
+// @Description Get the configuration and state of a compute container by ID
+// @Tags Compute
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Container ID"
+// @Success 200 {object} models.ComputeContainerDetail
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/compute/{id} [get]
+func (h *ComputeHandler) GetCompute(c *gin.Context) {
+	claims, err := h.getClaims(c)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	if !h.hasPermission(claims, "compute", 0) {
+		errors.RespondWithPermissionError(c, "read compute containers")
+		return
+	}
+
+	userID, err := uuid.Parse(claims.AccountID)
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Invalid user ID in token"))
+		return
+	}
+
+	detail, err := h.service.GetContainer(userID, c.Param("id"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// StartCompute godoc
+// @Summary Start a compute container
+// @Description Start a stopped compute container, billing resumes
+// @Tags Compute
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Container ID"
+// @Success 200 {object} models.ComputeContainerDetail
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/compute/{id}/start [post]
+func (h *ComputeHandler) StartCompute(c *gin.Context) {
+	h.runAction(c, "start compute containers", h.StartContainer)
+}
+
+// StopCompute godoc
+// @Summary Stop a compute container
+// @Description Stop a running compute container, it isn't billed while stopped
+// @Tags Compute
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Container ID"
+// @Success 200 {object} models.ComputeContainerDetail
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/compute/{id}/stop [post]
+func (h *ComputeHandler) StopCompute(c *gin.Context) {
+	h.runAction(c, "stop compute containers", h.StopContainer)
+}
+
+// RestartCompute godoc
+// @Summary Restart a compute container
+// @Description Stop a compute container if it runs and start it
+// @Tags Compute
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Container ID"
+// @Success 200 {object} models.ComputeContainerDetail
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/compute/{id}/restart [post]
+func (h *ComputeHandler) RestartCompute(c *gin.Context) {
+	h.runAction(c, "restart compute containers", func(userID uuid.UUID, containerID string) error {
+		if err := h.service.RestartContainer(userID, containerID); err != nil {
+			return err
+		}
+		h.trackStatus(containerID, models.ResourceStatusActive)
+		return nil
+	})
+}
+
+// UpdateCompute godoc
+// @Summary Update a compute container
+// @Description Change the preset, environment or command of a compute container. The container is recreated with the same name and ports and gets a new ID.
+// @Tags Compute
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Container ID"
+// @Param request body models.ComputeUpdateRequest true "Compute container update request"
+// @Success 200 {object} models.ComputeContainerDetail
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/compute/{id} [put]
+func (h *ComputeHandler) UpdateCompute(c *gin.Context) {
+	claims, err := h.getClaims(c)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	if !h.hasPermission(claims, "compute", 1) {
+		errors.RespondWithPermissionError(c, "update compute containers")
+		return
+	}
+
+	var req models.ComputeUpdateRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.AccountID)
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Invalid user ID in token"))
+		return
+	}
+
+	containerID := c.Param("id")
+	detail, err := h.service.UpdateContainer(userID, containerID, req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	// The recreated container is billed at the rate of its preset from now on
+	if h.monitoringService != nil {
+		if err := h.monitoringService.TrackResourceDeletion(containerID, models.ResourceTypeCompute); err != nil {
+			log.Printf("Failed to track resource deletion: %v", err)
+		}
+		account, err := h.iamStore.GetAccountByID(claims.AccountID)
+		if err == nil {
+			configuration := services.ComputeResourceConfiguration(detail.Image, detail.Preset)
+			err = h.monitoringService.TrackResourceCreation(
+				userID,
+				account.OrganizationID,
+				models.ResourceTypeCompute,
+				detail.ID,
+				detail.Name,
+				configuration,
+			)
+			if err != nil {
+				log.Printf("Failed to track resource creation: %v", err)
+			}
+			if detail.State != "running" {
+				h.trackStatus(detail.ID, models.ResourceStatusInactive)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// StartContainer starts a container of a user and resumes its billing
+func (h *ComputeHandler) StartContainer(userID uuid.UUID, containerID string) error {
+	if err := h.service.StartContainer(userID, containerID); err != nil {
+		return err
+	}
+	h.trackStatus(containerID, models.ResourceStatusActive)
+	return nil
+}
+
+// CheckContainer returns an error unless the container belongs to the user
+func (h *ComputeHandler) CheckContainer(userID uuid.UUID, containerID string) error {
+	return h.service.CheckContainer(userID, containerID)
+}
+
+// StopContainer stops a container of a user and stops its billing
+func (h *ComputeHandler) StopContainer(userID uuid.UUID, containerID string) error {
+	if err := h.service.StopContainer(userID, containerID); err != nil {
+		return err
+	}
+	h.trackStatus(containerID, models.ResourceStatusInactive)
+	return nil
+}
+
+// runAction runs a lifecycle action on the container of the request and responds with the container
+func (h *ComputeHandler) runAction(c *gin.Context, action string, run func(userID uuid.UUID, containerID string) error) {
+	claims, err := h.getClaims(c)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	if !h.hasPermission(claims, "compute", 1) {
+		errors.RespondWithPermissionError(c, action)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.AccountID)
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Invalid user ID in token"))
+		return
+	}
+
+	containerID := c.Param("id")
+	if err := run(userID, containerID); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	detail, err := h.service.GetContainer(userID, containerID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	h.trackHealth(claims.AccountID, detail)
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// trackHealth reports the health of a container after an action, which may have cleared its drift
+func (h *ComputeHandler) trackHealth(accountID string, detail *models.ComputeContainerDetail) {
+	if h.monitoringService == nil {
+		return
+	}
+	account, err := h.iamStore.GetAccountByID(accountID)
+	if err != nil {
+		return
+	}
+	err = h.monitoringService.UpdateMonitoringMetrics(account.OrganizationID, detail.ID, models.ResourceTypeCompute, map[string]interface{}{
+		"health_status": detail.Drift.HealthStatus(),
+	})
+	if err != nil {
+		log.Printf("Failed to update monitoring metrics: %v", err)
+	}
+}
+
+// trackStatus reports a container transition for monitoring, without failing the request
+func (h *ComputeHandler) trackStatus(containerID string, status models.ResourceStatus) {
+	if h.monitoringService == nil {
+		return
+	}
+	if err := h.monitoringService.TrackResourceUpdate(containerID, models.ResourceTypeCompute, status, nil); err != nil {
+		log.Printf("Failed to track resource update: %v", err)
+	}
+}
+
+// ListComputeInstances godoc
+// @Summary List the compute inventory
+// @Description List the compute instances of the organization with their requested configuration, observed state and drift
+// @Tags Compute
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param include_deleted query bool false "Include the deleted instances"
+// @Param drifted query bool false "Only the instances whose container differs from their configuration"
+// @Success 200 {array} models.ComputeInstance
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/compute/instances [get]
+func (h *ComputeHandler) ListComputeInstances(c *gin.Context) {
+	claims, err := h.getClaims(c)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	if !h.hasPermission(claims, "compute", 0) {
+		errors.RespondWithPermissionError(c, "list compute instances")
+		return
+	}
+
+	account, err := h.iamStore.GetAccountByID(claims.AccountID)
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Account not found"))
+		return
+	}
+
+	instances, err := h.service.ListInstances(account.OrganizationID, c.Query("include_deleted") == "true", c.Query("drifted") == "true")
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, instances)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/stores"
+)
+
+// GetOrganizationConcurrency godoc
+// @Summary Get the concurrency of the organization
+// @Description Get the number of function invocations the organization of the caller can run at once, the part reserved by its functions and the invocations running
+// @Tags Functions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.ConcurrencyResponse
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/lambda/concurrency [get]
+func (h *FunctionHandler) GetOrganizationConcurrency(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read the concurrency")
+	if !ok {
+		return
+	}
+
+	h.respondOrganizationConcurrency(c, account.OrganizationID)
+}
+
+// PutOrganizationConcurrency godoc
+// @Summary Set the concurrency of an organization
+// @Description Set the number of function invocations an organization can run at once, the organization of the caller unless another one is given. Only the admins can set it, it's clamped to the configured ceiling and can't go below the concurrency reserved by the functions.
+// @Tags Functions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.PutOrganizationConcurrencyRequest true "Organization concurrency request"
+// @Success 200 {object} models.ConcurrencyResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/lambda/concurrency [put]
+func (h *FunctionHandler) PutOrganizationConcurrency(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "set the concurrency")
+	if !ok {
+		return
+	}
+	// the capacity of the organizations protects the whole fleet, their members can't raise it
+	if !h.isAdmin(account) {
+		errors.RespondWithPermissionError(c, "set the concurrency")
+		return
+	}
+
+	var req models.PutOrganizationConcurrencyRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	orgID := account.OrganizationID
+	if req.OrganizationID != nil {
+		if _, err := h.iamStore.GetOrganizationByID(req.OrganizationID.String()); err != nil {
+			errors.RespondWithNotFoundError(c, "Organization")
+			return
+		}
+		orgID = *req.OrganizationID
+	}
+
+	if err := h.service.PutOrganizationConcurrency(orgID, req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	h.respondOrganizationConcurrency(c, orgID)
+}
+
+// GetFunctionConcurrency godoc
+// @Summary Get the concurrency of a function
+// @Description Get the maximum and reserved concurrency of a function and its invocations running
+// @Tags Functions
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Success 200 {object} models.ConcurrencyResponse
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/concurrency [get]
+func (h *FunctionHandler) GetFunctionConcurrency(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read functions")
+	if !ok {
+		return
+	}
+
+	function, err := h.service.GetFunction(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.functionConcurrency(function))
+}
+
+// PutFunctionConcurrency godoc
+// @Summary Set the concurrency of a function
+// @Description Limit the invocations of a function running at once, and reserve part of the capacity of the organization for it
+// @Tags Functions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Param request body models.PutFunctionConcurrencyRequest true "Function concurrency request"
+// @Success 200 {object} models.ConcurrencyResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/concurrency [put]
+func (h *FunctionHandler) PutFunctionConcurrency(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "update functions")
+	if !ok {
+		return
+	}
+
+	var req models.PutFunctionConcurrencyRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	function, err := h.service.PutFunctionConcurrency(account.OrganizationID, c.Param("name"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.functionConcurrency(function))
+}
+
+// isAdmin reports whether the account belongs to the organization administering the API
+func (h *FunctionHandler) isAdmin(account *models.Account) bool {
+	org, err := h.iamStore.GetOrganizationByID(account.OrganizationID.String())
+	return err == nil && org.Name == stores.AdminOrganizationName
+}
+
+func (h *FunctionHandler) respondOrganizationConcurrency(c *gin.Context, orgID uuid.UUID) {
+	maxConcurrency, reserved, err := h.service.GetOrganizationConcurrency(orgID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ConcurrencyResponse{
+		MaxConcurrency:      maxConcurrency,
+		ReservedConcurrency: reserved,
+		InFlight:            h.lambda.Concurrency.InFlight(orgID, uuid.Nil),
+	})
+}
+
+func (h *FunctionHandler) functionConcurrency(function *models.Function) models.ConcurrencyResponse {
+	return models.ConcurrencyResponse{
+		MaxConcurrency:      function.MaxConcurrency,
+		ReservedConcurrency: function.ReservedConcurrency,
+		InFlight:            h.lambda.Concurrency.InFlight(function.OrganizationID, function.ID),
+	}
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/common/validation"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/middleware"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
+	"unicorn-api/internal/stores"
+)
+
+// FunctionHandler handles the registry of lambda functions and their invocations
+type FunctionHandler struct {
+	service   *services.FunctionService
+	lambda    *LambdaHandler
+	validator *validation.Validator
+	config    *config.Config
+	iamStore  stores.IAMStore
+}
+
+// NewFunctionHandler creates a new function handler, invocations are forwarded by the lambda handler
+func NewFunctionHandler(cfg *config.Config, iamStore stores.IAMStore, service *services.FunctionService, lambdaHandler *LambdaHandler) *FunctionHandler {
+	return &FunctionHandler{
+		service:   service,
+		lambda:    lambdaHandler,
+		validator: validation.NewValidator(),
+		config:    cfg,
+		iamStore:  iamStore,
+	}
+}
+
+// authorize checks the permission of the caller and returns its account,
+// the error response is sent when it fails
+func (h *FunctionHandler) authorize(c *gin.Context, perm models.Permission, action string) (*models.Account, bool) {
+	claims, exists := middleware.GetClaimsFromContext(c)
+	if !exists {
+		errors.RespondWithError(c, errors.ErrUnauthorized)
+		return nil, false
+	}
+
+	role, err := h.iamStore.GetRoleByID(claims.RoleID)
+	if err != nil || !hasPermission(role.Permissions, perm) {
+		errors.RespondWithPermissionError(c, action)
+		return nil, false
+	}
+
+	account, err := h.iamStore.GetAccountByID(claims.AccountID)
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Account not found"))
+		return nil, false
+	}
+
+	return account, true
+}
+
+// ListFunctions godoc
+// @Summary List functions
+// @Description List the lambda functions of the organization of the caller
+// @Tags Functions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Function
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/lambda/functions [get]
+func (h *FunctionHandler) ListFunctions(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "list functions")
+	if !ok {
+		return
+	}
+
+	functions, err := h.service.ListFunctions(account.OrganizationID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, functions)
+}
+
+// CreateFunction godoc
+// @Summary Create a function
+// @Description Create a lambda function in the organization of the caller, its code is published as version 1
+// @Tags Functions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateFunctionRequest true "Function creation request"
+// @Success 201 {object} models.FunctionVersion
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/lambda/functions [post]
+func (h *FunctionHandler) CreateFunction(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "create functions")
+	if !ok {
+		return
+	}
+
+	var req models.CreateFunctionRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	_, version, err := h.service.CreateFunction(account.OrganizationID, account.ID, req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, version)
+}
+
+// GetFunction godoc
+// @Summary Get a function
+// @Description Get a lambda function with its aliases
+// @Tags Functions
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Success 200 {object} models.Function
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name} [get]
+func (h *FunctionHandler) GetFunction(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read functions")
+	if !ok {
+		return
+	}
+
+	function, err := h.service.GetFunction(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, function)
+}
+
+// UpdateFunction godoc
+// @Summary Update a function
+// @Description Publish a new immutable version of a function, the fields left out are kept from the latest version
+// @Tags Functions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Param request body models.UpdateFunctionRequest true "Function update request"
+// @Success 201 {object} models.FunctionVersion
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name} [put]
+func (h *FunctionHandler) UpdateFunction(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "update functions")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateFunctionRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	_, version, err := h.service.UpdateFunction(account.OrganizationID, account.ID, c.Param("name"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, version)
+}
+
+// DeleteFunction godoc
+// @Summary Delete a function
+// @Description Delete a lambda function with all its versions and aliases
+// @Tags Functions
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Success 204 {string} string "Function deleted successfully"
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name} [delete]
+func (h *FunctionHandler) DeleteFunction(c *gin.Context) {
+	account, ok := h.authorize(c, models.Delete, "delete functions")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteFunction(account.OrganizationID, c.Param("name")); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListFunctionVersions godoc
+// @Summary List function versions
+// @Description List the published versions of a function, the most recent first
+// @Tags Functions
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Success 200 {array} models.FunctionVersion
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/versions [get]
+func (h *FunctionHandler) ListFunctionVersions(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read functions")
+	if !ok {
+		return
+	}
+
+	versions, err := h.service.ListVersions(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetFunctionVersion godoc
+// @Summary Get a function version
+// @Description Get the code and settings of a function, by version number or alias
+// @Tags Functions
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Param qualifier path string true "Version number, alias or latest"
+// @Success 200 {object} models.FunctionVersion
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/versions/{qualifier} [get]
+func (h *FunctionHandler) GetFunctionVersion(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read functions")
+	if !ok {
+		return
+	}
+
+	_, version, err := h.service.Resolve(account.OrganizationID, c.Param("name"), c.Param("qualifier"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// PutFunctionAlias godoc
+// @Summary Create or move an alias
+// @Description Point an alias of a function, like prod, to one of its versions
+// @Tags Functions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Param alias path string true "Alias name"
+// @Param request body models.PutFunctionAliasRequest true "Alias request"
+// @Success 200 {object} models.FunctionAlias
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/aliases/{alias} [put]
+func (h *FunctionHandler) PutFunctionAlias(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "update function aliases")
+	if !ok {
+		return
+	}
+
+	var req models.PutFunctionAliasRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	alias, err := h.service.PutAlias(account.OrganizationID, c.Param("name"), c.Param("alias"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, alias)
+}
+
+// DeleteFunctionAlias godoc
+// @Summary Delete an alias
+// @Description Delete an alias of a function, the version it points to is kept
+// @Tags Functions
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Param alias path string true "Alias name"
+// @Success 204 {string} string "Alias deleted successfully"
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/aliases/{alias} [delete]
+func (h *FunctionHandler) DeleteFunctionAlias(c *gin.Context) {
+	account, ok := h.authorize(c, models.Delete, "delete function aliases")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteAlias(account.OrganizationID, c.Param("name"), c.Param("alias")); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// InvokeFunction godoc
+// @Summary Invoke a function
+// @Description Run a version of a function, selected by number or alias, on the Lambda API
+// @Tags Functions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Param request body models.InvokeFunctionRequest false "Invocation request"
+// @Success 200 {object} models.LambdaExecuteResponse
+// @Header 200 {string} X-Function-Version "The version that ran"
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 429 {object} map[string]string "Concurrency limit reached"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/lambda/functions/{name}/invoke [post]
+func (h *FunctionHandler) InvokeFunction(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "invoke functions")
+	if !ok {
+		return
+	}
+
+	// the body is optional, the latest version runs with its defaults
+	var req models.InvokeFunctionRequest
+	if c.Request.ContentLength != 0 {
+		if err := h.validator.BindAndValidate(c, &req); err != nil {
+			errors.RespondWithError(c, err)
+			return
+		}
+	}
+	if qualifier := c.Query("qualifier"); qualifier != "" {
+		req.Qualifier = qualifier
+	}
+
+	function, version, err := h.service.Resolve(account.OrganizationID, c.Param("name"), req.Qualifier)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	execute, err := h.service.ExecuteRequest(account.OrganizationID, version, req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	limits, err := h.service.ConcurrencyLimits(function)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.Header("X-Function-Version", strconv.Itoa(version.Version))
+	h.lambda.executeForCaller(c, &limits, execute)
+}
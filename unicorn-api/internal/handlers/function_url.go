@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"unicorn-api/internal/auth"
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/lambdaclient"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
+)
+
+// maxFunctionURLBody caps the request bodies passed to the functions invoked through their URL
+const maxFunctionURLBody = 6 << 20
+
+// connection headers, never copied from the response of a function
+var hopHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// headers protecting the origin of the API, a function served on it can't set them
+var securityHeaders = map[string]bool{
+	"Set-Cookie":                          true,
+	"Set-Cookie2":                         true,
+	"Clear-Site-Data":                     true,
+	"Content-Security-Policy":             true,
+	"Content-Security-Policy-Report-Only": true,
+	"Strict-Transport-Security":           true,
+	"X-Content-Type-Options":              true,
+	"Access-Control-Allow-Origin":         true,
+	"Access-Control-Allow-Credentials":    true,
+	"Access-Control-Allow-Headers":        true,
+	"Access-Control-Allow-Methods":        true,
+	"Access-Control-Expose-Headers":       true,
+	"Service-Worker-Allowed":              true,
+}
+
+// PutFunctionURL godoc
+// @Summary Enable the invoke URL of a function
+// @Description Expose a function as a web endpoint on /fn/{org}/{name}, or change the settings of its URL. The API key is only returned when it is generated.
+// @Tags Functions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Param request body models.PutFunctionURLRequest true "Invoke URL settings"
+// @Success 200 {object} models.FunctionURLResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/url [put]
+func (h *FunctionHandler) PutFunctionURL(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "update function URLs")
+	if !ok {
+		return
+	}
+
+	var req models.PutFunctionURLRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	function, apiKey, err := h.service.PutURL(account.OrganizationID, c.Param("name"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FunctionURLResponse{
+		URL:       functionURL(c, function),
+		AuthType:  function.URLAuth,
+		Qualifier: function.URLQualifier,
+		APIKey:    apiKey,
+	})
+}
+
+// DeleteFunctionURL godoc
+// @Summary Disable the invoke URL of a function
+// @Description Stop exposing a function as a web endpoint, its API key is revoked
+// @Tags Functions
+// @Security BearerAuth
+// @Param name path string true "Function name"
+// @Success 204 {string} string "Invoke URL disabled"
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/functions/{name}/url [delete]
+func (h *FunctionHandler) DeleteFunctionURL(c *gin.Context) {
+	account, ok := h.authorize(c, models.Delete, "delete function URLs")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteURL(account.OrganizationID, c.Param("name")); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// InvokeFunctionURL godoc
+// @Summary Invoke a function through its URL
+// @Description Run a function with the HTTP request serialized as a JSON event on its standard input. A function printing a JSON object with a status_code controls the status, headers and body of the response, any other output is returned as plain text. The response is sandboxed by its Content-Security-Policy and can't set cookies or the security headers of the API.
+// @Tags Functions
+// @Accept */*
+// @Produce */*
+// @Param org path string true "Organization ID"
+// @Param name path string true "Function name"
+// @Param X-Api-Key header string false "API key of the URL, for the api_key auth type"
+// @Param Authorization header string false "Bearer token of an account of the organization, for the jwt auth type"
+// @Success 200 {string} string "Response of the function"
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 413 {object} errors.AppError
+// @Failure 429 {object} errors.AppError
+// @Failure 502 {object} errors.AppError
+// @Router /fn/{org}/{name} [post]
+func (h *FunctionHandler) InvokeFunctionURL(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("org"))
+	if err != nil {
+		errors.RespondWithNotFoundError(c, "Function")
+		return
+	}
+
+	// functions without a URL don't exist for the outside
+	function, err := h.service.GetFunction(orgID, c.Param("name"))
+	if err != nil || function.URLAuth == "" {
+		errors.RespondWithNotFoundError(c, "Function")
+		return
+	}
+
+	// anonymous and API key callers run the function on behalf of the account that published it
+	var accountID string
+	credentialHeader := ""
+
+	switch function.URLAuth {
+	case models.FunctionURLAuthAPIKey:
+		credentialHeader = "X-Api-Key"
+		if !services.CheckURLKey(function, c.GetHeader(credentialHeader)) {
+			errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Invalid or missing API key"))
+			return
+		}
+	case models.FunctionURLAuthJWT:
+		credentialHeader = "Authorization"
+		token, found := strings.CutPrefix(c.GetHeader(credentialHeader), "Bearer ")
+		claims, err := auth.ValidateToken(token, h.config)
+		if !found || err != nil {
+			errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Invalid or missing token"))
+			return
+		}
+
+		account, err := h.iamStore.GetAccountByID(claims.AccountID)
+		if err != nil || account.OrganizationID != function.OrganizationID {
+			errors.RespondWithPermissionError(c, "invoking this function")
+			return
+		}
+		role, err := h.iamStore.GetRoleByID(claims.RoleID)
+		if err != nil || !hasPermission(role.Permissions, models.Write) {
+			errors.RespondWithPermissionError(c, "invoking this function")
+			return
+		}
+
+		// the execution is attributed to the caller
+		accountID = account.ID.String()
+	}
+
+	_, version, err := h.service.Resolve(orgID, function.Name, function.URLQualifier)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	if accountID == "" {
+		publisher, err := h.iamStore.GetAccountByID(version.CreatedBy.String())
+		if err != nil {
+			errors.RespondWithError(c, errors.ErrInternalError.WithDetails("The publisher of the function no longer exists"))
+			return
+		}
+		accountID = publisher.ID.String()
+	}
+
+	// the Lambda API only gets a token running functions, valid through the retries of the
+	// invocation and its wait for capacity
+	lifetime := h.config.LambdaConcurrencyWait + time.Duration(h.config.LambdaMaxRetries+1)*h.config.LambdaTimeout + time.Minute
+	token, err := auth.GenerateInvocationToken(accountID, lifetime, h.config)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	authorization := "Bearer " + token
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxFunctionURLBody))
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrPayloadTooLarge.WithDetails("The request body is limited to 6 MiB"))
+		return
+	}
+
+	event, err := json.Marshal(newFunctionHTTPEvent(c, body, credentialHeader))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	// a web request has someone waiting for it
+	execute, err := h.service.ExecuteRequest(orgID, version, models.InvokeFunctionRequest{
+		StandardInput: string(event),
+		Priority:      "high",
+	})
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	limits, err := h.service.ConcurrencyLimits(function)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	resp, err := h.lambda.ExecuteFunction(c.Request.Context(), authorization, limits, execute)
+	var statusErr *lambdaclient.StatusError
+	switch {
+	case stderrors.Is(err, services.ErrConcurrencyLimit):
+		c.Header("Retry-After", "1")
+		errors.RespondWithError(c, errors.ErrTooManyRequests.WithDetails("Concurrency limit of the function reached"))
+		return
+	case stderrors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests:
+		errors.RespondWithError(c, errors.ErrTooManyRequests.WithDetails("Too many invocations of the function"))
+		return
+	case err != nil:
+		log.Printf("Failed to invoke function %s through its URL: %v", function.Name, err)
+		errors.RespondWithError(c, errors.ErrBadGateway.WithDetails("Function invocation failed"))
+		return
+	}
+
+	c.Header("X-Function-Version", strconv.Itoa(version.Version))
+
+	if resp.Status != models.LambdaTaskSuccessful {
+		errors.RespondWithError(c, errors.ErrBadGateway.WithDetails("Function invocation failed with exit code "+strconv.Itoa(int(resp.ExitCode))))
+		return
+	}
+
+	writeFunctionHTTPResponse(c, resp.Stdout)
+}
+
+// functionURL returns the absolute invoke URL of a function
+func functionURL(c *gin.Context, function *models.Function) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + c.Request.Host + "/fn/" + function.OrganizationID.String() + "/" + function.Name
+}
+
+// newFunctionHTTPEvent serializes an HTTP request for a function, without the credential it was authorized with
+func newFunctionHTTPEvent(c *gin.Context, body []byte, credentialHeader string) models.FunctionHTTPEvent {
+	event := models.FunctionHTTPEvent{
+		Method:   c.Request.Method,
+		Path:     c.Param("path"),
+		Headers:  make(map[string]string),
+		Query:    make(map[string]string),
+		RawQuery: c.Request.URL.RawQuery,
+		SourceIP: c.ClientIP(),
+	}
+
+	if event.Path == "" {
+		event.Path = "/"
+	}
+
+	for name, values := range c.Request.Header {
+		if credentialHeader != "" && strings.EqualFold(name, credentialHeader) {
+			continue
+		}
+		event.Headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	for name, values := range c.Request.URL.Query() {
+		event.Query[name] = strings.Join(values, ",")
+	}
+
+	if utf8.Valid(body) {
+		event.Body = string(body)
+	} else {
+		event.Body = base64.StdEncoding.EncodeToString(body)
+		event.IsBase64Encoded = true
+	}
+
+	return event
+}
+
+// writeFunctionHTTPResponse maps the output of a function to the HTTP response. The response is
+// served on the origin of the API, it is sandboxed so its scripts can't use the origin and its cookies.
+func writeFunctionHTTPResponse(c *gin.Context, stdout string) {
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	var response models.FunctionHTTPResponse
+	trimmed := strings.TrimSpace(stdout)
+
+	if !strings.HasPrefix(trimmed, "{") || json.Unmarshal([]byte(trimmed), &response) != nil || response.StatusCode == 0 {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(stdout))
+		return
+	}
+
+	if response.StatusCode < 100 || response.StatusCode > 599 {
+		errors.RespondWithError(c, errors.ErrBadGateway.WithDetails("Function returned an invalid status code"))
+		return
+	}
+
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			errors.RespondWithError(c, errors.ErrBadGateway.WithDetails("Function returned an invalid base64 body"))
+			return
+		}
+		body = decoded
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	for name, value := range response.Headers {
+		if canonical := http.CanonicalHeaderKey(name); hopHeaders[canonical] || securityHeaders[canonical] {
+			continue
+		}
+		if strings.EqualFold(name, "Content-Type") {
+			contentType = value
+			continue
+		}
+		c.Header(name, value)
+	}
+
+	c.Data(response.StatusCode, contentType, body)
+}
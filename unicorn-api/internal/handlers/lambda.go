@@ -1,42 +1,54 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	stderrors "errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 
 	"unicorn-api/internal/auth"
 	"unicorn-api/internal/config"
+	"unicorn-api/internal/lambdaclient"
 	"unicorn-api/internal/middleware"
 	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
 	"unicorn-api/internal/stores"
 )
 
 // LambdaHandler handles Lambda function execution requests
 type LambdaHandler struct {
-	Config    *config.Config
-	IAMStore  stores.IAMStore
-	LambdaURL string
+	Config      *config.Config
+	IAMStore    stores.IAMStore
+	Client      *lambdaclient.Client
+	Monitoring  *services.MonitoringService
+	Concurrency *services.ConcurrencyLimiter
+	Functions   *services.FunctionService
 }
 
-// NewLambdaHandler creates a new Lambda handler
-func NewLambdaHandler(cfg *config.Config, iamStore stores.IAMStore) *LambdaHandler {
-	lambdaURL := cfg.LambdaURL
-	lambdaURL = "http://localhost:6900" // Default Lambda API URL
+// NewLambdaHandler creates a new Lambda handler calling the Lambda API set in the configuration,
+// the executions are metered by the monitoring service and admitted against the concurrency
+// of the organizations held by the function service
+func NewLambdaHandler(cfg *config.Config, iamStore stores.IAMStore, monitoringService *services.MonitoringService, functions *services.FunctionService) *LambdaHandler {
 	return &LambdaHandler{
-		Config:    cfg,
-		IAMStore:  iamStore,
-		LambdaURL: lambdaURL,
+		Config:      cfg,
+		IAMStore:    iamStore,
+		Client:      lambdaclient.NewClient(lambdaclient.OptionsFromConfig(cfg)),
+		Monitoring:  monitoringService,
+		Concurrency: services.NewConcurrencyLimiter(cfg.LambdaConcurrencyWait),
+		Functions:   functions,
 	}
 }
 
 // ExecuteLambda godoc
 // @Summary Execute a Lambda function
-// @Description Execute code in a Lambda function with specified runtime and files
+// @Description Execute code in a Lambda function with specified runtime and files, admitted against the concurrency of the organization no function reserved
 // @Tags Lambda
 // @Accept json
 // @Produce json
@@ -46,7 +58,9 @@ func NewLambdaHandler(cfg *config.Config, iamStore stores.IAMStore) *LambdaHandl
 // @Failure 400 {object} map[string]string "Bad request"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Forbidden - insufficient permissions"
+// @Failure 429 {object} map[string]string "Too many executions"
 // @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 503 {object} map[string]string "Lambda API unavailable"
 // @Router /api/v1/lambda/execute [post]
 func (h *LambdaHandler) ExecuteLambda(c *gin.Context) {
 	var req models.LambdaExecuteRequest
@@ -65,40 +79,19 @@ func (h *LambdaHandler) ExecuteLambda(c *gin.Context) {
 		return
 	}
 
-	// Forward the request to the Lambda API
-	lambdaReqBody, err := json.Marshal(req)
+	// the executions share the capacity of the organization no function reserved
+	account, err := h.IAMStore.GetAccountByID(claims.AccountID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal request"})
-		return
-	}
-
-	lambdaReq, err := http.NewRequest("POST", h.LambdaURL+"/api/v1/execute", bytes.NewBuffer(lambdaReqBody))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request to Lambda API"})
-		return
-	}
-	lambdaReq.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(lambdaReq)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to connect to Lambda API: " + err.Error()})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
-	defer resp.Body.Close()
-
-	// Set the same content type as the Lambda API
-	c.Header("Content-Type", resp.Header.Get("Content-Type"))
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	limits, err := h.Functions.OrganizationLimits(account.OrganizationID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read Lambda API response"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Return the Lambda API response
-	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	h.executeForCaller(c, &limits, req)
 }
 
 // TestLambda godoc
@@ -132,43 +125,111 @@ func (h *LambdaHandler) TestLambda(c *gin.Context) {
 		return
 	}
 
-	// Forward the request to the Lambda API
-	lambdaReqBody, err := json.Marshal(req)
+	h.forwardToLambda(c, "/api/v1/test", req)
+}
+
+// Helpers
+
+// forwardToLambda sends the request to the Lambda API and relays its raw response,
+// the trace context is propagated through the W3C trace headers
+func (h *LambdaHandler) forwardToLambda(c *gin.Context, path string, req models.LambdaExecuteRequest) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	// the Lambda API verifies the same token and attributes the execution to the account
+	resp, err := h.Client.Post(ctx, path, c.GetHeader("Authorization"), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal request"})
+		respondLambdaError(c, err)
 		return
 	}
 
-	lambdaReq, err := http.NewRequest("POST", h.LambdaURL+"/api/v1/test", bytes.NewBuffer(lambdaReqBody))
+	// Return the Lambda API response
+	c.Data(resp.StatusCode, resp.ContentType, resp.Body)
+}
+
+// executeForCaller runs the request on behalf of the caller and responds with the typed result,
+// the executions are admitted against their concurrency limits when they have some
+func (h *LambdaHandler) executeForCaller(c *gin.Context, limits *services.ConcurrencyLimits, req models.LambdaExecuteRequest) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	var resp *models.LambdaExecuteResponse
+	var err error
+	if limits != nil {
+		resp, err = h.ExecuteFunction(ctx, c.GetHeader("Authorization"), *limits, req)
+	} else {
+		resp, err = h.Execute(ctx, c.GetHeader("Authorization"), req)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request to Lambda API"})
+		respondLambdaError(c, err)
 		return
 	}
-	lambdaReq.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(lambdaReq)
+	c.JSON(http.StatusOK, resp)
+}
+
+// Execute runs a request on the Lambda API on behalf of the holder of the authorization,
+// and meters it. An answer other than 200 is returned as a *lambdaclient.StatusError.
+func (h *LambdaHandler) Execute(ctx context.Context, authorization string, req models.LambdaExecuteRequest) (*models.LambdaExecuteResponse, error) {
+	resp, err := h.Client.Execute(ctx, authorization, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to connect to Lambda API: " + err.Error()})
-		return
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Set the same content type as the Lambda API
-	c.Header("Content-Type", resp.Header.Get("Content-Type"))
+	h.meter(authorization, resp)
+	return resp, nil
+}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+// ExecuteFunction runs an invocation of a function, or an execution of an organization, once its
+// concurrency limits admit it. An invocation finding no capacity before the end of its wait fails
+// with services.ErrConcurrencyLimit.
+func (h *LambdaHandler) ExecuteFunction(ctx context.Context, authorization string, limits services.ConcurrencyLimits, req models.LambdaExecuteRequest) (*models.LambdaExecuteResponse, error) {
+	release, err := h.Concurrency.Acquire(ctx, limits)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read Lambda API response"})
+		return nil, err
+	}
+	defer release()
+
+	return h.Execute(ctx, authorization, req)
+}
+
+// respondLambdaError relays the answers of the Lambda API other than 200 with their status
+func respondLambdaError(c *gin.Context, err error) {
+	var statusErr *lambdaclient.StatusError
+	switch {
+	case stderrors.As(err, &statusErr):
+		c.JSON(statusErr.StatusCode, gin.H{"error": statusErr.Message})
+	case stderrors.Is(err, services.ErrConcurrencyLimit):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case stderrors.Is(err, lambdaclient.ErrCircuitOpen):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// meter records the usage of an execution for the account holding the authorization,
+// whatever its outcome: a failing function still ran
+func (h *LambdaHandler) meter(authorization string, resp *models.LambdaExecuteResponse) {
+	if h.Monitoring == nil {
 		return
 	}
 
-	// Return the Lambda API response
-	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	claims, err := auth.ValidateInvocationToken(strings.TrimPrefix(authorization, "Bearer "), h.Config)
+	if err != nil {
+		return
+	}
+	account, err := h.IAMStore.GetAccountByID(claims.AccountID)
+	if err != nil {
+		log.Printf("Failed to meter lambda execution %s: %v", resp.ID, err)
+		return
+	}
+
+	executionTime := time.Duration(resp.Time) * time.Millisecond
+	if err := h.Monitoring.TrackLambdaInvocation(account.ID, account.OrganizationID, executionTime, resp.Memory); err != nil {
+		log.Printf("Failed to meter lambda execution %s: %v", resp.ID, err)
+	}
 }
 
-// Helpers
 func (h *LambdaHandler) getClaims(c *gin.Context) (*auth.Claims, error) {
 	claims, exists := middleware.GetClaimsFromContext(c)
 	if !exists {
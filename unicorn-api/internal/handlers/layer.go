@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/models"
+)
+
+// ListLayers godoc
+// @Summary List layers
+// @Description List the layers of the organization of the caller
+// @Tags Layers
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Layer
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/lambda/layers [get]
+func (h *FunctionHandler) ListLayers(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "list layers")
+	if !ok {
+		return
+	}
+
+	layers, err := h.service.ListLayers(account.OrganizationID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, layers)
+}
+
+// PublishLayerVersion godoc
+// @Summary Publish a layer version
+// @Description Publish the next version of a layer of the organization of the caller, the layer is created with version 1
+// @Tags Layers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Layer name"
+// @Param request body models.PublishLayerVersionRequest true "Layer version request"
+// @Success 201 {object} models.LayerVersion
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/lambda/layers/{name}/versions [post]
+func (h *FunctionHandler) PublishLayerVersion(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "publish layers")
+	if !ok {
+		return
+	}
+
+	var req models.PublishLayerVersionRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	_, version, err := h.service.PublishLayerVersion(account.OrganizationID, account.ID, c.Param("name"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, version)
+}
+
+// GetLayer godoc
+// @Summary Get a layer
+// @Description Get a layer of the organization of the caller
+// @Tags Layers
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Layer name"
+// @Success 200 {object} models.Layer
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/layers/{name} [get]
+func (h *FunctionHandler) GetLayer(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read layers")
+	if !ok {
+		return
+	}
+
+	layer, err := h.service.GetLayer(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, layer)
+}
+
+// DeleteLayer godoc
+// @Summary Delete a layer
+// @Description Delete a layer with all its versions, the functions referencing it can no longer be invoked until they are updated
+// @Tags Layers
+// @Security BearerAuth
+// @Param name path string true "Layer name"
+// @Success 204 "No Content"
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/layers/{name} [delete]
+func (h *FunctionHandler) DeleteLayer(c *gin.Context) {
+	account, ok := h.authorize(c, models.Delete, "delete layers")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteLayer(account.OrganizationID, c.Param("name")); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListLayerVersions godoc
+// @Summary List layer versions
+// @Description List the published versions of a layer without their files, the most recent first
+// @Tags Layers
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Layer name"
+// @Success 200 {array} models.LayerVersion
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/layers/{name}/versions [get]
+func (h *FunctionHandler) ListLayerVersions(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read layers")
+	if !ok {
+		return
+	}
+
+	versions, err := h.service.ListLayerVersions(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetLayerVersion godoc
+// @Summary Get a layer version
+// @Description Get a version of a layer with its files
+// @Tags Layers
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Layer name"
+// @Param version path int true "Version number"
+// @Success 200 {object} models.LayerVersion
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/lambda/layers/{name}/versions/{version} [get]
+func (h *FunctionHandler) GetLayerVersion(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read layers")
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		errors.RespondWithError(c, errors.ErrBadRequest.WithDetails("Invalid layer version"))
+		return
+	}
+
+	version, err := h.service.GetLayerVersion(account.OrganizationID, c.Param("name"), number)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
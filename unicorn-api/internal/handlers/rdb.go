@@ -25,9 +25,9 @@ type RDBHandler struct {
 }
 
 // NewRDBHandler creates a new RDB handler
-func NewRDBHandler(cfg *config.Config, iamStore stores.IAMStore) *RDBHandler {
+func NewRDBHandler(cfg *config.Config, iamStore stores.IAMStore, service *services.RDBService) *RDBHandler {
 	return &RDBHandler{
-		service:   services.NewRDBService(),
+		service:   service,
 		validator: validation.NewValidator(),
 		config:    cfg,
 		iamStore:  iamStore,
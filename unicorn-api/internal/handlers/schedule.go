@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/common/validation"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/middleware"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
+	"unicorn-api/internal/stores"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduleHandler manages the schedules of the organizations and their run history
+type ScheduleHandler struct {
+	service   *services.ScheduleService
+	iamStore  stores.IAMStore
+	validator *validation.Validator
+	config    *config.Config
+}
+
+// NewScheduleHandler creates a new schedule handler
+func NewScheduleHandler(cfg *config.Config, iamStore stores.IAMStore, service *services.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{
+		service:   service,
+		iamStore:  iamStore,
+		validator: validation.NewValidator(),
+		config:    cfg,
+	}
+}
+
+// authorize checks the permission of the caller and returns its account,
+// the error response is sent when it fails
+func (h *ScheduleHandler) authorize(c *gin.Context, perm models.Permission, action string) (*models.Account, bool) {
+	claims, exists := middleware.GetClaimsFromContext(c)
+	if !exists {
+		errors.RespondWithError(c, errors.ErrUnauthorized)
+		return nil, false
+	}
+
+	role, err := h.iamStore.GetRoleByID(claims.RoleID)
+	if err != nil || !hasPermission(role.Permissions, perm) {
+		errors.RespondWithPermissionError(c, action)
+		return nil, false
+	}
+
+	account, err := h.iamStore.GetAccountByID(claims.AccountID)
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Account not found"))
+		return nil, false
+	}
+
+	return account, true
+}
+
+// ListSchedules godoc
+// @Summary List schedules
+// @Description List the schedules of the organization of the caller
+// @Tags Schedules
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Schedule
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/schedules [get]
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "list schedules")
+	if !ok {
+		return
+	}
+
+	schedules, err := h.service.ListSchedules(account.OrganizationID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// CreateSchedule godoc
+// @Summary Create a schedule
+// @Description Create a schedule invoking a function or starting or stopping a compute container of the caller at the occurrences of a cron or rate expression
+// @Tags Schedules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateScheduleRequest true "Schedule creation request"
+// @Success 201 {object} models.Schedule
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError "The function of the target doesn't exist"
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/schedules [post]
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "create schedules")
+	if !ok {
+		return
+	}
+
+	var req models.CreateScheduleRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	schedule, err := h.service.CreateSchedule(account.OrganizationID, account.ID, req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// GetSchedule godoc
+// @Summary Get a schedule
+// @Description Get a schedule with its next occurrence
+// @Tags Schedules
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Schedule name"
+// @Success 200 {object} models.Schedule
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/schedules/{name} [get]
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read schedules")
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.GetSchedule(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule godoc
+// @Summary Update a schedule
+// @Description Replace the settings of a schedule, enable or disable it; its next occurrence is computed again
+// @Tags Schedules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Schedule name"
+// @Param request body models.UpdateScheduleRequest true "Schedule update request"
+// @Success 200 {object} models.Schedule
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/schedules/{name} [put]
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "update schedules")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateScheduleRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	schedule, err := h.service.UpdateSchedule(account.OrganizationID, c.Param("name"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule godoc
+// @Summary Delete a schedule
+// @Description Delete a schedule with its run history
+// @Tags Schedules
+// @Security BearerAuth
+// @Param name path string true "Schedule name"
+// @Success 204 "No Content"
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/schedules/{name} [delete]
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	account, ok := h.authorize(c, models.Delete, "delete schedules")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSchedule(account.OrganizationID, c.Param("name")); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RunSchedule godoc
+// @Summary Run a schedule now
+// @Description Run the target of a schedule now in the background, even when it's disabled, without changing its next occurrence
+// @Tags Schedules
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Schedule name"
+// @Success 202 {object} models.ScheduleRun
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/schedules/{name}/run [post]
+func (h *ScheduleHandler) RunSchedule(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "run schedules")
+	if !ok {
+		return
+	}
+
+	run, err := h.service.RunSchedule(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// ListScheduleRuns godoc
+// @Summary List the runs of a schedule
+// @Description List the run history of a schedule, the most recent first, with the occurrences skipped
+// @Tags Schedules
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Schedule name"
+// @Param limit query int false "Maximum number of runs" default(100)
+// @Success 200 {array} models.ScheduleRun
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/schedules/{name}/runs [get]
+func (h *ScheduleHandler) ListScheduleRuns(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read schedules")
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			errors.RespondWithError(c, errors.ErrBadRequest.WithDetails("Invalid limit"))
+			return
+		}
+	}
+
+	runs, err := h.service.ListRuns(account.OrganizationID, c.Param("name"), limit)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"net/http"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/common/validation"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/middleware"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
+	"unicorn-api/internal/stores"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// StorageEventHandler manages the notifications invoking functions for the events of the buckets
+type StorageEventHandler struct {
+	service   *services.StorageEventService
+	store     *stores.GORMStorageStore
+	iamStore  stores.IAMStore
+	validator *validation.Validator
+	config    *config.Config
+}
+
+// NewStorageEventHandler creates a new storage event handler
+func NewStorageEventHandler(cfg *config.Config, iamStore stores.IAMStore, store *stores.GORMStorageStore, service *services.StorageEventService) *StorageEventHandler {
+	return &StorageEventHandler{
+		service:   service,
+		store:     store,
+		iamStore:  iamStore,
+		validator: validation.NewValidator(),
+		config:    cfg,
+	}
+}
+
+// ListNotificationsHandler lists the notifications of a bucket
+// @Summary List bucket notifications
+// @Description List the notifications invoking functions for the events of a bucket
+// @Tags Storage
+// @Produce json
+// @Security BearerAuth
+// @Param bucket_id path string true "Bucket ID"
+// @Success 200 {array} models.BucketNotification
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Forbidden - insufficient permissions"
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/buckets/{bucket_id}/notifications [get]
+func (h *StorageEventHandler) ListNotificationsHandler(c *gin.Context) {
+	bucket, _, ok := h.authorizeBucket(c, models.Read)
+	if !ok {
+		return
+	}
+
+	notifications, err := h.service.ListNotifications(bucket.ID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+// CreateNotificationHandler adds a notification to a bucket
+// @Summary Create bucket notification
+// @Description Invoke a function of the organization for the files created or deleted in a bucket, filtered by name prefix and suffix. The function runs on behalf of the caller with the event on its standard input.
+// @Tags Storage
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param bucket_id path string true "Bucket ID"
+// @Param request body models.CreateBucketNotificationRequest true "Notification"
+// @Success 201 {object} models.BucketNotification
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Forbidden - insufficient permissions"
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/buckets/{bucket_id}/notifications [post]
+func (h *StorageEventHandler) CreateNotificationHandler(c *gin.Context) {
+	bucket, account, ok := h.authorizeBucket(c, models.Write)
+	if !ok {
+		return
+	}
+
+	var req models.CreateBucketNotificationRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	notification, err := h.service.CreateNotification(bucket.ID, account, req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, notification)
+}
+
+// DeleteNotificationHandler deletes a notification of a bucket
+// @Summary Delete bucket notification
+// @Description Stop invoking a function for the events of a bucket, the past deliveries are kept
+// @Tags Storage
+// @Security BearerAuth
+// @Param bucket_id path string true "Bucket ID"
+// @Param notification_id path string true "Notification ID"
+// @Success 204 {object} nil
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Forbidden - insufficient permissions"
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/buckets/{bucket_id}/notifications/{notification_id} [delete]
+func (h *StorageEventHandler) DeleteNotificationHandler(c *gin.Context) {
+	bucket, _, ok := h.authorizeBucket(c, models.Delete)
+	if !ok {
+		return
+	}
+
+	notificationID, err := uuid.Parse(c.Param("notification_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid notification id"})
+		return
+	}
+
+	if err := h.service.DeleteNotification(bucket.ID, notificationID); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveriesHandler lists the deliveries of the events of a bucket
+// @Summary List bucket event deliveries
+// @Description List the invocations of functions for the events of a bucket, the most recent first
+// @Tags Storage
+// @Produce json
+// @Security BearerAuth
+// @Param bucket_id path string true "Bucket ID"
+// @Param status query string false "Filter by status" Enums(pending, succeeded, failed)
+// @Success 200 {array} models.StorageEventDelivery
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Forbidden - insufficient permissions"
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/buckets/{bucket_id}/notifications/deliveries [get]
+func (h *StorageEventHandler) ListDeliveriesHandler(c *gin.Context) {
+	bucket, _, ok := h.authorizeBucket(c, models.Read)
+	if !ok {
+		return
+	}
+
+	status := models.StorageEventDeliveryStatus(c.Query("status"))
+	switch status {
+	case "", models.StorageEventDeliveryPending, models.StorageEventDeliverySucceeded, models.StorageEventDeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid delivery status"})
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(bucket.ID, status)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// authorizeBucket checks that the caller owns the bucket of the request and has the permission,
+// responding otherwise
+func (h *StorageEventHandler) authorizeBucket(c *gin.Context, required models.Permission) (*models.StorageBucket, *models.Account, bool) {
+	claims, exists := middleware.GetClaimsFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid or missing token"})
+		return nil, nil, false
+	}
+
+	account, err := h.iamStore.GetAccountByID(claims.AccountID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid user id in token"})
+		return nil, nil, false
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucket_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid bucket id"})
+		return nil, nil, false
+	}
+
+	bucket, err := h.store.GetBucketByID(bucketID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "bucket not found"})
+		return nil, nil, false
+	}
+
+	if bucket.UserID != account.ID {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "permission denied: bucket does not belong to user"})
+		return nil, nil, false
+	}
+
+	role, err := h.iamStore.GetRoleByID(account.RoleID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to fetch user permissions"})
+		return nil, nil, false
+	}
+
+	if !hasPermission(role.Permissions, required) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "permission denied: insufficient permissions"})
+		return nil, nil, false
+	}
+
+	return bucket, account, true
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"net/http"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/common/validation"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/middleware"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
+	"unicorn-api/internal/stores"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WorkflowHandler manages the workflows of the organizations and their executions
+type WorkflowHandler struct {
+	service   *services.WorkflowService
+	iamStore  stores.IAMStore
+	validator *validation.Validator
+	config    *config.Config
+}
+
+// NewWorkflowHandler creates a new workflow handler
+func NewWorkflowHandler(cfg *config.Config, iamStore stores.IAMStore, service *services.WorkflowService) *WorkflowHandler {
+	return &WorkflowHandler{
+		service:   service,
+		iamStore:  iamStore,
+		validator: validation.NewValidator(),
+		config:    cfg,
+	}
+}
+
+// authorize checks the permission of the caller and returns its account,
+// the error response is sent when it fails
+func (h *WorkflowHandler) authorize(c *gin.Context, perm models.Permission, action string) (*models.Account, bool) {
+	claims, exists := middleware.GetClaimsFromContext(c)
+	if !exists {
+		errors.RespondWithError(c, errors.ErrUnauthorized)
+		return nil, false
+	}
+
+	role, err := h.iamStore.GetRoleByID(claims.RoleID)
+	if err != nil || !hasPermission(role.Permissions, perm) {
+		errors.RespondWithPermissionError(c, action)
+		return nil, false
+	}
+
+	account, err := h.iamStore.GetAccountByID(claims.AccountID)
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrUnauthorized.WithDetails("Account not found"))
+		return nil, false
+	}
+
+	return account, true
+}
+
+// ListWorkflows godoc
+// @Summary List workflows
+// @Description List the workflows of the organization of the caller
+// @Tags Workflows
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Workflow
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 500 {object} errors.AppError
+// @Router /api/v1/workflows [get]
+func (h *WorkflowHandler) ListWorkflows(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "list workflows")
+	if !ok {
+		return
+	}
+
+	workflows, err := h.service.ListWorkflows(account.OrganizationID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workflows)
+}
+
+// CreateWorkflow godoc
+// @Summary Create a workflow
+// @Description Create a workflow in the organization of the caller: a state machine of task, choice, parallel, wait, succeed and fail states invoking its functions
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateWorkflowRequest true "Workflow creation request"
+// @Success 201 {object} models.Workflow
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError "A function of the tasks doesn't exist"
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/workflows [post]
+func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "create workflows")
+	if !ok {
+		return
+	}
+
+	var req models.CreateWorkflowRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	workflow, err := h.service.CreateWorkflow(account.OrganizationID, req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, workflow)
+}
+
+// GetWorkflow godoc
+// @Summary Get a workflow
+// @Description Get a workflow with its definition
+// @Tags Workflows
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Workflow name"
+// @Success 200 {object} models.Workflow
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/workflows/{name} [get]
+func (h *WorkflowHandler) GetWorkflow(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read workflows")
+	if !ok {
+		return
+	}
+
+	workflow, err := h.service.GetWorkflow(account.OrganizationID, c.Param("name"))
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// UpdateWorkflow godoc
+// @Summary Update a workflow
+// @Description Replace the definition of a workflow, the running executions keep the definition they started with
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Workflow name"
+// @Param request body models.UpdateWorkflowRequest true "Workflow update request"
+// @Success 200 {object} models.Workflow
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/workflows/{name} [put]
+func (h *WorkflowHandler) UpdateWorkflow(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "update workflows")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWorkflowRequest
+	if err := h.validator.BindAndValidate(c, &req); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	workflow, err := h.service.UpdateWorkflow(account.OrganizationID, c.Param("name"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// DeleteWorkflow godoc
+// @Summary Delete a workflow
+// @Description Delete a workflow with the history of its executions, none of them can be running
+// @Tags Workflows
+// @Security BearerAuth
+// @Param name path string true "Workflow name"
+// @Success 204 "No Content"
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/workflows/{name} [delete]
+func (h *WorkflowHandler) DeleteWorkflow(c *gin.Context) {
+	account, ok := h.authorize(c, models.Delete, "delete workflows")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteWorkflow(account.OrganizationID, c.Param("name")); err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// StartExecution godoc
+// @Summary Start a workflow execution
+// @Description Start an execution of a workflow on an input, it runs in the background and its functions run on behalf of the caller
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Workflow name"
+// @Param request body models.StartWorkflowExecutionRequest false "Execution input"
+// @Success 202 {object} models.WorkflowExecution
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/workflows/{name}/executions [post]
+func (h *WorkflowHandler) StartExecution(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "start workflows")
+	if !ok {
+		return
+	}
+
+	// the body is optional, the execution starts with a null input
+	var req models.StartWorkflowExecutionRequest
+	if c.Request.ContentLength != 0 {
+		if err := h.validator.BindAndValidate(c, &req); err != nil {
+			errors.RespondWithError(c, err)
+			return
+		}
+	}
+
+	execution, err := h.service.StartExecution(account.OrganizationID, account.ID, c.Param("name"), req)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, execution)
+}
+
+// ListExecutions godoc
+// @Summary List workflow executions
+// @Description List the executions of a workflow without their history, the most recent first
+// @Tags Workflows
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Workflow name"
+// @Param status query string false "Only the executions with this status" Enums(running, succeeded, failed, cancelled)
+// @Success 200 {array} models.WorkflowExecution
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/workflows/{name}/executions [get]
+func (h *WorkflowHandler) ListExecutions(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read workflows")
+	if !ok {
+		return
+	}
+
+	status := models.WorkflowExecutionStatus(c.Query("status"))
+	executions, err := h.service.ListExecutions(account.OrganizationID, c.Param("name"), status)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, executions)
+}
+
+// DescribeExecution godoc
+// @Summary Describe a workflow execution
+// @Description Get the status, input, output or error of an execution with the history of its states
+// @Tags Workflows
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Workflow name"
+// @Param execution_id path string true "Execution ID"
+// @Success 200 {object} models.WorkflowExecution
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/workflows/{name}/executions/{execution_id} [get]
+func (h *WorkflowHandler) DescribeExecution(c *gin.Context) {
+	account, ok := h.authorize(c, models.Read, "read workflows")
+	if !ok {
+		return
+	}
+
+	executionID, err := uuid.Parse(c.Param("execution_id"))
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrBadRequest.WithDetails("Invalid execution ID"))
+		return
+	}
+
+	execution, err := h.service.DescribeExecution(account.OrganizationID, c.Param("name"), executionID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, execution)
+}
+
+// CancelExecution godoc
+// @Summary Cancel a workflow execution
+// @Description Stop a running execution, the function running is interrupted. When another replica of the API runs it, the execution is returned once that replica cancelled it or after a short wait.
+// @Tags Workflows
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Workflow name"
+// @Param execution_id path string true "Execution ID"
+// @Success 200 {object} models.WorkflowExecution
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 409 {object} errors.AppError "The execution already ended"
+// @Router /api/v1/workflows/{name}/executions/{execution_id}/cancel [post]
+func (h *WorkflowHandler) CancelExecution(c *gin.Context) {
+	account, ok := h.authorize(c, models.Write, "cancel workflows")
+	if !ok {
+		return
+	}
+
+	executionID, err := uuid.Parse(c.Param("execution_id"))
+	if err != nil {
+		errors.RespondWithError(c, errors.ErrBadRequest.WithDetails("Invalid execution ID"))
+		return
+	}
+
+	execution, err := h.service.CancelExecution(account.OrganizationID, c.Param("name"), executionID)
+	if err != nil {
+		errors.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, execution)
+}
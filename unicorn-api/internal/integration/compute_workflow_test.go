@@ -2,66 +2,25 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
-	"unicorn-api/internal/config"
-	"unicorn-api/internal/handlers"
+	"unicorn-api/internal/containers"
 	"unicorn-api/internal/models"
-	"unicorn-api/internal/routes"
 	"unicorn-api/internal/services"
 	"unicorn-api/internal/stores"
 )
 
-func setupTestServer() *gin.Engine {
-	_ = os.Remove("test.db") // Ensure fresh DB for each test
-	cfg := config.New()
-	cfg.JWTSecret = "test-secret" // Ensure consistent JWT secret for test
-	store, _ := stores.NewGORMIAMStore("test.db")
-	secretsStore, err := stores.NewSecretStore("test.db")
-	if err != nil {
-		panic("failed to initialize secrets store: " + err.Error())
-	}
-	monitoringStore, err := stores.NewGORMMonitoringStore("test.db")
-	if err != nil {
-		panic("failed to initialize monitoring store: " + err.Error())
-	}
-	monitoringService := services.NewMonitoringService(monitoringStore, store)
-
-	_ = store.SeedAdmin(cfg)
-	iamHandler := handlers.NewIAMHandler(store, cfg)
-	secretsHandler := handlers.NewSecretsHandler(secretsStore, store, cfg)
-	computeHandler := handlers.NewComputeHandler(cfg, store, monitoringService)
-	storageHandler := handlers.NewStorageHandler(&stores.GORMStorageStore{}, store, cfg)
-	lambdaHandler := handlers.NewLambdaHandler(cfg, store)
-	rdbHandler := handlers.NewRDBHandler(cfg, store)
-	monitoringHandler := handlers.NewMonitoringHandler(cfg, store, monitoringStore)
-	router := gin.Default()
-	routes.SetupRoutes(router, iamHandler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler, cfg)
-	return router
-}
-
 func TestComputeCreateAndList(t *testing.T) {
-	if os.Getenv("SKIP_DOCKER_TESTS") == "1" {
-		t.Skip("Skipping Docker integration test")
-	}
-
-	// Check if Docker is available by trying to create a client
-	// If Docker is not available, skip the test
-	if os.Getenv("DOCKER_HOST") == "" {
-		// Try to detect if Docker is running
-		_, err := os.Stat("/var/run/docker.sock")
-		if err != nil {
-			t.Skip("Docker not available - skipping compute test")
-		}
-	}
-	router := setupTestServer()
+	router := newAdminTestServer(t).Router
 
 	// Login as admin to get JWT token
 	loginReq := map[string]string{"email": "admin@unicorn.local", "password": "admin123"}
@@ -102,3 +61,352 @@ func TestComputeCreateAndList(t *testing.T) {
 	_ = json.Unmarshal(w2.Body.Bytes(), &containers)
 	assert.GreaterOrEqual(t, len(containers), 1)
 }
+
+func TestComputeLifecycle(t *testing.T) {
+	server := newAdminTestServer(t)
+	router, monitoringStore := server.Router, server.MonitoringStore
+
+	loginBody, _ := json.Marshal(map[string]string{"email": "admin@unicorn.local", "password": "admin123"})
+	login := httptest.NewRequest("POST", "/api/v1/login", bytes.NewReader(loginBody))
+	login.Header.Set("Content-Type", "application/json")
+	loginW := httptest.NewRecorder()
+	router.ServeHTTP(loginW, login)
+	require.Equal(t, http.StatusOK, loginW.Code)
+	var loginResp map[string]interface{}
+	_ = json.Unmarshal(loginW.Body.Bytes(), &loginResp)
+	token, _ := loginResp["token"].(string)
+
+	w := functionRequest(router, "POST", "/api/v1/compute/create", token, models.ComputeCreateRequest{
+		Name:        "lifecycle",
+		Image:       "nginx:alpine",
+		Preset:      models.PresetMicro,
+		Ports:       map[string]string{"80": "18080"},
+		Environment: map[string]string{"MODE": "blue"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created models.ComputeContainerInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	usageStatus := func(id string) models.ResourceStatus {
+		usage, err := monitoringStore.GetResourceUsageByResourceID(id, models.ResourceTypeCompute)
+		require.NoError(t, err)
+		return usage.Status
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		w := functionRequest(router, "GET", "/api/v1/compute/"+created.ID, token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var detail models.ComputeContainerDetail
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+		assert.Equal(t, "lifecycle", detail.Name)
+		assert.Equal(t, "running", detail.State)
+		assert.Equal(t, map[string]string{"MODE": "blue"}, detail.Environment)
+		assert.Equal(t, models.PresetMicro, detail.Preset)
+		assert.Equal(t, "18080", detail.Ports["80"])
+		assert.Equal(t, int64(256*1024*1024), detail.MemoryBytes)
+
+		w = functionRequest(router, "GET", "/api/v1/compute/missing", token, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Stop, start and restart", func(t *testing.T) {
+		w := functionRequest(router, "POST", "/api/v1/compute/"+created.ID+"/stop", token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var detail models.ComputeContainerDetail
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+		assert.Equal(t, "exited", detail.State)
+		assert.Equal(t, models.ResourceStatusInactive, usageStatus(created.ID), "billing stops")
+
+		w = functionRequest(router, "POST", "/api/v1/compute/"+created.ID+"/start", token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+		assert.Equal(t, "running", detail.State)
+		usage, err := monitoringStore.GetResourceUsageByResourceID(created.ID, models.ResourceTypeCompute)
+		require.NoError(t, err)
+		assert.Equal(t, models.ResourceStatusActive, usage.Status)
+		assert.Greater(t, usage.InactiveHours, 0.0, "the stopped time isn't billed")
+
+		w = functionRequest(router, "POST", "/api/v1/compute/"+created.ID+"/restart", token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+		assert.Equal(t, "running", detail.State)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		w := functionRequest(router, "PUT", "/api/v1/compute/"+created.ID, token, map[string]interface{}{"preset": "huge"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = functionRequest(router, "POST", "/api/v1/schedules", token, models.CreateScheduleRequest{
+			Name:       "nightly-stop",
+			Expression: "cron(0 22 * * *)",
+			Target:     models.ScheduleTarget{Type: models.ScheduleTargetCompute, ContainerID: created.ID, Action: models.ScheduleComputeStop},
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		w = functionRequest(router, "PUT", "/api/v1/compute/"+created.ID, token, models.ComputeUpdateRequest{
+			Preset:      models.PresetSmall,
+			Environment: map[string]string{"MODE": "green"},
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var updated models.ComputeContainerDetail
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.NotEqual(t, created.ID, updated.ID, "the container is recreated")
+		assert.Equal(t, "lifecycle", updated.Name)
+		assert.Equal(t, "running", updated.State)
+		assert.Equal(t, "18080", updated.Ports["80"], "the ports are kept")
+		assert.Equal(t, map[string]string{"MODE": "green"}, updated.Environment)
+		assert.Equal(t, models.PresetSmall, updated.Preset)
+		assert.Equal(t, int64(512*1024*1024), updated.MemoryBytes)
+
+		w = functionRequest(router, "GET", "/api/v1/compute/"+created.ID, token, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, models.ResourceStatusDeleted, usageStatus(created.ID))
+		assert.Equal(t, models.ResourceStatusActive, usageStatus(updated.ID))
+
+		// the schedules follow the recreated container
+		w = functionRequest(router, "GET", "/api/v1/schedules/nightly-stop", token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var schedule models.Schedule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+		assert.Equal(t, updated.ID, schedule.Target.ContainerID)
+
+		w = functionRequest(router, "DELETE", "/api/v1/compute/"+updated.ID, token, nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+}
+
+func TestComputeInventoryReconciliation(t *testing.T) {
+	cfg := testConfig()
+	cfg.ComputeReconcileInterval = 20 * time.Millisecond
+	server := newTestServer(t, cfg, nil)
+	router, runtime, monitoringStore := server.Router, server.Runtime, server.MonitoringStore
+	ctx := context.Background()
+
+	orgID := createTestOrganization(t, router, "Compute Org")
+	roleID := createTestRole(t, router, "compute_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "compute@example.com", "computepass")
+
+	w := functionRequest(router, "POST", "/api/v1/compute/create", user.Token, models.ComputeCreateRequest{
+		Name:        "web",
+		Image:       "nginx:alpine",
+		Ports:       map[string]string{"80": "18081"},
+		Environment: map[string]string{"MODE": "blue"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created models.ComputeContainerInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	instances := func(query string) []models.ComputeInstance {
+		w := functionRequest(router, "GET", "/api/v1/compute/instances"+query, user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var instances []models.ComputeInstance
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &instances))
+		return instances
+	}
+	driftOf := func(containerID string) models.ComputeDrift {
+		for _, instance := range instances("") {
+			if instance.ContainerID == containerID {
+				return instance.Drift
+			}
+		}
+		return "unknown"
+	}
+	usageStatus := func(containerID string) models.ResourceStatus {
+		usage, err := monitoringStore.GetResourceUsageByResourceID(containerID, models.ResourceTypeCompute)
+		if err != nil {
+			return ""
+		}
+		return usage.Status
+	}
+	healthStatus := func(containerID string) string {
+		metrics, err := monitoringStore.GetMonitoringMetricsByResource(containerID, models.ResourceTypeCompute)
+		if err != nil {
+			return ""
+		}
+		return metrics.HealthStatus
+	}
+
+	t.Run("Inventory", func(t *testing.T) {
+		list := instances("")
+		require.Len(t, list, 1)
+		instance := list[0]
+		assert.Equal(t, created.ID, instance.ContainerID)
+		assert.Equal(t, orgID, instance.OrganizationID.String())
+		assert.Equal(t, models.ComputeDesiredRunning, instance.DesiredState)
+		assert.Equal(t, "running", instance.ObservedState)
+		assert.Equal(t, map[string]string{"MODE": "blue"}, instance.Environment)
+		assert.Equal(t, models.ComputeDriftNone, instance.Drift)
+
+		// the list is served from the inventory, with the time the instance was created
+		var first, second []models.ComputeContainerInfo
+		require.NoError(t, json.Unmarshal(functionRequest(router, "GET", "/api/v1/compute/list", user.Token, nil).Body.Bytes(), &first))
+		time.Sleep(1100 * time.Millisecond)
+		require.NoError(t, json.Unmarshal(functionRequest(router, "GET", "/api/v1/compute/list", user.Token, nil).Body.Bytes(), &second))
+		require.Len(t, first, 1)
+		assert.Equal(t, first[0].CreatedAt, second[0].CreatedAt)
+		assert.Equal(t, "18081", first[0].Ports["80/tcp"])
+	})
+
+	t.Run("Crashed", func(t *testing.T) {
+		require.NoError(t, runtime.StopContainer(ctx, created.ID))
+		require.Eventually(t, func() bool { return driftOf(created.ID) == models.ComputeDriftCrashed }, 5*time.Second, 20*time.Millisecond)
+		require.Eventually(t, func() bool { return healthStatus(created.ID) == "crashed" }, 5*time.Second, 20*time.Millisecond)
+		assert.Equal(t, models.ResourceStatusInactive, usageStatus(created.ID), "a crashed container isn't billed")
+
+		drifted := instances("?drifted=true")
+		require.Len(t, drifted, 1)
+		assert.Equal(t, "exited", drifted[0].ObservedState)
+		assert.NotNil(t, drifted[0].DriftDetectedAt)
+
+		// starting it through the API clears the drift
+		w := functionRequest(router, "POST", "/api/v1/compute/"+created.ID+"/start", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var detail models.ComputeContainerDetail
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+		assert.Equal(t, models.ComputeDriftNone, detail.Drift)
+		assert.Equal(t, models.ResourceStatusActive, usageStatus(created.ID))
+		require.Eventually(t, func() bool { return healthStatus(created.ID) == "healthy" }, 5*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("Altered", func(t *testing.T) {
+		require.NoError(t, runtime.AlterContainer(created.ID, func(c *containers.Container) {
+			c.Memory = 1024 * 1024 * 1024
+			c.Env = []string{"MODE=green"}
+		}))
+		require.Eventually(t, func() bool { return driftOf(created.ID) == models.ComputeDriftAltered }, 5*time.Second, 20*time.Millisecond)
+
+		w := functionRequest(router, "GET", "/api/v1/compute/"+created.ID, user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var detail models.ComputeContainerDetail
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+		assert.Equal(t, models.ComputeDriftAltered, detail.Drift)
+		assert.Equal(t, "the environment variable MODE changed; the resource limits changed", detail.DriftDetails)
+	})
+
+	t.Run("Vanished", func(t *testing.T) {
+		require.NoError(t, runtime.StopContainer(ctx, created.ID))
+		require.NoError(t, runtime.RemoveContainer(ctx, created.ID))
+		require.Eventually(t, func() bool { return driftOf(created.ID) == models.ComputeDriftVanished }, 5*time.Second, 20*time.Millisecond)
+		require.Eventually(t, func() bool { return usageStatus(created.ID) == models.ResourceStatusInactive }, 5*time.Second, 20*time.Millisecond)
+
+		instance := instances("?drifted=true")[0]
+		assert.Equal(t, models.ComputeObservedMissing, instance.ObservedState)
+	})
+
+	t.Run("Adopted", func(t *testing.T) {
+		accountID := instances("")[0].AccountID.String()
+
+		// a container created before the inventory existed
+		id, err := runtime.CreateContainer(ctx, containers.ContainerSpec{
+			Name:   "legacy",
+			Image:  "nginx:alpine",
+			Labels: map[string]string{"owner": accountID},
+			Ports:  []containers.PortBinding{{ContainerPort: "80", HostPort: "18082"}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, runtime.StartContainer(ctx, id))
+
+		require.Eventually(t, func() bool { return driftOf(id) == models.ComputeDriftNone }, 5*time.Second, 20*time.Millisecond)
+		require.Eventually(t, func() bool { return usageStatus(id) == models.ResourceStatusActive }, 5*time.Second, 20*time.Millisecond,
+			"the adopted container is billed")
+
+		var list []models.ComputeContainerInfo
+		require.NoError(t, json.Unmarshal(functionRequest(router, "GET", "/api/v1/compute/list", user.Token, nil).Body.Bytes(), &list))
+		assert.Len(t, list, 2)
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		var list []models.ComputeContainerInfo
+		require.NoError(t, json.Unmarshal(functionRequest(router, "GET", "/api/v1/compute/list", user.Token, nil).Body.Bytes(), &list))
+		var legacy string
+		for _, container := range list {
+			if container.Name == "legacy" {
+				legacy = container.ID
+			}
+		}
+		require.NotEmpty(t, legacy)
+
+		w := functionRequest(router, "DELETE", "/api/v1/compute/"+legacy, user.Token, nil)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		for _, instance := range instances("") {
+			assert.NotEqual(t, legacy, instance.ContainerID, "the deleted instances are left out")
+		}
+		var deleted *models.ComputeInstance
+		all := instances("?include_deleted=true")
+		for i := range all {
+			if all[i].ContainerID == legacy {
+				deleted = &all[i]
+			}
+		}
+		require.NotNil(t, deleted, "the deleted instances are kept")
+		assert.Equal(t, models.ComputeDesiredDeleted, deleted.DesiredState)
+		assert.NotNil(t, deleted.DeletedAt)
+		assert.Equal(t, models.ComputeDriftNone, deleted.Drift)
+	})
+}
+
+// inspectGate holds the result of the first inspection of a container until it's released
+type inspectGate struct {
+	*containers.Fake
+	held     atomic.Bool
+	entered  chan struct{}
+	released chan struct{}
+}
+
+func (g *inspectGate) InspectContainer(ctx context.Context, id string) (*containers.Container, error) {
+	c, err := g.Fake.InspectContainer(ctx, id)
+	if g.held.CompareAndSwap(false, true) {
+		close(g.entered)
+		<-g.released
+	}
+	return c, err
+}
+
+func TestComputeReconciliationDoesNotBlockChanges(t *testing.T) {
+	server := newTestServer(t, testConfig(), nil)
+	router := server.Router
+
+	orgID := createTestOrganization(t, router, "Compute Org")
+	roleID := createTestRole(t, router, "compute_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	createTestUser(t, router, orgID, roleID, "compute@example.com", "computepass")
+	account, err := server.IAMStore.GetAccountByEmail("compute@example.com")
+	require.NoError(t, err)
+
+	computeStore, err := stores.NewGORMComputeStore(server.DSN)
+	require.NoError(t, err)
+	compute := services.NewComputeService(server.Runtime, computeStore, server.IAMStore)
+	created, err := compute.CreateContainer(account.ID, models.ComputeCreateRequest{Name: "web", Image: "nginx:alpine"})
+	require.NoError(t, err)
+
+	gate := &inspectGate{Fake: server.Runtime, entered: make(chan struct{}), released: make(chan struct{})}
+	compute = services.NewComputeService(gate, computeStore, server.IAMStore)
+
+	reconciled := make(chan []services.ComputeChange)
+	go func() {
+		changes, err := compute.Reconcile(context.Background())
+		assert.NoError(t, err)
+		reconciled <- changes
+	}()
+	<-gate.entered
+
+	// the reconciliation is inspecting the container, it doesn't hold up the changes
+	stopped := make(chan error)
+	go func() { stopped <- compute.StopContainer(account.ID, created.ID) }()
+	select {
+	case err := <-stopped:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		close(gate.released)
+		t.Fatal("the container was not stopped while the containers were reconciled")
+	}
+	close(gate.released)
+
+	// what it inspected before the change isn't recorded over it
+	<-reconciled
+	instance, err := computeStore.GetInstance(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ComputeDesiredStopped, instance.DesiredState)
+	assert.Equal(t, "exited", instance.ObservedState)
+	assert.Equal(t, models.ComputeDriftNone, instance.Drift)
+}
@@ -0,0 +1,1249 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unicorn-api/internal/auth"
+	"unicorn-api/internal/handlers"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
+	"unicorn-api/internal/stores"
+)
+
+// fakeLambdaAPI records the execution requests it receives and answers them with the
+// task status, successful unless changed, and the standard output returned by Stdout.
+// While a gate is set, the answers wait for it to be closed.
+type fakeLambdaAPI struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	requests      []models.LambdaExecuteRequest
+	authorization []string
+	status        string
+	statusOf      func(req models.LambdaExecuteRequest) string
+	gate          chan struct{}
+	Stdout        func(req models.LambdaExecuteRequest) string
+}
+
+func newFakeLambdaAPI() *fakeLambdaAPI {
+	fake := &fakeLambdaAPI{
+		status: models.LambdaTaskSuccessful,
+		Stdout: func(models.LambdaExecuteRequest) string { return "ok\n" },
+	}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.LambdaExecuteRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		fake.mu.Lock()
+		gate := fake.gate
+		fake.mu.Unlock()
+		if gate != nil {
+			<-gate
+		}
+
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, req)
+		fake.authorization = append(fake.authorization, r.Header.Get("Authorization"))
+		stdout := fake.Stdout(req)
+		status := fake.status
+		if fake.statusOf != nil {
+			status = fake.statusOf(req)
+		}
+		fake.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     uuid.New(),
+			"status": status,
+			"output": map[string]interface{}{
+				"compile": map[string]interface{}{},
+				"run":     map[string]interface{}{"stdout": stdout, "output": stdout, "time": 12, "memory": 1 << 20},
+			},
+		})
+	}))
+	return fake
+}
+
+func (f *fakeLambdaAPI) SetStdout(stdout func(req models.LambdaExecuteRequest) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Stdout = stdout
+}
+
+// SetStatusFunc answers each request with its own status, instead of the one set by SetStatus
+func (f *fakeLambdaAPI) SetStatusFunc(status func(req models.LambdaExecuteRequest) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statusOf = status
+}
+
+func (f *fakeLambdaAPI) SetGate(gate chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gate = gate
+}
+
+func (f *fakeLambdaAPI) SetStatus(status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakeLambdaAPI) LastAuthorization() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.authorization[len(f.authorization)-1]
+}
+
+func (f *fakeLambdaAPI) Requests() []models.LambdaExecuteRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.LambdaExecuteRequest(nil), f.requests...)
+}
+
+func setupFunctionIntegrationTest(t *testing.T, lambdaURL string) *gin.Engine {
+	cfg := testConfig()
+	cfg.LambdaURL = lambdaURL
+	return newTestServer(t, cfg, nil).Router
+}
+
+func functionRequest(router *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestFunctionVersionsAndAliases(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	router := setupFunctionIntegrationTest(t, lambda.URL)
+
+	orgID := createTestOrganization(t, router, "Function Org")
+	roleID := createTestRole(t, router, "function_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "functions@example.com", "functionpass")
+
+	create := models.CreateFunctionRequest{
+		Name:        "greet",
+		Runtime:     models.FunctionRuntime{Name: "python3", Version: "3.12"},
+		Files:       []models.LambdaFile{{Name: "main.py", Contents: "print('v1')"}},
+		Environment: map[string]string{"STAGE": "dev", "GREETING": "hello"},
+	}
+	w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// the same name can't be created twice
+	w = functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// only the files change, the rest is kept from version 1
+	update := models.UpdateFunctionRequest{
+		Files: []models.LambdaFile{{Name: "main.py", Contents: "print('v2')"}},
+	}
+	w = functionRequest(router, "PUT", "/api/v1/lambda/functions/greet", user.Token, update)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var version models.FunctionVersion
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &version))
+	assert.Equal(t, 2, version.Version)
+	assert.Equal(t, "python3", version.Runtime.Name)
+	assert.Equal(t, "dev", version.Environment["STAGE"])
+
+	w = functionRequest(router, "PUT", "/api/v1/lambda/functions/greet/aliases/prod", user.Token, models.PutFunctionAliasRequest{Version: 1})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// aliases can't shadow version numbers, nor point to missing versions
+	w = functionRequest(router, "PUT", "/api/v1/lambda/functions/greet/aliases/2", user.Token, models.PutFunctionAliasRequest{Version: 1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = functionRequest(router, "PUT", "/api/v1/lambda/functions/greet/aliases/next", user.Token, models.PutFunctionAliasRequest{Version: 7})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = functionRequest(router, "GET", "/api/v1/lambda/functions/greet", user.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var function models.Function
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &function))
+	assert.Equal(t, 2, function.LatestVersion)
+	require.Len(t, function.Aliases, 1)
+	assert.Equal(t, "prod", function.Aliases[0].Name)
+
+	w = functionRequest(router, "GET", "/api/v1/lambda/functions/greet/versions", user.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var versions []models.FunctionVersion
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &versions))
+	assert.Len(t, versions, 2)
+
+	t.Run("Invoke the latest version", func(t *testing.T) {
+		w := functionRequest(router, "POST", "/api/v1/lambda/functions/greet/invoke", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "2", w.Header().Get("X-Function-Version"))
+
+		requests := lambda.Requests()
+		last := requests[len(requests)-1]
+		assert.Equal(t, "print('v2')", last.Project.Files[0].Contents)
+	})
+
+	t.Run("Invoke an alias with overrides", func(t *testing.T) {
+		invoke := models.InvokeFunctionRequest{
+			Qualifier:     "prod",
+			StandardInput: "world",
+			Environment:   map[string]string{"GREETING": "hi"},
+		}
+		w := functionRequest(router, "POST", "/api/v1/lambda/functions/greet/invoke", user.Token, invoke)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "1", w.Header().Get("X-Function-Version"))
+
+		requests := lambda.Requests()
+		last := requests[len(requests)-1]
+		assert.Equal(t, "python3", last.Runtime.Name)
+		assert.Equal(t, "print('v1')", last.Project.Files[0].Contents)
+		assert.Equal(t, "world", last.Process.StandardInput)
+		assert.Equal(t, map[string]string{"STAGE": "dev", "GREETING": "hi"}, last.Process.EnvironmentVars)
+	})
+
+	t.Run("Invoke a missing version", func(t *testing.T) {
+		w := functionRequest(router, "POST", "/api/v1/lambda/functions/greet/invoke?qualifier=9", user.Token, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Functions are scoped to the organization", func(t *testing.T) {
+		otherOrgID := createTestOrganization(t, router, "Other Function Org")
+		other := createTestUser(t, router, otherOrgID, roleID, "other-functions@example.com", "functionpass")
+
+		w := functionRequest(router, "GET", "/api/v1/lambda/functions/greet", other.Token, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	w = functionRequest(router, "DELETE", "/api/v1/lambda/functions/greet", user.Token, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = functionRequest(router, "GET", "/api/v1/lambda/functions/greet", user.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFunctionURL(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	router := setupFunctionIntegrationTest(t, lambda.URL)
+
+	orgID := createTestOrganization(t, router, "Function URL Org")
+	roleID := createTestRole(t, router, "function_url_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "function-urls@example.com", "functionpass")
+
+	create := models.CreateFunctionRequest{
+		Name:    "web",
+		Runtime: models.FunctionRuntime{Name: "python3"},
+		Files:   []models.LambdaFile{{Name: "main.py", Contents: "print('hi')"}},
+	}
+	w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// the function answers with the event it received
+	lambda.SetStdout(func(req models.LambdaExecuteRequest) string {
+		out, _ := json.Marshal(models.FunctionHTTPResponse{
+			StatusCode: http.StatusCreated,
+			Headers: map[string]string{
+				"Content-Type":            "application/json",
+				"X-Handled-By":            "web",
+				"Set-Cookie":              "session=stolen",
+				"Content-Security-Policy": "default-src *",
+			},
+			Body: req.Process.StandardInput,
+		})
+		return string(out)
+	})
+
+	// the Lambda API gets a token only running functions, on behalf of the account it names
+	cfg := testConfig()
+	invocationAccount := func(authorization string) string {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		_, err := auth.ValidateToken(token, cfg)
+		assert.Error(t, err, "the API rejects the invocation tokens")
+		w := functionRequest(router, "GET", "/api/v1/lambda/functions", token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		claims, err := auth.ValidateInvocationToken(token, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, auth.ScopeInvoke, claims.Scope)
+		assert.Empty(t, claims.RoleID)
+		return claims.AccountID
+	}
+	userClaims, err := auth.ValidateToken(user.Token, cfg)
+	require.NoError(t, err)
+
+	invoke := func(method, path string, header http.Header, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	url := "/fn/" + orgID + "/web"
+
+	w = invoke("GET", url, nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code, "functions have no URL by default")
+
+	t.Run("Public URL", func(t *testing.T) {
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/web/url", user.Token, models.PutFunctionURLRequest{AuthType: models.FunctionURLAuthNone})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response models.FunctionURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Contains(t, response.URL, url)
+		assert.Empty(t, response.APIKey)
+
+		w = invoke("POST", url+"/orders/7?expand=items&expand=customer", http.Header{"X-Trace": {"abc"}}, `{"qty":2}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "web", w.Header().Get("X-Handled-By"))
+		assert.Empty(t, w.Header().Get("Set-Cookie"), "the functions can't set cookies on the origin of the API")
+		assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+		var event models.FunctionHTTPEvent
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &event))
+		assert.Equal(t, "POST", event.Method)
+		assert.Equal(t, "/orders/7", event.Path)
+		assert.Equal(t, "abc", event.Headers["x-trace"])
+		assert.Equal(t, "items,customer", event.Query["expand"])
+		assert.Equal(t, `{"qty":2}`, event.Body)
+		assert.False(t, event.IsBase64Encoded)
+
+		// anonymous calls run on behalf of the publisher
+		assert.Equal(t, userClaims.AccountID, invocationAccount(lambda.LastAuthorization()))
+	})
+
+	t.Run("API key URL", func(t *testing.T) {
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/web/url", user.Token, models.PutFunctionURLRequest{AuthType: models.FunctionURLAuthAPIKey})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response models.FunctionURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.APIKey)
+
+		w = invoke("GET", url, nil, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = invoke("GET", url, http.Header{"X-Api-Key": {"wrong"}}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = invoke("GET", url, http.Header{"X-Api-Key": {response.APIKey}}, "")
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var event models.FunctionHTTPEvent
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &event))
+		assert.NotContains(t, event.Headers, "x-api-key", "the key is not passed to the function")
+
+		// the key is kept until it is rotated
+		w = functionRequest(router, "PUT", "/api/v1/lambda/functions/web/url", user.Token, models.PutFunctionURLRequest{AuthType: models.FunctionURLAuthAPIKey})
+		require.Equal(t, http.StatusOK, w.Code)
+		var unchanged models.FunctionURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &unchanged))
+		assert.Empty(t, unchanged.APIKey)
+
+		w = functionRequest(router, "PUT", "/api/v1/lambda/functions/web/url", user.Token, models.PutFunctionURLRequest{AuthType: models.FunctionURLAuthAPIKey, RotateKey: true})
+		require.Equal(t, http.StatusOK, w.Code)
+		w = invoke("GET", url, http.Header{"X-Api-Key": {response.APIKey}}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("JWT URL", func(t *testing.T) {
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/web/url", user.Token, models.PutFunctionURLRequest{AuthType: models.FunctionURLAuthJWT})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = invoke("GET", url, nil, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		otherOrgID := createTestOrganization(t, router, "Other Function URL Org")
+		other := createTestUser(t, router, otherOrgID, roleID, "other-function-urls@example.com", "functionpass")
+		w = invoke("GET", url, http.Header{"Authorization": {"Bearer " + other.Token}}, "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// the members of the organization need the permission to invoke functions
+		readerRoleID := createTestRole(t, router, "function_url_reader", []models.Permission{models.Read})
+		reader := createTestUser(t, router, orgID, readerRoleID, "function-url-reader@example.com", "functionpass")
+		w = invoke("GET", url, http.Header{"Authorization": {"Bearer " + reader.Token}}, "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = invoke("GET", url, http.Header{"Authorization": {"Bearer " + user.Token}}, "")
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, userClaims.AccountID, invocationAccount(lambda.LastAuthorization()))
+	})
+
+	t.Run("Plain output", func(t *testing.T) {
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/web/url", user.Token, models.PutFunctionURLRequest{AuthType: models.FunctionURLAuthNone})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		lambda.SetStdout(func(models.LambdaExecuteRequest) string { return "hello\n" })
+		w = invoke("GET", url, nil, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "hello\n", w.Body.String())
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+	})
+
+	w = functionRequest(router, "DELETE", "/api/v1/lambda/functions/web/url", user.Token, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = invoke("GET", url, nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStorageEventNotifications(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	router := setupFunctionIntegrationTest(t, lambda.URL)
+
+	orgID := createTestOrganization(t, router, "Storage Events Org")
+	roleID := createTestRole(t, router, "storage_events_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "storage-events@example.com", "eventspass")
+
+	create := models.CreateFunctionRequest{
+		Name:    "thumbnail",
+		Runtime: models.FunctionRuntime{Name: "python3"},
+		Files:   []models.LambdaFile{{Name: "main.py", Contents: "import sys; print(sys.stdin.read())"}},
+	}
+	w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = functionRequest(router, "POST", "/api/v1/buckets", user.Token, map[string]string{"name": "photos"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var bucket models.StorageBucket
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bucket))
+	notifications := "/api/v1/buckets/" + bucket.ID.String() + "/notifications"
+
+	upload := func(name string) models.File {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = part.Write([]byte("fake image"))
+		require.NoError(t, err)
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/v1/buckets/"+bucket.ID.String()+"/files", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var file models.File
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &file))
+		return file
+	}
+
+	deliveries := func(status models.StorageEventDeliveryStatus) []models.StorageEventDelivery {
+		w := functionRequest(router, "GET", notifications+"/deliveries?status="+string(status), user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var deliveries []models.StorageEventDelivery
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deliveries))
+		return deliveries
+	}
+
+	t.Run("Unknown function", func(t *testing.T) {
+		w := functionRequest(router, "POST", notifications, user.Token, models.CreateBucketNotificationRequest{
+			Events:       []models.StorageEventType{models.StorageEventFileCreated},
+			FunctionName: "missing",
+		})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Invalid event", func(t *testing.T) {
+		w := functionRequest(router, "POST", notifications, user.Token, map[string]interface{}{
+			"events":        []string{"file.renamed"},
+			"function_name": "thumbnail",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	var notification models.BucketNotification
+	w = functionRequest(router, "POST", notifications, user.Token, models.CreateBucketNotificationRequest{
+		Events:       []models.StorageEventType{models.StorageEventFileCreated, models.StorageEventFileDeleted},
+		Prefix:       "cat",
+		Suffix:       ".png",
+		FunctionName: "thumbnail",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &notification))
+
+	t.Run("Matching files invoke the function", func(t *testing.T) {
+		upload("notes.txt")
+		upload("dog.png")
+		file := upload("cat-1.png")
+
+		require.Eventually(t, func() bool {
+			return len(deliveries(models.StorageEventDeliverySucceeded)) == 1
+		}, 5*time.Second, 20*time.Millisecond)
+
+		delivery := deliveries("")[0]
+		assert.Equal(t, notification.ID, delivery.NotificationID)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, file.ID, delivery.Event.FileID)
+
+		requests := lambda.Requests()
+		require.Len(t, requests, 1)
+		assert.Equal(t, "low", requests[0].Priority)
+
+		var event models.StorageEvent
+		require.NoError(t, json.Unmarshal([]byte(requests[0].Process.StandardInput), &event))
+		assert.Equal(t, models.StorageEventFileCreated, event.Type)
+		assert.Equal(t, "cat-1.png", event.Name)
+		assert.Equal(t, bucket.ID, event.BucketID)
+	})
+
+	t.Run("Failed invocations are retried", func(t *testing.T) {
+		lambda.SetStatus("runtime_error")
+		file := upload("cat-2.png")
+
+		require.Eventually(t, func() bool {
+			return len(deliveries(models.StorageEventDeliveryFailed)) == 1
+		}, 5*time.Second, 20*time.Millisecond)
+
+		failed := deliveries(models.StorageEventDeliveryFailed)[0]
+		assert.Equal(t, file.ID, failed.Event.FileID)
+		assert.Equal(t, 3, failed.Attempts)
+		assert.Contains(t, failed.LastError, "runtime_error")
+		lambda.SetStatus(models.LambdaTaskSuccessful)
+	})
+
+	t.Run("Deleted files invoke the function", func(t *testing.T) {
+		file := upload("cat-3.png")
+		require.Eventually(t, func() bool {
+			return len(deliveries(models.StorageEventDeliverySucceeded)) == 2
+		}, 5*time.Second, 20*time.Millisecond)
+
+		w := functionRequest(router, "DELETE", "/api/v1/buckets/"+bucket.ID.String()+"/files/"+file.ID.String(), user.Token, nil)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		require.Eventually(t, func() bool {
+			succeeded := deliveries(models.StorageEventDeliverySucceeded)
+			return len(succeeded) == 3 && succeeded[0].Event.Type == models.StorageEventFileDeleted
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("Delete notification", func(t *testing.T) {
+		w := functionRequest(router, "DELETE", notifications+"/"+notification.ID.String(), user.Token, nil)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		w = functionRequest(router, "GET", notifications, user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+
+		before := len(lambda.Requests())
+		upload("cat-4.png")
+		time.Sleep(50 * time.Millisecond)
+		assert.Len(t, lambda.Requests(), before)
+		assert.Len(t, deliveries(""), 4, "past deliveries are kept")
+	})
+}
+
+func TestStorageEventDeliveriesResumed(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	cfg := testConfig()
+	cfg.LambdaURL = lambda.URL
+	server := newTestServer(t, cfg, nil)
+	router := server.Router
+
+	orgID := createTestOrganization(t, router, "Resumed Events Org")
+	roleID := createTestRole(t, router, "resumed_events_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "resumed-events@example.com", "eventspass")
+
+	w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, models.CreateFunctionRequest{
+		Name:    "thumbnail",
+		Runtime: models.FunctionRuntime{Name: "python3"},
+		Files:   []models.LambdaFile{{Name: "main.py", Contents: "print('ok')"}},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = functionRequest(router, "POST", "/api/v1/buckets", user.Token, map[string]string{"name": "resumed"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var bucket models.StorageBucket
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bucket))
+	w = functionRequest(router, "POST", "/api/v1/buckets/"+bucket.ID.String()+"/notifications", user.Token, models.CreateBucketNotificationRequest{
+		Events:       []models.StorageEventType{models.StorageEventFileCreated},
+		FunctionName: "thumbnail",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var notification models.BucketNotification
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &notification))
+
+	// a replica stopped in the middle of a delivery and its lease expired
+	store, err := stores.NewGORMStorageEventStore(server.DSN)
+	require.NoError(t, err)
+	delivery := &models.StorageEventDelivery{
+		NotificationID: notification.ID,
+		BucketID:       bucket.ID,
+		Event:          models.StorageEvent{Type: models.StorageEventFileCreated, BucketID: bucket.ID, Name: "cat.png"},
+		Status:         models.StorageEventDeliveryPending,
+		Attempts:       1,
+		Holder:         "stopped-replica",
+		LeaseExpiresAt: time.Now().Add(-time.Minute).UTC(),
+	}
+	require.NoError(t, store.CreateDelivery(delivery))
+
+	// the next replica starting takes it over
+	functionStore, err := stores.NewGORMFunctionStore(server.DSN)
+	require.NoError(t, err)
+	functions := services.NewFunctionService(cfg, functionStore, functionStore, functionStore)
+	restarted := services.NewStorageEventService(cfg, store, functions, server.IAMStore, handlers.NewLambdaHandler(cfg, server.IAMStore, nil, functions))
+	defer restarted.Close()
+
+	require.Eventually(t, func() bool {
+		deliveries, err := store.ListDeliveries(bucket.ID, models.StorageEventDeliverySucceeded)
+		return err == nil && len(deliveries) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	deliveries, err := store.ListDeliveries(bucket.ID, "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 2, deliveries[0].Attempts, "the attempts of the stopped replica are kept")
+	require.Len(t, lambda.Requests(), 1)
+}
+
+func TestFunctionMetering(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	router := setupFunctionIntegrationTest(t, lambda.URL)
+
+	orgID := createTestOrganization(t, router, "Metering Org")
+	roleID := createTestRole(t, router, "metering_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "metering@example.com", "meteringpass")
+
+	create := models.CreateFunctionRequest{
+		Name:    "metered",
+		Runtime: models.FunctionRuntime{Name: "python3"},
+		Files:   []models.LambdaFile{{Name: "main.py", Contents: "print('ok')"}},
+	}
+	w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// the fake runs every invocation in 12 ms and 1 MB
+	for i := 0; i < 3; i++ {
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/metered/invoke", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp models.LambdaExecuteResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, models.LambdaTaskSuccessful, resp.Status)
+		assert.Equal(t, "ok\n", resp.Stdout)
+		assert.Equal(t, int32(12), resp.Time)
+		assert.Equal(t, uint64(1<<20), resp.Memory)
+	}
+
+	t.Run("Usage per account and memory class", func(t *testing.T) {
+		w := functionRequest(router, "GET", "/api/v1/monitoring/resources/active", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resources []models.ResourceUsage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resources))
+		require.Len(t, resources, 1)
+
+		usage := resources[0]
+		assert.Equal(t, models.ResourceTypeLambda, usage.ResourceType)
+		assert.Equal(t, "lambda 128 MB", usage.ResourceName)
+		assert.Equal(t, int64(3), usage.RequestCount)
+		assert.InDelta(t, 0.3, usage.ExecutionTime, 1e-9, "12 ms are billed as 100 ms")
+		assert.Greater(t, usage.TotalCost, 0.0)
+	})
+
+	t.Run("Monthly billing", func(t *testing.T) {
+		now := time.Now()
+		path := "/api/v1/monitoring/billing/generate?year=" + strconv.Itoa(now.Year()) + "&month=" + strconv.Itoa(int(now.Month()))
+		w := functionRequest(router, "POST", path, user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var billing models.BillingPeriod
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &billing))
+
+		expected := 3 * (services.LambdaCostPerHour*(100*time.Millisecond).Hours() + services.LambdaCostPerRequest)
+		assert.InDelta(t, expected, billing.LambdaCost, 1e-12)
+		assert.InDelta(t, expected, billing.TotalCost, 1e-12)
+	})
+}
+
+func TestFunctionLayers(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	router := setupFunctionIntegrationTest(t, lambda.URL)
+
+	orgID := createTestOrganization(t, router, "Layer Org")
+	roleID := createTestRole(t, router, "layer_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "layers@example.com", "layerpass")
+
+	publish := func(name string, files ...models.LambdaFile) {
+		t.Helper()
+		w := functionRequest(router, "POST", "/api/v1/lambda/layers/"+name+"/versions", user.Token, models.PublishLayerVersionRequest{Files: files})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	publish("base",
+		models.LambdaFile{Name: "helpers.py", Contents: "base helpers v1"},
+		models.LambdaFile{Name: "config.py", Contents: "base config"},
+		models.LambdaFile{Name: "main.py", Contents: "base main"},
+	)
+	publish("base",
+		models.LambdaFile{Name: "helpers.py", Contents: "base helpers v2"},
+		models.LambdaFile{Name: "config.py", Contents: "base config"},
+		models.LambdaFile{Name: "main.py", Contents: "base main"},
+	)
+	publish("extra",
+		models.LambdaFile{Name: "config.py", Contents: "extra config"},
+		models.LambdaFile{Name: "extra.py", Contents: "extra"},
+	)
+
+	w := functionRequest(router, "GET", "/api/v1/lambda/layers/base/versions", user.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var versions []models.LayerVersion
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &versions))
+	require.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Empty(t, versions[0].Files)
+
+	create := models.CreateFunctionRequest{
+		Name:    "layered",
+		Runtime: models.FunctionRuntime{Name: "python3"},
+		Files:   []models.LambdaFile{{Name: "main.py", Contents: "print('function')"}},
+		Layers:  []models.LayerReference{{Name: "base", Version: 1}, {Name: "extra", Version: 1}},
+	}
+	w = functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("Merged files", func(t *testing.T) {
+		w := functionRequest(router, "POST", "/api/v1/lambda/functions/layered/invoke", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		requests := lambda.Requests()
+		// the function files come first and win, a later layer overrides an earlier one in place
+		assert.Equal(t, []models.LambdaFile{
+			{Name: "main.py", Contents: "print('function')"},
+			{Name: "helpers.py", Contents: "base helpers v1"},
+			{Name: "config.py", Contents: "extra config"},
+			{Name: "extra.py", Contents: "extra"},
+		}, requests[len(requests)-1].Project.Files)
+	})
+
+	t.Run("Pinned versions", func(t *testing.T) {
+		update := models.UpdateFunctionRequest{Layers: []models.LayerReference{{Name: "base", Version: 2}}}
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/layered", user.Token, update)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/layered/invoke", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		requests := lambda.Requests()
+		assert.Equal(t, []models.LambdaFile{
+			{Name: "main.py", Contents: "print('function')"},
+			{Name: "helpers.py", Contents: "base helpers v2"},
+			{Name: "config.py", Contents: "base config"},
+		}, requests[len(requests)-1].Project.Files)
+
+		// version 1 still runs the layers it was published with
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/layered/invoke?qualifier=1", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		requests = lambda.Requests()
+		assert.Len(t, requests[len(requests)-1].Project.Files, 4)
+	})
+
+	t.Run("Invalid references", func(t *testing.T) {
+		invoked := len(lambda.Requests())
+
+		update := models.UpdateFunctionRequest{Layers: []models.LayerReference{{Name: "missing", Version: 1}}}
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/layered", user.Token, update)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		update.Layers = []models.LayerReference{{Name: "base", Version: 3}}
+		w = functionRequest(router, "PUT", "/api/v1/lambda/functions/layered", user.Token, update)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		update.Layers = []models.LayerReference{{Name: "base", Version: 1}, {Name: "base", Version: 2}}
+		w = functionRequest(router, "PUT", "/api/v1/lambda/functions/layered", user.Token, update)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		assert.Len(t, lambda.Requests(), invoked)
+	})
+
+	t.Run("Combined size limit", func(t *testing.T) {
+		large := strings.Repeat("x", services.MaxProjectSize-10)
+		publish("large", models.LambdaFile{Name: "data.txt", Contents: large})
+
+		update := models.UpdateFunctionRequest{Layers: []models.LayerReference{{Name: "large", Version: 1}}}
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/layered", user.Token, update)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	})
+
+	t.Run("Deleted layer", func(t *testing.T) {
+		w := functionRequest(router, "DELETE", "/api/v1/lambda/layers/base", user.Token, nil)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/layered/invoke", user.Token, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		// an empty list detaches the layers
+		w = functionRequest(router, "PUT", "/api/v1/lambda/functions/layered", user.Token, map[string]interface{}{"layers": []interface{}{}})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/layered/invoke", user.Token, nil)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+}
+
+func TestFunctionConcurrency(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	cfg := testConfig()
+	cfg.LambdaURL = lambda.URL
+	cfg.LambdaOrgConcurrencyMax = 50
+	server := newTestServer(t, cfg, nil)
+	require.NoError(t, server.IAMStore.SeedAdmin(cfg))
+	router := server.Router
+
+	orgID := createTestOrganization(t, router, "Concurrency Org")
+	roleID := createTestRole(t, router, "concurrency_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "concurrency@example.com", "concurrencypass")
+	admin := loginUser(t, router, handlers.LoginRequest{Email: "admin@unicorn.local", Password: "admin123"})
+	org := uuid.MustParse(orgID)
+
+	for _, name := range []string{"reserved", "capped", "other"} {
+		create := models.CreateFunctionRequest{
+			Name:    name,
+			Runtime: models.FunctionRuntime{Name: "python3"},
+			Files:   []models.LambdaFile{{Name: "main.py", Contents: "print('ok')"}},
+		}
+		w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	w := functionRequest(router, "PUT", "/api/v1/lambda/concurrency", admin.Token, models.PutOrganizationConcurrencyRequest{OrganizationID: &org, MaxConcurrency: 3})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = functionRequest(router, "PUT", "/api/v1/lambda/functions/reserved/concurrency", user.Token, models.PutFunctionConcurrencyRequest{ReservedConcurrency: 2})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = functionRequest(router, "PUT", "/api/v1/lambda/functions/capped/concurrency", user.Token, models.PutFunctionConcurrencyRequest{MaxConcurrency: 1})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	t.Run("Reservations fit in the organization", func(t *testing.T) {
+		w := functionRequest(router, "PUT", "/api/v1/lambda/functions/other/concurrency", user.Token, models.PutFunctionConcurrencyRequest{ReservedConcurrency: 2})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = functionRequest(router, "PUT", "/api/v1/lambda/functions/other/concurrency", user.Token, models.PutFunctionConcurrencyRequest{MaxConcurrency: 1, ReservedConcurrency: 2})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = functionRequest(router, "PUT", "/api/v1/lambda/concurrency", admin.Token, models.PutOrganizationConcurrencyRequest{OrganizationID: &org, MaxConcurrency: 1})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Only the admins set the capacity", func(t *testing.T) {
+		w := functionRequest(router, "PUT", "/api/v1/lambda/concurrency", user.Token, models.PutOrganizationConcurrencyRequest{MaxConcurrency: 10})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		unknown := uuid.New()
+		w = functionRequest(router, "PUT", "/api/v1/lambda/concurrency", admin.Token, models.PutOrganizationConcurrencyRequest{OrganizationID: &unknown, MaxConcurrency: 10})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		// the capacity is clamped to the ceiling
+		w = functionRequest(router, "PUT", "/api/v1/lambda/concurrency", admin.Token, models.PutOrganizationConcurrencyRequest{OrganizationID: &org, MaxConcurrency: 500})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp models.ConcurrencyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 50, resp.MaxConcurrency)
+
+		w = functionRequest(router, "PUT", "/api/v1/lambda/concurrency", admin.Token, models.PutOrganizationConcurrencyRequest{OrganizationID: &org, MaxConcurrency: 3})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+
+	t.Run("Excess invocations are throttled", func(t *testing.T) {
+		gate := make(chan struct{})
+		lambda.SetGate(gate)
+
+		var wg sync.WaitGroup
+		codes := make(chan int, 3)
+		invoke := func(name string) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- functionRequest(router, "POST", "/api/v1/lambda/functions/"+name+"/invoke", user.Token, nil).Code
+			}()
+		}
+		inFlight := func() int {
+			w := functionRequest(router, "GET", "/api/v1/lambda/concurrency", user.Token, nil)
+			var resp models.ConcurrencyResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			return resp.InFlight
+		}
+
+		// capped takes the only unreserved slot, reserved runs on its reservation
+		invoke("capped")
+		require.Eventually(t, func() bool { return inFlight() == 1 }, 2*time.Second, 5*time.Millisecond)
+		invoke("reserved")
+		invoke("reserved")
+		require.Eventually(t, func() bool { return inFlight() == 3 }, 2*time.Second, 5*time.Millisecond)
+
+		w := functionRequest(router, "POST", "/api/v1/lambda/functions/capped/invoke", user.Token, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "over the maximum of the function")
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/other/invoke", user.Token, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "the unreserved capacity is used")
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/reserved/invoke", user.Token, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "beyond its reservation a function shares the unreserved capacity")
+		var execute models.LambdaExecuteRequest
+		execute.Runtime.Name = "python3"
+		execute.Project.Files = []models.LambdaFile{{Name: "main.py", Contents: "print('ok')"}}
+		w = functionRequest(router, "POST", "/api/v1/lambda/execute", user.Token, execute)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "the executions run on the unreserved capacity")
+
+		w = functionRequest(router, "GET", "/api/v1/lambda/functions/reserved/concurrency", user.Token, nil)
+		var reserved models.ConcurrencyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reserved))
+		assert.Equal(t, models.ConcurrencyResponse{ReservedConcurrency: 2, InFlight: 2}, reserved)
+
+		lambda.SetGate(nil)
+		close(gate)
+		wg.Wait()
+		close(codes)
+		for code := range codes {
+			assert.Equal(t, http.StatusOK, code)
+		}
+		assert.Equal(t, 0, inFlight())
+
+		w = functionRequest(router, "POST", "/api/v1/lambda/functions/other/invoke", user.Token, nil)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+
+	t.Run("Bounded wait", func(t *testing.T) {
+		limiter := services.NewConcurrencyLimiter(time.Second)
+		limits := services.ConcurrencyLimits{OrganizationID: uuid.New(), FunctionID: uuid.New(), OrganizationMax: 10, FunctionMax: 1}
+
+		release, err := limiter.Acquire(context.Background(), limits)
+		require.NoError(t, err)
+		time.AfterFunc(20*time.Millisecond, release)
+
+		// the invocation waits for the first one to end
+		release, err = limiter.Acquire(context.Background(), limits)
+		require.NoError(t, err)
+
+		limiter.Wait = 20 * time.Millisecond
+		_, err = limiter.Acquire(context.Background(), limits)
+		assert.ErrorIs(t, err, services.ErrConcurrencyLimit)
+
+		release()
+		assert.Equal(t, 0, limiter.InFlight(limits.OrganizationID, uuid.Nil))
+	})
+}
+
+func TestWorkflowExecutions(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+
+	cfg := testConfig()
+	cfg.LambdaURL = lambda.URL
+	server := newTestServer(t, cfg, nil)
+	router := server.Router
+
+	orgID := createTestOrganization(t, router, "Workflow Org")
+	roleID := createTestRole(t, router, "workflow_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "workflows@example.com", "workflowpass")
+
+	// the functions are told apart by their code: double doubles n, and fails its first call
+	for _, name := range []string{"double", "broken"} {
+		create := models.CreateFunctionRequest{
+			Name:    name,
+			Runtime: models.FunctionRuntime{Name: "python3"},
+			Files:   []models.LambdaFile{{Name: "main.py", Contents: name}},
+		}
+		w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var doubled atomic.Int32
+	lambda.SetStatusFunc(func(req models.LambdaExecuteRequest) string {
+		if req.Project.Files[0].Contents == "broken" ||
+			(req.Project.Files[0].Contents == "double" && doubled.Add(1) == 1) {
+			return "failed"
+		}
+		return models.LambdaTaskSuccessful
+	})
+	lambda.SetStdout(func(req models.LambdaExecuteRequest) string {
+		var input struct {
+			N float64 `json:"n"`
+		}
+		_ = json.Unmarshal([]byte(req.Process.StandardInput), &input)
+		return fmt.Sprintf(`{"n": %v}`, input.N*2)
+	})
+
+	ten := 10.0
+	zero := 0
+	pipeline := models.CreateWorkflowRequest{
+		Name: "pipeline",
+		Definition: models.WorkflowDefinition{
+			StartAt: "check",
+			States: map[string]models.WorkflowState{
+				"check": {
+					Type:    models.WorkflowStateChoice,
+					Choices: []models.WorkflowChoice{{Variable: "$.n", NumericGreaterThan: &ten, Next: "too-big"}},
+					Default: "double",
+				},
+				"double": {
+					Type:     models.WorkflowStateTask,
+					Function: "double",
+					Retry:    []models.WorkflowRetrier{{ErrorEquals: []string{models.WorkflowErrorTaskFailed}, IntervalSeconds: 0.01}},
+					Next:     "fan-out",
+				},
+				"fan-out": {
+					Type: models.WorkflowStateParallel,
+					Branches: []models.WorkflowDefinition{
+						{StartAt: "again", States: map[string]models.WorkflowState{
+							"again": {Type: models.WorkflowStateTask, Function: "double", End: true},
+						}},
+						{StartAt: "pause", States: map[string]models.WorkflowState{
+							"pause": {Type: models.WorkflowStateWait, Seconds: 0.01, Next: "keep"},
+							"keep":  {Type: models.WorkflowStateSucceed},
+						}},
+					},
+					Next: "done",
+				},
+				"done":    {Type: models.WorkflowStateSucceed},
+				"too-big": {Type: models.WorkflowStateFail, Error: "TooBig", Cause: "n is over 10"},
+			},
+		},
+	}
+	w := functionRequest(router, "POST", "/api/v1/workflows", user.Token, pipeline)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	start := func(name string, input string) models.WorkflowExecution {
+		t.Helper()
+		w := functionRequest(router, "POST", "/api/v1/workflows/"+name+"/executions", user.Token,
+			models.StartWorkflowExecutionRequest{Input: json.RawMessage(input)})
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		var execution models.WorkflowExecution
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &execution))
+		assert.Equal(t, models.WorkflowExecutionRunning, execution.Status)
+		return execution
+	}
+	describe := func(name string, id uuid.UUID) models.WorkflowExecution {
+		t.Helper()
+		w := functionRequest(router, "GET", "/api/v1/workflows/"+name+"/executions/"+id.String(), user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var execution models.WorkflowExecution
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &execution))
+		return execution
+	}
+	wait := func(name string, id uuid.UUID) models.WorkflowExecution {
+		t.Helper()
+		var execution models.WorkflowExecution
+		require.Eventually(t, func() bool {
+			execution = describe(name, id)
+			return execution.Status != models.WorkflowExecutionRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		return execution
+	}
+
+	t.Run("Task, retry, parallel and wait", func(t *testing.T) {
+		execution := wait("pipeline", start("pipeline", `{"n": 3}`).ID)
+		require.Equal(t, models.WorkflowExecutionSucceeded, execution.Status, execution.Error+" "+execution.Cause)
+		assert.JSONEq(t, `[{"n": 12}, {"n": 6}]`, string(execution.Output))
+
+		var states []string
+		retried := 0
+		for _, event := range execution.History {
+			if event.Type == models.WorkflowEventStateEntered {
+				states = append(states, event.State)
+			}
+			if event.Type == models.WorkflowEventStateRetried {
+				retried++
+			}
+		}
+		assert.Equal(t, 1, retried, "the first call of double failed")
+		assert.Subset(t, states, []string{"check", "double", "fan-out", "fan-out/0/again", "fan-out/1/pause", "fan-out/1/keep", "done"})
+		assert.Equal(t, models.WorkflowEventExecutionStarted, execution.History[0].Type)
+		assert.Equal(t, models.WorkflowEventExecutionSucceeded, execution.History[len(execution.History)-1].Type)
+	})
+
+	t.Run("Choice and fail", func(t *testing.T) {
+		execution := wait("pipeline", start("pipeline", `{"n": 30}`).ID)
+		assert.Equal(t, models.WorkflowExecutionFailed, execution.Status)
+		assert.Equal(t, "TooBig", execution.Error)
+		assert.Equal(t, "n is over 10", execution.Cause)
+	})
+
+	t.Run("Catch", func(t *testing.T) {
+		guarded := models.CreateWorkflowRequest{
+			Name: "guarded",
+			Definition: models.WorkflowDefinition{
+				StartAt: "call",
+				States: map[string]models.WorkflowState{
+					"call": {
+						Type:     models.WorkflowStateTask,
+						Function: "broken",
+						Retry:    []models.WorkflowRetrier{{ErrorEquals: []string{models.WorkflowErrorAll}, MaxAttempts: &zero}},
+						Catch:    []models.WorkflowCatcher{{ErrorEquals: []string{models.WorkflowErrorAll}, Next: "handled"}},
+						End:      true,
+					},
+					"handled": {Type: models.WorkflowStateSucceed},
+				},
+			},
+		}
+		w := functionRequest(router, "POST", "/api/v1/workflows", user.Token, guarded)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		execution := wait("guarded", start("guarded", `{}`).ID)
+		require.Equal(t, models.WorkflowExecutionSucceeded, execution.Status)
+
+		var output struct {
+			Error string `json:"error"`
+			Cause string `json:"cause"`
+		}
+		require.NoError(t, json.Unmarshal(execution.Output, &output))
+		assert.Equal(t, models.WorkflowErrorTaskFailed, output.Error)
+		assert.Contains(t, output.Cause, "broken")
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		slow := models.CreateWorkflowRequest{
+			Name: "slow",
+			Definition: models.WorkflowDefinition{
+				StartAt: "sleep",
+				States: map[string]models.WorkflowState{
+					"sleep": {Type: models.WorkflowStateWait, Seconds: 60, End: true},
+				},
+			},
+		}
+		w := functionRequest(router, "POST", "/api/v1/workflows", user.Token, slow)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		execution := start("slow", "")
+		path := "/api/v1/workflows/slow/executions/" + execution.ID.String() + "/cancel"
+
+		w = functionRequest(router, "POST", path, user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &execution))
+		assert.Equal(t, models.WorkflowExecutionCancelled, execution.Status)
+		assert.NotNil(t, execution.StoppedAt)
+
+		w = functionRequest(router, "POST", path, user.Token, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = functionRequest(router, "GET", "/api/v1/workflows/slow/executions?status=cancelled", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var executions []models.WorkflowExecution
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &executions))
+		assert.Len(t, executions, 1)
+
+		// running executions keep their workflow from being deleted
+		running := start("slow", "")
+		w = functionRequest(router, "DELETE", "/api/v1/workflows/slow", user.Token, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = functionRequest(router, "POST", "/api/v1/workflows/slow/executions/"+running.ID.String()+"/cancel", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = functionRequest(router, "DELETE", "/api/v1/workflows/slow", user.Token, nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Replicas", func(t *testing.T) {
+		sleepy := models.CreateWorkflowRequest{
+			Name: "sleepy",
+			Definition: models.WorkflowDefinition{
+				StartAt: "sleep",
+				States: map[string]models.WorkflowState{
+					"sleep": {Type: models.WorkflowStateWait, Seconds: 60, End: true},
+				},
+			},
+		}
+		w := functionRequest(router, "POST", "/api/v1/workflows", user.Token, sleepy)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		execution := start("sleepy", "")
+
+		// a replica stopped while running an execution, another one still runs its own
+		store, err := stores.NewGORMWorkflowStore(server.DSN)
+		require.NoError(t, err)
+		held := func(holder string, leaseExpiresAt time.Time) *models.WorkflowExecution {
+			held := &models.WorkflowExecution{
+				WorkflowID:     execution.WorkflowID,
+				OrganizationID: execution.OrganizationID,
+				AccountID:      execution.AccountID,
+				Status:         models.WorkflowExecutionRunning,
+				Input:          json.RawMessage("null"),
+				Holder:         holder,
+				LeaseExpiresAt: leaseExpiresAt.UTC(),
+			}
+			require.NoError(t, store.CreateExecution(held))
+			return held
+		}
+		stopped := held("stopped-replica", time.Now().Add(-time.Minute))
+		live := held("live-replica", time.Now().Add(time.Hour))
+
+		// a replica starting only ends the executions nobody holds anymore
+		functionStore, err := stores.NewGORMFunctionStore(server.DSN)
+		require.NoError(t, err)
+		functions := services.NewFunctionService(cfg, functionStore, functionStore, functionStore)
+		replica := services.NewWorkflowService(cfg, store, functions, server.IAMStore, handlers.NewLambdaHandler(cfg, server.IAMStore, nil, functions))
+		defer replica.Close()
+
+		interrupted := describe("sleepy", stopped.ID)
+		assert.Equal(t, models.WorkflowExecutionFailed, interrupted.Status)
+		assert.Equal(t, models.WorkflowErrorRuntime, interrupted.Error)
+		assert.Equal(t, models.WorkflowExecutionRunning, describe("sleepy", live.ID).Status)
+		assert.Equal(t, models.WorkflowExecutionRunning, describe("sleepy", execution.ID).Status)
+
+		// the cancellation asked to a replica not running the execution reaches the one running it
+		cancelled, err := replica.CancelExecution(uuid.MustParse(orgID), "sleepy", execution.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.WorkflowExecutionCancelled, cancelled.Status)
+	})
+
+	t.Run("Invalid definitions", func(t *testing.T) {
+		invalid := models.CreateWorkflowRequest{
+			Name: "invalid",
+			Definition: models.WorkflowDefinition{
+				StartAt: "call",
+				States: map[string]models.WorkflowState{
+					"call": {Type: models.WorkflowStateTask, Function: "double", Next: "nowhere"},
+				},
+			},
+		}
+		w := functionRequest(router, "POST", "/api/v1/workflows", user.Token, invalid)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		invalid.Definition.States["call"] = models.WorkflowState{Type: models.WorkflowStateTask, Function: "missing", End: true}
+		w = functionRequest(router, "POST", "/api/v1/workflows", user.Token, invalid)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		// the waits don't outlast a restart of the API by much
+		invalid.Definition.States["call"] = models.WorkflowState{Type: models.WorkflowStateWait, Seconds: 86400, End: true}
+		w = functionRequest(router, "POST", "/api/v1/workflows", user.Token, invalid)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		invalid.Definition.States["call"] = models.WorkflowState{
+			Type: models.WorkflowStateTask, Function: "double", End: true,
+			Retry: []models.WorkflowRetrier{{ErrorEquals: []string{models.WorkflowErrorAll}, IntervalSeconds: 3600}},
+		}
+		w = functionRequest(router, "POST", "/api/v1/workflows", user.Token, invalid)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
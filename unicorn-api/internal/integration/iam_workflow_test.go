@@ -5,68 +5,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
-	"time"
-	"unicorn-api/internal/config"
 	"unicorn-api/internal/handlers"
 	"unicorn-api/internal/models"
-	"unicorn-api/internal/routes"
-	"unicorn-api/internal/services"
-	"unicorn-api/internal/stores"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func setupIntegrationTest(t *testing.T) (*gin.Engine, *stores.GORMIAMStore, func()) {
-	// Create a temporary database file
-	dbPath := "integration_test_" + uuid.New().String() + ".db"
-
-	store, err := stores.NewGORMIAMStore(dbPath)
-	require.NoError(t, err)
-
-	cfg := &config.Config{
-		JWTSecret:       "integration-test-secret-key",
-		TokenExpiration: 24 * time.Hour,
-		Environment:     "test",
-	}
-
-	secretsStore, err := stores.NewSecretStore("test.db")
-	if err != nil {
-		panic("failed to initialize secrets store: " + err.Error())
-	}
-
-	monitoringStore, err := stores.NewGORMMonitoringStore("test.db")
-	if err != nil {
-		panic("failed to initialize monitoring store: " + err.Error())
-	}
-	monitoringService := services.NewMonitoringService(monitoringStore, store)
-
-	handler := handlers.NewIAMHandler(store, cfg)
-	storageHandler := handlers.NewStorageHandler(&stores.GORMStorageStore{}, store, cfg)
-	computeHandler := handlers.NewComputeHandler(cfg, store, monitoringService)
-	lambdaHandler := handlers.NewLambdaHandler(cfg, store)
-	secretsHandler := handlers.NewSecretsHandler(secretsStore, store, cfg)
-	rdbHandler := handlers.NewRDBHandler(cfg, store)
-	monitoringHandler := handlers.NewMonitoringHandler(cfg, store, monitoringStore)
-
-	// Setup router
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	routes.SetupRoutes(router, handler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler, cfg)
-
-	// Return cleanup function
-	cleanup := func() {
-		store.DB().Migrator().DropTable(&models.Role{}, &models.Organization{}, &models.Account{})
-		os.Remove(dbPath)
-	}
-
-	return router, store, cleanup
-}
-
 // TestFullIAMWorkflow tests the complete workflow of:
 // 1. Creating an organization
 // 2. Creating roles with different permissions
@@ -75,8 +22,7 @@ func setupIntegrationTest(t *testing.T) (*gin.Engine, *stores.GORMIAMStore, func
 // 5. Testing authentication
 // 6. Testing token validation
 func TestFullIAMWorkflow(t *testing.T) {
-	router, _, cleanup := setupIntegrationTest(t)
-	defer cleanup()
+	router := newTestServer(t, testConfig(), nil).Router
 
 	// Step 1: Create an organization
 	var orgID string
@@ -528,8 +474,7 @@ func TestFullIAMWorkflow(t *testing.T) {
 
 // TestOrganizationIsolation tests that users from different organizations are properly isolated
 func TestOrganizationIsolation(t *testing.T) {
-	router, _, cleanup := setupIntegrationTest(t)
-	defer cleanup()
+	router := newTestServer(t, testConfig(), nil).Router
 
 	// Create two organizations
 	var org1ID, org2ID string
@@ -645,8 +590,7 @@ func TestOrganizationIsolation(t *testing.T) {
 
 // TestRolePermissionWorkflow tests the complete role and permission workflow
 func TestRolePermissionWorkflow(t *testing.T) {
-	router, _, cleanup := setupIntegrationTest(t)
-	defer cleanup()
+	router := newTestServer(t, testConfig(), nil).Router
 
 	// Create organization
 	t.Run("Create Organization", func(t *testing.T) {
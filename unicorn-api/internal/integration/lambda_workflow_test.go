@@ -8,50 +8,16 @@ import (
 	"os"
 	"testing"
 
-	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
-	"unicorn-api/internal/config"
-	"unicorn-api/internal/handlers"
 	"unicorn-api/internal/models"
-	"unicorn-api/internal/routes"
-	"unicorn-api/internal/services"
-	"unicorn-api/internal/stores"
 )
 
-func setupLambdaTestServer() *gin.Engine {
-	_ = os.Remove("test.db") // Ensure fresh DB for each test
-	cfg := config.New()
-	cfg.JWTSecret = "test-secret" // Ensure consistent JWT secret for test
-	store, _ := stores.NewGORMIAMStore("test.db")
-	secretsStore, err := stores.NewSecretStore("test.db")
-	if err != nil {
-		panic("failed to initialize secrets store: " + err.Error())
-	}
-	monitoringStore, err := stores.NewGORMMonitoringStore("test.db")
-	if err != nil {
-		panic("failed to initialize monitoring store: " + err.Error())
-	}
-	monitoringService := services.NewMonitoringService(monitoringStore, store)
-
-	_ = store.SeedAdmin(cfg)
-	iamHandler := handlers.NewIAMHandler(store, cfg)
-	secretsHandler := handlers.NewSecretsHandler(secretsStore, store, cfg)
-	computeHandler := handlers.NewComputeHandler(cfg, store, monitoringService)
-	storageHandler := handlers.NewStorageHandler(&stores.GORMStorageStore{}, store, cfg)
-	lambdaHandler := handlers.NewLambdaHandler(cfg, store)
-	rdbHandler := handlers.NewRDBHandler(cfg, store)
-	monitoringHandler := handlers.NewMonitoringHandler(cfg, store, monitoringStore)
-	router := gin.Default()
-	routes.SetupRoutes(router, iamHandler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler, cfg)
-	return router
-}
-
 func TestLambdaExecute(t *testing.T) {
 	if os.Getenv("SKIP_LAMBDA_TESTS") == "1" {
 		t.Skip("Skipping Lambda integration test")
 	}
-	router := setupLambdaTestServer()
+	router := newAdminTestServer(t).Router
 
 	// Login as admin to get JWT token
 	loginReq := map[string]string{"email": "admin@unicorn.local", "password": "admin123"}
@@ -5,63 +5,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
-	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
-	"unicorn-api/internal/config"
 	"unicorn-api/internal/handlers"
 	"unicorn-api/internal/models"
-	"unicorn-api/internal/routes"
-	"unicorn-api/internal/services"
-	"unicorn-api/internal/stores"
 )
 
-func setupRDBTestServer() *gin.Engine {
-	_ = os.Remove("test.db") // Ensure fresh DB for each test
-	cfg := config.New()
-	cfg.JWTSecret = "test-secret" // Ensure consistent JWT secret for test
-	store, _ := stores.NewGORMIAMStore("test.db")
-	secretsStore, err := stores.NewSecretStore("test.db")
-	if err != nil {
-		panic("failed to initialize secrets store: " + err.Error())
-	}
-	monitoringStore, err := stores.NewGORMMonitoringStore("test.db")
-	if err != nil {
-		panic("failed to initialize monitoring store: " + err.Error())
-	}
-	monitoringService := services.NewMonitoringService(monitoringStore, store)
-
-	_ = store.SeedAdmin(cfg)
-	iamHandler := handlers.NewIAMHandler(store, cfg)
-	secretsHandler := handlers.NewSecretsHandler(secretsStore, store, cfg)
-	computeHandler := handlers.NewComputeHandler(cfg, store, monitoringService)
-	storageHandler := handlers.NewStorageHandler(&stores.GORMStorageStore{}, store, cfg)
-	lambdaHandler := handlers.NewLambdaHandler(cfg, store)
-	rdbHandler := handlers.NewRDBHandler(cfg, store)
-	monitoringHandler := handlers.NewMonitoringHandler(cfg, store, monitoringStore)
-	router := gin.Default()
-	routes.SetupRoutes(router, iamHandler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler, cfg)
-	return router
-}
-
 func TestRDBCreateAndList(t *testing.T) {
-	if os.Getenv("SKIP_DOCKER_TESTS") == "1" {
-		t.Skip("Skipping Docker integration test")
-	}
-
-	// Check if Docker is available by trying to create a client
-	// If Docker is not available, skip the test
-	if os.Getenv("DOCKER_HOST") == "" {
-		// Try to detect if Docker is running
-		_, err := os.Stat("/var/run/docker.sock")
-		if err != nil {
-			t.Skip("Docker not available - skipping RDB test")
-		}
-	}
-	router := setupRDBTestServer()
+	router := newAdminTestServer(t).Router
 
 	// Login as admin to get JWT token
 	loginReq := map[string]string{"email": "admin@unicorn.local", "password": "admin123"}
@@ -153,11 +106,7 @@ func TestRDBCreateAndList(t *testing.T) {
 }
 
 func TestRDBPermissionChecks(t *testing.T) {
-	if os.Getenv("SKIP_DOCKER_TESTS") == "1" {
-		t.Skip("Skipping Docker integration test")
-	}
-
-	router := setupRDBTestServer()
+	router := newAdminTestServer(t).Router
 
 	// Create organization and roles for permission testing
 	var orgID, readonlyRoleID string
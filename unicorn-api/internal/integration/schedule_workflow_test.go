@@ -0,0 +1,307 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/services"
+	"unicorn-api/internal/stores"
+)
+
+// fakeComputeController records the containers started and stopped by the schedules
+type fakeComputeController struct {
+	mu      sync.Mutex
+	owners  map[string]uuid.UUID
+	actions []string
+}
+
+func (f *fakeComputeController) Own(containerID string, userID uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.owners == nil {
+		f.owners = make(map[string]uuid.UUID)
+	}
+	f.owners[containerID] = userID
+}
+
+func (f *fakeComputeController) CheckContainer(userID uuid.UUID, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	owner, ok := f.owners[containerID]
+	if !ok {
+		return errors.ErrNotFound.WithDetails("Container not found")
+	}
+	if owner != userID {
+		return errors.ErrForbidden.WithDetails("Container does not belong to user")
+	}
+	return nil
+}
+
+func (f *fakeComputeController) StartContainer(userID uuid.UUID, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, "start "+containerID+" "+userID.String())
+	return nil
+}
+
+func (f *fakeComputeController) StopContainer(userID uuid.UUID, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, "stop "+containerID+" "+userID.String())
+	return nil
+}
+
+func (f *fakeComputeController) Actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.actions...)
+}
+
+func TestSchedules(t *testing.T) {
+	lambda := newFakeLambdaAPI()
+	defer lambda.Close()
+	lambda.SetStdout(func(models.LambdaExecuteRequest) string { return "tick\n" })
+	compute := &fakeComputeController{}
+
+	cfg := testConfig()
+	cfg.LambdaURL = lambda.URL
+	cfg.SchedulerInterval = 20 * time.Millisecond
+	server := newTestServer(t, cfg, compute)
+	router := server.Router
+
+	orgID := createTestOrganization(t, router, "Schedule Org")
+	roleID := createTestRole(t, router, "schedule_admin", []models.Permission{models.Read, models.Write, models.Delete})
+	user := createTestUser(t, router, orgID, roleID, "schedules@example.com", "schedulepass")
+	account, err := server.IAMStore.GetAccountByEmail("schedules@example.com")
+	require.NoError(t, err)
+	compute.Own("c-1", account.ID)
+	compute.Own("c-2", account.ID)
+	compute.Own("c-other", uuid.New())
+
+	create := models.CreateFunctionRequest{
+		Name:    "report",
+		Runtime: models.FunctionRuntime{Name: "python3"},
+		Files:   []models.LambdaFile{{Name: "main.py", Contents: "print('tick')"}},
+	}
+	w := functionRequest(router, "POST", "/api/v1/lambda/functions", user.Token, create)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	functionTarget := models.ScheduleTarget{
+		Type:     models.ScheduleTargetFunction,
+		Function: "report",
+		Input:    json.RawMessage(`{"kind": "daily"}`),
+	}
+	createSchedule := func(req models.CreateScheduleRequest) models.Schedule {
+		t.Helper()
+		w := functionRequest(router, "POST", "/api/v1/schedules", user.Token, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var schedule models.Schedule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+		return schedule
+	}
+	listRuns := func(name string) []models.ScheduleRun {
+		t.Helper()
+		w := functionRequest(router, "GET", "/api/v1/schedules/"+name+"/runs", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var runs []models.ScheduleRun
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+		return runs
+	}
+	countRuns := func(runs []models.ScheduleRun, status models.ScheduleRunStatus, trigger models.ScheduleRunTrigger) int {
+		count := 0
+		for _, run := range runs {
+			if run.Status == status && run.Trigger == trigger {
+				count++
+			}
+		}
+		return count
+	}
+
+	t.Run("Invalid schedules", func(t *testing.T) {
+		invalid := []struct {
+			req  models.CreateScheduleRequest
+			code int
+		}{
+			{models.CreateScheduleRequest{Name: "bad", Expression: "every day", Target: functionTarget}, http.StatusBadRequest},
+			{models.CreateScheduleRequest{Name: "bad", Expression: "rate(0 minutes)", Target: functionTarget}, http.StatusBadRequest},
+			{models.CreateScheduleRequest{Name: "bad", Expression: "CRON_TZ=UTC 0 8 * * *", Target: functionTarget}, http.StatusBadRequest},
+			{models.CreateScheduleRequest{Name: "bad", Expression: "@daily", Timezone: "Mars/Olympus", Target: functionTarget}, http.StatusBadRequest},
+			{models.CreateScheduleRequest{Name: "bad", Expression: "@daily", Target: models.ScheduleTarget{Type: models.ScheduleTargetCompute, Action: models.ScheduleComputeStart}}, http.StatusBadRequest},
+			{models.CreateScheduleRequest{Name: "bad", Expression: "@daily", Target: models.ScheduleTarget{Type: models.ScheduleTargetFunction, Function: "missing"}}, http.StatusNotFound},
+		}
+		for _, tc := range invalid {
+			w := functionRequest(router, "POST", "/api/v1/schedules", user.Token, tc.req)
+			assert.Equal(t, tc.code, w.Code, tc.req.Expression+" "+w.Body.String())
+		}
+	})
+
+	t.Run("Rate schedule invokes the function", func(t *testing.T) {
+		schedule := createSchedule(models.CreateScheduleRequest{Name: "ticker", Expression: "rate(1 second)", Target: functionTarget})
+		assert.True(t, schedule.Enabled)
+		assert.Equal(t, "UTC", schedule.Timezone)
+		require.NotNil(t, schedule.NextRunAt)
+
+		w := functionRequest(router, "POST", "/api/v1/schedules", user.Token,
+			models.CreateScheduleRequest{Name: "ticker", Expression: "@daily", Target: functionTarget})
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		require.Eventually(t, func() bool {
+			return countRuns(listRuns("ticker"), models.ScheduleRunSucceeded, models.ScheduleRunOnTime) >= 2
+		}, 5*time.Second, 20*time.Millisecond)
+
+		runs := listRuns("ticker")
+		for _, run := range runs {
+			if run.Status == models.ScheduleRunSucceeded {
+				assert.Equal(t, "tick\n", run.Output)
+				assert.NotEmpty(t, run.Replica)
+				break
+			}
+		}
+		assert.JSONEq(t, `{"kind": "daily"}`, lambda.Requests()[0].Process.StandardInput)
+
+		// a disabled schedule has no next occurrence, and still runs by hand
+		enabled := false
+		w = functionRequest(router, "PUT", "/api/v1/schedules/ticker", user.Token, models.UpdateScheduleRequest{
+			Expression: "rate(1 second)", Enabled: &enabled, Target: functionTarget,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var disabled models.Schedule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &disabled))
+		assert.False(t, disabled.Enabled)
+		assert.Nil(t, disabled.NextRunAt)
+
+		lambda.SetStatus("failed")
+		defer lambda.SetStatus(models.LambdaTaskSuccessful)
+		w = functionRequest(router, "POST", "/api/v1/schedules/ticker/run", user.Token, nil)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		require.Eventually(t, func() bool {
+			return countRuns(listRuns("ticker"), models.ScheduleRunFailed, models.ScheduleRunManual) == 1
+		}, 5*time.Second, 20*time.Millisecond)
+		runs = listRuns("ticker")
+		assert.Equal(t, models.ScheduleRunManual, runs[0].Trigger)
+		assert.Contains(t, runs[0].Error, "function report exited with code")
+
+		w = functionRequest(router, "GET", "/api/v1/schedules/ticker/runs?limit=1", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+		assert.Len(t, runs, 1)
+	})
+
+	t.Run("Cron schedule in a time zone starts a container", func(t *testing.T) {
+		schedule := createSchedule(models.CreateScheduleRequest{
+			Name:          "office-hours",
+			Expression:    "cron(0 8 * * MON-FRI)",
+			Timezone:      "Europe/Bucharest",
+			JitterSeconds: 60,
+			Target:        models.ScheduleTarget{Type: models.ScheduleTargetCompute, ContainerID: "c-1", Action: models.ScheduleComputeStart},
+		})
+		require.NotNil(t, schedule.NextRunAt)
+
+		location, err := time.LoadLocation("Europe/Bucharest")
+		require.NoError(t, err)
+		next := schedule.NextRunAt.In(location)
+		assert.Equal(t, 8, next.Hour())
+		assert.Equal(t, 0, next.Minute())
+		assert.NotEqual(t, time.Saturday, next.Weekday())
+		assert.NotEqual(t, time.Sunday, next.Weekday())
+
+		w := functionRequest(router, "POST", "/api/v1/schedules/office-hours/run", user.Token, nil)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		require.Eventually(t, func() bool {
+			return countRuns(listRuns("office-hours"), models.ScheduleRunSucceeded, models.ScheduleRunManual) == 1
+		}, 5*time.Second, 20*time.Millisecond)
+		assert.Equal(t, []string{"start c-1 " + schedule.AccountID.String()}, compute.Actions())
+	})
+
+	t.Run("Compute target must belong to the account", func(t *testing.T) {
+		for container, code := range map[string]int{"c-missing": http.StatusNotFound, "c-other": http.StatusForbidden} {
+			w := functionRequest(router, "POST", "/api/v1/schedules", user.Token, models.CreateScheduleRequest{
+				Name:       "foreign",
+				Expression: "rate(1 hour)",
+				Target:     models.ScheduleTarget{Type: models.ScheduleTargetCompute, ContainerID: container, Action: models.ScheduleComputeStart},
+			})
+			assert.Equal(t, code, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Missed occurrences", func(t *testing.T) {
+		// another replica of the API moves the schedules half an hour back, as if none ran since
+		store, err := stores.NewGORMScheduleStore(server.DSN)
+		require.NoError(t, err)
+		rewind := func(name string) {
+			schedule, err := store.GetSchedule(uuid.MustParse(orgID), name)
+			require.NoError(t, err)
+			past := schedule.NextRunAt.Add(-30 * time.Minute)
+			schedule.NextRunAt = &past
+			require.NoError(t, store.UpdateSchedule(schedule))
+		}
+
+		stop := models.ScheduleTarget{Type: models.ScheduleTargetCompute, ContainerID: "c-2", Action: models.ScheduleComputeStop}
+		createSchedule(models.CreateScheduleRequest{Name: "catch-up", Expression: "rate(1 minute)", CatchUp: true, Enabled: new(bool), Target: stop})
+		createSchedule(models.CreateScheduleRequest{Name: "no-catch-up", Expression: "rate(1 minute)", Enabled: new(bool), Target: stop})
+		for _, name := range []string{"catch-up", "no-catch-up"} {
+			enabled := true
+			w := functionRequest(router, "PUT", "/api/v1/schedules/"+name, user.Token, models.UpdateScheduleRequest{
+				Expression: "rate(1 minute)", CatchUp: name == "catch-up", Enabled: &enabled, Target: stop,
+			})
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			rewind(name)
+		}
+
+		require.Eventually(t, func() bool {
+			return countRuns(listRuns("catch-up"), models.ScheduleRunSucceeded, models.ScheduleRunCatchUp) == services.DefaultScheduleMaxCatchUp
+		}, 5*time.Second, 20*time.Millisecond)
+
+		// 30 occurrences are due: the last one is on time, and 10 of the 29 missed are caught up
+		require.Eventually(t, func() bool {
+			return countRuns(listRuns("catch-up"), models.ScheduleRunSucceeded, models.ScheduleRunOnTime) == 1
+		}, 5*time.Second, 20*time.Millisecond)
+		runs := listRuns("catch-up")
+		assert.Len(t, runs, services.DefaultScheduleMaxCatchUp+2)
+		require.Equal(t, 1, countRuns(runs, models.ScheduleRunSkipped, models.ScheduleRunOnTime), "the oldest beyond the catch-up limit")
+		assert.Contains(t, runs[len(runs)-1].Error, "19 occurrences missed")
+
+		require.Eventually(t, func() bool {
+			return countRuns(listRuns("no-catch-up"), models.ScheduleRunSucceeded, models.ScheduleRunOnTime) == 1
+		}, 5*time.Second, 20*time.Millisecond)
+		runs = listRuns("no-catch-up")
+		require.Len(t, runs, 2)
+		assert.Equal(t, 1, countRuns(runs, models.ScheduleRunSkipped, models.ScheduleRunOnTime))
+		assert.Contains(t, runs[len(runs)-1].Error, "29 occurrences missed")
+		assert.Len(t, compute.Actions(), services.DefaultScheduleMaxCatchUp+3, "the start by hand, and the stops run")
+
+		w := functionRequest(router, "GET", "/api/v1/schedules/no-catch-up", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var schedule models.Schedule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+		assert.True(t, schedule.NextRunAt.After(time.Now()))
+		assert.NotNil(t, schedule.LastRunAt)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		w := functionRequest(router, "DELETE", "/api/v1/schedules/office-hours", user.Token, nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		w = functionRequest(router, "GET", "/api/v1/schedules/office-hours/runs", user.Token, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = functionRequest(router, "GET", "/api/v1/schedules", user.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var schedules []models.Schedule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedules))
+		assert.Len(t, schedules, 3)
+	})
+}
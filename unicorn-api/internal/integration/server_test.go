@@ -0,0 +1,136 @@
+package integration
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/containers"
+	"unicorn-api/internal/handlers"
+	"unicorn-api/internal/routes"
+	"unicorn-api/internal/services"
+	"unicorn-api/internal/stores"
+)
+
+// testServer is the API wired like main on a database of its own, with the container
+// runtime faked
+type testServer struct {
+	Router          *gin.Engine
+	DSN             string
+	IAMStore        *stores.GORMIAMStore
+	MonitoringStore *stores.GORMMonitoringStore
+	Runtime         *containers.Fake
+}
+
+// testConfig is the configuration of the test servers, the tests change what they exercise
+func testConfig() *config.Config {
+	return &config.Config{
+		JWTSecret:       "integration-test-secret-key",
+		TokenExpiration: 24 * time.Hour,
+		Environment:     "test",
+		LambdaTimeout:   5 * time.Second,
+
+		LambdaOrgConcurrency:    100,
+		LambdaOrgConcurrencyMax: 1000,
+	}
+}
+
+// newTestServer creates a test server running all the background services, which are closed
+// with the test. The schedules start and stop the containers through compute, or through the
+// compute handler when it's nil.
+func newTestServer(t *testing.T, cfg *config.Config, compute services.ComputeController) *testServer {
+	t.Helper()
+	dbPath := "integration_test_" + uuid.New().String() + ".db"
+	t.Cleanup(func() { os.Remove(dbPath) })
+	// the stores and the background services share the file, the transactions take the write
+	// lock when they begin so the writers wait for each other instead of failing
+	dsn := dbPath + "?_busy_timeout=5000&_txlock=immediate"
+
+	iamStore, err := stores.NewGORMIAMStore(dsn)
+	require.NoError(t, err)
+	storageStore, err := stores.NewGORMStorageStore(dsn, t.TempDir())
+	require.NoError(t, err)
+	secretsStore, err := stores.NewSecretStore(dsn)
+	require.NoError(t, err)
+	monitoringStore, err := stores.NewGORMMonitoringStore(dsn)
+	require.NoError(t, err)
+	functionStore, err := stores.NewGORMFunctionStore(dsn)
+	require.NoError(t, err)
+	storageEventStore, err := stores.NewGORMStorageEventStore(dsn)
+	require.NoError(t, err)
+	workflowStore, err := stores.NewGORMWorkflowStore(dsn)
+	require.NoError(t, err)
+	computeStore, err := stores.NewGORMComputeStore(dsn)
+	require.NoError(t, err)
+	scheduleStore, err := stores.NewGORMScheduleStore(dsn)
+	require.NoError(t, err)
+
+	runtime := containers.NewFake()
+	monitoringService := services.NewMonitoringService(monitoringStore, iamStore)
+	computeService := services.NewComputeService(runtime, computeStore, iamStore)
+	reconciler := services.NewComputeReconciler(cfg, computeService, monitoringService)
+	t.Cleanup(reconciler.Close)
+
+	computeHandler := handlers.NewComputeHandler(cfg, iamStore, monitoringService, computeService)
+	functionService := services.NewFunctionService(cfg, functionStore, functionStore, functionStore)
+	lambdaHandler := handlers.NewLambdaHandler(cfg, iamStore, monitoringService, functionService)
+
+	storageEventService := services.NewStorageEventService(cfg, storageEventStore, functionService, iamStore, lambdaHandler)
+	storageEventService.RetryDelay = 10 * time.Millisecond
+	storageStore.SetEventSink(storageEventService)
+	t.Cleanup(storageEventService.Close)
+
+	workflowService := services.NewWorkflowService(cfg, workflowStore, functionService, iamStore, lambdaHandler)
+	t.Cleanup(workflowService.Close)
+
+	if compute == nil {
+		compute = computeHandler
+	}
+	scheduleService := services.NewScheduleService(cfg, scheduleStore, functionService, iamStore, lambdaHandler, compute)
+	computeService.SetReplacementSink(scheduleService)
+	t.Cleanup(scheduleService.Close)
+
+	h := routes.Handlers{
+		IAM:          handlers.NewIAMHandler(iamStore, cfg),
+		Storage:      handlers.NewStorageHandler(storageStore, iamStore, cfg),
+		StorageEvent: handlers.NewStorageEventHandler(cfg, iamStore, storageStore, storageEventService),
+		Compute:      computeHandler,
+		Lambda:       lambdaHandler,
+		Function:     handlers.NewFunctionHandler(cfg, iamStore, functionService, lambdaHandler),
+		Workflow:     handlers.NewWorkflowHandler(cfg, iamStore, workflowService),
+		Schedule:     handlers.NewScheduleHandler(cfg, iamStore, scheduleService),
+		Secrets:      handlers.NewSecretsHandler(secretsStore, iamStore, cfg),
+		RDB:          handlers.NewRDBHandler(cfg, iamStore, services.NewRDBService(runtime)),
+		Monitoring:   handlers.NewMonitoringHandler(cfg, iamStore, monitoringStore),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	routes.SetupRoutes(router, h, cfg)
+
+	return &testServer{
+		Router:          router,
+		DSN:             dsn,
+		IAMStore:        iamStore,
+		MonitoringStore: monitoringStore,
+		Runtime:         runtime,
+	}
+}
+
+// newAdminTestServer creates a test server with the seeded admin account, for the tests
+// logging in as the admin
+func newAdminTestServer(t *testing.T) *testServer {
+	t.Helper()
+	cfg := config.New()
+	cfg.JWTSecret = "test-secret"
+
+	server := newTestServer(t, cfg, nil)
+	require.NoError(t, server.IAMStore.SeedAdmin(cfg))
+
+	return server
+}
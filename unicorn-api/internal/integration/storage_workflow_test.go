@@ -6,90 +6,22 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
-	"time"
-	"unicorn-api/internal/config"
 	"unicorn-api/internal/handlers"
 	"unicorn-api/internal/models"
-	"unicorn-api/internal/routes"
-	"unicorn-api/internal/services"
-	"unicorn-api/internal/stores"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func setupStorageIntegrationTest(t *testing.T) (*gin.Engine, func()) {
-	// Create temporary database files
-	iamDBPath := "storage_integration_iam_test_" + uuid.New().String() + ".db"
-	storageDBPath := "storage_integration_storage_test_" + uuid.New().String() + ".db"
-	storagePath := "storage_test_" + uuid.New().String()
-
-	// Create storage directory
-	err := os.MkdirAll(storagePath, 0755)
-	require.NoError(t, err)
-
-	// Setup IAM store
-	iamStore, err := stores.NewGORMIAMStore(iamDBPath)
-	require.NoError(t, err)
-
-	// Setup storage store
-	storageStore, err := stores.NewGORMStorageStore(storageDBPath, storagePath)
-	require.NoError(t, err)
-
-	cfg := &config.Config{
-		JWTSecret:       "integration-test-secret-key",
-		TokenExpiration: 24 * time.Hour,
-		Environment:     "test",
-	}
-
-	secretsStore, err := stores.NewSecretStore("test.db")
-	if err != nil {
-		panic("failed to initialize secrets store: " + err.Error())
-	}
-
-	monitoringStore, err := stores.NewGORMMonitoringStore("test.db")
-	if err != nil {
-		panic("failed to initialize monitoring store: " + err.Error())
-	}
-
-	monitoringService := services.NewMonitoringService(monitoringStore, iamStore)
-
-	iamHandler := handlers.NewIAMHandler(iamStore, cfg)
-	storageHandler := handlers.NewStorageHandler(storageStore, iamStore, cfg)
-	computeHandler := handlers.NewComputeHandler(cfg, iamStore, monitoringService)
-	lambdaHandler := handlers.NewLambdaHandler(cfg, iamStore)
-	secretsHandler := handlers.NewSecretsHandler(secretsStore, iamStore, cfg)
-	rdbHandler := handlers.NewRDBHandler(cfg, iamStore)
-	monitoringHandler := handlers.NewMonitoringHandler(cfg, iamStore, monitoringStore)
-
-	// Setup router
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	routes.SetupRoutes(router, iamHandler, storageHandler, computeHandler, lambdaHandler, secretsHandler, rdbHandler, monitoringHandler, cfg)
-
-	// Return cleanup function
-	cleanup := func() {
-		// Drop tables and cleanup
-		os.Remove(iamDBPath)
-		os.Remove(storageDBPath)
-		os.RemoveAll(storagePath)
-	}
-
-	return router, cleanup
-}
-
 // TestFullStorageWorkflow tests the complete storage workflow:
 // 1. Create organization and roles
 // 2. Create users with different permissions
 // 3. Test bucket creation with different permission levels
 // 4. Test file operations with proper authorization
 func TestFullStorageWorkflow(t *testing.T) {
-	router, cleanup := setupStorageIntegrationTest(t)
-	defer cleanup()
+	router := newTestServer(t, testConfig(), nil).Router
 
 	// Step 1: Create organization
 	var orgID string
@@ -512,8 +444,7 @@ func loginUser(t *testing.T, router *gin.Engine, loginReq handlers.LoginRequest)
 
 // TestStorageAuthorization tests authorization scenarios
 func TestStorageAuthorization(t *testing.T) {
-	router, cleanup := setupStorageIntegrationTest(t)
-	defer cleanup()
+	router := newTestServer(t, testConfig(), nil).Router
 
 	// Setup test data
 	orgID := createTestOrganization(t, router, "Auth Test Org")
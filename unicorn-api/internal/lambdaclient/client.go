@@ -0,0 +1,248 @@
+// Package lambdaclient calls the Lambda API on behalf of the accounts of unicorn-api.
+package lambdaclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/tracing"
+)
+
+// ErrCircuitOpen is returned without calling the Lambda API while it is considered down
+var ErrCircuitOpen = errors.New("lambda API is unavailable, circuit breaker is open")
+
+// StatusError is an answer of the Lambda API other than 200
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("lambda API answered %d: %s", e.StatusCode, e.Message)
+}
+
+// Options configures a Client
+type Options struct {
+	// BaseURL is the address of the Lambda API entry
+	BaseURL string
+	// Timeout bounds each attempt, queueing and execution included
+	Timeout time.Duration
+	// MaxRetries is the number of times a request answered 503 is sent again, under the
+	// same Idempotency-Key so that a task already dispatched is never run twice
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for the next ones,
+	// unless the Lambda API asks for another one with Retry-After
+	RetryBackoff time.Duration
+	// BreakerThreshold consecutive failures open the circuit for BreakerCooldown,
+	// a threshold of 0 disables the breaker
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// OptionsFromConfig returns the options of the client of the Lambda API set in the configuration
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		BaseURL:          cfg.LambdaURL,
+		Timeout:          cfg.LambdaTimeout,
+		MaxRetries:       cfg.LambdaMaxRetries,
+		RetryBackoff:     200 * time.Millisecond,
+		BreakerThreshold: cfg.LambdaBreakerThreshold,
+		BreakerCooldown:  cfg.LambdaBreakerCooldown,
+	}
+}
+
+// Client sends execution requests to the Lambda API
+type Client struct {
+	options Options
+	http    *http.Client
+	breaker *breaker
+}
+
+// NewClient creates a new client of the Lambda API
+func NewClient(options Options) *Client {
+	return &Client{
+		options: options,
+		http:    &http.Client{Timeout: options.Timeout},
+		breaker: newBreaker(options.BreakerThreshold, options.BreakerCooldown),
+	}
+}
+
+// BaseURL returns the address of the Lambda API
+func (c *Client) BaseURL() string {
+	return c.options.BaseURL
+}
+
+// Response is the raw response of the Lambda API
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Execute runs a request on behalf of the holder of the authorization and decodes the task
+// the Lambda API answers with. An answer other than 200 is returned as a *StatusError.
+func (c *Client) Execute(ctx context.Context, authorization string, req models.LambdaExecuteRequest) (*models.LambdaExecuteResponse, error) {
+	resp, err := c.Post(ctx, "/api/v1/execute", authorization, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: failureMessage(resp.Body)}
+	}
+
+	var task models.LambdaTask
+	if err := json.Unmarshal(resp.Body, &task); err != nil {
+		return nil, fmt.Errorf("failed to decode Lambda API response: %w", err)
+	}
+	return NewExecuteResponse(&task), nil
+}
+
+// Post sends a request to a path of the Lambda API and reads the whole response. The requests
+// answered 503 are retried with the Idempotency-Key of the first attempt: the Lambda API also
+// answers 503 when the reply of a dispatched task is lost, the retries then get its outcome
+// instead of running it again. The trace context is propagated through the W3C trace headers.
+func (c *Client) Post(ctx context.Context, path, authorization string, req models.LambdaExecuteRequest) (*Response, error) {
+	ctx, span := tracing.Tracer("unicorn-api").Start(ctx, "lambda.forward",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("lambda.runtime", req.Runtime.Name),
+			attribute.String("lambda.path", path),
+		),
+	)
+	defer span.End()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	key := uuid.NewString()
+	backoff := c.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			span.SetStatus(codes.Error, ErrCircuitOpen.Error())
+			return nil, ErrCircuitOpen
+		}
+
+		resp, retryAfter, err := c.send(ctx, path, authorization, key, body)
+		// the API answering 5xx or not at all counts against it, not the errors of the callers nor
+		// the callers hanging up
+		if errors.Is(err, context.Canceled) {
+			c.breaker.release()
+		} else {
+			c.breaker.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+
+		span.SetAttributes(
+			attribute.Int("http.status_code", resp.StatusCode),
+			attribute.Int("lambda.attempts", attempt+1),
+		)
+		if resp.StatusCode != http.StatusServiceUnavailable || attempt >= c.options.MaxRetries {
+			return resp, nil
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// send makes a single attempt, returning the wait asked by a Retry-After header
+func (c *Client) send(ctx context.Context, path, authorization, idempotencyKey string, body []byte) (*Response, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.options.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request to Lambda API: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to connect to Lambda API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read Lambda API response: %w", err)
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return &Response{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        respBody,
+	}, retryAfter, nil
+}
+
+// NewExecuteResponse maps a task of the Lambda API to the response of unicorn-api: the streams
+// and exit code are the ones of the run, unless the compilation failed
+func NewExecuteResponse(task *models.LambdaTask) *models.LambdaExecuteResponse {
+	compile, run := task.Output.Compile, task.Output.Run
+
+	resp := &models.LambdaExecuteResponse{
+		ID:              task.ID,
+		Status:          task.Status,
+		Stdout:          run.Stdout,
+		Stderr:          run.Stderr,
+		Output:          run.Output,
+		ExitCode:        run.ExitCode,
+		CompileExitCode: compile.ExitCode,
+		TimedOut:        compile.TimedOut || run.TimedOut,
+		Truncated:       run.StdoutTruncated || run.StderrTruncated || run.OutputKilled,
+		Time:            compile.Time + run.Time,
+		Memory:          max(compile.Memory, run.Memory),
+	}
+
+	if compile.ExitCode != 0 {
+		resp.Stdout = compile.Stdout
+		resp.Stderr = compile.Stderr
+		resp.Output = compile.Output
+	}
+
+	return resp
+}
+
+// failureMessage extracts the message of a failure answered by the Lambda API
+func failureMessage(body []byte) string {
+	var failure struct {
+		Message string `json:"output"`
+	}
+	if err := json.Unmarshal(body, &failure); err == nil && failure.Message != "" {
+		return failure.Message
+	}
+	return string(bytes.TrimSpace(body))
+}
@@ -0,0 +1,194 @@
+package lambdaclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unicorn-api/internal/models"
+)
+
+const successfulTask = `{
+	"id": "9b2f8c1e-7d4a-4e0b-8f57-3c6f1d2a9e10",
+	"status": "successful",
+	"output": {
+		"compile": {"time": 40, "memory": 4194304},
+		"run": {"stdout": "3\n", "stderr": "warn\n", "output": "warn\n3\n", "exit_code": 0, "time": 12, "memory": 9437184, "stdout_truncated": true}
+	}
+}`
+
+func testClient(url string) *Client {
+	return NewClient(Options{
+		BaseURL:          url,
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		RetryBackoff:     time.Millisecond,
+		BreakerThreshold: 3,
+		BreakerCooldown:  time.Hour,
+	})
+}
+
+func TestExecuteDecodesTask(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/execute", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte(successfulTask))
+	}))
+	defer server.Close()
+
+	resp, err := testClient(server.URL).Execute(context.Background(), "Bearer token", models.LambdaExecuteRequest{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "9b2f8c1e-7d4a-4e0b-8f57-3c6f1d2a9e10", resp.ID)
+	assert.Equal(t, models.LambdaTaskSuccessful, resp.Status)
+	assert.Equal(t, "3\n", resp.Stdout)
+	assert.Equal(t, "warn\n", resp.Stderr)
+	assert.Equal(t, int32(0), resp.ExitCode)
+	assert.Equal(t, int32(52), resp.Time, "compile and run time add up")
+	assert.Equal(t, uint64(9437184), resp.Memory, "the peak memory of both processes")
+	assert.True(t, resp.Truncated)
+}
+
+func TestExecuteCompileFailure(t *testing.T) {
+	task := &models.LambdaTask{Status: "failed"}
+	task.Output.Compile = models.LambdaProcessResult{Stderr: "main.c:1: error", ExitCode: 1}
+
+	resp := NewExecuteResponse(task)
+	assert.Equal(t, "main.c:1: error", resp.Stderr, "the streams of the failed compilation are returned")
+	assert.Equal(t, int32(1), resp.CompileExitCode)
+}
+
+func TestExecuteRetriesUnavailable(t *testing.T) {
+	var calls atomic.Int32
+	keys := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys <- r.Header.Get("Idempotency-Key")
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"failed","output":"queue unavailable"}`))
+			return
+		}
+		w.Write([]byte(successfulTask))
+	}))
+	defer server.Close()
+
+	resp, err := testClient(server.URL).Execute(context.Background(), "", models.LambdaExecuteRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, models.LambdaTaskSuccessful, resp.Status)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// the retries can't run a task already dispatched again
+	first := <-keys
+	assert.NotEmpty(t, first)
+	assert.Equal(t, first, <-keys)
+	assert.Equal(t, first, <-keys)
+}
+
+func TestExecuteStatusError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"status":"failed","output":"concurrency limit reached"}`))
+	}))
+	defer server.Close()
+
+	_, err := testClient(server.URL).Execute(context.Background(), "", models.LambdaExecuteRequest{})
+
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+	assert.Equal(t, "concurrency limit reached", statusErr.Message)
+	assert.Equal(t, int32(1), calls.Load(), "only 503 is retried")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL)
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Execute(context.Background(), "", models.LambdaExecuteRequest{})
+		var statusErr *StatusError
+		require.True(t, errors.As(err, &statusErr))
+	}
+
+	_, err := client.Execute(context.Background(), "", models.LambdaExecuteRequest{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// after the cooldown a failing probe opens the circuit again
+	now = now.Add(2 * time.Hour)
+	_, err = client.Execute(context.Background(), "", models.LambdaExecuteRequest{})
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	_, err = client.Execute(context.Background(), "", models.LambdaExecuteRequest{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestCircuitBreakerIgnoresCancellation(t *testing.T) {
+	var calls atomic.Int32
+	hangUp := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-hangUp:
+		}
+	}))
+	defer server.Close()
+	defer close(hangUp)
+
+	client := testClient(server.URL)
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			cancel()
+		}()
+		_, err := client.Execute(ctx, "", models.LambdaExecuteRequest{})
+		assert.ErrorIs(t, err, context.Canceled)
+		cancel()
+	}
+	assert.Equal(t, int32(5), calls.Load(), "the callers hanging up don't open the circuit")
+
+	// a cancelled probe gives its place back to the next request
+	client.breaker.state = breakerOpen
+	client.breaker.openedAt = now.Add(-2 * time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.Execute(ctx, "", models.LambdaExecuteRequest{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, client.breaker.allow(), "the probe isn't held by the cancelled request")
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(successfulTask))
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL)
+	client.http.Timeout = 20 * time.Millisecond
+
+	_, err := client.Execute(context.Background(), "", models.LambdaExecuteRequest{})
+	assert.Error(t, err)
+}
@@ -1,5 +1,15 @@
 package models
 
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrComputeInstanceNotFound is returned when a container has no inventory record
+var ErrComputeInstanceNotFound = errors.New("compute instance not found")
+
 // ComputePreset defines hardware constraints for compute service
 // e.g. Micro, Small
 
@@ -31,4 +41,109 @@ type ComputeContainerInfo struct {
 	Ports     map[string]string `json:"ports"`
 	CreatedAt string            `json:"created_at"`
 	UpdatedAt string            `json:"updated_at"`
+	// How the container differs from its requested configuration, empty when it doesn't
+	Drift        ComputeDrift `json:"drift,omitempty"`
+	DriftDetails string       `json:"drift_details,omitempty"`
+}
+
+// ComputeUpdateRequest is the request body for updating a compute container.
+// The fields left out keep their value, the environment is replaced as a whole.
+type ComputeUpdateRequest struct {
+	Command     []string          `json:"command,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+	Preset      ComputePreset     `json:"preset,omitempty" binding:"omitempty,oneof=micro small"`
+}
+
+// ComputeContainerDetail holds the configuration and state of a container
+type ComputeContainerDetail struct {
+	ComputeContainerInfo
+	// created, running or exited
+	State       string            `json:"state"`
+	Command     []string          `json:"command"`
+	Environment map[string]string `json:"environment"`
+	Preset      ComputePreset     `json:"preset,omitempty"`
+	// Resource limits, 0 for no limit
+	NanoCPUs    int64 `json:"nano_cpus"`
+	MemoryBytes int64 `json:"memory_bytes"`
+}
+
+// ComputeDesiredState is the state a compute instance was asked to be in
+type ComputeDesiredState string
+
+const (
+	ComputeDesiredRunning ComputeDesiredState = "running"
+	ComputeDesiredStopped ComputeDesiredState = "stopped"
+	ComputeDesiredDeleted ComputeDesiredState = "deleted"
+)
+
+// ComputeObservedMissing is the observed state of a compute instance whose container no longer exists
+const ComputeObservedMissing = "missing"
+
+// ComputeDrift is how a container differs from its compute instance
+type ComputeDrift string
+
+const (
+	ComputeDriftNone ComputeDrift = ""
+	// ComputeDriftVanished: the container no longer exists
+	ComputeDriftVanished ComputeDrift = "vanished"
+	// ComputeDriftCrashed: the container should run and doesn't
+	ComputeDriftCrashed ComputeDrift = "crashed"
+	// ComputeDriftStarted: the container runs and was stopped
+	ComputeDriftStarted ComputeDrift = "started"
+	// ComputeDriftAltered: the image, command, environment, resources or ports of the container
+	// were changed outside the API
+	ComputeDriftAltered ComputeDrift = "altered"
+)
+
+// HealthStatus is the health reported to monitoring for a container with the drift
+func (d ComputeDrift) HealthStatus() string {
+	if d == ComputeDriftNone {
+		return "healthy"
+	}
+	return string(d)
+}
+
+// ComputeInstance is the inventory record of a compute container: the configuration requested
+// through the API, and the state last observed by the reconciliation.
+// The records of the deleted containers are kept.
+// swagger:model ComputeInstance
+type ComputeInstance struct {
+	// The unique identifier of the instance
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The ID of the organization owning the instance
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;not null;index"`
+	// The ID of the account that created the instance
+	AccountID uuid.UUID `json:"account_id" gorm:"type:text;not null;index"`
+	// The ID of the container, it changes when the instance is updated
+	ContainerID string `json:"container_id" gorm:"type:text;not null;uniqueIndex"`
+	// The name of the container
+	Name string `json:"name" gorm:"type:text;not null"`
+
+	// Requested configuration
+	Image       string            `json:"image" gorm:"type:text;not null"`
+	Command     []string          `json:"command" gorm:"serializer:json"`
+	Environment map[string]string `json:"environment" gorm:"serializer:json"`
+	Preset      ComputePreset     `json:"preset,omitempty" gorm:"type:text"`
+	// Resource limits, 0 for no limit
+	NanoCPUs    int64 `json:"nano_cpus"`
+	MemoryBytes int64 `json:"memory_bytes"`
+	// Host ports by container port
+	Ports        map[string]string   `json:"ports" gorm:"serializer:json"`
+	DesiredState ComputeDesiredState `json:"desired_state" gorm:"type:text;not null;index"`
+
+	// Observed state: created, running, exited or missing, and its description
+	ObservedState  string     `json:"observed_state" gorm:"type:text"`
+	ObservedStatus string     `json:"observed_status,omitempty" gorm:"type:text"`
+	ObservedAt     *time.Time `json:"observed_at,omitempty"`
+	// How the container differs from the requested configuration, and since when
+	Drift           ComputeDrift `json:"drift,omitempty" gorm:"type:text;index"`
+	DriftDetails    string       `json:"drift_details,omitempty" gorm:"type:text"`
+	DriftDetectedAt *time.Time   `json:"drift_detected_at,omitempty"`
+
+	// When the instance was deleted through the API
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
 }
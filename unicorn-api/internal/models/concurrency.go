@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrganizationConcurrency overrides the default number of invocations an organization can run at once.
+// swagger:model OrganizationConcurrency
+type OrganizationConcurrency struct {
+	// The ID of the organization
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;primaryKey"`
+	// The number of invocations of the functions of the organization running at once
+	MaxConcurrency int `json:"max_concurrency" gorm:"not null"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PutOrganizationConcurrencyRequest is the request body for setting the capacity of an organization,
+// the organization of the caller when none is given
+type PutOrganizationConcurrencyRequest struct {
+	OrganizationID *uuid.UUID `json:"organization_id,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	MaxConcurrency int        `json:"max_concurrency" binding:"required,min=1" example:"100"`
+}
+
+// PutFunctionConcurrencyRequest is the request body for setting the concurrency of a function,
+// 0 removes a limit or a reservation
+type PutFunctionConcurrencyRequest struct {
+	MaxConcurrency      int `json:"max_concurrency" binding:"min=0" example:"10"`
+	ReservedConcurrency int `json:"reserved_concurrency" binding:"min=0" example:"5"`
+}
+
+// ConcurrencyResponse describes the capacity of an organization or a function and its use
+type ConcurrencyResponse struct {
+	// The number of invocations that can run at once, 0 when only the organization limits it
+	MaxConcurrency int `json:"max_concurrency" example:"100"`
+	// The number of invocations set aside for functions
+	ReservedConcurrency int `json:"reserved_concurrency" example:"20"`
+	// The number of invocations running on this replica of the API
+	InFlight int `json:"in_flight" example:"3"`
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// general errors for the function registry
+var (
+	ErrFunctionNotFound        = errors.New("function not found")
+	ErrFunctionExists          = errors.New("function already exists")
+	ErrFunctionVersionNotFound = errors.New("function version not found")
+	ErrFunctionAliasNotFound   = errors.New("function alias not found")
+)
+
+// LatestQualifier selects the most recent version of a function
+const LatestQualifier = "latest"
+
+// FunctionRuntime is the lambda runtime a function runs on
+type FunctionRuntime struct {
+	Name    string `json:"name" binding:"required" example:"python3"`
+	Version string `json:"version,omitempty" example:"3.12"`
+}
+
+// Function is a named lambda function owned by an organization.
+// swagger:model Function
+// @description A function of an organization, every update of its code publishes a new version.
+type Function struct {
+	// The unique identifier of the function
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The name of the function, unique in its organization
+	Name string `json:"name" gorm:"not null;type:text;uniqueIndex:idx_function_org_name"`
+	// The ID of the organization owning the function
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;not null;uniqueIndex:idx_function_org_name"`
+	// A description of the function
+	Description string `json:"description,omitempty" gorm:"type:text"`
+	// The number of the most recent version
+	LatestVersion int `json:"latest_version" gorm:"not null"`
+	// The aliases pointing to versions of the function
+	Aliases []FunctionAlias `json:"aliases,omitempty" gorm:"foreignKey:FunctionID"`
+
+	// How callers of the invoke URL authenticate, the URL is disabled when empty
+	URLAuth FunctionURLAuth `json:"url_auth,omitempty" gorm:"type:text"`
+	// The version number or alias run by the invoke URL, the latest version when empty
+	URLQualifier string `json:"url_qualifier,omitempty" gorm:"type:text"`
+	// The SHA-256 of the API key of the invoke URL
+	URLKeyHash string `json:"-" gorm:"type:text"`
+
+	// The number of invocations the function can run at once, unlimited up to the capacity of
+	// its organization when 0
+	MaxConcurrency int `json:"max_concurrency,omitempty" gorm:"not null;default:0"`
+	// The number of invocations set aside for the function in the capacity of its organization,
+	// the other functions can't use them
+	ReservedConcurrency int `json:"reserved_concurrency,omitempty" gorm:"not null;default:0"`
+}
+
+// FunctionVersion is an immutable snapshot of the code and settings of a function.
+// swagger:model FunctionVersion
+type FunctionVersion struct {
+	// The unique identifier of the version
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The publication timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The ID of the function
+	FunctionID uuid.UUID `json:"function_id" gorm:"type:text;not null;uniqueIndex:idx_function_version"`
+	// The number of the version, starting at 1
+	Version int `json:"version" gorm:"not null;uniqueIndex:idx_function_version"`
+	// The ID of the account that published the version
+	CreatedBy uuid.UUID `json:"created_by" gorm:"type:text"`
+	// A description of the changes
+	Description string `json:"description,omitempty" gorm:"type:text"`
+
+	Runtime FunctionRuntime   `json:"runtime" gorm:"embedded;embeddedPrefix:runtime_"`
+	Entry   string            `json:"entry,omitempty" gorm:"type:text"`
+	Files   []LambdaFile      `json:"files" gorm:"serializer:json"`
+	Process LambdaProcessInfo `json:"process" gorm:"serializer:json"`
+	// Environment variables set on every invocation, on top of the process ones
+	Environment map[string]string `json:"env,omitempty" gorm:"serializer:json"`
+	// The layers merged into the files at invocation, a later layer overrides the files of the
+	// previous ones and the files of the function override all of them
+	Layers []LayerReference `json:"layers,omitempty" gorm:"serializer:json"`
+}
+
+// FunctionAlias is a named pointer to a version of a function, like prod or staging.
+// swagger:model FunctionAlias
+type FunctionAlias struct {
+	// The unique identifier of the alias
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The ID of the function
+	FunctionID uuid.UUID `json:"function_id" gorm:"type:text;not null;uniqueIndex:idx_function_alias"`
+	// The name of the alias
+	Name string `json:"name" gorm:"not null;type:text;uniqueIndex:idx_function_alias"`
+	// The version the alias points to
+	Version int `json:"version" gorm:"not null"`
+	// A description of the alias
+	Description string `json:"description,omitempty" gorm:"type:text"`
+}
+
+// FunctionURLAuth is the authentication of the invoke URL of a function
+type FunctionURLAuth string
+
+const (
+	FunctionURLAuthNone   FunctionURLAuth = "none"    // public
+	FunctionURLAuthAPIKey FunctionURLAuth = "api_key" // X-Api-Key header with the key of the URL
+	FunctionURLAuthJWT    FunctionURLAuth = "jwt"     // bearer token of an account of the organization
+)
+
+// CreateFunctionRequest is the request body for creating a function, it publishes version 1
+type CreateFunctionRequest struct {
+	Name        string            `json:"name" binding:"required" example:"resize-image"`
+	Description string            `json:"description,omitempty" example:"Resizes the uploaded images"`
+	Runtime     FunctionRuntime   `json:"runtime" binding:"required"`
+	Entry       string            `json:"entry,omitempty" example:"import main"`
+	Files       []LambdaFile      `json:"files" binding:"required,dive"`
+	Process     LambdaProcessInfo `json:"process,omitempty"`
+	Environment map[string]string `json:"env,omitempty" example:"{\"STAGE\":\"dev\"}"`
+	Layers      []LayerReference  `json:"layers,omitempty" binding:"omitempty,dive"`
+}
+
+// UpdateFunctionRequest is the request body for publishing a new version of a function,
+// the fields left out are kept from the latest version
+type UpdateFunctionRequest struct {
+	Description string             `json:"description,omitempty" example:"Use a faster encoder"`
+	Runtime     *FunctionRuntime   `json:"runtime,omitempty"`
+	Entry       *string            `json:"entry,omitempty"`
+	Files       []LambdaFile       `json:"files,omitempty" binding:"omitempty,dive"`
+	Process     *LambdaProcessInfo `json:"process,omitempty"`
+	Environment map[string]string  `json:"env,omitempty"`
+	// The layers replacing the ones of the latest version, an empty list detaches them
+	Layers []LayerReference `json:"layers,omitempty" binding:"omitempty,dive"`
+}
+
+// PutFunctionAliasRequest is the request body for creating or moving an alias
+type PutFunctionAliasRequest struct {
+	Version     int    `json:"version" binding:"required,min=1" example:"3"`
+	Description string `json:"description,omitempty" example:"Production traffic"`
+}
+
+// InvokeFunctionRequest is the request body for invoking a function
+type InvokeFunctionRequest struct {
+	// Version number or alias to run, the latest version by default
+	Qualifier string `json:"qualifier,omitempty" example:"prod"`
+	// Standard input of the invocation, replaces the default one
+	StandardInput string `json:"stdin,omitempty" example:"{\"width\":200}"`
+	// Environment variables added to the ones of the version
+	Environment map[string]string `json:"env,omitempty"`
+	Priority    string            `json:"priority,omitempty" binding:"omitempty,oneof=high normal low" example:"high"`
+}
+
+// PutFunctionURLRequest is the request body for enabling the invoke URL of a function
+type PutFunctionURLRequest struct {
+	AuthType FunctionURLAuth `json:"auth_type" binding:"required,oneof=none api_key jwt" example:"api_key"`
+	// Version number or alias run by the URL, the latest version by default
+	Qualifier string `json:"qualifier,omitempty" example:"prod"`
+	// Replace the API key of the URL, one is always generated when there is none
+	RotateKey bool `json:"rotate_key,omitempty" example:"false"`
+}
+
+// FunctionURLResponse describes the invoke URL of a function
+type FunctionURLResponse struct {
+	URL       string          `json:"url" example:"http://localhost:8080/fn/123e4567-e89b-12d3-a456-426614174000/resize-image"`
+	AuthType  FunctionURLAuth `json:"auth_type" example:"api_key"`
+	Qualifier string          `json:"qualifier,omitempty" example:"prod"`
+	// The API key of the URL, only returned when it is generated
+	APIKey string `json:"api_key,omitempty" example:"fk_3f9a..."`
+}
+
+// FunctionHTTPEvent is the standard input of a function invoked through its URL
+type FunctionHTTPEvent struct {
+	Method string `json:"method" example:"POST"`
+	// The path after the function name, at least /
+	Path     string            `json:"path" example:"/images/42"`
+	Headers  map[string]string `json:"headers"`
+	Query    map[string]string `json:"query"`
+	RawQuery string            `json:"raw_query,omitempty" example:"size=small&format=png"`
+	Body     string            `json:"body"`
+	// The body is base64 encoded when it isn't valid UTF-8
+	IsBase64Encoded bool   `json:"is_base64_encoded"`
+	SourceIP        string `json:"source_ip" example:"203.0.113.7"`
+}
+
+// FunctionHTTPResponse is the output of a function invoked through its URL, printed as JSON
+// on its standard output. Any other output is returned as a plain text 200 response.
+type FunctionHTTPResponse struct {
+	StatusCode      int               `json:"status_code" example:"201"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"is_base64_encoded,omitempty"`
+}
@@ -15,13 +15,21 @@ type LambdaPermissions struct {
 
 // LambdaProcessInfo contains execution parameters for the Lambda function
 type LambdaProcessInfo struct {
-	StandardInput    string            `json:"stdin,omitempty" example:"test input"`
-	CPUTime          string            `json:"time,omitempty" example:"2s"`
-	MaxOpenedFiles   int32             `json:"max_opened_files,omitempty" example:"10"`
-	MaxProcesses     int32             `json:"max_processes,omitempty" example:"5"`
-	Permissions      LambdaPermissions `json:"permissions,omitempty"`
-	EnvironmentVars  map[string]string `json:"env,omitempty" example:"{\"DEBUG\":\"true\"}"`
-	WorkingDirectory string            `json:"-"`
+	StandardInput    string             `json:"stdin,omitempty" example:"test input"`
+	CPUTime          string             `json:"time,omitempty" example:"2s"`
+	MaxOpenedFiles   int32              `json:"max_opened_files,omitempty" example:"10"`
+	MaxProcesses     int32              `json:"max_processes,omitempty" example:"5"`
+	Permissions      LambdaPermissions  `json:"permissions,omitempty"`
+	EnvironmentVars  map[string]string  `json:"env,omitempty" example:"{\"DEBUG\":\"true\"}"`
+	OutputLimits     LambdaOutputLimits `json:"output_limits,omitempty"`
+	WorkingDirectory string             `json:"-"`
+}
+
+// LambdaOutputLimits caps the bytes kept from each output stream, the workers apply their own caps on top
+type LambdaOutputLimits struct {
+	Stdout int64 `json:"stdout,omitempty" binding:"omitempty,min=1" example:"65536"`
+	Stderr int64 `json:"stderr,omitempty" binding:"omitempty,min=1" example:"65536"`
+	Kill   bool  `json:"kill,omitempty" example:"true"`
 }
 
 // LambdaExecuteRequest is the request body for executing a Lambda function
@@ -35,12 +43,55 @@ type LambdaExecuteRequest struct {
 		Files []LambdaFile `json:"files" binding:"required"`
 	} `json:"project"`
 	Process LambdaProcessInfo `json:"process,omitempty"`
+	// Queue lane of the execution, interactive calls should use high
+	Priority string `json:"priority,omitempty" binding:"omitempty,oneof=high normal low" example:"normal"`
 }
 
 // LambdaExecuteResponse is the response from executing a Lambda function
 type LambdaExecuteResponse struct {
-	Status  string `json:"status" example:"success"`
-	Output  string `json:"output" example:"3\n"`
-	Runtime string `json:"runtime,omitempty" example:"python3"`
-	Time    string `json:"time,omitempty" example:"0.023s"`
+	ID string `json:"id" example:"9b2f8c1e-7d4a-4e0b-8f57-3c6f1d2a9e10"`
+	// successful, failed when the code did not compile or exited with an error, or error
+	Status string `json:"status" example:"successful"`
+	// The streams of the run, or of the compilation when it failed
+	Stdout string `json:"stdout" example:"3\n"`
+	Stderr string `json:"stderr" example:""`
+	Output string `json:"output" example:"3\n"`
+	// The exit codes of the run and of the compilation
+	ExitCode        int32 `json:"exit_code" example:"0"`
+	CompileExitCode int32 `json:"compile_exit_code" example:"0"`
+	// Whether a process was killed at the CPU time limit, or an output stream was cut
+	TimedOut  bool `json:"timed_out,omitempty" example:"false"`
+	Truncated bool `json:"truncated,omitempty" example:"false"`
+	// The CPU time in milliseconds, and the peak memory in bytes
+	Time   int32  `json:"time" example:"23"`
+	Memory uint64 `json:"memory" example:"9437184"`
+}
+
+// LambdaTaskSuccessful is the status of an execution that ran to completion
+const LambdaTaskSuccessful = "successful"
+
+// LambdaTask is the response of the Lambda API to an execution request
+type LambdaTask struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Output struct {
+		Compile LambdaProcessResult `json:"compile"`
+		Run     LambdaProcessResult `json:"run"`
+	} `json:"output"`
+}
+
+// LambdaProcessResult is the result of a process run by the Lambda API
+type LambdaProcessResult struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Output   string `json:"output"`
+	ExitCode int32  `json:"exit_code"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	// The CPU time in milliseconds and the peak memory in bytes
+	Time   int32  `json:"time"`
+	Memory uint64 `json:"memory"`
+	// The streams are cut at the output limits of the process
+	StdoutTruncated bool `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool `json:"stderr_truncated,omitempty"`
+	OutputKilled    bool `json:"output_killed,omitempty"`
 }
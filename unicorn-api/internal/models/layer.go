@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// general errors for the layers
+var (
+	ErrLayerNotFound        = errors.New("layer not found")
+	ErrLayerVersionNotFound = errors.New("layer version not found")
+)
+
+// Layer is a named bundle of files owned by an organization, shared by its functions.
+// swagger:model Layer
+// @description A layer of an organization, every publication of its files creates a new version.
+type Layer struct {
+	// The unique identifier of the layer
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The name of the layer, unique in its organization
+	Name string `json:"name" gorm:"not null;type:text;uniqueIndex:idx_layer_org_name"`
+	// The ID of the organization owning the layer
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;not null;uniqueIndex:idx_layer_org_name"`
+	// A description of the layer
+	Description string `json:"description,omitempty" gorm:"type:text"`
+	// The number of the most recent version
+	LatestVersion int `json:"latest_version" gorm:"not null"`
+}
+
+// LayerVersion is an immutable snapshot of the files of a layer.
+// swagger:model LayerVersion
+type LayerVersion struct {
+	// The unique identifier of the version
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The publication timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The ID of the layer
+	LayerID uuid.UUID `json:"layer_id" gorm:"type:text;not null;uniqueIndex:idx_layer_version"`
+	// The number of the version, starting at 1
+	Version int `json:"version" gorm:"not null;uniqueIndex:idx_layer_version"`
+	// The ID of the account that published the version
+	CreatedBy uuid.UUID `json:"created_by" gorm:"type:text"`
+	// A description of the changes
+	Description string `json:"description,omitempty" gorm:"type:text"`
+	// The files of the layer, left out of the version listings
+	Files []LambdaFile `json:"files,omitempty" gorm:"serializer:json"`
+	// The total size of the contents of the files in bytes
+	Size int64 `json:"size" gorm:"not null"`
+}
+
+// LayerReference attaches a version of a layer of the organization to a function
+type LayerReference struct {
+	Name    string `json:"name" binding:"required" example:"image-utils"`
+	Version int    `json:"version" binding:"required,min=1" example:"2"`
+}
+
+// PublishLayerVersionRequest is the request body for publishing a version of a layer,
+// the layer is created with its first version
+type PublishLayerVersionRequest struct {
+	Description string       `json:"description,omitempty" example:"Add the webp helpers"`
+	Files       []LambdaFile `json:"files" binding:"required,min=1,dive"`
+}
@@ -76,6 +76,8 @@ type ResourceUsage struct {
 	ResourceCreatedAt time.Time `json:"resource_created_at"`
 	// When the resource was last active
 	LastActiveAt *time.Time `json:"last_active_at"`
+	// Hours the resource was inactive, like a stopped container, which are not billed
+	InactiveHours float64 `json:"inactive_hours" gorm:"type:real;default:0"`
 	// When this usage record was last updated
 	LastUpdatedAt time.Time `json:"last_updated_at"`
 
@@ -282,3 +284,18 @@ type MonthlyUsageTrend struct {
 	TotalCost float64 `json:"total_cost"`
 	Resources int     `json:"resources"`
 }
+
+// LambdaUsage is the metering of a lambda invocation, accumulated per account and memory class
+type LambdaUsage struct {
+	AccountID      uuid.UUID
+	OrganizationID uuid.UUID
+	// The memory class in MB, the peak memory of the invocation rounded up to a power of two
+	MemoryClass int
+	// The execution time rounded up to the billing granularity
+	BilledDuration time.Duration
+	// The cost of the invocation in USD, and the hourly price of its memory class
+	Cost        float64
+	CostPerHour float64
+	// When the invocation ended
+	Time time.Time
+}
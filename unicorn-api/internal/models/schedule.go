@@ -0,0 +1,161 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// general errors for the schedules
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrScheduleExists   = errors.New("schedule already exists")
+)
+
+// ScheduleTargetType is what a schedule runs
+type ScheduleTargetType string
+
+const (
+	// ScheduleTargetFunction invokes a function with the input of the target on its standard input
+	ScheduleTargetFunction ScheduleTargetType = "function"
+	// ScheduleTargetCompute starts or stops a compute container
+	ScheduleTargetCompute ScheduleTargetType = "compute"
+)
+
+// ScheduleComputeAction is what a schedule does to a compute container
+type ScheduleComputeAction string
+
+const (
+	ScheduleComputeStart ScheduleComputeAction = "start"
+	ScheduleComputeStop  ScheduleComputeAction = "stop"
+)
+
+// ScheduleTarget is what a schedule runs, the fields used depend on its type
+type ScheduleTarget struct {
+	Type ScheduleTargetType `json:"type" example:"function"`
+
+	// function: the function invoked, its version number or alias, and its standard input
+	Function  string          `json:"function,omitempty" example:"nightly-report"`
+	Qualifier string          `json:"qualifier,omitempty" example:"prod"`
+	Input     json.RawMessage `json:"input,omitempty" swaggertype:"object"`
+
+	// compute: the container of the account owning the schedule, and the action run on it
+	ContainerID string                `json:"container_id,omitempty"`
+	Action      ScheduleComputeAction `json:"action,omitempty" example:"start"`
+}
+
+// Schedule runs a target at the occurrences of a cron or rate expression, on behalf of the
+// account that created it.
+// swagger:model Schedule
+type Schedule struct {
+	// The unique identifier of the schedule
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The name of the schedule, unique in its organization
+	Name string `json:"name" gorm:"not null;type:text;uniqueIndex:idx_schedule_org_name"`
+	// The ID of the organization owning the schedule
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;not null;uniqueIndex:idx_schedule_org_name"`
+	// The ID of the account that created the schedule, the targets run on its behalf
+	AccountID uuid.UUID `json:"account_id" gorm:"type:text;not null"`
+	// A description of the schedule
+	Description string `json:"description,omitempty" gorm:"type:text"`
+	// A cron expression like cron(0 9 * * MON-FRI) or 0 9 * * MON-FRI, a descriptor like @daily,
+	// or a rate expression like rate(5 minutes)
+	Expression string `json:"expression" gorm:"type:text;not null" example:"cron(0 9 * * MON-FRI)"`
+	// The IANA time zone of the cron expressions
+	Timezone string `json:"timezone" gorm:"type:text;not null" example:"Europe/Bucharest"`
+	// The largest random delay added to each occurrence, spreading the schedules firing at once
+	JitterSeconds int `json:"jitter_seconds"`
+	// Whether the occurrences missed while no replica of the API ran are run late, or skipped
+	CatchUp bool `json:"catch_up"`
+	// Whether the schedule runs, a disabled schedule can still be run by hand
+	Enabled bool `json:"enabled"`
+	// What the schedule runs
+	Target ScheduleTarget `json:"target" gorm:"serializer:json"`
+	// The next occurrence, before its jitter, when the schedule is enabled
+	NextRunAt *time.Time `json:"next_run_at,omitempty" gorm:"index"`
+	// The last time the schedule was run by the scheduler
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+}
+
+// ScheduleRunStatus is the status of a run of a schedule
+type ScheduleRunStatus string
+
+const (
+	ScheduleRunRunning   ScheduleRunStatus = "running"
+	ScheduleRunSucceeded ScheduleRunStatus = "succeeded"
+	ScheduleRunFailed    ScheduleRunStatus = "failed"
+	// ScheduleRunSkipped records the occurrences missed and not caught up
+	ScheduleRunSkipped ScheduleRunStatus = "skipped"
+)
+
+// ScheduleRunTrigger is what started a run of a schedule
+type ScheduleRunTrigger string
+
+const (
+	ScheduleRunOnTime  ScheduleRunTrigger = "schedule"
+	ScheduleRunCatchUp ScheduleRunTrigger = "catch_up"
+	ScheduleRunManual  ScheduleRunTrigger = "manual"
+)
+
+// ScheduleRun is an entry of the run history of a schedule
+type ScheduleRun struct {
+	// The unique identifier of the run
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The ID of the schedule
+	ScheduleID uuid.UUID `json:"schedule_id" gorm:"type:text;not null;index"`
+	// The occurrence the run is for, the time it was asked for when run by hand
+	ScheduledAt time.Time `json:"scheduled_at"`
+	// What started the run
+	Trigger ScheduleRunTrigger `json:"trigger" gorm:"type:text;not null"`
+	// The status of the run
+	Status ScheduleRunStatus `json:"status" gorm:"type:text;not null"`
+	// The replica of the API that ran it
+	Replica string `json:"replica,omitempty" gorm:"type:text"`
+	// The start and end timestamps
+	StartedAt  time.Time  `json:"started_at" gorm:"index"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// The standard output of the function, truncated
+	Output string `json:"output,omitempty" gorm:"type:text"`
+	// Why the run failed or was skipped
+	Error string `json:"error,omitempty" gorm:"type:text"`
+}
+
+// SchedulerLease elects the replica of the API running the schedules, it holds the lease until
+// it expires without being renewed
+type SchedulerLease struct {
+	Name      string    `gorm:"type:text;primaryKey"`
+	Holder    string    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// CreateScheduleRequest is the request body for creating a schedule
+type CreateScheduleRequest struct {
+	Name        string `json:"name" binding:"required" example:"nightly-report"`
+	Description string `json:"description,omitempty"`
+	Expression  string `json:"expression" binding:"required" example:"cron(0 2 * * *)"`
+	// UTC by default
+	Timezone      string `json:"timezone,omitempty" example:"Europe/Bucharest"`
+	JitterSeconds int    `json:"jitter_seconds,omitempty" binding:"min=0,max=3600" example:"30"`
+	CatchUp       bool   `json:"catch_up,omitempty"`
+	// true by default
+	Enabled *bool          `json:"enabled,omitempty"`
+	Target  ScheduleTarget `json:"target" binding:"required"`
+}
+
+// UpdateScheduleRequest is the request body for replacing the settings of a schedule,
+// its next occurrence is computed again
+type UpdateScheduleRequest struct {
+	Description   string         `json:"description,omitempty"`
+	Expression    string         `json:"expression" binding:"required" example:"rate(1 hour)"`
+	Timezone      string         `json:"timezone,omitempty"`
+	JitterSeconds int            `json:"jitter_seconds,omitempty" binding:"min=0,max=3600"`
+	CatchUp       bool           `json:"catch_up,omitempty"`
+	Enabled       *bool          `json:"enabled,omitempty"`
+	Target        ScheduleTarget `json:"target" binding:"required"`
+}
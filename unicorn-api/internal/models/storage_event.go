@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrBucketNotificationNotFound is returned for a notification missing from its bucket
+var ErrBucketNotificationNotFound = errors.New("bucket notification not found")
+
+// StorageEventType is a change of the files of a bucket
+type StorageEventType string
+
+const (
+	StorageEventFileCreated StorageEventType = "file.created"
+	StorageEventFileDeleted StorageEventType = "file.deleted"
+)
+
+// StorageEvent is the standard input of a function invoked by a bucket notification.
+// swagger:model StorageEvent
+type StorageEvent struct {
+	Type        StorageEventType `json:"type" example:"file.created"`
+	BucketID    uuid.UUID        `json:"bucket_id"`
+	FileID      uuid.UUID        `json:"file_id"`
+	Name        string           `json:"name" example:"uploads/cat.png"`
+	Size        int64            `json:"size" example:"52341"`
+	ContentType string           `json:"content_type" example:"image/png"`
+	Time        time.Time        `json:"time"`
+}
+
+// BucketNotification invokes a function for the events of the files of a bucket matching it.
+// swagger:model BucketNotification
+type BucketNotification struct {
+	// The unique identifier of the notification
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The ID of the bucket
+	BucketID uuid.UUID `json:"bucket_id" gorm:"type:text;not null;index"`
+	// The ID of the organization owning the function
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;not null"`
+	// The ID of the account that created the notification, the function runs on its behalf
+	AccountID uuid.UUID `json:"account_id" gorm:"type:text;not null"`
+	// The events invoking the function
+	Events []StorageEventType `json:"events" gorm:"serializer:json"`
+	// Only the files whose name starts with the prefix and ends with the suffix match
+	Prefix string `json:"prefix,omitempty" gorm:"type:text"`
+	Suffix string `json:"suffix,omitempty" gorm:"type:text"`
+	// The function invoked, and its version number or alias
+	FunctionName string `json:"function_name" gorm:"type:text;not null"`
+	Qualifier    string `json:"qualifier,omitempty" gorm:"type:text"`
+}
+
+// Matches reports whether an event invokes the function of the notification
+func (n *BucketNotification) Matches(event StorageEvent) bool {
+	if event.BucketID != n.BucketID {
+		return false
+	}
+	if !strings.HasPrefix(event.Name, n.Prefix) || !strings.HasSuffix(event.Name, n.Suffix) {
+		return false
+	}
+	for _, eventType := range n.Events {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageEventDeliveryStatus is the outcome of the invocation of a function for an event
+type StorageEventDeliveryStatus string
+
+const (
+	StorageEventDeliveryPending   StorageEventDeliveryStatus = "pending"
+	StorageEventDeliverySucceeded StorageEventDeliveryStatus = "succeeded"
+	StorageEventDeliveryFailed    StorageEventDeliveryStatus = "failed"
+)
+
+// StorageEventDelivery records the invocation of the function of a notification for an event.
+// swagger:model StorageEventDelivery
+type StorageEventDelivery struct {
+	// The unique identifier of the delivery
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The ID of the notification
+	NotificationID uuid.UUID `json:"notification_id" gorm:"type:text;not null;index"`
+	// The ID of the bucket
+	BucketID uuid.UUID `json:"bucket_id" gorm:"type:text;not null;index"`
+	// The event passed to the function
+	Event StorageEvent `json:"event" gorm:"serializer:json"`
+	// The status of the delivery
+	Status StorageEventDeliveryStatus `json:"status" gorm:"type:text;not null;index"`
+	// The number of invocations tried
+	Attempts int `json:"attempts"`
+	// The error of the last attempt
+	LastError string `json:"last_error,omitempty" gorm:"type:text"`
+	// The replica of the API delivering the event while pending, and until when it holds it
+	// unless it renews it. Another replica takes over the pending deliveries of an expired holder.
+	Holder         string    `json:"-" gorm:"type:text;index"`
+	LeaseExpiresAt time.Time `json:"-" gorm:"index"`
+}
+
+// CreateBucketNotificationRequest is the request body for adding a notification to a bucket
+type CreateBucketNotificationRequest struct {
+	Events       []StorageEventType `json:"events" binding:"required,min=1,dive,oneof=file.created file.deleted" example:"file.created"`
+	Prefix       string             `json:"prefix,omitempty" example:"uploads/"`
+	Suffix       string             `json:"suffix,omitempty" example:".png"`
+	FunctionName string             `json:"function_name" binding:"required" example:"resize-image"`
+	Qualifier    string             `json:"qualifier,omitempty" example:"prod"`
+}
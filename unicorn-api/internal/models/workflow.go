@@ -0,0 +1,238 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// general errors for the workflows
+var (
+	ErrWorkflowNotFound          = errors.New("workflow not found")
+	ErrWorkflowExists            = errors.New("workflow already exists")
+	ErrWorkflowExecutionNotFound = errors.New("workflow execution not found")
+)
+
+// WorkflowStateType is the kind of a state of a workflow
+type WorkflowStateType string
+
+const (
+	// WorkflowStateTask invokes a function with the input of the state on its standard input,
+	// its standard output is the output of the state
+	WorkflowStateTask WorkflowStateType = "task"
+	// WorkflowStateChoice moves to the next state of the first choice matching the input
+	WorkflowStateChoice WorkflowStateType = "choice"
+	// WorkflowStateParallel runs its branches at once, its output is the list of their outputs
+	WorkflowStateParallel WorkflowStateType = "parallel"
+	// WorkflowStateWait waits before moving to the next state
+	WorkflowStateWait WorkflowStateType = "wait"
+	// WorkflowStateSucceed ends the execution, or the branch, successfully
+	WorkflowStateSucceed WorkflowStateType = "succeed"
+	// WorkflowStateFail ends the execution with an error
+	WorkflowStateFail WorkflowStateType = "fail"
+)
+
+// Errors raised by the states of a workflow, matched by the retriers and catchers
+const (
+	// WorkflowErrorAll matches every error
+	WorkflowErrorAll = "States.ALL"
+	// WorkflowErrorTaskFailed is raised by a function that didn't run successfully
+	WorkflowErrorTaskFailed = "States.TaskFailed"
+	// WorkflowErrorTimeout is raised by a function that ran out of time
+	WorkflowErrorTimeout = "States.Timeout"
+	// WorkflowErrorThrottled is raised by a function over its concurrency limits
+	WorkflowErrorThrottled = "States.Throttled"
+	// WorkflowErrorNoChoiceMatched is raised by a choice state matching none of its choices
+	WorkflowErrorNoChoiceMatched = "States.NoChoiceMatched"
+	// WorkflowErrorRuntime is raised when the execution can't go on, like a path missing from the input
+	WorkflowErrorRuntime = "States.Runtime"
+)
+
+// WorkflowDefinition is a state machine: the execution starts at a state, and moves from one
+// state to the next until one ends it
+type WorkflowDefinition struct {
+	StartAt string                   `json:"start_at" binding:"required" example:"resize"`
+	States  map[string]WorkflowState `json:"states" binding:"required"`
+}
+
+// WorkflowState is a state of a workflow, the fields used depend on its type
+type WorkflowState struct {
+	Type WorkflowStateType `json:"type" example:"task"`
+	// The state executed next, unless the state ends the execution
+	Next string `json:"next,omitempty" example:"notify"`
+	End  bool   `json:"end,omitempty"`
+
+	// task: the function invoked, and its version number or alias
+	Function  string `json:"function,omitempty" example:"resize-image"`
+	Qualifier string `json:"qualifier,omitempty" example:"prod"`
+
+	// task and parallel: the errors retried, and the ones moving to another state
+	Retry []WorkflowRetrier `json:"retry,omitempty"`
+	Catch []WorkflowCatcher `json:"catch,omitempty"`
+
+	// choice: the rules tried in order, and the state when none matches
+	Choices []WorkflowChoice `json:"choices,omitempty"`
+	Default string           `json:"default,omitempty"`
+
+	// parallel: the state machines run at once on the input of the state
+	Branches []WorkflowDefinition `json:"branches,omitempty"`
+
+	// wait: the number of seconds to wait, at most 300: the executions don't survive a
+	// restart of the API
+	Seconds float64 `json:"seconds,omitempty" example:"10"`
+
+	// fail: the error ending the execution
+	Error string `json:"error,omitempty" example:"ImageTooLarge"`
+	Cause string `json:"cause,omitempty"`
+}
+
+// WorkflowRetrier retries a state failing with one of its errors
+type WorkflowRetrier struct {
+	ErrorEquals []string `json:"error_equals" example:"States.TaskFailed"`
+	// The number of retries, 3 by default
+	MaxAttempts *int `json:"max_attempts,omitempty" example:"3"`
+	// The wait before the first retry, 1 second by default and 300 at most
+	IntervalSeconds float64 `json:"interval_seconds,omitempty" example:"1"`
+	// The multiplier of the wait after each retry, 2 by default. The waits stop growing at 300 seconds.
+	BackoffRate float64 `json:"backoff_rate,omitempty" example:"2"`
+}
+
+// WorkflowCatcher moves to another state when a state fails with one of its errors, once
+// the retries are exhausted. The error and its cause are the input of that state.
+type WorkflowCatcher struct {
+	ErrorEquals []string `json:"error_equals" example:"States.ALL"`
+	Next        string   `json:"next" example:"report-failure"`
+}
+
+// WorkflowChoice is a rule of a choice state, comparing a value of the input: its variable
+// is a path like $.order.total
+type WorkflowChoice struct {
+	Variable           string   `json:"variable" example:"$.size"`
+	StringEquals       *string  `json:"string_equals,omitempty"`
+	NumericEquals      *float64 `json:"numeric_equals,omitempty"`
+	NumericLessThan    *float64 `json:"numeric_less_than,omitempty"`
+	NumericGreaterThan *float64 `json:"numeric_greater_than,omitempty" example:"1048576"`
+	BooleanEquals      *bool    `json:"boolean_equals,omitempty"`
+	IsPresent          *bool    `json:"is_present,omitempty"`
+	Next               string   `json:"next" example:"resize"`
+}
+
+// Workflow is a named state machine of an organization invoking its functions.
+// swagger:model Workflow
+type Workflow struct {
+	// The unique identifier of the workflow
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The creation timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The name of the workflow, unique in its organization
+	Name string `json:"name" gorm:"not null;type:text;uniqueIndex:idx_workflow_org_name"`
+	// The ID of the organization owning the workflow
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;not null;uniqueIndex:idx_workflow_org_name"`
+	// A description of the workflow
+	Description string `json:"description,omitempty" gorm:"type:text"`
+	// The state machine of the workflow
+	Definition WorkflowDefinition `json:"definition" gorm:"serializer:json"`
+}
+
+// WorkflowExecutionStatus is the status of an execution of a workflow
+type WorkflowExecutionStatus string
+
+const (
+	WorkflowExecutionRunning   WorkflowExecutionStatus = "running"
+	WorkflowExecutionSucceeded WorkflowExecutionStatus = "succeeded"
+	WorkflowExecutionFailed    WorkflowExecutionStatus = "failed"
+	WorkflowExecutionCancelled WorkflowExecutionStatus = "cancelled"
+)
+
+// WorkflowExecution is a run of a workflow on an input.
+// swagger:model WorkflowExecution
+type WorkflowExecution struct {
+	// The unique identifier of the execution
+	ID uuid.UUID `json:"id" gorm:"type:text;primaryKey"`
+	// The start timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// The last update timestamp
+	UpdatedAt time.Time `json:"updated_at"`
+	// The ID of the workflow
+	WorkflowID uuid.UUID `json:"workflow_id" gorm:"type:text;not null;index"`
+	// The ID of the organization owning the workflow
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:text;not null"`
+	// The ID of the account that started the execution, the functions run on its behalf
+	AccountID uuid.UUID `json:"account_id" gorm:"type:text;not null"`
+	// The definition of the workflow when the execution started
+	Definition WorkflowDefinition `json:"-" gorm:"serializer:json"`
+	// The status of the execution
+	Status WorkflowExecutionStatus `json:"status" gorm:"type:text;not null;index"`
+	// The input of the execution, and the output of its last state once it succeeded
+	Input  json.RawMessage `json:"input" gorm:"type:text"`
+	Output json.RawMessage `json:"output,omitempty" gorm:"type:text"`
+	// The error and its cause once it failed
+	Error string `json:"error,omitempty" gorm:"type:text"`
+	Cause string `json:"cause,omitempty" gorm:"type:text"`
+	// The end timestamp
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+	// The replica of the API running the execution, and until when it holds it unless it renews
+	// it. Another replica ends the running executions of an expired holder.
+	Holder         string    `json:"-" gorm:"type:text;index"`
+	LeaseExpiresAt time.Time `json:"-" gorm:"index"`
+	// Whether the cancellation was asked to a replica not running the execution
+	CancelRequested bool `json:"-"`
+	// The events of the execution, when it's described
+	History []WorkflowEvent `json:"history,omitempty" gorm:"foreignKey:ExecutionID"`
+}
+
+// WorkflowEventType is a step of an execution of a workflow
+type WorkflowEventType string
+
+const (
+	WorkflowEventExecutionStarted   WorkflowEventType = "execution_started"
+	WorkflowEventStateEntered       WorkflowEventType = "state_entered"
+	WorkflowEventStateExited        WorkflowEventType = "state_exited"
+	WorkflowEventStateFailed        WorkflowEventType = "state_failed"
+	WorkflowEventStateRetried       WorkflowEventType = "state_retried"
+	WorkflowEventStateCaught        WorkflowEventType = "state_caught"
+	WorkflowEventExecutionSucceeded WorkflowEventType = "execution_succeeded"
+	WorkflowEventExecutionFailed    WorkflowEventType = "execution_failed"
+	WorkflowEventExecutionCancelled WorkflowEventType = "execution_cancelled"
+)
+
+// WorkflowEvent is a step of the history of an execution
+type WorkflowEvent struct {
+	// The position of the event in the history of all executions
+	ID uint `json:"id" gorm:"primaryKey;autoIncrement"`
+	// The time of the event
+	CreatedAt time.Time `json:"time"`
+	// The ID of the execution
+	ExecutionID uuid.UUID `json:"-" gorm:"type:text;not null;index"`
+	// The kind of step
+	Type WorkflowEventType `json:"type" gorm:"type:text;not null"`
+	// The state of the step, prefixed in the branches of parallel states by the parallel state
+	// and the index of the branch, like fan-out/1/resize
+	State string `json:"state,omitempty" gorm:"type:text"`
+	// The input or output of the state, or the error of the step
+	Details string `json:"details,omitempty" gorm:"type:text"`
+}
+
+// CreateWorkflowRequest is the request body for creating a workflow
+type CreateWorkflowRequest struct {
+	Name        string             `json:"name" binding:"required" example:"process-upload"`
+	Description string             `json:"description,omitempty" example:"Resize the uploaded images and notify the owner"`
+	Definition  WorkflowDefinition `json:"definition" binding:"required"`
+}
+
+// UpdateWorkflowRequest is the request body for replacing the definition of a workflow,
+// the executions already started keep the definition they started with
+type UpdateWorkflowRequest struct {
+	Description string             `json:"description,omitempty"`
+	Definition  WorkflowDefinition `json:"definition" binding:"required"`
+}
+
+// StartWorkflowExecutionRequest is the request body for starting an execution of a workflow
+type StartWorkflowExecutionRequest struct {
+	// The input of the first state, a JSON value, null by default
+	Input json.RawMessage `json:"input,omitempty" swaggertype:"object"`
+}
@@ -8,25 +8,44 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Handlers are the handlers of the routes of the application
+type Handlers struct {
+	IAM          *handlers.IAMHandler
+	Storage      *handlers.StorageHandler
+	StorageEvent *handlers.StorageEventHandler
+	Compute      *handlers.ComputeHandler
+	Lambda       *handlers.LambdaHandler
+	Function     *handlers.FunctionHandler
+	Workflow     *handlers.WorkflowHandler
+	Schedule     *handlers.ScheduleHandler
+	Secrets      *handlers.SecretsHandler
+	RDB          *handlers.RDBHandler
+	Monitoring   *handlers.MonitoringHandler
+}
+
 // SetupRoutes configures all the routes for the application
-func SetupRoutes(router *gin.Engine, iamHandler *handlers.IAMHandler, storageHandler *handlers.StorageHandler, computeHandler *handlers.ComputeHandler, lambdaHandler *handlers.LambdaHandler, secretHandler *handlers.SecretsHandler, rdbHandler *handlers.RDBHandler, monitoringHandler *handlers.MonitoringHandler, config *config.Config) {
+func SetupRoutes(router *gin.Engine, h Handlers, config *config.Config) {
 	// Apply CORS middleware to all routes
 	router.Use(middleware.CORS())
 
+	// Function invoke URLs, each function authenticates its callers
+	router.Any("/fn/:org/:name", h.Function.InvokeFunctionURL)
+	router.Any("/fn/:org/:name/*path", h.Function.InvokeFunctionURL)
+
 	// API v1 group
 	v1 := router.Group("/api/v1")
 	{
 		// Public routes (no authentication required)
 		{
-			v1.POST("/login", iamHandler.Login)
-			v1.POST("/token/refresh", iamHandler.RefreshToken)
-			v1.GET("/token/validate", iamHandler.ValidateToken)
-			v1.GET("/debug/token", iamHandler.GetDebugToken)
+			v1.POST("/login", h.IAM.Login)
+			v1.POST("/token/refresh", h.IAM.RefreshToken)
+			v1.GET("/token/validate", h.IAM.ValidateToken)
+			v1.GET("/debug/token", h.IAM.GetDebugToken)
 
 			// Setup routes (no authentication required for initial setup)
-			v1.POST("/organizations", iamHandler.CreateOrganization)
-			v1.POST("/roles", iamHandler.CreateRole)
-			v1.POST("/organizations/:org_id/users", iamHandler.CreateUserInOrg)
+			v1.POST("/organizations", h.IAM.CreateOrganization)
+			v1.POST("/roles", h.IAM.CreateRole)
+			v1.POST("/organizations/:org_id/users", h.IAM.CreateUserInOrg)
 		}
 
 		// Protected routes (authentication required)
@@ -34,53 +53,109 @@ func SetupRoutes(router *gin.Engine, iamHandler *handlers.IAMHandler, storageHan
 		protected.Use(middleware.AuthMiddleware(config))
 		{
 			// IAM routes
-			protected.GET("/roles", iamHandler.GetRoles)
-			protected.POST("/roles/assign", iamHandler.AssignRole)
-			protected.GET("/organizations", iamHandler.GetOrganizations)
-			protected.GET("/accounts/me", iamHandler.GetCurrentAccount)
+			protected.GET("/roles", h.IAM.GetRoles)
+			protected.POST("/roles/assign", h.IAM.AssignRole)
+			protected.GET("/organizations", h.IAM.GetOrganizations)
+			protected.GET("/accounts/me", h.IAM.GetCurrentAccount)
 
 			// Secrets Manager routes
-			protected.GET("/secrets", secretHandler.ListSecrets)
-			protected.POST("/secrets", secretHandler.CreateSecret)
-			protected.GET("/secrets/:id", secretHandler.ReadSecret)
-			protected.PUT("/secrets/:id", secretHandler.UpdateSecret)
-			protected.DELETE("/secrets/:id", secretHandler.DeleteSecret)
-			protected.POST("/secrets/rotate-keys", secretHandler.RotateKeys)
-			protected.GET("/secrets/key-versions", secretHandler.GetKeyVersions)
+			protected.GET("/secrets", h.Secrets.ListSecrets)
+			protected.POST("/secrets", h.Secrets.CreateSecret)
+			protected.GET("/secrets/:id", h.Secrets.ReadSecret)
+			protected.PUT("/secrets/:id", h.Secrets.UpdateSecret)
+			protected.DELETE("/secrets/:id", h.Secrets.DeleteSecret)
+			protected.POST("/secrets/rotate-keys", h.Secrets.RotateKeys)
+			protected.GET("/secrets/key-versions", h.Secrets.GetKeyVersions)
 
 			// Storage routes
-			protected.GET("/buckets", storageHandler.ListBucketsHandler)
-			protected.POST("/buckets", storageHandler.CreateBucketHandler)
-			protected.POST("/buckets/:bucket_id/files", storageHandler.UploadFileHandler)
-			protected.GET("/buckets/:bucket_id/files", storageHandler.ListFilesHandler)
-			protected.GET("/buckets/:bucket_id/files/:file_id", storageHandler.DownloadFileHandler)
-			protected.DELETE("/buckets/:bucket_id/files/:file_id", storageHandler.DeleteFileHandler)
+			protected.GET("/buckets", h.Storage.ListBucketsHandler)
+			protected.POST("/buckets", h.Storage.CreateBucketHandler)
+			protected.POST("/buckets/:bucket_id/files", h.Storage.UploadFileHandler)
+			protected.GET("/buckets/:bucket_id/files", h.Storage.ListFilesHandler)
+			protected.GET("/buckets/:bucket_id/files/:file_id", h.Storage.DownloadFileHandler)
+			protected.DELETE("/buckets/:bucket_id/files/:file_id", h.Storage.DeleteFileHandler)
+			protected.GET("/buckets/:bucket_id/notifications", h.StorageEvent.ListNotificationsHandler)
+			protected.POST("/buckets/:bucket_id/notifications", h.StorageEvent.CreateNotificationHandler)
+			protected.GET("/buckets/:bucket_id/notifications/deliveries", h.StorageEvent.ListDeliveriesHandler)
+			protected.DELETE("/buckets/:bucket_id/notifications/:notification_id", h.StorageEvent.DeleteNotificationHandler)
 
 			// Compute routes
-			protected.POST("/compute/create", computeHandler.CreateCompute)
-			protected.GET("/compute/list", computeHandler.ListCompute)
-			protected.DELETE("/compute/:id", computeHandler.DeleteCompute)
+			protected.POST("/compute/create", h.Compute.CreateCompute)
+			protected.GET("/compute/list", h.Compute.ListCompute)
+			protected.GET("/compute/instances", h.Compute.ListComputeInstances)
+			protected.GET("/compute/:id", h.Compute.GetCompute)
+			protected.PUT("/compute/:id", h.Compute.UpdateCompute)
+			protected.DELETE("/compute/:id", h.Compute.DeleteCompute)
+			protected.POST("/compute/:id/start", h.Compute.StartCompute)
+			protected.POST("/compute/:id/stop", h.Compute.StopCompute)
+			protected.POST("/compute/:id/restart", h.Compute.RestartCompute)
 
 			// Lambda routes
-			protected.POST("/lambda/execute", lambdaHandler.ExecuteLambda)
-			protected.POST("/lambda/test", lambdaHandler.TestLambda)
+			protected.POST("/lambda/execute", h.Lambda.ExecuteLambda)
+			protected.POST("/lambda/test", h.Lambda.TestLambda)
+
+			// Lambda function routes
+			protected.GET("/lambda/functions", h.Function.ListFunctions)
+			protected.POST("/lambda/functions", h.Function.CreateFunction)
+			protected.GET("/lambda/functions/:name", h.Function.GetFunction)
+			protected.PUT("/lambda/functions/:name", h.Function.UpdateFunction)
+			protected.DELETE("/lambda/functions/:name", h.Function.DeleteFunction)
+			protected.GET("/lambda/functions/:name/versions", h.Function.ListFunctionVersions)
+			protected.GET("/lambda/functions/:name/versions/:qualifier", h.Function.GetFunctionVersion)
+			protected.PUT("/lambda/functions/:name/aliases/:alias", h.Function.PutFunctionAlias)
+			protected.DELETE("/lambda/functions/:name/aliases/:alias", h.Function.DeleteFunctionAlias)
+			protected.POST("/lambda/functions/:name/invoke", h.Function.InvokeFunction)
+			protected.PUT("/lambda/functions/:name/url", h.Function.PutFunctionURL)
+			protected.DELETE("/lambda/functions/:name/url", h.Function.DeleteFunctionURL)
+			protected.GET("/lambda/functions/:name/concurrency", h.Function.GetFunctionConcurrency)
+			protected.PUT("/lambda/functions/:name/concurrency", h.Function.PutFunctionConcurrency)
+			protected.GET("/lambda/concurrency", h.Function.GetOrganizationConcurrency)
+			protected.PUT("/lambda/concurrency", h.Function.PutOrganizationConcurrency)
+
+			// Lambda layer routes
+			protected.GET("/lambda/layers", h.Function.ListLayers)
+			protected.GET("/lambda/layers/:name", h.Function.GetLayer)
+			protected.DELETE("/lambda/layers/:name", h.Function.DeleteLayer)
+			protected.GET("/lambda/layers/:name/versions", h.Function.ListLayerVersions)
+			protected.POST("/lambda/layers/:name/versions", h.Function.PublishLayerVersion)
+			protected.GET("/lambda/layers/:name/versions/:version", h.Function.GetLayerVersion)
+
+			// Workflow routes
+			protected.GET("/workflows", h.Workflow.ListWorkflows)
+			protected.POST("/workflows", h.Workflow.CreateWorkflow)
+			protected.GET("/workflows/:name", h.Workflow.GetWorkflow)
+			protected.PUT("/workflows/:name", h.Workflow.UpdateWorkflow)
+			protected.DELETE("/workflows/:name", h.Workflow.DeleteWorkflow)
+			protected.GET("/workflows/:name/executions", h.Workflow.ListExecutions)
+			protected.POST("/workflows/:name/executions", h.Workflow.StartExecution)
+			protected.GET("/workflows/:name/executions/:execution_id", h.Workflow.DescribeExecution)
+			protected.POST("/workflows/:name/executions/:execution_id/cancel", h.Workflow.CancelExecution)
+
+			// Schedule routes
+			protected.GET("/schedules", h.Schedule.ListSchedules)
+			protected.POST("/schedules", h.Schedule.CreateSchedule)
+			protected.GET("/schedules/:name", h.Schedule.GetSchedule)
+			protected.PUT("/schedules/:name", h.Schedule.UpdateSchedule)
+			protected.DELETE("/schedules/:name", h.Schedule.DeleteSchedule)
+			protected.POST("/schedules/:name/run", h.Schedule.RunSchedule)
+			protected.GET("/schedules/:name/runs", h.Schedule.ListScheduleRuns)
 
 			// RDB routes
-			protected.POST("/rdb/create", rdbHandler.CreateRDB)
-			protected.GET("/rdb/list", rdbHandler.ListRDB)
-			protected.DELETE("/rdb/:id", rdbHandler.DeleteRDB)
+			protected.POST("/rdb/create", h.RDB.CreateRDB)
+			protected.GET("/rdb/list", h.RDB.ListRDB)
+			protected.DELETE("/rdb/:id", h.RDB.DeleteRDB)
 
 			// Monitoring routes
-			protected.GET("/monitoring/usage", monitoringHandler.GetResourceUsage)
-			protected.GET("/monitoring/metrics/:resource_type/:resource_id", monitoringHandler.GetMonitoringMetrics)
-			protected.PUT("/monitoring/metrics/:resource_type/:resource_id", monitoringHandler.UpdateMonitoringMetrics)
-			protected.GET("/monitoring/billing", monitoringHandler.GetBillingHistory)
-			protected.POST("/monitoring/billing/generate", monitoringHandler.GenerateMonthlyBilling)
-			protected.GET("/monitoring/trends", monitoringHandler.GetMonthlyUsageTrends)
-			protected.GET("/monitoring/resources/active", monitoringHandler.GetActiveResources)
-			protected.POST("/monitoring/track/create", monitoringHandler.TrackResourceCreation)
-			protected.PUT("/monitoring/track/:resource_type/:resource_id", monitoringHandler.TrackResourceUpdate)
-			protected.DELETE("/monitoring/track/:resource_type/:resource_id", monitoringHandler.TrackResourceDeletion)
+			protected.GET("/monitoring/usage", h.Monitoring.GetResourceUsage)
+			protected.GET("/monitoring/metrics/:resource_type/:resource_id", h.Monitoring.GetMonitoringMetrics)
+			protected.PUT("/monitoring/metrics/:resource_type/:resource_id", h.Monitoring.UpdateMonitoringMetrics)
+			protected.GET("/monitoring/billing", h.Monitoring.GetBillingHistory)
+			protected.POST("/monitoring/billing/generate", h.Monitoring.GenerateMonthlyBilling)
+			protected.GET("/monitoring/trends", h.Monitoring.GetMonthlyUsageTrends)
+			protected.GET("/monitoring/resources/active", h.Monitoring.GetActiveResources)
+			protected.POST("/monitoring/track/create", h.Monitoring.TrackResourceCreation)
+			protected.PUT("/monitoring/track/:resource_type/:resource_id", h.Monitoring.TrackResourceUpdate)
+			protected.DELETE("/monitoring/track/:resource_type/:resource_id", h.Monitoring.TrackResourceDeletion)
 		}
 	}
 }
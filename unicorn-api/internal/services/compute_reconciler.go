@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/containers"
+	"unicorn-api/internal/models"
+)
+
+// DefaultComputeReconcileInterval is how often the containers are compared with the inventory
+const DefaultComputeReconcileInterval = 30 * time.Second
+
+// ComputeReconciler periodically reconciles the compute containers with their inventory, and
+// reports the containers which crashed, vanished or were changed outside the API to monitoring.
+// A container which no longer runs isn't billed until it runs again.
+type ComputeReconciler struct {
+	compute    *ComputeService
+	monitoring *MonitoringService
+	interval   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewComputeReconciler creates a compute reconciler and starts it
+func NewComputeReconciler(cfg *config.Config, compute *ComputeService, monitoring *MonitoringService) *ComputeReconciler {
+	interval := DefaultComputeReconcileInterval
+	if cfg.ComputeReconcileInterval > 0 {
+		interval = cfg.ComputeReconcileInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &ComputeReconciler{
+		compute:    compute,
+		monitoring: monitoring,
+		interval:   interval,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	r.wg.Add(1)
+	go r.reconcile()
+
+	return r
+}
+
+// Close stops the reconciler and waits for the reconciliation in progress
+func (r *ComputeReconciler) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *ComputeReconciler) reconcile() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			changes, err := r.compute.Reconcile(r.ctx)
+			if err != nil && r.ctx.Err() == nil {
+				log.Printf("Failed to reconcile the compute containers: %v", err)
+			}
+			for _, change := range changes {
+				r.report(change)
+			}
+		}
+	}
+}
+
+// report tells monitoring about an instance whose observed state or drift changed
+func (r *ComputeReconciler) report(change ComputeChange) {
+	instance := change.Instance
+	if instance.Drift != models.ComputeDriftNone {
+		log.Printf("Compute instance %s drifted (%s): %s", instance.Name, instance.Drift, instance.DriftDetails)
+	}
+	if r.monitoring == nil {
+		return
+	}
+
+	running := instance.ObservedState == string(containers.StateRunning)
+	status := models.ResourceStatusInactive
+	if running {
+		status = models.ResourceStatusActive
+	}
+
+	switch {
+	case change.Adopted:
+		configuration := ComputeResourceConfiguration(instance.Image, instance.Preset)
+		err := r.monitoring.TrackResourceCreation(instance.AccountID, instance.OrganizationID, models.ResourceTypeCompute,
+			instance.ContainerID, instance.Name, configuration)
+		if err == nil && !running {
+			err = r.monitoring.TrackResourceUpdate(instance.ContainerID, models.ResourceTypeCompute, status, nil)
+		}
+		if err != nil {
+			log.Printf("Failed to track adopted compute instance: %v", err)
+		}
+	case running != change.WasRunning:
+		if err := r.monitoring.TrackResourceUpdate(instance.ContainerID, models.ResourceTypeCompute, status, nil); err != nil {
+			log.Printf("Failed to track resource update: %v", err)
+		}
+	}
+
+	err := r.monitoring.UpdateMonitoringMetrics(instance.OrganizationID, instance.ContainerID, models.ResourceTypeCompute, map[string]interface{}{
+		"status":        status,
+		"health_status": instance.Drift.HealthStatus(),
+	})
+	if err != nil {
+		log.Printf("Failed to update monitoring metrics: %v", err)
+	}
+}
+
+// ComputeResourceConfiguration returns the configuration of a compute container tracked by monitoring
+func ComputeResourceConfiguration(image string, preset models.ComputePreset) string {
+	configuration, _ := json.Marshal(struct {
+		Image  string               `json:"image"`
+		Preset models.ComputePreset `json:"preset"`
+	}{image, preset})
+	return string(configuration)
+}
@@ -2,31 +2,61 @@ package services
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"math/rand"
-	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"unicorn-api/internal/common/errors"
 	"unicorn-api/internal/common/validation"
+	"unicorn-api/internal/containers"
 	"unicorn-api/internal/models"
+	"unicorn-api/internal/stores"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
 )
 
-// ComputeService handles Docker container operations
+// ComputeService handles Docker container operations, keeping an inventory of the containers
+// with their requested configuration and observed state
 type ComputeService struct {
+	runtime   containers.ContainerRuntime
+	store     stores.ComputeStore
+	iamStore  stores.IAMStore
 	validator *validation.Validator
+
+	// The changes of the containers hold mu for reading and a reconciliation holds it for
+	// writing while it records what it observed, so it never records a container being created
+	// or recreated
+	mu sync.RWMutex
+
+	replacements ContainerReplacementSink
+}
+
+// ContainerReplacementSink follows the containers recreated with a new ID
+type ContainerReplacementSink interface {
+	ContainerReplaced(oldID, newID string)
 }
 
-// NewComputeService creates a new compute service
-func NewComputeService() *ComputeService {
+// ComputeChange is a compute instance whose observed state or drift changed in a reconciliation
+type ComputeChange struct {
+	Instance models.ComputeInstance
+	// WasRunning tells whether the container ran at the previous observation
+	WasRunning bool
+	// Adopted is set for the containers found without an inventory record, like the ones
+	// created before the inventory existed
+	Adopted bool
+}
+
+// NewComputeService creates a new compute service running the containers on runtime
+func NewComputeService(runtime containers.ContainerRuntime, store stores.ComputeStore, iamStore stores.IAMStore) *ComputeService {
 	return &ComputeService{
+		runtime:   runtime,
+		store:     store,
+		iamStore:  iamStore,
 		validator: validation.NewValidator(),
 	}
 }
@@ -56,47 +86,37 @@ func (s *ComputeService) CreateContainer(userID uuid.UUID, req models.ComputeCre
 		}
 	}
 
-	// Create Docker client with proper socket path for macOS
-	var cli *client.Client
-	var err error
-	if runtime.GOOS == "darwin" {
-		// On macOS, Docker Desktop uses a different socket path
-		cli, err = client.NewClientWithOpts(
-			client.WithHost("unix:///Users/asandeistefan/.docker/run/docker.sock"),
-			client.WithAPIVersionNegotiation(),
-		)
-	} else {
-		cli, err = client.NewClientWithOpts(client.FromEnv)
-	}
+	account, err := s.iamStore.GetAccountByID(userID.String())
 	if err != nil {
-		return nil, errors.ErrInternalError.WithDetails("Docker client unavailable: " + err.Error())
+		return nil, errors.ErrNotFound.WithDetails("Account not found")
 	}
-	defer cli.Close()
 
 	ctx := context.Background()
 
 	// Pull image with retry logic
-	if err := s.pullImageWithRetry(ctx, cli, req.Image); err != nil {
+	if err := s.pullImageWithRetry(ctx, req.Image); err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Failed to pull Docker image: " + err.Error())
 	}
 
-	// Set resource limits based on preset
-	resources := s.getResourceLimits(req.Preset)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	// Configure port bindings
-	exposedPorts := s.natPortSet(req.Ports)
-	portBindings := s.natPortBindings(req.Ports)
+	// Set resource limits based on preset
+	nanoCPUs, memory := s.getResourceLimits(req.Preset)
 
 	// Handle exposed port
 	if req.ExposePort != "" {
 		if _, exists := req.Ports[req.ExposePort]; !exists {
-			hostPort := fmt.Sprintf("%d", 10000+rand.Intn(10000))
-			req.Ports[req.ExposePort] = hostPort
-			exposedPorts = s.natPortSet(req.Ports)
-			portBindings = s.natPortBindings(req.Ports)
+			req.Ports[req.ExposePort] = fmt.Sprintf("%d", 10000+rand.Intn(10000))
 		}
 	}
 
+	// Configure port bindings
+	var ports []containers.PortBinding
+	for cport, hport := range req.Ports {
+		ports = append(ports, containers.PortBinding{ContainerPort: cport, HostPort: hport})
+	}
+
 	// Set environment variables
 	envVars := []string{}
 	for key, value := range req.Environment {
@@ -110,156 +130,670 @@ func (s *ComputeService) CreateContainer(userID uuid.UUID, req models.ComputeCre
 	}
 
 	// Create container
-	resp, err := cli.ContainerCreate(ctx, &container.Config{
-		Image:        req.Image,
-		Cmd:          req.Command,
-		Env:          envVars,
-		ExposedPorts: exposedPorts,
-		Labels:       map[string]string{"owner": userID.String()},
-	}, &container.HostConfig{
-		PortBindings: portBindings,
-		Resources:    resources,
-	}, nil, nil, containerName)
+	id, err := s.runtime.CreateContainer(ctx, containers.ContainerSpec{
+		Name:     containerName,
+		Image:    req.Image,
+		Command:  req.Command,
+		Env:      envVars,
+		Labels:   map[string]string{"owner": userID.String(), "preset": string(req.Preset)},
+		Ports:    ports,
+		NanoCPUs: nanoCPUs,
+		Memory:   memory,
+	})
 	if err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Container creation failed: " + err.Error())
 	}
 
+	// Record the requested configuration
+	instance := &models.ComputeInstance{
+		OrganizationID: account.OrganizationID,
+		AccountID:      userID,
+		ContainerID:    id,
+		Name:           containerName,
+		Image:          req.Image,
+		Command:        req.Command,
+		Environment:    req.Environment,
+		Preset:         req.Preset,
+		NanoCPUs:       nanoCPUs,
+		MemoryBytes:    memory,
+		Ports:          req.Ports,
+		DesiredState:   models.ComputeDesiredRunning,
+	}
+	if err := s.store.CreateInstance(instance); err != nil {
+		return nil, errors.ErrInternalError.WithDetails("Failed to record compute instance: " + err.Error())
+	}
+
 	// Start container
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	if err := s.runtime.StartContainer(ctx, id); err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Container start failed: " + err.Error())
 	}
 
 	// Get container info
-	containerInfo, err := cli.ContainerInspect(ctx, resp.ID)
+	containerInfo, err := s.runtime.InspectContainer(ctx, id)
 	if err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Failed to inspect container: " + err.Error())
 	}
 
+	observe(instance, containerInfo, time.Now())
+	if err := s.store.UpdateInstance(instance); err != nil {
+		return nil, errors.ErrInternalError.WithDetails("Failed to record compute instance: " + err.Error())
+	}
+
 	// Build response
-	ports := make(map[string]string)
-	for port, bindings := range containerInfo.NetworkSettings.Ports {
-		if len(bindings) > 0 {
-			ports[port.Port()] = bindings[0].HostPort
+	result := make(map[string]string)
+	for _, binding := range containerInfo.Ports {
+		if _, exists := result[binding.ContainerPort]; !exists {
+			result[binding.ContainerPort] = binding.HostPort
 		}
 	}
 
-	now := time.Now().Format(time.RFC3339)
 	return &models.ComputeContainerInfo{
-		ID:        resp.ID,
+		ID:        id,
 		Name:      containerName,
 		Image:     req.Image,
-		Status:    containerInfo.State.Status,
-		Ports:     ports,
-		CreatedAt: now,
-		UpdatedAt: now,
+		Status:    string(containerInfo.State),
+		Ports:     result,
+		CreatedAt: instance.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: instance.UpdatedAt.Format(time.RFC3339),
 	}, nil
 }
 
-// ListContainers lists all containers for a user
+// ListContainers lists all containers for a user, as last observed by the reconciliation
 func (s *ComputeService) ListContainers(userID uuid.UUID) ([]models.ComputeContainerInfo, error) {
-	var cli *client.Client
-	var err error
-	if runtime.GOOS == "darwin" {
-		// On macOS, Docker Desktop uses a different socket path
-		cli, err = client.NewClientWithOpts(
-			client.WithHost("unix:///Users/asandeistefan/.docker/run/docker.sock"),
-			client.WithAPIVersionNegotiation(),
-		)
-	} else {
-		cli, err = client.NewClientWithOpts(client.FromEnv)
-	}
-	if err != nil {
-		return nil, errors.ErrInternalError.WithDetails("Docker client unavailable: " + err.Error())
-	}
-	defer cli.Close()
-
-	ctx := context.Background()
-	filter := filters.NewArgs()
-	filter.Add("label", "owner="+userID.String())
-
-	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
-		All:     true,
-		Filters: filter,
-	})
+	instances, err := s.store.ListInstances(userID)
 	if err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Failed to list containers: " + err.Error())
 	}
 
 	var result []models.ComputeContainerInfo
-	for _, ctr := range containers {
+	for _, instance := range instances {
 		ports := make(map[string]string)
-		for _, p := range ctr.Ports {
-			if p.PublicPort != 0 {
-				ports[fmt.Sprintf("%d/%s", p.PrivatePort, p.Type)] = fmt.Sprintf("%d", p.PublicPort)
-			}
+		for cport, hport := range instance.Ports {
+			ports[cport+"/tcp"] = hport
 		}
 
-		now := time.Now().Format(time.RFC3339)
 		result = append(result, models.ComputeContainerInfo{
-			ID:        ctr.ID,
-			Name:      ctr.Names[0][1:], // Remove leading slash
-			Image:     ctr.Image,
-			Status:    ctr.Status,
-			Ports:     ports,
-			CreatedAt: now,
-			UpdatedAt: now,
+			ID:           instance.ContainerID,
+			Name:         instance.Name,
+			Image:        instance.Image,
+			Status:       instance.ObservedStatus,
+			Ports:        ports,
+			CreatedAt:    instance.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:    instance.UpdatedAt.Format(time.RFC3339),
+			Drift:        instance.Drift,
+			DriftDetails: instance.DriftDetails,
 		})
 	}
 
 	return result, nil
 }
 
-// DeleteContainer deletes a Docker container
-func (s *ComputeService) DeleteContainer(userID uuid.UUID, containerID string) error {
-	var cli *client.Client
-	var err error
-	if runtime.GOOS == "darwin" {
-		// On macOS, Docker Desktop uses a different socket path
-		cli, err = client.NewClientWithOpts(
-			client.WithHost("unix:///Users/asandeistefan/.docker/run/docker.sock"),
-			client.WithAPIVersionNegotiation(),
-		)
-	} else {
-		cli, err = client.NewClientWithOpts(client.FromEnv)
-	}
+// ListInstances returns the inventory of the compute instances of an organization
+func (s *ComputeService) ListInstances(orgID uuid.UUID, includeDeleted, driftedOnly bool) ([]models.ComputeInstance, error) {
+	instances, err := s.store.ListOrganizationInstances(orgID, includeDeleted, driftedOnly)
 	if err != nil {
-		return errors.ErrInternalError.WithDetails("Docker client unavailable: " + err.Error())
+		return nil, errors.ErrInternalError.WithDetails("Failed to list compute instances: " + err.Error())
 	}
-	defer cli.Close()
+	return instances, nil
+}
 
+// DeleteContainer deletes a Docker container, its inventory record is kept
+func (s *ComputeService) DeleteContainer(userID uuid.UUID, containerID string) error {
 	ctx := context.Background()
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	// Verify the container belongs to the user
-	containerInfo, err := cli.ContainerInspect(ctx, containerID)
+	containerInfo, err := s.ownedContainer(ctx, userID, containerID)
 	if err != nil {
-		return errors.ErrNotFound.WithDetails("Container not found")
-	}
-
-	// Check if container belongs to user
-	if containerInfo.Config.Labels["owner"] != userID.String() {
-		return errors.ErrForbidden.WithDetails("Container does not belong to user")
+		return err
 	}
 
 	// Stop the container if it's running
-	if containerInfo.State.Running {
-		if err := cli.ContainerStop(ctx, containerID, container.StopOptions{}); err != nil {
+	if containerInfo.Running() {
+		if err := s.runtime.StopContainer(ctx, containerID); err != nil {
 			return errors.ErrInternalError.WithDetails("Failed to stop container: " + err.Error())
 		}
 	}
 
 	// Remove the container
-	if err := cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{}); err != nil {
+	if err := s.runtime.RemoveContainer(ctx, containerID); err != nil {
 		return errors.ErrInternalError.WithDetails("Failed to remove container: " + err.Error())
 	}
 
+	return s.updateInstance(containerID, func(instance *models.ComputeInstance) {
+		now := time.Now()
+		instance.DesiredState = models.ComputeDesiredDeleted
+		instance.DeletedAt = &now
+		observe(instance, nil, now)
+		instance.Drift = models.ComputeDriftNone
+		instance.DriftDetails = ""
+		instance.DriftDetectedAt = nil
+	})
+}
+
+// SetReplacementSink makes the service tell a sink about the containers it recreates
+func (s *ComputeService) SetReplacementSink(sink ContainerReplacementSink) {
+	s.replacements = sink
+}
+
+// CheckContainer returns an error unless the container belongs to the user
+func (s *ComputeService) CheckContainer(userID uuid.UUID, containerID string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, err := s.ownedContainer(context.Background(), userID, containerID)
+	return err
+}
+
+// StartContainer starts a stopped Docker container of a user
+func (s *ComputeService) StartContainer(userID uuid.UUID, containerID string) error {
+	ctx := context.Background()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	containerInfo, err := s.ownedContainer(ctx, userID, containerID)
+	if err != nil {
+		return err
+	}
+
+	if !containerInfo.Running() {
+		if err := s.runtime.StartContainer(ctx, containerID); err != nil {
+			return errors.ErrInternalError.WithDetails("Failed to start container: " + err.Error())
+		}
+	}
+	return s.recordState(ctx, containerID, models.ComputeDesiredRunning)
+}
+
+// StopContainer stops a running Docker container of a user
+func (s *ComputeService) StopContainer(userID uuid.UUID, containerID string) error {
+	ctx := context.Background()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	containerInfo, err := s.ownedContainer(ctx, userID, containerID)
+	if err != nil {
+		return err
+	}
+
+	if containerInfo.Running() {
+		if err := s.runtime.StopContainer(ctx, containerID); err != nil {
+			return errors.ErrInternalError.WithDetails("Failed to stop container: " + err.Error())
+		}
+	}
+	return s.recordState(ctx, containerID, models.ComputeDesiredStopped)
+}
+
+// RestartContainer stops a Docker container of a user if it runs and starts it
+func (s *ComputeService) RestartContainer(userID uuid.UUID, containerID string) error {
+	ctx := context.Background()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	containerInfo, err := s.ownedContainer(ctx, userID, containerID)
+	if err != nil {
+		return err
+	}
+
+	if containerInfo.Running() {
+		if err := s.runtime.StopContainer(ctx, containerID); err != nil {
+			return errors.ErrInternalError.WithDetails("Failed to stop container: " + err.Error())
+		}
+	}
+	if err := s.runtime.StartContainer(ctx, containerID); err != nil {
+		return errors.ErrInternalError.WithDetails("Failed to start container: " + err.Error())
+	}
+	return s.recordState(ctx, containerID, models.ComputeDesiredRunning)
+}
+
+// GetContainer returns the configuration and state of a Docker container of a user
+func (s *ComputeService) GetContainer(userID uuid.UUID, containerID string) (*models.ComputeContainerDetail, error) {
+	containerInfo, err := s.ownedContainer(context.Background(), userID, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make(map[string]string)
+	for _, binding := range containerInfo.Ports {
+		if _, exists := ports[binding.ContainerPort]; !exists {
+			ports[binding.ContainerPort] = binding.HostPort
+		}
+	}
+
+	environment := make(map[string]string)
+	for _, variable := range containerInfo.Env {
+		if key, value, found := strings.Cut(variable, "="); found {
+			environment[key] = value
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	info := models.ComputeContainerInfo{
+		ID:        containerInfo.ID,
+		Name:      containerInfo.Name,
+		Image:     containerInfo.Image,
+		Status:    containerInfo.Status,
+		Ports:     ports,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !containerInfo.CreatedAt.IsZero() {
+		info.CreatedAt = containerInfo.CreatedAt.Format(time.RFC3339)
+	}
+	if instance, err := s.store.GetInstance(containerInfo.ID); err == nil {
+		info.CreatedAt = instance.CreatedAt.Format(time.RFC3339)
+		info.UpdatedAt = instance.UpdatedAt.Format(time.RFC3339)
+		info.Drift = instance.Drift
+		info.DriftDetails = instance.DriftDetails
+	}
+
+	return &models.ComputeContainerDetail{
+		ComputeContainerInfo: info,
+		State:                string(containerInfo.State),
+		Command:              containerInfo.Command,
+		Environment:          environment,
+		Preset:               models.ComputePreset(containerInfo.Labels["preset"]),
+		NanoCPUs:             containerInfo.NanoCPUs,
+		MemoryBytes:          containerInfo.Memory,
+	}, nil
+}
+
+// UpdateContainer changes the preset, environment or command of a Docker container of a user.
+// The container is recreated with the same name and ports, and started if it was running,
+// so the updated container has a new ID which the replacement sink is told about.
+func (s *ComputeService) UpdateContainer(userID uuid.UUID, containerID string, req models.ComputeUpdateRequest) (*models.ComputeContainerDetail, error) {
+	ctx := context.Background()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	containerInfo, err := s.ownedContainer(ctx, userID, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := containerSpec(containerInfo)
+	if req.Command != nil {
+		spec.Command = req.Command
+	}
+	if req.Environment != nil {
+		spec.Env = []string{}
+		for key, value := range req.Environment {
+			spec.Env = append(spec.Env, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	if req.Preset != "" {
+		spec.NanoCPUs, spec.Memory = s.getResourceLimits(req.Preset)
+		spec.Labels["preset"] = string(req.Preset)
+	}
+
+	// The name and host ports are released before the new container takes them
+	if containerInfo.Running() {
+		if err := s.runtime.StopContainer(ctx, containerInfo.ID); err != nil {
+			return nil, errors.ErrInternalError.WithDetails("Failed to stop container: " + err.Error())
+		}
+	}
+	if err := s.runtime.RemoveContainer(ctx, containerInfo.ID); err != nil {
+		return nil, errors.ErrInternalError.WithDetails("Failed to remove container: " + err.Error())
+	}
+
+	id, err := s.runtime.CreateContainer(ctx, spec)
+	if err != nil {
+		// Put the previous container back
+		if restored, restoreErr := s.runtime.CreateContainer(ctx, containerSpec(containerInfo)); restoreErr == nil {
+			if containerInfo.Running() {
+				_ = s.runtime.StartContainer(ctx, restored)
+			}
+			_ = s.updateInstance(containerInfo.ID, func(instance *models.ComputeInstance) {
+				instance.ContainerID = restored
+			})
+			s.replaced(containerInfo.ID, restored)
+		}
+		return nil, errors.ErrInternalError.WithDetails("Container creation failed: " + err.Error())
+	}
+	s.replaced(containerInfo.ID, id)
+
+	if containerInfo.Running() {
+		if err := s.runtime.StartContainer(ctx, id); err != nil {
+			return nil, errors.ErrInternalError.WithDetails("Container start failed: " + err.Error())
+		}
+	}
+
+	// The inventory record follows the container
+	updated, err := s.runtime.InspectContainer(ctx, id)
+	if err != nil {
+		return nil, errors.ErrInternalError.WithDetails("Failed to inspect container: " + err.Error())
+	}
+	err = s.updateInstance(containerInfo.ID, func(instance *models.ComputeInstance) {
+		instance.ContainerID = id
+		if req.Command != nil {
+			instance.Command = req.Command
+		}
+		if req.Environment != nil {
+			instance.Environment = req.Environment
+		}
+		if req.Preset != "" {
+			instance.Preset = req.Preset
+			instance.NanoCPUs, instance.MemoryBytes = spec.NanoCPUs, spec.Memory
+		}
+		observe(instance, updated, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetContainer(userID, id)
+}
+
+// Reconcile compares the containers with their inventory records, recording their observed state
+// and drift, and adopts the compute containers without a record. It returns the instances
+// whose observed state or drift changed.
+//
+// The containers are inspected without blocking the changes, which only wait for the records
+// to be written. The instances changed meanwhile are inspected again before they are recorded.
+func (s *ComputeService) Reconcile(ctx context.Context) ([]ComputeChange, error) {
+	started := time.Now()
+
+	instances, err := s.store.ListActiveInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	observed := make(map[string]*containers.Container, len(instances))
+	for _, instance := range instances {
+		containerInfo, err := s.inspect(ctx, instance.ContainerID)
+		if err != nil {
+			return nil, err
+		}
+		observed[instance.ContainerID] = containerInfo
+	}
+
+	list, err := s.runtime.ListContainers(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	var candidates []containers.Container
+	for _, ctr := range list {
+		// the RDB containers have their own type
+		if _, known := observed[ctr.ID]; known || ctr.Labels["owner"] == "" || ctr.Labels["type"] != "" {
+			continue
+		}
+		candidates = append(candidates, ctr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instances, err = s.store.ListActiveInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	known := make(map[string]bool, len(instances))
+	var changes []ComputeChange
+	for i := range instances {
+		instance := &instances[i]
+		known[instance.ContainerID] = true
+
+		containerInfo, ok := observed[instance.ContainerID]
+		if !ok || !instance.UpdatedAt.Before(started) {
+			// created, recreated or changed since it was inspected
+			if containerInfo, err = s.inspect(ctx, instance.ContainerID); err != nil {
+				return changes, err
+			}
+		}
+
+		previous := *instance
+		observe(instance, containerInfo, now)
+		if err := s.store.UpdateInstance(instance); err != nil {
+			return changes, err
+		}
+
+		if instance.ObservedState != previous.ObservedState || instance.Drift != previous.Drift || instance.DriftDetails != previous.DriftDetails {
+			changes = append(changes, ComputeChange{
+				Instance:   *instance,
+				WasRunning: previous.ObservedState == string(containers.StateRunning),
+			})
+		}
+	}
+
+	// the containers without a record are rare, they are inspected once nothing can change them
+	for _, ctr := range candidates {
+		if known[ctr.ID] {
+			continue
+		}
+		account, err := s.iamStore.GetAccountByID(ctr.Labels["owner"])
+		if err != nil {
+			continue
+		}
+		containerInfo, err := s.runtime.InspectContainer(ctx, ctr.ID)
+		if err != nil {
+			continue
+		}
+
+		instance := adoptedInstance(account, containerInfo)
+		observe(instance, containerInfo, now)
+		if err := s.store.CreateInstance(instance); err != nil {
+			return changes, err
+		}
+		changes = append(changes, ComputeChange{Instance: *instance, Adopted: true})
+	}
+
+	return changes, nil
+}
+
+// inspect returns a container, nil when it no longer exists
+func (s *ComputeService) inspect(ctx context.Context, containerID string) (*containers.Container, error) {
+	containerInfo, err := s.runtime.InspectContainer(ctx, containerID)
+	if stderrors.Is(err, containers.ErrContainerNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	return containerInfo, nil
+}
+
+// replaced tells the replacement sink about a container recreated with a new ID
+func (s *ComputeService) replaced(oldID, newID string) {
+	if s.replacements != nil {
+		s.replacements.ContainerReplaced(oldID, newID)
+	}
+}
+
+// ownedContainer returns a container of a user
+func (s *ComputeService) ownedContainer(ctx context.Context, userID uuid.UUID, containerID string) (*containers.Container, error) {
+	containerInfo, err := s.runtime.InspectContainer(ctx, containerID)
+	if err != nil {
+		return nil, errors.ErrNotFound.WithDetails("Container not found")
+	}
+	if containerInfo.Labels["owner"] != userID.String() {
+		return nil, errors.ErrForbidden.WithDetails("Container does not belong to user")
+	}
+	return containerInfo, nil
+}
+
+// recordState records the state asked for a container and its observed state
+func (s *ComputeService) recordState(ctx context.Context, containerID string, desired models.ComputeDesiredState) error {
+	containerInfo, err := s.runtime.InspectContainer(ctx, containerID)
+	if err != nil {
+		return errors.ErrInternalError.WithDetails("Failed to inspect container: " + err.Error())
+	}
+
+	return s.updateInstance(containerID, func(instance *models.ComputeInstance) {
+		instance.DesiredState = desired
+		observe(instance, containerInfo, time.Now())
+	})
+}
+
+// updateInstance changes the inventory record of a container, the containers without one are
+// left to the reconciliation
+func (s *ComputeService) updateInstance(containerID string, change func(instance *models.ComputeInstance)) error {
+	instance, err := s.store.GetInstance(containerID)
+	if stderrors.Is(err, models.ErrComputeInstanceNotFound) {
+		return nil
+	}
+	if err != nil {
+		return errors.ErrInternalError.WithDetails("Failed to get compute instance: " + err.Error())
+	}
+
+	change(instance)
+	if err := s.store.UpdateInstance(instance); err != nil {
+		return errors.ErrInternalError.WithDetails("Failed to record compute instance: " + err.Error())
+	}
 	return nil
 }
 
+// observe records the observed state of a container in its instance, nil when it no longer exists
+func observe(instance *models.ComputeInstance, c *containers.Container, now time.Time) {
+	instance.ObservedAt = &now
+	if c == nil {
+		instance.ObservedState = models.ComputeObservedMissing
+		instance.ObservedStatus = ""
+	} else {
+		instance.ObservedState = string(c.State)
+		instance.ObservedStatus = c.Status
+	}
+
+	drift, details := computeDrift(instance, c)
+	if drift == models.ComputeDriftNone {
+		instance.DriftDetectedAt = nil
+	} else if drift != instance.Drift || instance.DriftDetectedAt == nil {
+		instance.DriftDetectedAt = &now
+	}
+	instance.Drift = drift
+	instance.DriftDetails = details
+}
+
+// computeDrift tells how a container differs from its instance
+func computeDrift(instance *models.ComputeInstance, c *containers.Container) (models.ComputeDrift, string) {
+	if c == nil {
+		return models.ComputeDriftVanished, "the container no longer exists"
+	}
+
+	switch {
+	case instance.DesiredState == models.ComputeDesiredRunning && !c.Running():
+		return models.ComputeDriftCrashed, fmt.Sprintf("the container is %s", strings.ToLower(c.Status))
+	case instance.DesiredState == models.ComputeDesiredStopped && c.Running():
+		return models.ComputeDriftStarted, "the container runs although it was stopped"
+	}
+
+	var changes []string
+	if c.Image != instance.Image {
+		changes = append(changes, fmt.Sprintf("the image is %s instead of %s", c.Image, instance.Image))
+	}
+	// without a command the container runs the one of its image
+	if len(instance.Command) > 0 && !slices.Equal(c.Command, instance.Command) {
+		changes = append(changes, "the command changed")
+	}
+
+	// the image can set variables of its own
+	environment := make(map[string]string)
+	for _, variable := range c.Env {
+		if key, value, found := strings.Cut(variable, "="); found {
+			environment[key] = value
+		}
+	}
+	for _, key := range sortedKeys(instance.Environment) {
+		if value, ok := environment[key]; !ok || value != instance.Environment[key] {
+			changes = append(changes, fmt.Sprintf("the environment variable %s changed", key))
+		}
+	}
+
+	if c.NanoCPUs != instance.NanoCPUs || c.Memory != instance.MemoryBytes {
+		changes = append(changes, "the resource limits changed")
+	}
+
+	for _, cport := range sortedKeys(instance.Ports) {
+		published := false
+		for _, binding := range c.Ports {
+			if binding.ContainerPort == cport && binding.HostPort == instance.Ports[cport] {
+				published = true
+			}
+		}
+		if !published {
+			changes = append(changes, fmt.Sprintf("the port %s is no longer published on %s", cport, instance.Ports[cport]))
+		}
+	}
+
+	if len(changes) > 0 {
+		return models.ComputeDriftAltered, strings.Join(changes, "; ")
+	}
+	return models.ComputeDriftNone, ""
+}
+
+// adoptedInstance returns the inventory record of a container created without one
+func adoptedInstance(account *models.Account, c *containers.Container) *models.ComputeInstance {
+	environment := make(map[string]string)
+	for _, variable := range c.Env {
+		if key, value, found := strings.Cut(variable, "="); found {
+			environment[key] = value
+		}
+	}
+	ports := make(map[string]string)
+	for _, binding := range c.Ports {
+		ports[binding.ContainerPort] = binding.HostPort
+	}
+
+	desired := models.ComputeDesiredStopped
+	if c.Running() {
+		desired = models.ComputeDesiredRunning
+	}
+
+	return &models.ComputeInstance{
+		OrganizationID: account.OrganizationID,
+		AccountID:      account.ID,
+		ContainerID:    c.ID,
+		Name:           c.Name,
+		Image:          c.Image,
+		Command:        c.Command,
+		Environment:    environment,
+		Preset:         models.ComputePreset(c.Labels["preset"]),
+		NanoCPUs:       c.NanoCPUs,
+		MemoryBytes:    c.Memory,
+		Ports:          ports,
+		DesiredState:   desired,
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containerSpec returns the spec recreating a container
+func containerSpec(c *containers.Container) containers.ContainerSpec {
+	labels := make(map[string]string, len(c.Labels))
+	for key, value := range c.Labels {
+		labels[key] = value
+	}
+	return containers.ContainerSpec{
+		Name:     c.Name,
+		Image:    c.Image,
+		Command:  c.Command,
+		Env:      c.Env,
+		Labels:   labels,
+		Ports:    c.Ports,
+		Volumes:  c.Volumes,
+		NanoCPUs: c.NanoCPUs,
+		Memory:   c.Memory,
+	}
+}
+
 // pullImageWithRetry pulls a Docker image with retry logic
-func (s *ComputeService) pullImageWithRetry(ctx context.Context, cli *client.Client, image string) error {
+func (s *ComputeService) pullImageWithRetry(ctx context.Context, image string) error {
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		_, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+		err := s.runtime.PullImage(ctx, image)
 		if err == nil {
 			return nil
 		}
@@ -271,42 +805,16 @@ func (s *ComputeService) pullImageWithRetry(ctx context.Context, cli *client.Cli
 	return fmt.Errorf("failed to pull image after %d attempts", maxRetries)
 }
 
-// getResourceLimits returns resource limits based on preset
-func (s *ComputeService) getResourceLimits(preset models.ComputePreset) container.Resources {
+// getResourceLimits returns the CPU, in nano CPUs, and the memory, in bytes, of a preset
+func (s *ComputeService) getResourceLimits(preset models.ComputePreset) (int64, int64) {
 	switch preset {
 	case models.PresetMicro:
-		return container.Resources{
-			NanoCPUs: 500_000_000,       // 0.5 CPU
-			Memory:   256 * 1024 * 1024, // 256MB
-		}
+		return 500_000_000, 256 * 1024 * 1024 // 0.5 CPU, 256MB
 	case models.PresetSmall:
-		return container.Resources{
-			NanoCPUs: 1_000_000_000,     // 1 CPU
-			Memory:   512 * 1024 * 1024, // 512MB
-		}
+		return 1_000_000_000, 512 * 1024 * 1024 // 1 CPU, 512MB
 	default:
-		return container.Resources{}
-	}
-}
-
-// natPortSet converts port map to Docker port set
-func (s *ComputeService) natPortSet(ports map[string]string) nat.PortSet {
-	ps := nat.PortSet{}
-	for cport := range ports {
-		p, _ := nat.NewPort("tcp", cport)
-		ps[p] = struct{}{}
-	}
-	return ps
-}
-
-// natPortBindings converts port map to Docker port bindings
-func (s *ComputeService) natPortBindings(ports map[string]string) nat.PortMap {
-	pm := nat.PortMap{}
-	for cport, hport := range ports {
-		p, _ := nat.NewPort("tcp", cport)
-		pm[p] = []nat.PortBinding{{HostPort: hport}}
+		return 0, 0
 	}
-	return pm
 }
 
 // randString generates a random string
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrConcurrencyLimit is returned when an invocation finds no capacity before the end of its wait
+var ErrConcurrencyLimit = stderrors.New("concurrency limit reached")
+
+// ConcurrencyLimits are the capacity an invocation of a function is admitted against
+type ConcurrencyLimits struct {
+	OrganizationID uuid.UUID
+	// FunctionID is uuid.Nil for the executions not running a function
+	FunctionID uuid.UUID
+	// OrganizationMax is the number of invocations of the organization running at once
+	OrganizationMax int
+	// OrganizationReserved is the capacity set aside by all the functions of the organization
+	OrganizationReserved int
+	// FunctionMax is the number of invocations of the function running at once, 0 for no limit
+	FunctionMax int
+	// FunctionReserved is the capacity set aside for the function
+	FunctionReserved int
+}
+
+// ConcurrencyLimiter tracks the invocations in flight per function and organization. A function
+// first runs on its reserved capacity, then on the capacity of its organization no function
+// reserved. The invocations finding no capacity wait up to Wait for one to be released.
+//
+// The invocations are only counted on this replica of the API.
+type ConcurrencyLimiter struct {
+	// Wait is how long an invocation waits for capacity before it's throttled
+	Wait time.Duration
+
+	mu            sync.Mutex
+	organizations map[uuid.UUID]map[uuid.UUID]*functionConcurrency
+	// released is closed and replaced whenever an invocation ends, to wake up the waiting ones
+	released chan struct{}
+}
+
+type functionConcurrency struct {
+	inFlight int
+	reserved int
+}
+
+// NewConcurrencyLimiter creates a new concurrency limiter
+func NewConcurrencyLimiter(wait time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		Wait:          wait,
+		organizations: make(map[uuid.UUID]map[uuid.UUID]*functionConcurrency),
+		released:      make(chan struct{}),
+	}
+}
+
+// Acquire admits an invocation, waiting for capacity when there is none. The returned function
+// must be called once the invocation ended.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, limits ConcurrencyLimits) (func(), error) {
+	var deadline <-chan time.Time
+	if l.Wait > 0 {
+		timer := time.NewTimer(l.Wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		l.mu.Lock()
+		admitted := l.tryAcquire(limits)
+		released := l.released
+		l.mu.Unlock()
+
+		if admitted {
+			var once sync.Once
+			return func() { once.Do(func() { l.release(limits) }) }, nil
+		}
+		if deadline == nil {
+			return nil, ErrConcurrencyLimit
+		}
+
+		select {
+		case <-released:
+		case <-deadline:
+			return nil, ErrConcurrencyLimit
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// InFlight returns the number of invocations running for an organization, or for one of its
+// functions when functionID isn't nil
+func (l *ConcurrencyLimiter) InFlight(orgID, functionID uuid.UUID) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	total := 0
+	for id, function := range l.organizations[orgID] {
+		if functionID == uuid.Nil || id == functionID {
+			total += function.inFlight
+		}
+	}
+	return total
+}
+
+func (l *ConcurrencyLimiter) tryAcquire(limits ConcurrencyLimits) bool {
+	functions := l.organizations[limits.OrganizationID]
+	if functions == nil {
+		functions = make(map[uuid.UUID]*functionConcurrency)
+		l.organizations[limits.OrganizationID] = functions
+	}
+	function := functions[limits.FunctionID]
+	if function == nil {
+		function = &functionConcurrency{}
+		functions[limits.FunctionID] = function
+	}
+	// the reservation may have changed since the last invocation
+	function.reserved = limits.FunctionReserved
+
+	admitted := false
+	switch {
+	case limits.FunctionMax > 0 && function.inFlight >= limits.FunctionMax:
+	case function.inFlight < function.reserved:
+		admitted = true
+	default:
+		unreserved := 0
+		for _, other := range functions {
+			unreserved += max(0, other.inFlight-other.reserved)
+		}
+		admitted = unreserved < limits.OrganizationMax-limits.OrganizationReserved
+	}
+
+	if admitted {
+		function.inFlight++
+	} else if function.inFlight == 0 {
+		delete(functions, limits.FunctionID)
+	}
+	return admitted
+}
+
+func (l *ConcurrencyLimiter) release(limits ConcurrencyLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	functions := l.organizations[limits.OrganizationID]
+	if function := functions[limits.FunctionID]; function != nil {
+		function.inFlight--
+		if function.inFlight <= 0 {
+			delete(functions, limits.FunctionID)
+		}
+	}
+	if len(functions) == 0 {
+		delete(l.organizations, limits.OrganizationID)
+	}
+
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// ConcurrencyLimits returns the capacity the invocations of a function are admitted against
+func (s *FunctionService) ConcurrencyLimits(function *models.Function) (ConcurrencyLimits, error) {
+	orgMax, err := s.organizationConcurrency(function.OrganizationID)
+	if err != nil {
+		return ConcurrencyLimits{}, err
+	}
+	reserved, err := s.concurrency.SumReservedConcurrency(function.OrganizationID)
+	if err != nil {
+		return ConcurrencyLimits{}, functionError(err)
+	}
+
+	return ConcurrencyLimits{
+		OrganizationID:       function.OrganizationID,
+		FunctionID:           function.ID,
+		OrganizationMax:      orgMax,
+		OrganizationReserved: reserved,
+		FunctionMax:          function.MaxConcurrency,
+		FunctionReserved:     function.ReservedConcurrency,
+	}, nil
+}
+
+// OrganizationLimits returns the capacity the executions of an organization not running a function
+// are admitted against, they run on the capacity no function reserved
+func (s *FunctionService) OrganizationLimits(orgID uuid.UUID) (ConcurrencyLimits, error) {
+	orgMax, reserved, err := s.GetOrganizationConcurrency(orgID)
+	if err != nil {
+		return ConcurrencyLimits{}, err
+	}
+
+	return ConcurrencyLimits{
+		OrganizationID:       orgID,
+		OrganizationMax:      orgMax,
+		OrganizationReserved: reserved,
+	}, nil
+}
+
+// PutFunctionConcurrency sets the maximum and reserved concurrency of a function, the reservations
+// of the functions of an organization can't exceed its capacity
+func (s *FunctionService) PutFunctionConcurrency(orgID uuid.UUID, name string, req models.PutFunctionConcurrencyRequest) (*models.Function, error) {
+	if req.MaxConcurrency > 0 && req.ReservedConcurrency > req.MaxConcurrency {
+		return nil, errors.ErrBadRequest.WithDetails("The reserved concurrency can't exceed the maximum concurrency")
+	}
+
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return nil, functionError(err)
+	}
+
+	orgMax, err := s.organizationConcurrency(orgID)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := s.concurrency.SumReservedConcurrency(orgID)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	if reserved-function.ReservedConcurrency+req.ReservedConcurrency > orgMax {
+		return nil, errors.ErrBadRequest.WithDetails(fmt.Sprintf("The functions of the organization can't reserve more than its %d concurrent invocations", orgMax))
+	}
+
+	function.MaxConcurrency = req.MaxConcurrency
+	function.ReservedConcurrency = req.ReservedConcurrency
+	if err := s.concurrency.UpdateFunctionConcurrency(function); err != nil {
+		return nil, functionError(err)
+	}
+
+	return function, nil
+}
+
+// GetOrganizationConcurrency returns the capacity of an organization and the part its functions reserved
+func (s *FunctionService) GetOrganizationConcurrency(orgID uuid.UUID) (int, int, error) {
+	orgMax, err := s.organizationConcurrency(orgID)
+	if err != nil {
+		return 0, 0, err
+	}
+	reserved, err := s.concurrency.SumReservedConcurrency(orgID)
+	if err != nil {
+		return 0, 0, functionError(err)
+	}
+	return orgMax, reserved, nil
+}
+
+// PutOrganizationConcurrency sets the capacity of an organization, clamped to the most an
+// organization can be let run. It can't go below the concurrency reserved by its functions.
+func (s *FunctionService) PutOrganizationConcurrency(orgID uuid.UUID, req models.PutOrganizationConcurrencyRequest) error {
+	reserved, err := s.concurrency.SumReservedConcurrency(orgID)
+	if err != nil {
+		return functionError(err)
+	}
+	maxConcurrency := min(req.MaxConcurrency, s.config.LambdaOrgConcurrencyMax)
+	if maxConcurrency < reserved {
+		return errors.ErrBadRequest.WithDetails(fmt.Sprintf("The functions of the organization reserve %d concurrent invocations", reserved))
+	}
+
+	return functionError(s.concurrency.PutOrganizationConcurrency(orgID, maxConcurrency))
+}
+
+func (s *FunctionService) organizationConcurrency(orgID uuid.UUID) (int, error) {
+	orgMax, err := s.concurrency.GetOrganizationConcurrency(orgID)
+	if err != nil {
+		return 0, functionError(err)
+	}
+	if orgMax == 0 {
+		orgMax = s.config.LambdaOrgConcurrency
+	}
+	// a capacity set before the ceiling was lowered doesn't go past it
+	return min(orgMax, s.config.LambdaOrgConcurrencyMax), nil
+}
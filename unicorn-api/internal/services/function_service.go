@@ -0,0 +1,373 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	stderrors "errors"
+	"regexp"
+	"strconv"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/common/validation"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/stores"
+
+	"github.com/google/uuid"
+)
+
+var (
+	functionNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	// aliases start with a letter, so a qualifier is never both a version and an alias
+	aliasNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+)
+
+// FunctionService handles the function registry and resolves invocations into lambda requests
+type FunctionService struct {
+	store       stores.FunctionStore
+	layers      stores.LayerStore
+	concurrency stores.ConcurrencyStore
+	validator   *validation.Validator
+	config      *config.Config
+}
+
+// NewFunctionService creates a new function service, shared by the handlers and the services
+// invoking functions
+func NewFunctionService(cfg *config.Config, store stores.FunctionStore, layers stores.LayerStore, concurrency stores.ConcurrencyStore) *FunctionService {
+	return &FunctionService{
+		store:       store,
+		layers:      layers,
+		concurrency: concurrency,
+		validator:   validation.NewValidator(),
+		config:      cfg,
+	}
+}
+
+// CreateFunction creates a function of an organization and publishes its first version
+func (s *FunctionService) CreateFunction(orgID, accountID uuid.UUID, req models.CreateFunctionRequest) (*models.Function, *models.FunctionVersion, error) {
+	if !functionNameRegex.MatchString(req.Name) {
+		return nil, nil, errors.ErrBadRequest.WithDetails("Function name can only contain up to 64 alphanumeric characters, hyphens, and underscores")
+	}
+	if err := validateFunctionFiles(req.Files); err != nil {
+		return nil, nil, err
+	}
+
+	function := &models.Function{
+		Name:           req.Name,
+		OrganizationID: orgID,
+		Description:    req.Description,
+	}
+	version := &models.FunctionVersion{
+		CreatedBy:   accountID,
+		Description: req.Description,
+		Runtime:     req.Runtime,
+		Entry:       req.Entry,
+		Files:       req.Files,
+		Process:     req.Process,
+		Environment: req.Environment,
+		Layers:      req.Layers,
+	}
+	if _, err := s.mergeLayers(orgID, version.Files, version.Layers); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.store.CreateFunction(function, version); err != nil {
+		return nil, nil, functionError(err)
+	}
+
+	return function, version, nil
+}
+
+// UpdateFunction publishes a new version of a function, the fields left out of the
+// request are copied from the latest version
+func (s *FunctionService) UpdateFunction(orgID, accountID uuid.UUID, name string, req models.UpdateFunctionRequest) (*models.Function, *models.FunctionVersion, error) {
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return nil, nil, functionError(err)
+	}
+
+	latest, err := s.store.GetVersion(function.ID, function.LatestVersion)
+	if err != nil {
+		return nil, nil, functionError(err)
+	}
+
+	version := &models.FunctionVersion{
+		CreatedBy:   accountID,
+		Description: req.Description,
+		Runtime:     latest.Runtime,
+		Entry:       latest.Entry,
+		Files:       latest.Files,
+		Process:     latest.Process,
+		Environment: latest.Environment,
+		Layers:      latest.Layers,
+	}
+
+	if req.Runtime != nil {
+		if req.Runtime.Name == "" {
+			return nil, nil, errors.ErrBadRequest.WithDetails("Runtime name is required")
+		}
+		version.Runtime = *req.Runtime
+	}
+	if req.Entry != nil {
+		version.Entry = *req.Entry
+	}
+	if req.Files != nil {
+		if err := validateFunctionFiles(req.Files); err != nil {
+			return nil, nil, err
+		}
+		version.Files = req.Files
+	}
+	if req.Process != nil {
+		version.Process = *req.Process
+	}
+	if req.Environment != nil {
+		version.Environment = req.Environment
+	}
+	if req.Layers != nil {
+		version.Layers = req.Layers
+	}
+	if _, err := s.mergeLayers(orgID, version.Files, version.Layers); err != nil {
+		return nil, nil, err
+	}
+
+	if req.Description != "" {
+		function.Description = req.Description
+	}
+
+	if err := s.store.PublishVersion(function, version); err != nil {
+		return nil, nil, functionError(err)
+	}
+
+	return function, version, nil
+}
+
+// GetFunction retrieves a function of an organization
+func (s *FunctionService) GetFunction(orgID uuid.UUID, name string) (*models.Function, error) {
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	return function, nil
+}
+
+// ListFunctions retrieves the functions of an organization
+func (s *FunctionService) ListFunctions(orgID uuid.UUID) ([]models.Function, error) {
+	functions, err := s.store.ListFunctions(orgID)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	return functions, nil
+}
+
+// DeleteFunction deletes a function with its versions and aliases
+func (s *FunctionService) DeleteFunction(orgID uuid.UUID, name string) error {
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return functionError(err)
+	}
+	return functionError(s.store.DeleteFunction(function.ID))
+}
+
+// ListVersions retrieves the published versions of a function
+func (s *FunctionService) ListVersions(orgID uuid.UUID, name string) ([]models.FunctionVersion, error) {
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return nil, functionError(err)
+	}
+
+	versions, err := s.store.ListVersions(function.ID)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	return versions, nil
+}
+
+// PutAlias creates an alias of a function, or points it to another version
+func (s *FunctionService) PutAlias(orgID uuid.UUID, name, aliasName string, req models.PutFunctionAliasRequest) (*models.FunctionAlias, error) {
+	if !aliasNameRegex.MatchString(aliasName) || aliasName == models.LatestQualifier {
+		return nil, errors.ErrBadRequest.WithDetails("Alias name must start with a letter, contain only alphanumeric characters, hyphens, and underscores, and not be 'latest'")
+	}
+
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return nil, functionError(err)
+	}
+
+	if _, err := s.store.GetVersion(function.ID, req.Version); err != nil {
+		return nil, functionError(err)
+	}
+
+	alias := &models.FunctionAlias{
+		FunctionID:  function.ID,
+		Name:        aliasName,
+		Version:     req.Version,
+		Description: req.Description,
+	}
+	if err := s.store.PutAlias(alias); err != nil {
+		return nil, functionError(err)
+	}
+
+	return alias, nil
+}
+
+// DeleteAlias deletes an alias of a function, the version it points to is kept
+func (s *FunctionService) DeleteAlias(orgID uuid.UUID, name, aliasName string) error {
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return functionError(err)
+	}
+	return functionError(s.store.DeleteAlias(function.ID, aliasName))
+}
+
+// Resolve finds the version of a function selected by a qualifier: a version
+// number, an alias, or latest when empty
+func (s *FunctionService) Resolve(orgID uuid.UUID, name, qualifier string) (*models.Function, *models.FunctionVersion, error) {
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return nil, nil, functionError(err)
+	}
+
+	number := function.LatestVersion
+	switch n, err := strconv.Atoi(qualifier); {
+	case qualifier == "" || qualifier == models.LatestQualifier:
+	case err == nil:
+		number = n
+	default:
+		alias, err := s.store.GetAlias(function.ID, qualifier)
+		if err != nil {
+			return nil, nil, functionError(err)
+		}
+		number = alias.Version
+	}
+
+	version, err := s.store.GetVersion(function.ID, number)
+	if err != nil {
+		return nil, nil, functionError(err)
+	}
+
+	return function, version, nil
+}
+
+// PutURL enables the invoke URL of a function, or changes its settings. The API key is
+// returned when one is generated, only its hash is stored.
+func (s *FunctionService) PutURL(orgID uuid.UUID, name string, req models.PutFunctionURLRequest) (*models.Function, string, error) {
+	function, _, err := s.Resolve(orgID, name, req.Qualifier)
+	if err != nil {
+		return nil, "", err
+	}
+
+	function.URLAuth = req.AuthType
+	function.URLQualifier = req.Qualifier
+
+	var apiKey string
+	if req.AuthType != models.FunctionURLAuthAPIKey {
+		function.URLKeyHash = ""
+	} else if function.URLKeyHash == "" || req.RotateKey {
+		key := make([]byte, 24)
+		if _, err := rand.Read(key); err != nil {
+			return nil, "", errors.ErrInternalError.WithDetails("Failed to generate the API key")
+		}
+		apiKey = "fk_" + hex.EncodeToString(key)
+		function.URLKeyHash = hashFunctionURLKey(apiKey)
+	}
+
+	if err := s.store.UpdateFunctionURL(function); err != nil {
+		return nil, "", functionError(err)
+	}
+
+	return function, apiKey, nil
+}
+
+// DeleteURL disables the invoke URL of a function and forgets its API key
+func (s *FunctionService) DeleteURL(orgID uuid.UUID, name string) error {
+	function, err := s.store.GetFunction(orgID, name)
+	if err != nil {
+		return functionError(err)
+	}
+
+	function.URLAuth = ""
+	function.URLQualifier = ""
+	function.URLKeyHash = ""
+
+	return functionError(s.store.UpdateFunctionURL(function))
+}
+
+// CheckURLKey reports whether the key is the API key of the invoke URL of a function
+func CheckURLKey(function *models.Function, key string) bool {
+	if function.URLKeyHash == "" || key == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashFunctionURLKey(key)), []byte(function.URLKeyHash)) == 1
+}
+
+func hashFunctionURLKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// BuildExecuteRequest turns a version and the parameters of an invocation into a lambda request,
+// the environment of the invocation overrides the one of the version, which overrides the process one
+func BuildExecuteRequest(version *models.FunctionVersion, req models.InvokeFunctionRequest) models.LambdaExecuteRequest {
+	var execute models.LambdaExecuteRequest
+	execute.Runtime.Name = version.Runtime.Name
+	execute.Runtime.Version = version.Runtime.Version
+	execute.Project.Entry = version.Entry
+	execute.Project.Files = append([]models.LambdaFile(nil), version.Files...)
+	execute.Process = version.Process
+	execute.Priority = req.Priority
+
+	env := make(map[string]string)
+	for _, vars := range []map[string]string{version.Process.EnvironmentVars, version.Environment, req.Environment} {
+		for key, value := range vars {
+			env[key] = value
+		}
+	}
+	if len(env) > 0 {
+		execute.Process.EnvironmentVars = env
+	}
+
+	if req.StandardInput != "" {
+		execute.Process.StandardInput = req.StandardInput
+	}
+
+	return execute
+}
+
+func validateFunctionFiles(files []models.LambdaFile) error {
+	if len(files) == 0 {
+		return errors.ErrBadRequest.WithDetails("At least one file is required")
+	}
+
+	names := make(map[string]bool)
+	for _, file := range files {
+		if names[file.Name] {
+			return errors.ErrBadRequest.WithDetails("Duplicate file name: " + file.Name)
+		}
+		names[file.Name] = true
+	}
+	return nil
+}
+
+// functionError maps the errors of the function store to API errors
+func functionError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case stderrors.Is(err, models.ErrFunctionNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Function not found")
+	case stderrors.Is(err, models.ErrFunctionVersionNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Function version not found")
+	case stderrors.Is(err, models.ErrFunctionAliasNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Function alias not found")
+	case stderrors.Is(err, models.ErrFunctionExists):
+		return errors.ErrConflict.WithDetails("A function with this name already exists")
+	case stderrors.Is(err, models.ErrLayerNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Layer not found")
+	case stderrors.Is(err, models.ErrLayerVersionNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Layer version not found")
+	default:
+		return errors.ErrInternalError.WithDetails(err.Error())
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxFunctionLayers is the number of layers a function can reference
+	MaxFunctionLayers = 5
+	// MaxProjectSize is the total size in bytes of the files sent to the Lambda API for an
+	// invocation, once the layers are merged into the files of the function
+	MaxProjectSize = 5 << 20
+	// MaxProjectFiles is the number of files sent to the Lambda API for an invocation
+	MaxProjectFiles = 256
+)
+
+// PublishLayerVersion publishes the next version of a layer of an organization, the layer
+// is created with its first version
+func (s *FunctionService) PublishLayerVersion(orgID, accountID uuid.UUID, name string, req models.PublishLayerVersionRequest) (*models.Layer, *models.LayerVersion, error) {
+	if !functionNameRegex.MatchString(name) {
+		return nil, nil, errors.ErrBadRequest.WithDetails("Layer name can only contain up to 64 alphanumeric characters, hyphens, and underscores")
+	}
+	if err := validateFunctionFiles(req.Files); err != nil {
+		return nil, nil, err
+	}
+
+	size := filesSize(req.Files)
+	if size > MaxProjectSize || len(req.Files) > MaxProjectFiles {
+		return nil, nil, errors.ErrBadRequest.WithDetails(fmt.Sprintf("A layer is limited to %d files and %d bytes", MaxProjectFiles, MaxProjectSize))
+	}
+
+	layer := &models.Layer{
+		Name:           name,
+		OrganizationID: orgID,
+		Description:    req.Description,
+	}
+	version := &models.LayerVersion{
+		CreatedBy:   accountID,
+		Description: req.Description,
+		Files:       req.Files,
+		Size:        size,
+	}
+
+	if err := s.layers.PublishLayerVersion(layer, version); err != nil {
+		return nil, nil, functionError(err)
+	}
+
+	return layer, version, nil
+}
+
+// GetLayer retrieves a layer of an organization
+func (s *FunctionService) GetLayer(orgID uuid.UUID, name string) (*models.Layer, error) {
+	layer, err := s.layers.GetLayer(orgID, name)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	return layer, nil
+}
+
+// ListLayers retrieves the layers of an organization
+func (s *FunctionService) ListLayers(orgID uuid.UUID) ([]models.Layer, error) {
+	layers, err := s.layers.ListLayers(orgID)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	return layers, nil
+}
+
+// DeleteLayer deletes a layer of an organization with all its versions, the functions still
+// referencing it fail to invoke until they are updated
+func (s *FunctionService) DeleteLayer(orgID uuid.UUID, name string) error {
+	layer, err := s.layers.GetLayer(orgID, name)
+	if err != nil {
+		return functionError(err)
+	}
+	return functionError(s.layers.DeleteLayer(layer.ID))
+}
+
+// ListLayerVersions retrieves the versions of a layer, without their files
+func (s *FunctionService) ListLayerVersions(orgID uuid.UUID, name string) ([]models.LayerVersion, error) {
+	layer, err := s.layers.GetLayer(orgID, name)
+	if err != nil {
+		return nil, functionError(err)
+	}
+
+	versions, err := s.layers.ListLayerVersions(layer.ID)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	return versions, nil
+}
+
+// GetLayerVersion retrieves a version of a layer with its files
+func (s *FunctionService) GetLayerVersion(orgID uuid.UUID, name string, version int) (*models.LayerVersion, error) {
+	layer, err := s.layers.GetLayer(orgID, name)
+	if err != nil {
+		return nil, functionError(err)
+	}
+
+	layerVersion, err := s.layers.GetLayerVersion(layer.ID, version)
+	if err != nil {
+		return nil, functionError(err)
+	}
+	return layerVersion, nil
+}
+
+// ExecuteRequest builds the lambda request of an invocation of a version, with the files of
+// its layers merged into the ones of the function
+func (s *FunctionService) ExecuteRequest(orgID uuid.UUID, version *models.FunctionVersion, req models.InvokeFunctionRequest) (models.LambdaExecuteRequest, error) {
+	execute := BuildExecuteRequest(version, req)
+
+	files, err := s.mergeLayers(orgID, version.Files, version.Layers)
+	if err != nil {
+		return execute, err
+	}
+	execute.Project.Files = files
+
+	return execute, nil
+}
+
+// mergeLayers resolves the layers and merges their files with the ones of a function. The files
+// of the function come first and override the ones of the layers, a layer overrides the files of
+// the layers before it, so the result only depends on the order of the references.
+func (s *FunctionService) mergeLayers(orgID uuid.UUID, files []models.LambdaFile, layers []models.LayerReference) ([]models.LambdaFile, error) {
+	if len(layers) > MaxFunctionLayers {
+		return nil, errors.ErrBadRequest.WithDetails(fmt.Sprintf("A function can reference up to %d layers", MaxFunctionLayers))
+	}
+
+	merged := append([]models.LambdaFile(nil), files...)
+	index := make(map[string]int, len(files))
+	for i, file := range files {
+		index[file.Name] = -1 - i
+	}
+
+	attached := make(map[string]bool, len(layers))
+	for _, ref := range layers {
+		if attached[ref.Name] {
+			return nil, errors.ErrBadRequest.WithDetails("Duplicate layer: " + ref.Name)
+		}
+		attached[ref.Name] = true
+
+		layer, err := s.layers.GetLayer(orgID, ref.Name)
+		if err != nil {
+			return nil, functionError(err)
+		}
+		version, err := s.layers.GetLayerVersion(layer.ID, ref.Version)
+		if err != nil {
+			return nil, functionError(err)
+		}
+
+		for _, file := range version.Files {
+			i, exists := index[file.Name]
+			switch {
+			case !exists:
+				index[file.Name] = len(merged)
+				merged = append(merged, file)
+			case i >= 0:
+				// replaced in place, so the position of a file doesn't depend on the later layers
+				merged[i] = file
+			}
+			// negative positions are files of the function, which take precedence
+		}
+	}
+
+	if len(merged) > MaxProjectFiles {
+		return nil, errors.ErrBadRequest.WithDetails(fmt.Sprintf("The function and its layers exceed the limit of %d files", MaxProjectFiles))
+	}
+	if size := filesSize(merged); size > MaxProjectSize {
+		return nil, errors.ErrBadRequest.WithDetails(fmt.Sprintf("The function and its layers weigh %d bytes, over the limit of %d bytes", size, MaxProjectSize))
+	}
+
+	return merged, nil
+}
+
+func filesSize(files []models.LambdaFile) int64 {
+	var size int64
+	for _, file := range files {
+		size += int64(len(file.Contents))
+	}
+	return size
+}
@@ -15,13 +15,17 @@ import (
 type MonitoringService struct {
 	monitoringStore stores.MonitoringStore
 	iamStore        stores.IAMStore
+
+	// LambdaBillingGranularity is the unit the execution time of the lambda invocations is rounded up to
+	LambdaBillingGranularity time.Duration
 }
 
 // NewMonitoringService creates a new monitoring service
 func NewMonitoringService(monitoringStore stores.MonitoringStore, iamStore stores.IAMStore) *MonitoringService {
 	return &MonitoringService{
-		monitoringStore: monitoringStore,
-		iamStore:        iamStore,
+		monitoringStore:          monitoringStore,
+		iamStore:                 iamStore,
+		LambdaBillingGranularity: DefaultLambdaBillingGranularity,
 	}
 }
 
@@ -29,12 +33,56 @@ func NewMonitoringService(monitoringStore stores.MonitoringStore, iamStore store
 const (
 	ComputeMicroCostPerHour = 0.05 // $0.05/hour for micro compute
 	ComputeSmallCostPerHour = 0.10 // $0.10/hour for small compute
-	LambdaCostPerHour       = 0.02 // $0.02/hour for lambda executions
+	LambdaCostPerHour       = 0.02 // $0.02/hour for lambda executions, in the smallest memory class
 	StorageCostPerGBPerHour = 0.01 // $0.01/GB/hour for storage
 	RDBCostPerHour          = 0.15 // $0.15/hour for RDB instances
 	SecretCostPerHour       = 0.01 // $0.01/hour for secrets
 )
 
+// Lambda metering
+const (
+	LambdaCostPerRequest            = 0.0000002 // $0.20 per million lambda invocations
+	LambdaMinMemoryClassMB          = 128       // invocations using less memory are billed as 128 MB
+	DefaultLambdaBillingGranularity = 100 * time.Millisecond
+)
+
+// TrackLambdaInvocation meters an invocation for its account and organization: one request,
+// the execution time rounded up to the billing granularity, and the peak memory rounded up
+// to its memory class, whose price doubles with each class
+func (s *MonitoringService) TrackLambdaInvocation(accountID, organizationID uuid.UUID, executionTime time.Duration, memoryBytes uint64) error {
+	billed := executionTime
+	if granularity := s.LambdaBillingGranularity; granularity > 0 {
+		billed = (executionTime + granularity - 1) / granularity * granularity
+		if billed == 0 {
+			// every invocation is billed at least one unit
+			billed = granularity
+		}
+	}
+
+	memoryClass := LambdaMemoryClass(memoryBytes)
+	costPerHour := LambdaCostPerHour * float64(memoryClass) / LambdaMinMemoryClassMB
+
+	return s.monitoringStore.RecordLambdaUsage(&models.LambdaUsage{
+		AccountID:      accountID,
+		OrganizationID: organizationID,
+		MemoryClass:    memoryClass,
+		BilledDuration: billed,
+		Cost:           costPerHour*billed.Hours() + LambdaCostPerRequest,
+		CostPerHour:    costPerHour,
+		Time:           time.Now(),
+	})
+}
+
+// LambdaMemoryClass returns the memory class in MB of an invocation: its peak memory rounded up
+// to a power of two, starting at 128 MB
+func LambdaMemoryClass(memoryBytes uint64) int {
+	class := LambdaMinMemoryClassMB
+	for uint64(class)<<20 < memoryBytes {
+		class *= 2
+	}
+	return class
+}
+
 // TrackResourceCreation tracks when a new resource is created
 func (s *MonitoringService) TrackResourceCreation(
 	accountID, organizationID uuid.UUID,
@@ -87,9 +135,20 @@ func (s *MonitoringService) TrackResourceUpdate(
 		return fmt.Errorf("failed to get resource usage: %w", err)
 	}
 
+	// Billing stops while the resource is inactive: it ends at the last time the resource was
+	// active, and the time until it's active again is left out
+	now := time.Now()
+	wasActive := usage.Status == models.ResourceStatusActive
+	if wasActive && status != models.ResourceStatusActive {
+		usage.LastActiveAt = &now
+	}
+	if !wasActive && status == models.ResourceStatusActive && usage.LastActiveAt != nil && !usage.LastActiveAt.IsZero() {
+		usage.InactiveHours += now.Sub(*usage.LastActiveAt).Hours()
+	}
+
 	// Update status
 	usage.Status = status
-	usage.LastUpdatedAt = time.Now()
+	usage.LastUpdatedAt = now
 
 	// Update metrics if provided
 	if metrics != nil {
@@ -115,7 +174,6 @@ func (s *MonitoringService) TrackResourceUpdate(
 
 	// Update last active time if resource is active
 	if status == models.ResourceStatusActive {
-		now := time.Now()
 		usage.LastActiveAt = &now
 	}
 
@@ -136,7 +194,11 @@ func (s *MonitoringService) TrackResourceDeletion(
 		return fmt.Errorf("failed to get resource usage: %w", err)
 	}
 
-	// Mark as deleted
+	// Mark as deleted, an active resource is billed until now
+	if usage.Status == models.ResourceStatusActive {
+		now := time.Now()
+		usage.LastActiveAt = &now
+	}
 	usage.Status = models.ResourceStatusDeleted
 	usage.LastUpdatedAt = time.Now()
 
@@ -404,16 +466,19 @@ func (s *MonitoringService) calculateCostPerHour(resourceType models.ResourceTyp
 
 // calculateTotalCost calculates the total cost for a resource based on usage duration
 func (s *MonitoringService) calculateTotalCost(usage *models.ResourceUsage) float64 {
-	var endTime time.Time
-	if usage.LastActiveAt == nil {
-		// If LastActiveAt is nil, use current time for active resources
-		endTime = time.Now()
-	} else {
+	// lambda usage is metered per invocation, not by the hour
+	if usage.ResourceType == models.ResourceTypeLambda {
+		return usage.TotalCost
+	}
+
+	// an active resource is billed until now, an inactive one until it was last active
+	endTime := time.Now()
+	if usage.Status != models.ResourceStatusActive && usage.LastActiveAt != nil {
 		endTime = *usage.LastActiveAt
 	}
 
 	duration := endTime.Sub(usage.ResourceCreatedAt)
-	hours := duration.Hours()
+	hours := duration.Hours() - usage.InactiveHours
 
 	// Calculate base cost
 	baseCost := usage.CostPerHour * hours
@@ -77,6 +77,11 @@ func (m *MockMonitoringStore) GetMonthlyUsageHistory(orgID string, year int, mon
 	return args.Get(0).([]models.ResourceUsageHistory), args.Error(1)
 }
 
+func (m *MockMonitoringStore) RecordLambdaUsage(usage *models.LambdaUsage) error {
+	args := m.Called(usage)
+	return args.Error(0)
+}
+
 func (m *MockMonitoringStore) CreateBillingPeriod(period *models.BillingPeriod) error {
 	args := m.Called(period)
 	return args.Error(0)
@@ -222,6 +227,11 @@ func (m *MockIAMStore) GetRolesByOrganizationID(orgID string) ([]models.Role, er
 	return args.Get(0).([]models.Role), args.Error(1)
 }
 
+func (m *MockIAMStore) GetAllRoles() ([]models.Role, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Role), args.Error(1)
+}
+
 func (m *MockIAMStore) GetOrganizationByID(orgID string) (*models.Organization, error) {
 	args := m.Called(orgID)
 	return args.Get(0).(*models.Organization), args.Error(1)
@@ -306,6 +316,70 @@ func TestTrackResourceDeletion(t *testing.T) {
 	mockStore.AssertExpectations(t)
 }
 
+func TestLambdaMemoryClass(t *testing.T) {
+	tests := []struct {
+		memoryBytes uint64
+		expected    int
+	}{
+		{0, 128},
+		{64 << 20, 128},
+		{128 << 20, 128},
+		{128<<20 + 1, 256},
+		{300 << 20, 512},
+		{1 << 30, 1024},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, LambdaMemoryClass(tt.memoryBytes), "memory class of %d bytes", tt.memoryBytes)
+	}
+}
+
+func TestTrackLambdaInvocation(t *testing.T) {
+	accountID := uuid.New()
+	orgID := uuid.New()
+
+	tests := []struct {
+		name           string
+		granularity    time.Duration
+		executionTime  time.Duration
+		memoryBytes    uint64
+		billedDuration time.Duration
+		memoryClass    int
+	}{
+		{"rounded up to the granularity", 100 * time.Millisecond, 120 * time.Millisecond, 10 << 20, 200 * time.Millisecond, 128},
+		{"billed at least one unit", 100 * time.Millisecond, 0, 10 << 20, 100 * time.Millisecond, 128},
+		{"exact units", time.Second, 3 * time.Second, 200 << 20, 3 * time.Second, 256},
+		{"no granularity", 0, 1234 * time.Microsecond, 10 << 20, 1234 * time.Microsecond, 128},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &MockMonitoringStore{}
+			service := NewMonitoringService(mockStore, &MockIAMStore{})
+			service.LambdaBillingGranularity = tt.granularity
+
+			var recorded *models.LambdaUsage
+			mockStore.On("RecordLambdaUsage", mock.AnythingOfType("*models.LambdaUsage")).
+				Run(func(args mock.Arguments) { recorded = args.Get(0).(*models.LambdaUsage) }).
+				Return(nil)
+
+			err := service.TrackLambdaInvocation(accountID, orgID, tt.executionTime, tt.memoryBytes)
+
+			assert.NoError(t, err)
+			mockStore.AssertExpectations(t)
+			assert.Equal(t, accountID, recorded.AccountID)
+			assert.Equal(t, orgID, recorded.OrganizationID)
+			assert.Equal(t, tt.billedDuration, recorded.BilledDuration)
+			assert.Equal(t, tt.memoryClass, recorded.MemoryClass)
+
+			// the price doubles with each memory class, and every request is charged
+			costPerHour := LambdaCostPerHour * float64(tt.memoryClass) / LambdaMinMemoryClassMB
+			assert.InDelta(t, costPerHour, recorded.CostPerHour, 1e-12)
+			assert.InDelta(t, costPerHour*tt.billedDuration.Hours()+LambdaCostPerRequest, recorded.Cost, 1e-12)
+		})
+	}
+}
+
 func TestCalculateCostPerHour(t *testing.T) {
 	service := &MonitoringService{}
 
@@ -357,6 +431,23 @@ func TestCalculateTotalCost(t *testing.T) {
 	assert.Equal(t, expectedCost, result)
 }
 
+func TestCalculateTotalCostActive(t *testing.T) {
+	service := &MonitoringService{}
+
+	// restarted an hour ago, the resource has run since it was created two hours ago
+	lastActive := time.Now().Add(-time.Hour)
+	usage := &models.ResourceUsage{
+		Status:            models.ResourceStatusActive,
+		CostPerHour:       1,
+		ResourceCreatedAt: time.Now().Add(-2 * time.Hour),
+		LastActiveAt:      &lastActive,
+	}
+	assert.InDelta(t, 2.0, service.calculateTotalCost(usage), 0.01, "an active resource is billed until now")
+
+	usage.Status = models.ResourceStatusInactive
+	assert.InDelta(t, 1.0, service.calculateTotalCost(usage), 0.01, "an inactive resource is billed until it was last active")
+}
+
 func TestGetResourceUsageSummary(t *testing.T) {
 	mockStore := &MockMonitoringStore{}
 	mockIAMStore := &MockIAMStore{}
@@ -4,30 +4,26 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"runtime"
 	"time"
 
 	"unicorn-api/internal/common/errors"
 	"unicorn-api/internal/common/validation"
+	"unicorn-api/internal/containers"
 	"unicorn-api/internal/models"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
 )
 
 // RDBService handles database container operations
 type RDBService struct {
+	runtime   containers.ContainerRuntime
 	validator *validation.Validator
 }
 
-// NewRDBService creates a new RDB service
-func NewRDBService() *RDBService {
+// NewRDBService creates a new RDB service running the databases on runtime
+func NewRDBService(runtime containers.ContainerRuntime) *RDBService {
 	return &RDBService{
+		runtime:   runtime,
 		validator: validation.NewValidator(),
 	}
 }
@@ -66,47 +62,25 @@ func (s *RDBService) CreateRDBInstance(userID uuid.UUID, req models.RDBCreateReq
 		}
 	}
 
-	// Create Docker client with proper socket path for macOS
-	var cli *client.Client
-	var err error
-	if runtime.GOOS == "darwin" {
-		// On macOS, Docker Desktop uses a different socket path
-		cli, err = client.NewClientWithOpts(
-			client.WithHost("unix:///Users/asandeistefan/.docker/run/docker.sock"),
-			client.WithAPIVersionNegotiation(),
-		)
-	} else {
-		cli, err = client.NewClientWithOpts(client.FromEnv)
-	}
-	if err != nil {
-		return nil, errors.ErrInternalError.WithDetails("Docker client unavailable: " + err.Error())
-	}
-	defer cli.Close()
-
 	ctx := context.Background()
 
 	// Get image and configuration based on database type
 	image, envVars := s.getDatabaseConfig(req)
 
 	// Pull image with retry logic
-	if err := s.pullImageWithRetry(ctx, cli, image); err != nil {
+	if err := s.pullImageWithRetry(ctx, image); err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Failed to pull Docker image: " + err.Error())
 	}
 
 	// Set resource limits based on preset
-	resources := s.getResourceLimits(req.Preset)
+	nanoCPUs, memory := s.getResourceLimits(req.Preset)
 
 	// Configure port bindings
-	exposedPorts := nat.PortSet{}
-	portBindings := nat.PortMap{}
-
-	port, _ := nat.NewPort("tcp", req.Port)
-	exposedPorts[port] = struct{}{}
 	hostPort := fmt.Sprintf("%d", 10000+rand.Intn(10000))
-	portBindings[port] = []nat.PortBinding{{HostPort: hostPort}}
+	ports := []containers.PortBinding{{ContainerPort: req.Port, HostPort: hostPort}}
 
 	// Configure volumes with automatic mount paths for database storage
-	var mounts []mount.Mount
+	var volumes []containers.VolumeMount
 	for _, volume := range req.Volumes {
 		volumeName := fmt.Sprintf("rdb-%s-%s", userID.String()[:8], volume.Name)
 
@@ -118,9 +92,8 @@ func (s *RDBService) CreateRDBInstance(userID uuid.UUID, req models.RDBCreateReq
 			mountPath = "/var/lib/mysql"
 		}
 
-		mounts = append(mounts, mount.Mount{
-			Type:   mount.TypeVolume,
-			Source: volumeName,
+		volumes = append(volumes, containers.VolumeMount{
+			Name:   volumeName,
 			Target: mountPath,
 		})
 	}
@@ -142,27 +115,27 @@ func (s *RDBService) CreateRDBInstance(userID uuid.UUID, req models.RDBCreateReq
 	}
 
 	// Create container
-	resp, err := cli.ContainerCreate(ctx, &container.Config{
-		Image:        image,
-		Env:          envVars,
-		ExposedPorts: exposedPorts,
-		Labels:       map[string]string{"owner": userID.String(), "type": "rdb"},
-	}, &container.HostConfig{
-		PortBindings: portBindings,
-		Resources:    resources,
-		Mounts:       mounts,
-	}, nil, nil, containerName)
+	id, err := s.runtime.CreateContainer(ctx, containers.ContainerSpec{
+		Name:     containerName,
+		Image:    image,
+		Env:      envVars,
+		Labels:   map[string]string{"owner": userID.String(), "type": "rdb"},
+		Ports:    ports,
+		Volumes:  volumes,
+		NanoCPUs: nanoCPUs,
+		Memory:   memory,
+	})
 	if err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Container creation failed: " + err.Error())
 	}
 
 	// Start container
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	if err := s.runtime.StartContainer(ctx, id); err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Container start failed: " + err.Error())
 	}
 
 	// Get container info
-	containerInfo, err := cli.ContainerInspect(ctx, resp.ID)
+	containerInfo, err := s.runtime.InspectContainer(ctx, id)
 	if err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Failed to inspect container: " + err.Error())
 	}
@@ -170,10 +143,10 @@ func (s *RDBService) CreateRDBInstance(userID uuid.UUID, req models.RDBCreateReq
 	// Build response
 	now := time.Now().Format(time.RFC3339)
 	return &models.RDBInstanceInfo{
-		ID:          resp.ID,
+		ID:          id,
 		Name:        containerName,
 		Type:        req.Type,
-		Status:      containerInfo.State.Status,
+		Status:      string(containerInfo.State),
 		Port:        hostPort,
 		Host:        "localhost",
 		Database:    req.Database,
@@ -187,50 +160,20 @@ func (s *RDBService) CreateRDBInstance(userID uuid.UUID, req models.RDBCreateReq
 
 // ListRDBInstances lists all database containers for a user
 func (s *RDBService) ListRDBInstances(userID uuid.UUID) ([]models.RDBInstanceInfo, error) {
-	var cli *client.Client
-	var err error
-	if runtime.GOOS == "darwin" {
-		// On macOS, Docker Desktop uses a different socket path
-		cli, err = client.NewClientWithOpts(
-			client.WithHost("unix:///Users/asandeistefan/.docker/run/docker.sock"),
-			client.WithAPIVersionNegotiation(),
-		)
-	} else {
-		cli, err = client.NewClientWithOpts(client.FromEnv)
-	}
-	if err != nil {
-		return nil, errors.ErrInternalError.WithDetails("Docker client unavailable: " + err.Error())
-	}
-	defer cli.Close()
-
-	ctx := context.Background()
-	filter := filters.NewArgs()
-	filter.Add("label", "owner="+userID.String())
-	filter.Add("label", "type=rdb")
-
-	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
-		All:     true,
-		Filters: filter,
+	list, err := s.runtime.ListContainers(context.Background(), map[string]string{
+		"owner": userID.String(),
+		"type":  "rdb",
 	})
 	if err != nil {
 		return nil, errors.ErrInternalError.WithDetails("Failed to list containers: " + err.Error())
 	}
 
 	var result []models.RDBInstanceInfo
-	for _, ctr := range containers {
-		// Get detailed container info
-		_, err = cli.ContainerInspect(ctx, ctr.ID)
-		if err != nil {
-			continue
-		}
-
+	for _, ctr := range list {
 		// Extract port information
 		var port string
-		for _, p := range ctr.Ports {
-			if p.PublicPort != 0 {
-				port = fmt.Sprintf("%d", p.PublicPort)
-				break
-			}
+		if len(ctr.Ports) > 0 {
+			port = ctr.Ports[0].HostPort
 		}
 
 		// Determine database type from image
@@ -239,7 +182,7 @@ func (s *RDBService) ListRDBInstances(userID uuid.UUID) ([]models.RDBInstanceInf
 		now := time.Now().Format(time.RFC3339)
 		result = append(result, models.RDBInstanceInfo{
 			ID:        ctr.ID,
-			Name:      ctr.Names[0][1:], // Remove leading slash
+			Name:      ctr.Name,
 			Type:      dbType,
 			Status:    ctr.Status,
 			Port:      port,
@@ -256,45 +199,29 @@ func (s *RDBService) ListRDBInstances(userID uuid.UUID) ([]models.RDBInstanceInf
 
 // DeleteRDBInstance deletes a database container
 func (s *RDBService) DeleteRDBInstance(userID uuid.UUID, containerID string) error {
-	var cli *client.Client
-	var err error
-	if runtime.GOOS == "darwin" {
-		// On macOS, Docker Desktop uses a different socket path
-		cli, err = client.NewClientWithOpts(
-			client.WithHost("unix:///Users/asandeistefan/.docker/run/docker.sock"),
-			client.WithAPIVersionNegotiation(),
-		)
-	} else {
-		cli, err = client.NewClientWithOpts(client.FromEnv)
-	}
-	if err != nil {
-		return errors.ErrInternalError.WithDetails("Docker client unavailable: " + err.Error())
-	}
-	defer cli.Close()
-
 	ctx := context.Background()
 
 	// Verify the container belongs to the user
-	containerInfo, err := cli.ContainerInspect(ctx, containerID)
+	containerInfo, err := s.runtime.InspectContainer(ctx, containerID)
 	if err != nil {
 		return errors.ErrNotFound.WithDetails("Container not found")
 	}
 
 	// Check if container belongs to user and is an RDB container
-	if containerInfo.Config.Labels["owner"] != userID.String() ||
-		containerInfo.Config.Labels["type"] != "rdb" {
+	if containerInfo.Labels["owner"] != userID.String() ||
+		containerInfo.Labels["type"] != "rdb" {
 		return errors.ErrForbidden.WithDetails("Container does not belong to user or is not an RDB container")
 	}
 
 	// Stop the container if it's running
-	if containerInfo.State.Running {
-		if err := cli.ContainerStop(ctx, containerID, container.StopOptions{}); err != nil {
+	if containerInfo.Running() {
+		if err := s.runtime.StopContainer(ctx, containerID); err != nil {
 			return errors.ErrInternalError.WithDetails("Failed to stop container: " + err.Error())
 		}
 	}
 
-	// Remove the container
-	if err := cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{}); err != nil {
+	// Remove the container, its volumes are kept
+	if err := s.runtime.RemoveContainer(ctx, containerID); err != nil {
 		return errors.ErrInternalError.WithDetails("Failed to remove container: " + err.Error())
 	}
 
@@ -342,34 +269,25 @@ func (s *RDBService) getDatabaseTypeFromImage(image string) models.RDBType {
 	return models.RDBTypePostgreSQL
 }
 
-// getResourceLimits returns resource limits based on preset
-func (s *RDBService) getResourceLimits(preset models.RDBPreset) container.Resources {
+// getResourceLimits returns the CPU, in nano CPUs, and the memory, in bytes, of a preset
+func (s *RDBService) getResourceLimits(preset models.RDBPreset) (int64, int64) {
 	switch preset {
 	case models.RDBPresetMicro:
-		return container.Resources{
-			NanoCPUs: 500_000_000,       // 0.5 CPU
-			Memory:   512 * 1024 * 1024, // 512MB
-		}
+		return 500_000_000, 512 * 1024 * 1024 // 0.5 CPU, 512MB
 	case models.RDBPresetSmall:
-		return container.Resources{
-			NanoCPUs: 1_000_000_000,          // 1 CPU
-			Memory:   1 * 1024 * 1024 * 1024, // 1GB
-		}
+		return 1_000_000_000, 1 * 1024 * 1024 * 1024 // 1 CPU, 1GB
 	case models.RDBPresetMedium:
-		return container.Resources{
-			NanoCPUs: 2_000_000_000,          // 2 CPU
-			Memory:   2 * 1024 * 1024 * 1024, // 2GB
-		}
+		return 2_000_000_000, 2 * 1024 * 1024 * 1024 // 2 CPU, 2GB
 	default:
-		return container.Resources{}
+		return 0, 0
 	}
 }
 
 // pullImageWithRetry pulls a Docker image with retry logic
-func (s *RDBService) pullImageWithRetry(ctx context.Context, cli *client.Client, image string) error {
+func (s *RDBService) pullImageWithRetry(ctx context.Context, image string) error {
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		_, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+		err := s.runtime.PullImage(ctx, image)
 		if err == nil {
 			return nil
 		}
@@ -0,0 +1,631 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	stderrors "errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"unicorn-api/internal/auth"
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/stores"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// DefaultSchedulerInterval is how often the due schedules are looked for
+	DefaultSchedulerInterval = 10 * time.Second
+	// DefaultScheduleMisfireThreshold is how late an occurrence can run before it's missed
+	DefaultScheduleMisfireThreshold = time.Minute
+	// DefaultScheduleMaxCatchUp bounds the missed occurrences run late at once, the oldest are skipped
+	DefaultScheduleMaxCatchUp = 10
+	// DefaultScheduleRunHistory is the number of runs kept per schedule
+	DefaultScheduleRunHistory = 100
+
+	schedulerLeaseName = "scheduler"
+	// scheduleMaxScan bounds the missed occurrences looked at, like a schedule firing every
+	// second while no replica ran for days
+	scheduleMaxScan     = 10000
+	scheduleOutputLimit = 4096
+)
+
+var (
+	scheduleRateRegex = regexp.MustCompile(`^rate\((\d+) (second|minute|hour|day)s?\)$`)
+	scheduleRateUnits = map[string]time.Duration{
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+	}
+	scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+)
+
+// ComputeController starts and stops the compute containers of the accounts
+type ComputeController interface {
+	// CheckContainer returns an error unless the container belongs to the account
+	CheckContainer(userID uuid.UUID, containerID string) error
+	StartContainer(userID uuid.UUID, containerID string) error
+	StopContainer(userID uuid.UUID, containerID string) error
+}
+
+// ScheduleService runs the targets of the schedules at their occurrences, on behalf of the
+// accounts owning them. When several replicas of the API run, the one holding the scheduler
+// lease runs the schedules, and each occurrence is claimed in the database before it runs.
+type ScheduleService struct {
+	store     stores.ScheduleStore
+	functions *FunctionService
+	iamStore  stores.IAMStore
+	lambda    LambdaExecutor
+	compute   ComputeController
+	config    *config.Config
+
+	// MisfireThreshold is how late an occurrence runs, later ones are caught up or skipped
+	MisfireThreshold time.Duration
+	// MaxCatchUp is the number of missed occurrences run late at once
+	MaxCatchUp int
+	// RunHistory is the number of runs kept per schedule
+	RunHistory int
+
+	interval      time.Duration
+	leaseDuration time.Duration
+	replica       string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduleService creates a new schedule service and starts its scheduler
+func NewScheduleService(cfg *config.Config, store stores.ScheduleStore, functions *FunctionService, iamStore stores.IAMStore, lambda LambdaExecutor, compute ComputeController) *ScheduleService {
+	interval := DefaultSchedulerInterval
+	if cfg.SchedulerInterval > 0 {
+		interval = cfg.SchedulerInterval
+	}
+	// a replica keeps the lease through a few missed renewals
+	leaseDuration := 3 * interval
+	if cfg.SchedulerLeaseDuration > interval {
+		leaseDuration = cfg.SchedulerLeaseDuration
+	}
+	hostname, _ := os.Hostname()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &ScheduleService{
+		store:            store,
+		functions:        functions,
+		iamStore:         iamStore,
+		lambda:           lambda,
+		compute:          compute,
+		config:           cfg,
+		MisfireThreshold: DefaultScheduleMisfireThreshold,
+		MaxCatchUp:       DefaultScheduleMaxCatchUp,
+		RunHistory:       DefaultScheduleRunHistory,
+		interval:         interval,
+		leaseDuration:    leaseDuration,
+		replica:          hostname + "-" + uuid.New().String()[:8],
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+
+	s.wg.Add(1)
+	go s.schedule()
+
+	return s
+}
+
+// Close stops the scheduler and waits for the runs in progress, then gives up the lease to
+// the other replicas
+func (s *ScheduleService) Close() {
+	s.cancel()
+	s.wg.Wait()
+
+	if err := s.store.ReleaseLease(schedulerLeaseName, s.replica); err != nil {
+		log.Printf("Failed to release the scheduler lease: %v", err)
+	}
+}
+
+// CreateSchedule creates a schedule of an organization, running on behalf of an account
+func (s *ScheduleService) CreateSchedule(orgID, accountID uuid.UUID, req models.CreateScheduleRequest) (*models.Schedule, error) {
+	if !functionNameRegex.MatchString(req.Name) {
+		return nil, errors.ErrBadRequest.WithDetails("Schedule name can only contain up to 64 alphanumeric characters, hyphens, and underscores")
+	}
+
+	schedule := &models.Schedule{
+		Name:           req.Name,
+		OrganizationID: orgID,
+		AccountID:      accountID,
+		Description:    req.Description,
+		Expression:     req.Expression,
+		Timezone:       req.Timezone,
+		JitterSeconds:  req.JitterSeconds,
+		CatchUp:        req.CatchUp,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		Target:         req.Target,
+	}
+	if err := s.prepare(schedule); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.CreateSchedule(schedule); err != nil {
+		return nil, scheduleError(err)
+	}
+
+	return schedule, nil
+}
+
+// UpdateSchedule replaces the settings of a schedule, its next occurrence is computed again
+func (s *ScheduleService) UpdateSchedule(orgID uuid.UUID, name string, req models.UpdateScheduleRequest) (*models.Schedule, error) {
+	schedule, err := s.store.GetSchedule(orgID, name)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+
+	if req.Description != "" {
+		schedule.Description = req.Description
+	}
+	schedule.Expression = req.Expression
+	schedule.Timezone = req.Timezone
+	schedule.JitterSeconds = req.JitterSeconds
+	schedule.CatchUp = req.CatchUp
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	schedule.Target = req.Target
+	if err := s.prepare(schedule); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.UpdateSchedule(schedule); err != nil {
+		return nil, scheduleError(err)
+	}
+
+	return schedule, nil
+}
+
+// ContainerReplaced points the schedules starting and stopping a container at the container
+// recreated in its place
+func (s *ScheduleService) ContainerReplaced(oldID, newID string) {
+	if err := s.store.RetargetContainer(oldID, newID); err != nil {
+		log.Printf("Failed to retarget the schedules of container %s: %v", oldID, err)
+	}
+}
+
+// GetSchedule retrieves a schedule of an organization
+func (s *ScheduleService) GetSchedule(orgID uuid.UUID, name string) (*models.Schedule, error) {
+	schedule, err := s.store.GetSchedule(orgID, name)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+	return schedule, nil
+}
+
+// ListSchedules retrieves the schedules of an organization
+func (s *ScheduleService) ListSchedules(orgID uuid.UUID) ([]models.Schedule, error) {
+	schedules, err := s.store.ListSchedules(orgID)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule deletes a schedule with its run history, the runs in progress aren't stopped
+func (s *ScheduleService) DeleteSchedule(orgID uuid.UUID, name string) error {
+	schedule, err := s.store.GetSchedule(orgID, name)
+	if err != nil {
+		return scheduleError(err)
+	}
+	return scheduleError(s.store.DeleteSchedule(schedule.ID))
+}
+
+// ListRuns retrieves the most recent runs of a schedule, up to limit
+func (s *ScheduleService) ListRuns(orgID uuid.UUID, name string, limit int) ([]models.ScheduleRun, error) {
+	schedule, err := s.store.GetSchedule(orgID, name)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+	if limit <= 0 || limit > s.RunHistory {
+		limit = s.RunHistory
+	}
+
+	runs, err := s.store.ListRuns(schedule.ID, limit)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+	return runs, nil
+}
+
+// RunSchedule runs the target of a schedule now in the background, even when it's disabled,
+// without changing its next occurrence
+func (s *ScheduleService) RunSchedule(orgID uuid.UUID, name string) (*models.ScheduleRun, error) {
+	schedule, err := s.store.GetSchedule(orgID, name)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+
+	run, err := s.startRun(*schedule, time.Now(), models.ScheduleRunManual)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+
+	copied := *run
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(*schedule, run)
+	}()
+
+	return &copied, nil
+}
+
+// prepare validates the settings of a schedule and computes its next occurrence
+func (s *ScheduleService) prepare(schedule *models.Schedule) error {
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	expression, err := parseScheduleExpression(schedule.Expression, schedule.Timezone)
+	if err != nil {
+		return err
+	}
+
+	target := schedule.Target
+	switch target.Type {
+	case models.ScheduleTargetFunction:
+		if _, _, err := s.functions.Resolve(schedule.OrganizationID, target.Function, target.Qualifier); err != nil {
+			return err
+		}
+	case models.ScheduleTargetCompute:
+		if target.ContainerID == "" {
+			return errors.ErrBadRequest.WithDetails("The container of a compute target is required")
+		}
+		if target.Action != models.ScheduleComputeStart && target.Action != models.ScheduleComputeStop {
+			return errors.ErrBadRequest.WithDetails("The action of a compute target must be start or stop")
+		}
+		// the runs start and stop the container on behalf of the account of the schedule
+		if err := s.compute.CheckContainer(schedule.AccountID, target.ContainerID); err != nil {
+			return err
+		}
+	default:
+		return errors.ErrBadRequest.WithDetails("The target of a schedule must be a function or compute")
+	}
+
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		schedule.NextRunAt = nextOccurrence(expression, time.Now())
+	}
+	return nil
+}
+
+// schedule looks for the due schedules until the service is closed
+func (s *ScheduleService) schedule() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.tick(now)
+		}
+	}
+}
+
+// tick runs the occurrences due, when this replica holds the scheduler lease
+func (s *ScheduleService) tick(now time.Time) {
+	leader, err := s.store.AcquireLease(schedulerLeaseName, s.replica, now, s.leaseDuration)
+	if err != nil {
+		log.Printf("Failed to acquire the scheduler lease: %v", err)
+		return
+	}
+	if !leader {
+		return
+	}
+
+	schedules, err := s.store.ListDueSchedules(now)
+	if err != nil {
+		log.Printf("Failed to list the due schedules: %v", err)
+		return
+	}
+	for _, schedule := range schedules {
+		s.dispatch(schedule, now)
+	}
+}
+
+// dispatch claims the occurrences of a schedule due by now and runs them. The occurrences
+// missed by more than the misfire threshold are caught up when the schedule asks for it, and
+// skipped otherwise.
+func (s *ScheduleService) dispatch(schedule models.Schedule, now time.Time) {
+	due := *schedule.NextRunAt
+	if now.Before(due.Add(scheduleJitter(schedule, due))) {
+		return
+	}
+
+	expression, err := parseScheduleExpression(schedule.Expression, schedule.Timezone)
+	if err != nil {
+		log.Printf("Failed to parse the expression of schedule %s: %v", schedule.ID, err)
+		return
+	}
+
+	occurrences := []time.Time{due}
+	next := nextOccurrence(expression, due)
+	for next != nil && !now.Before(next.Add(scheduleJitter(schedule, *next))) {
+		if len(occurrences) == scheduleMaxScan {
+			next = nextOccurrence(expression, now)
+			break
+		}
+		occurrences = append(occurrences, *next)
+		next = nextOccurrence(expression, *next)
+	}
+
+	claimed, err := s.store.ClaimOccurrence(schedule.ID, due, next, now)
+	if err != nil {
+		log.Printf("Failed to claim an occurrence of schedule %s: %v", schedule.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	var onTime, missed []time.Time
+	for _, occurrence := range occurrences {
+		if now.Sub(occurrence.Add(scheduleJitter(schedule, occurrence))) > s.MisfireThreshold {
+			missed = append(missed, occurrence)
+		} else {
+			onTime = append(onTime, occurrence)
+		}
+	}
+
+	var catchUp, skipped []time.Time
+	if schedule.CatchUp {
+		from := max(0, len(missed)-s.MaxCatchUp)
+		catchUp, skipped = missed[from:], missed[:from]
+	} else {
+		skipped = missed
+	}
+	if len(skipped) > 0 {
+		s.skip(schedule, skipped, now)
+	}
+
+	var runs []*models.ScheduleRun
+	for _, occurrence := range catchUp {
+		if run, err := s.startRun(schedule, occurrence, models.ScheduleRunCatchUp); err == nil {
+			runs = append(runs, run)
+		}
+	}
+	for _, occurrence := range onTime {
+		if run, err := s.startRun(schedule, occurrence, models.ScheduleRunOnTime); err == nil {
+			runs = append(runs, run)
+		}
+	}
+
+	if len(runs) == 0 {
+		return
+	}
+
+	// the occurrences of a schedule run one after the other
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for _, run := range runs {
+			s.execute(schedule, run)
+		}
+	}()
+}
+
+// skip records the occurrences of a schedule that were missed and won't run
+func (s *ScheduleService) skip(schedule models.Schedule, occurrences []time.Time, now time.Time) {
+	first, last := occurrences[0], occurrences[len(occurrences)-1]
+	reason := fmt.Sprintf("%d occurrences missed from %s to %s", len(occurrences),
+		first.Format(time.RFC3339), last.Format(time.RFC3339))
+	if len(occurrences) == 1 {
+		reason = "occurrence missed"
+	}
+
+	run := &models.ScheduleRun{
+		ScheduleID:  schedule.ID,
+		ScheduledAt: first,
+		Trigger:     models.ScheduleRunOnTime,
+		Status:      models.ScheduleRunSkipped,
+		Replica:     s.replica,
+		StartedAt:   now,
+		FinishedAt:  &now,
+		Error:       reason,
+	}
+	if err := s.store.CreateRun(run); err != nil {
+		log.Printf("Failed to record the missed occurrences of schedule %s: %v", schedule.ID, err)
+	}
+}
+
+// startRun records a run of a schedule starting
+func (s *ScheduleService) startRun(schedule models.Schedule, occurrence time.Time, trigger models.ScheduleRunTrigger) (*models.ScheduleRun, error) {
+	run := &models.ScheduleRun{
+		ScheduleID:  schedule.ID,
+		ScheduledAt: occurrence,
+		Trigger:     trigger,
+		Status:      models.ScheduleRunRunning,
+		Replica:     s.replica,
+		StartedAt:   time.Now(),
+	}
+	if err := s.store.CreateRun(run); err != nil {
+		log.Printf("Failed to record a run of schedule %s: %v", schedule.ID, err)
+		return nil, err
+	}
+	return run, nil
+}
+
+// execute runs the target of a schedule and records the result of the run
+func (s *ScheduleService) execute(schedule models.Schedule, run *models.ScheduleRun) {
+	output, err := s.runTarget(schedule)
+
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = models.ScheduleRunSucceeded
+	if len(output) > scheduleOutputLimit {
+		output = output[:scheduleOutputLimit]
+	}
+	run.Output = output
+	if err != nil {
+		run.Status = models.ScheduleRunFailed
+		run.Error = describeError(err)
+	}
+
+	if err := s.store.UpdateRun(run); err != nil {
+		log.Printf("Failed to save a run of schedule %s: %v", schedule.ID, err)
+	}
+	if err := s.store.PruneRuns(schedule.ID, s.RunHistory); err != nil {
+		log.Printf("Failed to prune the runs of schedule %s: %v", schedule.ID, err)
+	}
+}
+
+// runTarget invokes the function of a schedule, returning its standard output, or starts or
+// stops its container
+func (s *ScheduleService) runTarget(schedule models.Schedule) (string, error) {
+	account, err := s.iamStore.GetAccountByID(schedule.AccountID.String())
+	if err != nil {
+		return "", stderrors.New("the account owning the schedule no longer exists")
+	}
+
+	target := schedule.Target
+	switch target.Type {
+	case models.ScheduleTargetCompute:
+		if s.compute == nil {
+			return "", stderrors.New("compute is unavailable")
+		}
+		if target.Action == models.ScheduleComputeStop {
+			return "", s.compute.StopContainer(account.ID, target.ContainerID)
+		}
+		return "", s.compute.StartContainer(account.ID, target.ContainerID)
+
+	case models.ScheduleTargetFunction:
+		orgID := schedule.OrganizationID
+		function, version, err := s.functions.Resolve(orgID, target.Function, target.Qualifier)
+		if err != nil {
+			return "", err
+		}
+		execute, err := s.functions.ExecuteRequest(orgID, version, models.InvokeFunctionRequest{StandardInput: string(target.Input)})
+		if err != nil {
+			return "", err
+		}
+		limits, err := s.functions.ConcurrencyLimits(function)
+		if err != nil {
+			return "", err
+		}
+		// the Lambda API only gets a token running functions, valid through the retries of the
+		// invocation and its wait for capacity
+		lifetime := s.config.LambdaConcurrencyWait + time.Duration(s.config.LambdaMaxRetries+1)*s.config.LambdaTimeout + time.Minute
+		token, err := auth.GenerateInvocationToken(account.ID.String(), lifetime, s.config)
+		if err != nil {
+			return "", err
+		}
+
+		resp, err := s.lambda.ExecuteFunction(s.ctx, "Bearer "+token, limits, execute)
+		switch {
+		case err != nil:
+			return "", err
+		case resp.TimedOut:
+			return resp.Stdout, fmt.Errorf("function %s ran out of time", target.Function)
+		case resp.Status != models.LambdaTaskSuccessful:
+			cause := fmt.Sprintf("function %s exited with code %d", target.Function, resp.ExitCode)
+			if stderr := strings.TrimSpace(resp.Stderr); stderr != "" {
+				cause += ": " + stderr
+			}
+			return resp.Stdout, stderrors.New(cause)
+		}
+		return resp.Stdout, nil
+	}
+
+	return "", fmt.Errorf("unknown target type %q", target.Type)
+}
+
+// parseScheduleExpression parses a rate expression like rate(5 minutes), or a cron expression
+// with five fields, optionally written cron(...), or a descriptor like @daily. The cron
+// expressions are evaluated in the time zone.
+func parseScheduleExpression(expression, timezone string) (cron.Schedule, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.ErrBadRequest.WithDetails("Unknown time zone " + timezone)
+	}
+
+	expression = strings.TrimSpace(expression)
+	if match := scheduleRateRegex.FindStringSubmatch(expression); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 {
+			return nil, errors.ErrBadRequest.WithDetails("The rate of a schedule must be a positive number")
+		}
+		return cron.Every(time.Duration(n) * scheduleRateUnits[match[2]]), nil
+	}
+
+	if strings.HasPrefix(expression, "cron(") && strings.HasSuffix(expression, ")") {
+		expression = strings.TrimSpace(expression[len("cron(") : len(expression)-1])
+	}
+	if strings.Contains(expression, "TZ=") {
+		return nil, errors.ErrBadRequest.WithDetails("Set the time zone of the schedule instead of the expression")
+	}
+
+	schedule, err := scheduleParser.Parse(expression)
+	if err != nil {
+		return nil, errors.ErrBadRequest.WithDetails("Invalid schedule expression: " + err.Error())
+	}
+	if spec, ok := schedule.(*cron.SpecSchedule); ok {
+		spec.Location = location
+	}
+	return schedule, nil
+}
+
+// nextOccurrence returns the occurrence of an expression after a time, nil when there is none.
+// The occurrences are in UTC, the way they are compared in the database.
+func nextOccurrence(expression cron.Schedule, after time.Time) *time.Time {
+	next := expression.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// scheduleJitter returns the delay of an occurrence of a schedule, picked at random up to its
+// jitter but the same for every replica
+func scheduleJitter(schedule models.Schedule, occurrence time.Time) time.Duration {
+	if schedule.JitterSeconds <= 0 {
+		return 0
+	}
+
+	hash := fnv.New64a()
+	hash.Write(schedule.ID[:])
+	_ = binary.Write(hash, binary.BigEndian, occurrence.Unix())
+	return time.Duration(hash.Sum64()%uint64(schedule.JitterSeconds+1)) * time.Second
+}
+
+// describeError returns the message of an error with its details
+func describeError(err error) string {
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) && appErr.Details != "" {
+		return appErr.Message + ": " + appErr.Details
+	}
+	return err.Error()
+}
+
+// scheduleError maps the errors of the schedule store to application errors
+func scheduleError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case stderrors.Is(err, models.ErrScheduleNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Schedule not found")
+	case stderrors.Is(err, models.ErrScheduleExists):
+		return errors.ErrConflict.WithDetails("A schedule with this name already exists")
+	default:
+		return errors.ErrInternalError.WithDetails(err.Error())
+	}
+}
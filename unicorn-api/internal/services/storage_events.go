@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"unicorn-api/internal/auth"
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/stores"
+
+	"github.com/google/uuid"
+)
+
+// LambdaExecutor runs the invocations of functions on the Lambda API on behalf of the holder of
+// the authorization, once their concurrency limits admit them
+type LambdaExecutor interface {
+	ExecuteFunction(ctx context.Context, authorization string, limits ConcurrencyLimits, req models.LambdaExecuteRequest) (*models.LambdaExecuteResponse, error)
+}
+
+const (
+	storageEventQueueSize = 1024
+	storageEventWorkers   = 4
+
+	// how often a replica renews the lease of its deliveries and looks for the deliveries to take
+	// over, a lease outlives a few missed renewals
+	storageEventLeaseInterval = 10 * time.Second
+	storageEventLeaseDuration = 3 * storageEventLeaseInterval
+)
+
+// StorageEventService invokes the functions of the bucket notifications matching the
+// changes of the files, in the background and with retries. The pending deliveries are leased
+// by the replica running them: the deliveries released on shutdown or left by a replica that
+// stopped renewing its lease are taken over and resumed.
+type StorageEventService struct {
+	store     stores.StorageEventStore
+	functions *FunctionService
+	iamStore  stores.IAMStore
+	lambda    LambdaExecutor
+	config    *config.Config
+
+	// MaxAttempts is the number of invocations tried for an event before it is failed
+	MaxAttempts int
+	// RetryDelay is the wait before the second attempt, doubled after each failure
+	RetryDelay time.Duration
+
+	replica string
+	queue   chan *storageEventJob
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type storageEventJob struct {
+	notification models.BucketNotification
+	delivery     *models.StorageEventDelivery
+}
+
+// NewStorageEventService creates a new storage event service and starts its workers, the pending
+// deliveries nobody holds are resumed
+func NewStorageEventService(cfg *config.Config, store stores.StorageEventStore, functions *FunctionService, iamStore stores.IAMStore, lambda LambdaExecutor) *StorageEventService {
+	hostname, _ := os.Hostname()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &StorageEventService{
+		store:       store,
+		functions:   functions,
+		iamStore:    iamStore,
+		lambda:      lambda,
+		config:      cfg,
+		MaxAttempts: 3,
+		RetryDelay:  time.Second,
+		replica:     hostname + "-" + uuid.New().String()[:8],
+		queue:       make(chan *storageEventJob, storageEventQueueSize),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	for i := 0; i < storageEventWorkers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	s.wg.Add(1)
+	go s.lease()
+
+	return s
+}
+
+// Close stops the workers, then releases the deliveries left pending for the next replica or
+// the next start to resume them at once
+func (s *StorageEventService) Close() {
+	s.cancel()
+	s.wg.Wait()
+
+	if err := s.store.ReleaseDeliveries(s.replica); err != nil {
+		log.Printf("Failed to release the pending storage event deliveries: %v", err)
+	}
+}
+
+// CreateNotification adds a notification to a bucket, the function must exist in the
+// organization of the account, which the function will run on behalf of
+func (s *StorageEventService) CreateNotification(bucketID uuid.UUID, account *models.Account, req models.CreateBucketNotificationRequest) (*models.BucketNotification, error) {
+	if _, _, err := s.functions.Resolve(account.OrganizationID, req.FunctionName, req.Qualifier); err != nil {
+		return nil, err
+	}
+
+	notification := &models.BucketNotification{
+		BucketID:       bucketID,
+		OrganizationID: account.OrganizationID,
+		AccountID:      account.ID,
+		Events:         req.Events,
+		Prefix:         req.Prefix,
+		Suffix:         req.Suffix,
+		FunctionName:   req.FunctionName,
+		Qualifier:      req.Qualifier,
+	}
+	if err := s.store.CreateNotification(notification); err != nil {
+		return nil, errors.ErrInternalError.WithDetails(err.Error())
+	}
+
+	return notification, nil
+}
+
+// ListNotifications retrieves the notifications of a bucket
+func (s *StorageEventService) ListNotifications(bucketID uuid.UUID) ([]models.BucketNotification, error) {
+	notifications, err := s.store.ListNotifications(bucketID)
+	if err != nil {
+		return nil, errors.ErrInternalError.WithDetails(err.Error())
+	}
+	return notifications, nil
+}
+
+// DeleteNotification deletes a notification of a bucket
+func (s *StorageEventService) DeleteNotification(bucketID, notificationID uuid.UUID) error {
+	err := s.store.DeleteNotification(bucketID, notificationID)
+	switch {
+	case err == nil:
+		return nil
+	case stderrors.Is(err, models.ErrBucketNotificationNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Bucket notification not found")
+	default:
+		return errors.ErrInternalError.WithDetails(err.Error())
+	}
+}
+
+// ListDeliveries retrieves the deliveries of the events of a bucket, optionally by status
+func (s *StorageEventService) ListDeliveries(bucketID uuid.UUID, status models.StorageEventDeliveryStatus) ([]models.StorageEventDelivery, error) {
+	deliveries, err := s.store.ListDeliveries(bucketID, status)
+	if err != nil {
+		return nil, errors.ErrInternalError.WithDetails(err.Error())
+	}
+	return deliveries, nil
+}
+
+// Publish records a delivery for each notification matching the event and queues them.
+// It never blocks the storage operation: the deliveries not fitting in the queue are failed.
+func (s *StorageEventService) Publish(event models.StorageEvent) {
+	notifications, err := s.store.ListNotifications(event.BucketID)
+	if err != nil {
+		log.Printf("Failed to list the notifications of bucket %s: %v", event.BucketID, err)
+		return
+	}
+
+	for _, notification := range notifications {
+		if !notification.Matches(event) {
+			continue
+		}
+
+		delivery := &models.StorageEventDelivery{
+			NotificationID: notification.ID,
+			BucketID:       event.BucketID,
+			Event:          event,
+			Status:         models.StorageEventDeliveryPending,
+			Holder:         s.replica,
+			LeaseExpiresAt: time.Now().Add(storageEventLeaseDuration).UTC(),
+		}
+		if err := s.store.CreateDelivery(delivery); err != nil {
+			log.Printf("Failed to record the delivery of %s to function %s: %v", event.Type, notification.FunctionName, err)
+			continue
+		}
+
+		select {
+		case s.queue <- &storageEventJob{notification: notification, delivery: delivery}:
+		default:
+			delivery.Status = models.StorageEventDeliveryFailed
+			delivery.LastError = "event queue is full"
+			s.saveDelivery(delivery)
+		}
+	}
+}
+
+func (s *StorageEventService) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case job := <-s.queue:
+			s.deliver(job)
+		}
+	}
+}
+
+// lease renews the lease of the deliveries of the replica and resumes the ones nobody holds
+func (s *StorageEventService) lease() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(storageEventLeaseInterval)
+	defer ticker.Stop()
+
+	s.resume()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.store.RenewDeliveries(s.replica, time.Now(), storageEventLeaseDuration); err != nil {
+				log.Printf("Failed to renew the storage event deliveries: %v", err)
+			}
+			s.resume()
+		}
+	}
+}
+
+// resume claims the pending deliveries released or left by a replica that stopped, as many as
+// the queue has room for
+func (s *StorageEventService) resume() {
+	room := cap(s.queue) - len(s.queue)
+	if room == 0 {
+		return
+	}
+
+	deliveries, err := s.store.ClaimDeliveries(s.replica, time.Now(), storageEventLeaseDuration, room)
+	if err != nil {
+		log.Printf("Failed to claim the pending storage event deliveries: %v", err)
+	}
+
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		notification, err := s.store.GetNotification(delivery.NotificationID)
+		if err != nil {
+			delivery.Status = models.StorageEventDeliveryFailed
+			delivery.LastError = "the notification of the delivery no longer exists"
+			s.saveDelivery(delivery)
+			continue
+		}
+
+		log.Printf("Resuming delivery %s of %s to function %s", delivery.ID, delivery.Event.Type, notification.FunctionName)
+		select {
+		case s.queue <- &storageEventJob{notification: *notification, delivery: delivery}:
+		case <-s.ctx.Done():
+			// shutting down, the claimed deliveries are released with the others
+			return
+		}
+	}
+}
+
+// deliver invokes the function of a notification until it succeeds or runs out of attempts
+func (s *StorageEventService) deliver(job *storageEventJob) {
+	delivery := job.delivery
+	delay := s.RetryDelay
+
+	for delivery.Attempts < s.MaxAttempts {
+		if delivery.Attempts > 0 {
+			select {
+			case <-s.ctx.Done():
+				// shutting down, the delivery stays pending with the attempts so far
+				s.saveDelivery(delivery)
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		delivery.Attempts++
+		err := s.invoke(job.notification, delivery.Event)
+		if err == nil {
+			delivery.Status = models.StorageEventDeliverySucceeded
+			delivery.LastError = ""
+			s.saveDelivery(delivery)
+			return
+		}
+
+		delivery.LastError = err.Error()
+		log.Printf("Delivery %s of %s to function %s failed (attempt %d/%d): %v",
+			delivery.ID, delivery.Event.Type, job.notification.FunctionName, delivery.Attempts, s.MaxAttempts, err)
+	}
+
+	delivery.Status = models.StorageEventDeliveryFailed
+	s.saveDelivery(delivery)
+}
+
+// invoke runs the function of a notification with the event on its standard input
+func (s *StorageEventService) invoke(notification models.BucketNotification, event models.StorageEvent) error {
+	function, version, err := s.functions.Resolve(notification.OrganizationID, notification.FunctionName, notification.Qualifier)
+	if err != nil {
+		return err
+	}
+	limits, err := s.functions.ConcurrencyLimits(function)
+	if err != nil {
+		return err
+	}
+
+	account, err := s.iamStore.GetAccountByID(notification.AccountID.String())
+	if err != nil {
+		return fmt.Errorf("the account of the notification no longer exists")
+	}
+	// the Lambda API only gets a token running functions, valid through the retries of the
+	// invocation and its wait for capacity
+	lifetime := s.config.LambdaConcurrencyWait + time.Duration(s.config.LambdaMaxRetries+1)*s.config.LambdaTimeout + time.Minute
+	token, err := auth.GenerateInvocationToken(account.ID.String(), lifetime, s.config)
+	if err != nil {
+		return err
+	}
+
+	input, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// nobody waits for the events, they make way for the interactive invocations
+	execute, err := s.functions.ExecuteRequest(notification.OrganizationID, version, models.InvokeFunctionRequest{
+		StandardInput: string(input),
+		Priority:      "low",
+	})
+	if err != nil {
+		return err
+	}
+
+	// a throttled event is retried like a failed invocation
+	resp, err := s.lambda.ExecuteFunction(s.ctx, "Bearer "+token, limits, execute)
+	if err != nil {
+		return err
+	}
+	if resp.Status != models.LambdaTaskSuccessful {
+		return fmt.Errorf("function execution %s with exit code %d", resp.Status, resp.ExitCode)
+	}
+	return nil
+}
+
+func (s *StorageEventService) saveDelivery(delivery *models.StorageEventDelivery) {
+	if err := s.store.UpdateDelivery(delivery); err != nil {
+		log.Printf("Failed to save delivery %s: %v", delivery.ID, err)
+	}
+}
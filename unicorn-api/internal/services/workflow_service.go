@@ -0,0 +1,945 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"unicorn-api/internal/auth"
+	"unicorn-api/internal/common/errors"
+	"unicorn-api/internal/config"
+	"unicorn-api/internal/models"
+	"unicorn-api/internal/stores"
+
+	"github.com/google/uuid"
+)
+
+// DefaultWorkflowMaxTransitions bounds the states an execution goes through, ending the loops
+const DefaultWorkflowMaxTransitions = 1000
+
+const (
+	// how often a replica renews the lease of its executions and ends the ones of the replicas
+	// that stopped, a lease outlives a few missed renewals
+	workflowLeaseInterval = 10 * time.Second
+	workflowLeaseDuration = 3 * workflowLeaseInterval
+
+	// how often a replica looks for the cancellations of its executions asked to the others, and
+	// how long those wait for the execution to end
+	workflowCancelInterval = time.Second
+	workflowCancelWait     = 5 * time.Second
+
+	// the waits and retry backoffs are only timers of the replica running the execution, they
+	// are kept short enough for the executions to rarely span a restart of the API
+	workflowMaxWait = 5 * time.Minute
+)
+
+// WorkflowService runs the state machines of the workflows in the background, invoking the
+// functions of their task states on behalf of the accounts starting them. The running
+// executions are leased by the replica running them: the executions released on shutdown or
+// left by a replica that stopped renewing its lease can't be resumed, another replica fails them.
+// Only the history of an execution is stored, not its current state, so its waits are bounded
+// by workflowMaxWait.
+type WorkflowService struct {
+	store     stores.WorkflowStore
+	functions *FunctionService
+	iamStore  stores.IAMStore
+	lambda    LambdaExecutor
+	config    *config.Config
+
+	// MaxTransitions is the number of states an execution can go through
+	MaxTransitions int
+
+	replica string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*runningExecution
+}
+
+type runningExecution struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWorkflowService creates a new workflow service. The executions nobody holds anymore are
+// ended, the ones running on the other replicas are left to them.
+func NewWorkflowService(cfg *config.Config, store stores.WorkflowStore, functions *FunctionService, iamStore stores.IAMStore, lambda LambdaExecutor) *WorkflowService {
+	hostname, _ := os.Hostname()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WorkflowService{
+		store:          store,
+		functions:      functions,
+		iamStore:       iamStore,
+		lambda:         lambda,
+		config:         cfg,
+		MaxTransitions: DefaultWorkflowMaxTransitions,
+		replica:        hostname + "-" + uuid.New().String()[:8],
+		ctx:            ctx,
+		cancel:         cancel,
+		running:        make(map[uuid.UUID]*runningExecution),
+	}
+
+	s.takeOver()
+
+	s.wg.Add(1)
+	go s.lease()
+
+	return s
+}
+
+// Close stops the running executions, then releases them for the other replicas or the next
+// start to fail them at once
+func (s *WorkflowService) Close() {
+	s.cancel()
+	s.wg.Wait()
+
+	if err := s.store.ReleaseExecutions(s.replica); err != nil {
+		log.Printf("Failed to release the running workflow executions: %v", err)
+	}
+}
+
+// CreateWorkflow creates a workflow of an organization, the functions of its tasks must exist
+func (s *WorkflowService) CreateWorkflow(orgID uuid.UUID, req models.CreateWorkflowRequest) (*models.Workflow, error) {
+	if !functionNameRegex.MatchString(req.Name) {
+		return nil, errors.ErrBadRequest.WithDetails("Workflow name can only contain up to 64 alphanumeric characters, hyphens, and underscores")
+	}
+	if err := s.validateDefinition(orgID, req.Definition, ""); err != nil {
+		return nil, err
+	}
+
+	workflow := &models.Workflow{
+		Name:           req.Name,
+		OrganizationID: orgID,
+		Description:    req.Description,
+		Definition:     req.Definition,
+	}
+	if err := s.store.CreateWorkflow(workflow); err != nil {
+		return nil, workflowError(err)
+	}
+
+	return workflow, nil
+}
+
+// UpdateWorkflow replaces the definition of a workflow
+func (s *WorkflowService) UpdateWorkflow(orgID uuid.UUID, name string, req models.UpdateWorkflowRequest) (*models.Workflow, error) {
+	workflow, err := s.store.GetWorkflow(orgID, name)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+	if err := s.validateDefinition(orgID, req.Definition, ""); err != nil {
+		return nil, err
+	}
+
+	workflow.Definition = req.Definition
+	if req.Description != "" {
+		workflow.Description = req.Description
+	}
+	if err := s.store.UpdateWorkflow(workflow); err != nil {
+		return nil, workflowError(err)
+	}
+
+	return workflow, nil
+}
+
+// GetWorkflow retrieves a workflow of an organization
+func (s *WorkflowService) GetWorkflow(orgID uuid.UUID, name string) (*models.Workflow, error) {
+	workflow, err := s.store.GetWorkflow(orgID, name)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+	return workflow, nil
+}
+
+// ListWorkflows retrieves the workflows of an organization
+func (s *WorkflowService) ListWorkflows(orgID uuid.UUID) ([]models.Workflow, error) {
+	workflows, err := s.store.ListWorkflows(orgID)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+	return workflows, nil
+}
+
+// DeleteWorkflow deletes a workflow with its executions, once none is running
+func (s *WorkflowService) DeleteWorkflow(orgID uuid.UUID, name string) error {
+	workflow, err := s.store.GetWorkflow(orgID, name)
+	if err != nil {
+		return workflowError(err)
+	}
+
+	running, err := s.store.ListExecutions(workflow.ID, models.WorkflowExecutionRunning)
+	if err != nil {
+		return workflowError(err)
+	}
+	if len(running) > 0 {
+		return errors.ErrConflict.WithDetails("The workflow has running executions, cancel them first")
+	}
+
+	return workflowError(s.store.DeleteWorkflow(workflow.ID))
+}
+
+// StartExecution starts an execution of a workflow on behalf of an account, it runs in the background
+func (s *WorkflowService) StartExecution(orgID, accountID uuid.UUID, name string, req models.StartWorkflowExecutionRequest) (*models.WorkflowExecution, error) {
+	workflow, err := s.store.GetWorkflow(orgID, name)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+
+	input := json.RawMessage(bytes.TrimSpace(req.Input))
+	if len(input) == 0 {
+		input = json.RawMessage("null")
+	}
+	if !json.Valid(input) {
+		return nil, errors.ErrBadRequest.WithDetails("The input must be a JSON value")
+	}
+
+	execution := &models.WorkflowExecution{
+		WorkflowID:     workflow.ID,
+		OrganizationID: orgID,
+		AccountID:      accountID,
+		Definition:     workflow.Definition,
+		Status:         models.WorkflowExecutionRunning,
+		Input:          input,
+		Holder:         s.replica,
+		LeaseExpiresAt: time.Now().Add(workflowLeaseDuration).UTC(),
+	}
+	if err := s.store.CreateExecution(execution); err != nil {
+		return nil, workflowError(err)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	running := &runningExecution{cancel: cancel, done: make(chan struct{})}
+	s.mu.Lock()
+	s.running[execution.ID] = running
+	s.mu.Unlock()
+
+	run := &workflowRun{service: s, execution: *execution}
+	run.record(models.WorkflowEventExecutionStarted, "", string(input))
+
+	s.wg.Add(1)
+	go s.execute(ctx, run, running)
+
+	return execution, nil
+}
+
+// DescribeExecution retrieves an execution of a workflow with its history
+func (s *WorkflowService) DescribeExecution(orgID uuid.UUID, name string, executionID uuid.UUID) (*models.WorkflowExecution, error) {
+	workflow, err := s.store.GetWorkflow(orgID, name)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+
+	execution, err := s.store.GetExecution(executionID)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+	if execution.WorkflowID != workflow.ID {
+		return nil, workflowError(models.ErrWorkflowExecutionNotFound)
+	}
+	return execution, nil
+}
+
+// ListExecutions retrieves the executions of a workflow, optionally by status
+func (s *WorkflowService) ListExecutions(orgID uuid.UUID, name string, status models.WorkflowExecutionStatus) ([]models.WorkflowExecution, error) {
+	workflow, err := s.store.GetWorkflow(orgID, name)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+
+	executions, err := s.store.ListExecutions(workflow.ID, status)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+	return executions, nil
+}
+
+// CancelExecution stops a running execution, the state running is interrupted. The replica
+// running the execution is asked to cancel it, it's waited for a while.
+func (s *WorkflowService) CancelExecution(orgID uuid.UUID, name string, executionID uuid.UUID) (*models.WorkflowExecution, error) {
+	execution, err := s.DescribeExecution(orgID, name, executionID)
+	if err != nil {
+		return nil, err
+	}
+	if execution.Status != models.WorkflowExecutionRunning {
+		return nil, errors.ErrConflict.WithDetails("The execution already ended")
+	}
+
+	s.mu.Lock()
+	running := s.running[executionID]
+	s.mu.Unlock()
+
+	if running != nil {
+		running.cancel()
+		<-running.done
+		return s.DescribeExecution(orgID, name, executionID)
+	}
+
+	// running on another replica, which cancels it once it sees the request, or left by one
+	// that stopped and ended at once
+	if err := s.store.RequestCancellation(executionID); err != nil {
+		return nil, workflowError(err)
+	}
+	s.takeOver()
+	s.awaitEnd(executionID)
+
+	return s.DescribeExecution(orgID, name, executionID)
+}
+
+// awaitEnd waits for an execution running on another replica to end, for a while
+func (s *WorkflowService) awaitEnd(executionID uuid.UUID) {
+	deadline := time.After(workflowCancelWait)
+	ticker := time.NewTicker(workflowCancelInterval / 10)
+	defer ticker.Stop()
+
+	for {
+		execution, err := s.store.GetExecution(executionID)
+		if err != nil || execution.Status != models.WorkflowExecutionRunning {
+			return
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// execute runs an execution to its end and records its result
+func (s *WorkflowService) execute(ctx context.Context, run *workflowRun, running *runningExecution) {
+	defer s.wg.Done()
+	defer close(running.done)
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, run.execution.ID)
+		s.mu.Unlock()
+	}()
+
+	output, err := run.runMachine(ctx, run.execution.Definition, "", run.execution.Input)
+
+	var failure *stateError
+	switch {
+	case err == nil:
+		run.finish(models.WorkflowExecutionSucceeded, output, nil)
+	case s.ctx.Err() != nil:
+		// shutting down, the execution is released for another replica to fail it
+	case ctx.Err() != nil:
+		run.finish(models.WorkflowExecutionCancelled, nil, nil)
+	case stderrors.As(err, &failure):
+		run.finish(models.WorkflowExecutionFailed, nil, failure)
+	default:
+		run.finish(models.WorkflowExecutionFailed, nil, &stateError{Name: models.WorkflowErrorRuntime, Cause: err.Error()})
+	}
+}
+
+// lease renews the lease of the executions of the replica, ends the ones of the replicas that
+// stopped and cancels the executions other replicas were asked to cancel
+func (s *WorkflowService) lease() {
+	defer s.wg.Done()
+
+	renew := time.NewTicker(workflowLeaseInterval)
+	defer renew.Stop()
+	cancellations := time.NewTicker(workflowCancelInterval)
+	defer cancellations.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-renew.C:
+			if err := s.store.RenewExecutions(s.replica, time.Now(), workflowLeaseDuration); err != nil {
+				log.Printf("Failed to renew the workflow executions: %v", err)
+			}
+			s.takeOver()
+		case <-cancellations.C:
+			s.cancelRequested()
+		}
+	}
+}
+
+// takeOver ends the executions released or left by a replica that stopped, they can't be
+// resumed: they are failed, or cancelled when it was asked
+func (s *WorkflowService) takeOver() {
+	executions, err := s.store.ClaimExecutions(s.replica, time.Now(), workflowLeaseDuration)
+	if err != nil {
+		log.Printf("Failed to claim the interrupted workflow executions: %v", err)
+	}
+
+	for _, execution := range executions {
+		run := &workflowRun{service: s, execution: execution}
+		if execution.CancelRequested {
+			run.finish(models.WorkflowExecutionCancelled, nil, nil)
+			continue
+		}
+		run.finish(models.WorkflowExecutionFailed, nil, &stateError{
+			Name:  models.WorkflowErrorRuntime,
+			Cause: "the execution was interrupted by the stop of the API replica running it",
+		})
+	}
+}
+
+// cancelRequested cancels the executions of the replica asked to be cancelled to another one
+func (s *WorkflowService) cancelRequested() {
+	ids, err := s.store.ListCancelRequested(s.replica)
+	if err != nil {
+		log.Printf("Failed to list the workflow executions to cancel: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		s.mu.Lock()
+		running := s.running[id]
+		s.mu.Unlock()
+
+		// the execution ends as cancelled in the background
+		if running != nil {
+			running.cancel()
+		}
+	}
+}
+
+// stateError is an error raised by a state, matched by the retriers and catchers by its name
+type stateError struct {
+	Name  string `json:"error"`
+	Cause string `json:"cause,omitempty"`
+}
+
+func (e *stateError) Error() string {
+	if e.Cause == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Cause
+}
+
+// matches reports whether the error is one of the names of a retrier or catcher
+func (e *stateError) matches(names []string) bool {
+	for _, name := range names {
+		if name == e.Name || name == models.WorkflowErrorAll {
+			return true
+		}
+	}
+	return false
+}
+
+// workflowRun is the execution of a workflow being run
+type workflowRun struct {
+	service     *WorkflowService
+	execution   models.WorkflowExecution
+	transitions atomic.Int32
+}
+
+// runMachine runs a state machine from its first state until one ends it, returning the output
+// of the last state. The states of the branches of parallel states are prefixed by their path.
+func (r *workflowRun) runMachine(ctx context.Context, definition models.WorkflowDefinition, prefix string, input json.RawMessage) (json.RawMessage, error) {
+	name := definition.StartAt
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if int(r.transitions.Add(1)) > r.service.MaxTransitions {
+			return nil, &stateError{
+				Name:  models.WorkflowErrorRuntime,
+				Cause: fmt.Sprintf("the execution went through more than %d states", r.service.MaxTransitions),
+			}
+		}
+
+		state := definition.States[name]
+		path := prefix + name
+		r.record(models.WorkflowEventStateEntered, path, string(input))
+
+		output, next, err := r.runState(ctx, state, path, input)
+		if err != nil {
+			var failure *stateError
+			if ctx.Err() != nil || !stderrors.As(err, &failure) {
+				return nil, err
+			}
+
+			catcher := findCatcher(state.Catch, failure)
+			if catcher == nil {
+				r.record(models.WorkflowEventStateFailed, path, failure.Error())
+				return nil, failure
+			}
+
+			// the error is the input of the state handling it
+			output, _ = json.Marshal(failure)
+			next = catcher.Next
+			r.record(models.WorkflowEventStateCaught, path, failure.Error())
+		} else {
+			r.record(models.WorkflowEventStateExited, path, string(output))
+		}
+
+		if next == "" {
+			return output, nil
+		}
+		name, input = next, output
+	}
+}
+
+// runState runs a state, returning its output and the name of the next state, empty when it
+// ends the state machine
+func (r *workflowRun) runState(ctx context.Context, state models.WorkflowState, path string, input json.RawMessage) (json.RawMessage, string, error) {
+	next := state.Next
+	if state.End {
+		next = ""
+	}
+
+	switch state.Type {
+	case models.WorkflowStateTask:
+		output, err := r.withRetries(ctx, state.Retry, path, func() (json.RawMessage, error) {
+			return r.invoke(ctx, state, input)
+		})
+		return output, next, err
+	case models.WorkflowStateParallel:
+		output, err := r.withRetries(ctx, state.Retry, path, func() (json.RawMessage, error) {
+			return r.runBranches(ctx, state.Branches, path, input)
+		})
+		return output, next, err
+	case models.WorkflowStateChoice:
+		next, err := chooseNext(state, input)
+		return input, next, err
+	case models.WorkflowStateWait:
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(time.Duration(state.Seconds * float64(time.Second))):
+		}
+		return input, next, nil
+	case models.WorkflowStateSucceed:
+		return input, "", nil
+	case models.WorkflowStateFail:
+		return nil, "", &stateError{Name: state.Error, Cause: state.Cause}
+	default:
+		return nil, "", &stateError{Name: models.WorkflowErrorRuntime, Cause: "unknown state type " + string(state.Type)}
+	}
+}
+
+// withRetries runs a state until it succeeds or fails with an error no retrier retries anymore,
+// each retrier counting its own attempts
+func (r *workflowRun) withRetries(ctx context.Context, retriers []models.WorkflowRetrier, path string, attempt func() (json.RawMessage, error)) (json.RawMessage, error) {
+	retries := make([]int, len(retriers))
+	for {
+		output, err := attempt()
+
+		var failure *stateError
+		if err == nil || ctx.Err() != nil || !stderrors.As(err, &failure) {
+			return output, err
+		}
+
+		i := findRetrier(retriers, failure)
+		if i < 0 || retries[i] >= maxRetries(retriers[i]) {
+			return nil, err
+		}
+
+		delay := retryDelay(retriers[i], retries[i])
+		retries[i]++
+		r.record(models.WorkflowEventStateRetried, path, fmt.Sprintf("%s, retry %d in %s", failure.Error(), retries[i], delay))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runBranches runs the branches of a parallel state at once on the same input, the first
+// branch failing stops the others
+func (r *workflowRun) runBranches(ctx context.Context, branches []models.WorkflowDefinition, path string, input json.RawMessage) (json.RawMessage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outputs := make([]json.RawMessage, len(branches))
+	errs := make([]error, len(branches))
+
+	var wg sync.WaitGroup
+	for i, branch := range branches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outputs[i], errs[i] = r.runMachine(ctx, branch, path+"/"+strconv.Itoa(i)+"/", input)
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the failure of a branch rather than the cancellation of the others
+	var cancelled error
+	for _, err := range errs {
+		var failure *stateError
+		if stderrors.As(err, &failure) {
+			return nil, failure
+		}
+		if err != nil {
+			cancelled = err
+		}
+	}
+	if cancelled != nil {
+		return nil, cancelled
+	}
+
+	return json.Marshal(outputs)
+}
+
+// invoke runs the function of a task state with the input on its standard input. Its standard
+// output is the output of the state, as JSON when it is JSON and as a string otherwise.
+func (r *workflowRun) invoke(ctx context.Context, state models.WorkflowState, input json.RawMessage) (json.RawMessage, error) {
+	s := r.service
+	orgID := r.execution.OrganizationID
+
+	function, version, err := s.functions.Resolve(orgID, state.Function, state.Qualifier)
+	if err != nil {
+		return nil, &stateError{Name: models.WorkflowErrorTaskFailed, Cause: err.Error()}
+	}
+	execute, err := s.functions.ExecuteRequest(orgID, version, models.InvokeFunctionRequest{StandardInput: string(input)})
+	if err != nil {
+		return nil, &stateError{Name: models.WorkflowErrorTaskFailed, Cause: err.Error()}
+	}
+	limits, err := s.functions.ConcurrencyLimits(function)
+	if err != nil {
+		return nil, &stateError{Name: models.WorkflowErrorTaskFailed, Cause: err.Error()}
+	}
+
+	account, err := s.iamStore.GetAccountByID(r.execution.AccountID.String())
+	if err != nil {
+		return nil, &stateError{Name: models.WorkflowErrorRuntime, Cause: "the account that started the execution no longer exists"}
+	}
+	// the Lambda API only gets a token running functions, valid through the retries of the
+	// invocation and its wait for capacity
+	lifetime := s.config.LambdaConcurrencyWait + time.Duration(s.config.LambdaMaxRetries+1)*s.config.LambdaTimeout + time.Minute
+	token, err := auth.GenerateInvocationToken(account.ID.String(), lifetime, s.config)
+	if err != nil {
+		return nil, &stateError{Name: models.WorkflowErrorRuntime, Cause: err.Error()}
+	}
+
+	resp, err := s.lambda.ExecuteFunction(ctx, "Bearer "+token, limits, execute)
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case stderrors.Is(err, ErrConcurrencyLimit):
+		return nil, &stateError{Name: models.WorkflowErrorThrottled, Cause: err.Error()}
+	case err != nil:
+		return nil, &stateError{Name: models.WorkflowErrorTaskFailed, Cause: err.Error()}
+	case resp.TimedOut:
+		return nil, &stateError{Name: models.WorkflowErrorTimeout, Cause: "function " + state.Function + " ran out of time"}
+	case resp.Status != models.LambdaTaskSuccessful:
+		cause := fmt.Sprintf("function %s exited with code %d", state.Function, resp.ExitCode)
+		if stderr := strings.TrimSpace(resp.Stderr); stderr != "" {
+			cause += ": " + stderr
+		}
+		return nil, &stateError{Name: models.WorkflowErrorTaskFailed, Cause: cause}
+	}
+
+	stdout := bytes.TrimSpace([]byte(resp.Stdout))
+	if len(stdout) > 0 && json.Valid(stdout) {
+		return json.RawMessage(stdout), nil
+	}
+	return json.Marshal(resp.Stdout)
+}
+
+// record appends an event to the history of the execution
+func (r *workflowRun) record(eventType models.WorkflowEventType, state, details string) {
+	event := &models.WorkflowEvent{
+		ExecutionID: r.execution.ID,
+		Type:        eventType,
+		State:       state,
+		Details:     details,
+	}
+	if err := r.service.store.AddEvent(event); err != nil {
+		log.Printf("Failed to record %s of workflow execution %s: %v", eventType, r.execution.ID, err)
+	}
+}
+
+// finish records the end of the execution
+func (r *workflowRun) finish(status models.WorkflowExecutionStatus, output json.RawMessage, failure *stateError) {
+	execution := &r.execution
+	now := time.Now()
+	execution.Status = status
+	execution.Output = output
+	execution.StoppedAt = &now
+	if failure != nil {
+		execution.Error = failure.Name
+		execution.Cause = failure.Cause
+	}
+
+	// the history is complete once the execution is seen ended
+	switch status {
+	case models.WorkflowExecutionSucceeded:
+		r.record(models.WorkflowEventExecutionSucceeded, "", string(output))
+	case models.WorkflowExecutionFailed:
+		r.record(models.WorkflowEventExecutionFailed, "", failure.Error())
+	case models.WorkflowExecutionCancelled:
+		r.record(models.WorkflowEventExecutionCancelled, "", "")
+	}
+
+	if err := r.service.store.UpdateExecution(execution); err != nil {
+		log.Printf("Failed to save workflow execution %s: %v", execution.ID, err)
+	}
+}
+
+func findRetrier(retriers []models.WorkflowRetrier, failure *stateError) int {
+	for i, retrier := range retriers {
+		if failure.matches(retrier.ErrorEquals) {
+			return i
+		}
+	}
+	return -1
+}
+
+func findCatcher(catchers []models.WorkflowCatcher, failure *stateError) *models.WorkflowCatcher {
+	for i, catcher := range catchers {
+		if failure.matches(catcher.ErrorEquals) {
+			return &catchers[i]
+		}
+	}
+	return nil
+}
+
+func maxRetries(retrier models.WorkflowRetrier) int {
+	if retrier.MaxAttempts == nil {
+		return 3
+	}
+	return *retrier.MaxAttempts
+}
+
+// retryDelay returns the wait before a retry, the interval growing by the backoff rate up to
+// workflowMaxWait
+func retryDelay(retrier models.WorkflowRetrier, retry int) time.Duration {
+	interval, rate := retrier.IntervalSeconds, retrier.BackoffRate
+	if interval == 0 {
+		interval = 1
+	}
+	if rate == 0 {
+		rate = 2
+	}
+	delay := time.Duration(interval * math.Pow(rate, float64(retry)) * float64(time.Second))
+	return min(delay, workflowMaxWait)
+}
+
+// chooseNext returns the next state of the first choice matching the input, or the default one
+func chooseNext(state models.WorkflowState, input json.RawMessage) (string, error) {
+	var document interface{}
+	if err := json.Unmarshal(input, &document); err != nil {
+		return "", &stateError{Name: models.WorkflowErrorRuntime, Cause: "the input of a choice state must be JSON"}
+	}
+
+	for _, choice := range state.Choices {
+		value, found := lookupPath(document, choice.Variable)
+		if choiceMatches(choice, value, found) {
+			return choice.Next, nil
+		}
+	}
+
+	if state.Default == "" {
+		return "", &stateError{Name: models.WorkflowErrorNoChoiceMatched, Cause: "no choice matched the input"}
+	}
+	return state.Default, nil
+}
+
+// choiceMatches reports whether a value satisfies all the comparisons of a choice
+func choiceMatches(choice models.WorkflowChoice, value interface{}, found bool) bool {
+	if choice.IsPresent != nil && found != *choice.IsPresent {
+		return false
+	}
+	if !found {
+		return choice.IsPresent != nil
+	}
+
+	if choice.StringEquals != nil {
+		if s, ok := value.(string); !ok || s != *choice.StringEquals {
+			return false
+		}
+	}
+	if choice.BooleanEquals != nil {
+		if b, ok := value.(bool); !ok || b != *choice.BooleanEquals {
+			return false
+		}
+	}
+
+	if choice.NumericEquals != nil || choice.NumericLessThan != nil || choice.NumericGreaterThan != nil {
+		n, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		if choice.NumericEquals != nil && n != *choice.NumericEquals {
+			return false
+		}
+		if choice.NumericLessThan != nil && n >= *choice.NumericLessThan {
+			return false
+		}
+		if choice.NumericGreaterThan != nil && n <= *choice.NumericGreaterThan {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookupPath returns the value at a path like $.items.0.name of a JSON document
+func lookupPath(document interface{}, path string) (interface{}, bool) {
+	value := document
+	rest := strings.TrimPrefix(path, "$")
+	if rest == "" {
+		return value, true
+	}
+
+	for _, key := range strings.Split(strings.TrimPrefix(rest, "."), ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			value = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// validateDefinition checks a state machine, and the ones of the branches of its parallel
+// states: the states moved to exist, and the functions of the tasks too
+func (s *WorkflowService) validateDefinition(orgID uuid.UUID, definition models.WorkflowDefinition, path string) error {
+	invalid := func(state, details string) error {
+		return errors.ErrBadRequest.WithDetails("State " + path + state + ": " + details)
+	}
+
+	if len(definition.States) == 0 {
+		return errors.ErrBadRequest.WithDetails("The state machine " + path + " has no states")
+	}
+	if _, ok := definition.States[definition.StartAt]; !ok {
+		return errors.ErrBadRequest.WithDetails("The start state " + path + definition.StartAt + " doesn't exist")
+	}
+
+	exists := func(name string) bool {
+		_, ok := definition.States[name]
+		return ok
+	}
+
+	for name, state := range definition.States {
+		switch state.Type {
+		case models.WorkflowStateTask, models.WorkflowStateParallel, models.WorkflowStateWait:
+			if state.End == (state.Next != "") {
+				return invalid(name, "either next or end must be set")
+			}
+			if state.Next != "" && !exists(state.Next) {
+				return invalid(name, "the next state "+state.Next+" doesn't exist")
+			}
+		case models.WorkflowStateChoice:
+			if len(state.Choices) == 0 {
+				return invalid(name, "a choice state needs choices")
+			}
+			for _, choice := range state.Choices {
+				if !strings.HasPrefix(choice.Variable, "$") {
+					return invalid(name, "the variable of a choice must be a path starting with $")
+				}
+				if choice.StringEquals == nil && choice.NumericEquals == nil && choice.NumericLessThan == nil &&
+					choice.NumericGreaterThan == nil && choice.BooleanEquals == nil && choice.IsPresent == nil {
+					return invalid(name, "a choice needs a comparison")
+				}
+				if !exists(choice.Next) {
+					return invalid(name, "the next state "+choice.Next+" doesn't exist")
+				}
+			}
+			if state.Default != "" && !exists(state.Default) {
+				return invalid(name, "the default state "+state.Default+" doesn't exist")
+			}
+		case models.WorkflowStateFail:
+			if state.Error == "" {
+				return invalid(name, "a fail state needs an error")
+			}
+		case models.WorkflowStateSucceed:
+		default:
+			return invalid(name, "unknown type "+string(state.Type))
+		}
+
+		if state.Type == models.WorkflowStateWait && (state.Seconds < 0 || state.Seconds > workflowMaxWait.Seconds()) {
+			return invalid(name, fmt.Sprintf("the wait must be between 0 and %.0f seconds", workflowMaxWait.Seconds()))
+		}
+
+		if state.Type == models.WorkflowStateTask {
+			if state.Function == "" {
+				return invalid(name, "a task state needs a function")
+			}
+			if _, _, err := s.functions.Resolve(orgID, state.Function, state.Qualifier); err != nil {
+				return err
+			}
+		}
+
+		if state.Type == models.WorkflowStateParallel {
+			if len(state.Branches) == 0 {
+				return invalid(name, "a parallel state needs branches")
+			}
+			for i, branch := range state.Branches {
+				if err := s.validateDefinition(orgID, branch, path+name+"/"+strconv.Itoa(i)+"/"); err != nil {
+					return err
+				}
+			}
+		}
+
+		if state.Type != models.WorkflowStateTask && state.Type != models.WorkflowStateParallel &&
+			(len(state.Retry) > 0 || len(state.Catch) > 0) {
+			return invalid(name, "only task and parallel states retry and catch errors")
+		}
+		for _, retrier := range state.Retry {
+			if len(retrier.ErrorEquals) == 0 {
+				return invalid(name, "a retrier needs errors")
+			}
+			if (retrier.MaxAttempts != nil && *retrier.MaxAttempts < 0) || retrier.IntervalSeconds < 0 ||
+				(retrier.BackoffRate != 0 && retrier.BackoffRate < 1) {
+				return invalid(name, "a retrier needs a positive number of attempts and interval, and a backoff rate of at least 1")
+			}
+			if retrier.IntervalSeconds > workflowMaxWait.Seconds() {
+				return invalid(name, fmt.Sprintf("the interval of a retrier can't exceed %.0f seconds", workflowMaxWait.Seconds()))
+			}
+		}
+		for _, catcher := range state.Catch {
+			if len(catcher.ErrorEquals) == 0 {
+				return invalid(name, "a catcher needs errors")
+			}
+			if !exists(catcher.Next) {
+				return invalid(name, "the next state "+catcher.Next+" doesn't exist")
+			}
+		}
+	}
+
+	return nil
+}
+
+// workflowError maps the errors of the workflow store to API errors
+func workflowError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case stderrors.Is(err, models.ErrWorkflowNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Workflow not found")
+	case stderrors.Is(err, models.ErrWorkflowExecutionNotFound):
+		return errors.ErrResourceNotFound.WithDetails("Workflow execution not found")
+	case stderrors.Is(err, models.ErrWorkflowExists):
+		return errors.ErrConflict.WithDetails("A workflow with this name already exists")
+	default:
+		return errors.ErrInternalError.WithDetails(err.Error())
+	}
+}
@@ -0,0 +1,118 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ComputeStore abstracts DB operations for the inventory of the compute containers
+type ComputeStore interface {
+	CreateInstance(instance *models.ComputeInstance) error
+	GetInstance(containerID string) (*models.ComputeInstance, error)
+	UpdateInstance(instance *models.ComputeInstance) error
+	ListInstances(accountID uuid.UUID) ([]models.ComputeInstance, error)
+	ListOrganizationInstances(orgID uuid.UUID, includeDeleted, driftedOnly bool) ([]models.ComputeInstance, error)
+	ListActiveInstances() ([]models.ComputeInstance, error)
+}
+
+// GORMComputeStore implements ComputeStore using GORM for SQLite
+type GORMComputeStore struct {
+	db *gorm.DB
+}
+
+// NewGORMComputeStore creates a new GORMComputeStore
+func NewGORMComputeStore(dataSourceName string) (*GORMComputeStore, error) {
+	db, err := gorm.Open(sqlite.Open(dataSourceName), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database with GORM: %w", err)
+	}
+
+	if err := db.AutoMigrate(&models.ComputeInstance{}); err != nil {
+		return nil, fmt.Errorf("failed to auto migrate compute schema: %w", err)
+	}
+
+	return &GORMComputeStore{db: db}, nil
+}
+
+// CreateInstance records a compute instance
+func (s *GORMComputeStore) CreateInstance(instance *models.ComputeInstance) error {
+	if instance.ID == uuid.Nil {
+		instance.ID = uuid.New()
+	}
+	instance.CreatedAt = time.Now()
+	instance.UpdatedAt = time.Now()
+
+	if err := s.db.Create(instance).Error; err != nil {
+		return fmt.Errorf("failed to create compute instance: %w", err)
+	}
+	return nil
+}
+
+// GetInstance retrieves the compute instance of a container
+func (s *GORMComputeStore) GetInstance(containerID string) (*models.ComputeInstance, error) {
+	var instance models.ComputeInstance
+	err := s.db.First(&instance, "container_id = ?", containerID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrComputeInstanceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get compute instance: %w", err)
+	}
+	return &instance, nil
+}
+
+// UpdateInstance saves a compute instance
+func (s *GORMComputeStore) UpdateInstance(instance *models.ComputeInstance) error {
+	instance.UpdatedAt = time.Now()
+
+	if err := s.db.Save(instance).Error; err != nil {
+		return fmt.Errorf("failed to update compute instance: %w", err)
+	}
+	return nil
+}
+
+// ListInstances returns the compute instances of an account which are not deleted, the oldest first
+func (s *GORMComputeStore) ListInstances(accountID uuid.UUID) ([]models.ComputeInstance, error) {
+	var instances []models.ComputeInstance
+	err := s.db.Where("account_id = ? AND deleted_at IS NULL", accountID).Order("created_at").Find(&instances).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list compute instances: %w", err)
+	}
+	return instances, nil
+}
+
+// ListOrganizationInstances returns the compute instances of an organization, the oldest first
+func (s *GORMComputeStore) ListOrganizationInstances(orgID uuid.UUID, includeDeleted, driftedOnly bool) ([]models.ComputeInstance, error) {
+	query := s.db.Where("organization_id = ?", orgID)
+	if !includeDeleted {
+		query = query.Where("deleted_at IS NULL")
+	}
+	if driftedOnly {
+		query = query.Where("drift <> ''")
+	}
+
+	var instances []models.ComputeInstance
+	if err := query.Order("created_at").Find(&instances).Error; err != nil {
+		return nil, fmt.Errorf("failed to list compute instances: %w", err)
+	}
+	return instances, nil
+}
+
+// ListActiveInstances returns the compute instances which are not deleted, of every organization
+func (s *GORMComputeStore) ListActiveInstances() ([]models.ComputeInstance, error) {
+	var instances []models.ComputeInstance
+	if err := s.db.Where("deleted_at IS NULL").Order("created_at").Find(&instances).Error; err != nil {
+		return nil, fmt.Errorf("failed to list compute instances: %w", err)
+	}
+	return instances, nil
+}
@@ -0,0 +1,92 @@
+package stores
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupComputeTestDB(t *testing.T) (*GORMComputeStore, func()) {
+	dbPath := "test_compute_" + uuid.New().String() + ".db"
+
+	store, err := NewGORMComputeStore(dbPath)
+	require.NoError(t, err)
+
+	cleanup := func() {
+		os.Remove(dbPath)
+	}
+
+	return store, cleanup
+}
+
+func TestComputeInstanceInventory(t *testing.T) {
+	store, cleanup := setupComputeTestDB(t)
+	defer cleanup()
+
+	orgID, accountID := uuid.New(), uuid.New()
+	web := &models.ComputeInstance{
+		OrganizationID: orgID,
+		AccountID:      accountID,
+		ContainerID:    "web",
+		Name:           "web",
+		Image:          "nginx:alpine",
+		Environment:    map[string]string{"MODE": "blue"},
+		Ports:          map[string]string{"80": "18081"},
+		DesiredState:   models.ComputeDesiredRunning,
+	}
+	require.NoError(t, store.CreateInstance(web))
+	worker := &models.ComputeInstance{
+		OrganizationID: orgID,
+		AccountID:      uuid.New(),
+		ContainerID:    "worker",
+		Name:           "worker",
+		Image:          "alpine",
+		DesiredState:   models.ComputeDesiredRunning,
+	}
+	require.NoError(t, store.CreateInstance(worker))
+
+	instance, err := store.GetInstance("web")
+	require.NoError(t, err)
+	assert.Equal(t, web.ID, instance.ID)
+	assert.Equal(t, map[string]string{"MODE": "blue"}, instance.Environment)
+	assert.Equal(t, map[string]string{"80": "18081"}, instance.Ports)
+
+	_, err = store.GetInstance("missing")
+	assert.ErrorIs(t, err, models.ErrComputeInstanceNotFound)
+
+	worker.Drift = models.ComputeDriftCrashed
+	require.NoError(t, store.UpdateInstance(worker))
+	now := time.Now()
+	web.DesiredState = models.ComputeDesiredDeleted
+	web.DeletedAt = &now
+	require.NoError(t, store.UpdateInstance(web))
+
+	instances, err := store.ListInstances(accountID)
+	require.NoError(t, err)
+	assert.Empty(t, instances, "the deleted instances are left out")
+
+	instances, err = store.ListOrganizationInstances(orgID, false, false)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, "worker", instances[0].ContainerID)
+
+	instances, err = store.ListOrganizationInstances(orgID, true, false)
+	require.NoError(t, err)
+	assert.Len(t, instances, 2)
+
+	instances, err = store.ListOrganizationInstances(orgID, true, true)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, models.ComputeDriftCrashed, instances[0].Drift)
+
+	instances, err = store.ListActiveInstances()
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, "worker", instances[0].ContainerID)
+}
@@ -0,0 +1,78 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConcurrencyStore abstracts DB operations for the concurrency limits of the functions and organizations
+type ConcurrencyStore interface {
+	UpdateFunctionConcurrency(function *models.Function) error
+	SumReservedConcurrency(orgID uuid.UUID) (int, error)
+	GetOrganizationConcurrency(orgID uuid.UUID) (int, error)
+	PutOrganizationConcurrency(orgID uuid.UUID, maxConcurrency int) error
+}
+
+// UpdateFunctionConcurrency saves the maximum and reserved concurrency of a function
+func (s *GORMFunctionStore) UpdateFunctionConcurrency(function *models.Function) error {
+	function.UpdatedAt = time.Now()
+
+	result := s.db.Model(&models.Function{}).Where("id = ?", function.ID).Updates(map[string]interface{}{
+		"max_concurrency":      function.MaxConcurrency,
+		"reserved_concurrency": function.ReservedConcurrency,
+		"updated_at":           function.UpdatedAt,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update function concurrency: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrFunctionNotFound
+	}
+	return nil
+}
+
+// SumReservedConcurrency returns the concurrency reserved by the functions of an organization
+func (s *GORMFunctionStore) SumReservedConcurrency(orgID uuid.UUID) (int, error) {
+	var total int
+	err := s.db.Model(&models.Function{}).
+		Where("organization_id = ?", orgID).
+		Select("COALESCE(SUM(reserved_concurrency), 0)").
+		Scan(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum reserved concurrency: %w", err)
+	}
+	return total, nil
+}
+
+// GetOrganizationConcurrency returns the maximum concurrency set for an organization,
+// 0 when it uses the default one
+func (s *GORMFunctionStore) GetOrganizationConcurrency(orgID uuid.UUID) (int, error) {
+	var limit models.OrganizationConcurrency
+	err := s.db.First(&limit, "organization_id = ?", orgID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get organization concurrency: %w", err)
+	}
+	return limit.MaxConcurrency, nil
+}
+
+// PutOrganizationConcurrency sets the maximum concurrency of an organization
+func (s *GORMFunctionStore) PutOrganizationConcurrency(orgID uuid.UUID, maxConcurrency int) error {
+	limit := models.OrganizationConcurrency{
+		OrganizationID: orgID,
+		MaxConcurrency: maxConcurrency,
+		UpdatedAt:      time.Now(),
+	}
+	if err := s.db.Save(&limit).Error; err != nil {
+		return fmt.Errorf("failed to save organization concurrency: %w", err)
+	}
+	return nil
+}
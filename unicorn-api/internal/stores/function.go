@@ -0,0 +1,254 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// FunctionStore abstracts DB operations for the lambda functions
+type FunctionStore interface {
+	CreateFunction(function *models.Function, version *models.FunctionVersion) error
+	GetFunction(orgID uuid.UUID, name string) (*models.Function, error)
+	ListFunctions(orgID uuid.UUID) ([]models.Function, error)
+	DeleteFunction(functionID uuid.UUID) error
+	UpdateFunctionURL(function *models.Function) error
+
+	PublishVersion(function *models.Function, version *models.FunctionVersion) error
+	GetVersion(functionID uuid.UUID, version int) (*models.FunctionVersion, error)
+	ListVersions(functionID uuid.UUID) ([]models.FunctionVersion, error)
+
+	PutAlias(alias *models.FunctionAlias) error
+	GetAlias(functionID uuid.UUID, name string) (*models.FunctionAlias, error)
+	DeleteAlias(functionID uuid.UUID, name string) error
+}
+
+// GORMFunctionStore implements FunctionStore, LayerStore and ConcurrencyStore using GORM for SQLite
+type GORMFunctionStore struct {
+	db *gorm.DB
+}
+
+// NewGORMFunctionStore creates a new GORMFunctionStore
+func NewGORMFunctionStore(dataSourceName string) (*GORMFunctionStore, error) {
+	db, err := gorm.Open(sqlite.Open(dataSourceName), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database with GORM: %w", err)
+	}
+
+	err = db.AutoMigrate(&models.Function{}, &models.FunctionVersion{}, &models.FunctionAlias{}, &models.Layer{}, &models.LayerVersion{}, &models.OrganizationConcurrency{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to auto migrate function schema: %w", err)
+	}
+
+	return &GORMFunctionStore{db: db}, nil
+}
+
+// CreateFunction creates a function with its first version
+func (s *GORMFunctionStore) CreateFunction(function *models.Function, version *models.FunctionVersion) error {
+	if function.ID == uuid.Nil {
+		function.ID = uuid.New()
+	}
+	function.CreatedAt = time.Now()
+	function.UpdatedAt = time.Now()
+	function.LatestVersion = 1
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&models.Function{}).Where("organization_id = ? AND name = ?", function.OrganizationID, function.Name).Count(&count)
+		if count > 0 {
+			return models.ErrFunctionExists
+		}
+
+		if err := tx.Omit("Aliases").Create(function).Error; err != nil {
+			return fmt.Errorf("failed to create function: %w", err)
+		}
+
+		return createVersion(tx, function, version)
+	})
+}
+
+// GetFunction retrieves a function of an organization by name, with its aliases
+func (s *GORMFunctionStore) GetFunction(orgID uuid.UUID, name string) (*models.Function, error) {
+	var function models.Function
+	err := s.db.Preload("Aliases").First(&function, "organization_id = ? AND name = ?", orgID, name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrFunctionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function: %w", err)
+	}
+	return &function, nil
+}
+
+// ListFunctions returns the functions of an organization, sorted by name
+func (s *GORMFunctionStore) ListFunctions(orgID uuid.UUID) ([]models.Function, error) {
+	var functions []models.Function
+	err := s.db.Preload("Aliases").Where("organization_id = ?", orgID).Order("name").Find(&functions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list functions: %w", err)
+	}
+	return functions, nil
+}
+
+// DeleteFunction deletes a function with all its versions and aliases
+func (s *GORMFunctionStore) DeleteFunction(functionID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.FunctionAlias{}, "function_id = ?", functionID).Error; err != nil {
+			return fmt.Errorf("failed to delete function aliases: %w", err)
+		}
+		if err := tx.Delete(&models.FunctionVersion{}, "function_id = ?", functionID).Error; err != nil {
+			return fmt.Errorf("failed to delete function versions: %w", err)
+		}
+
+		result := tx.Delete(&models.Function{}, "id = ?", functionID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete function: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrFunctionNotFound
+		}
+		return nil
+	})
+}
+
+// UpdateFunctionURL saves the invoke URL settings of a function
+func (s *GORMFunctionStore) UpdateFunctionURL(function *models.Function) error {
+	function.UpdatedAt = time.Now()
+
+	result := s.db.Model(&models.Function{}).Where("id = ?", function.ID).Updates(map[string]interface{}{
+		"url_auth":      function.URLAuth,
+		"url_qualifier": function.URLQualifier,
+		"url_key_hash":  function.URLKeyHash,
+		"updated_at":    function.UpdatedAt,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update function url: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrFunctionNotFound
+	}
+	return nil
+}
+
+// PublishVersion stores the next version of a function and makes it the latest one
+func (s *GORMFunctionStore) PublishVersion(function *models.Function, version *models.FunctionVersion) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// read the latest version again, two updates must not publish the same number
+		var current models.Function
+		if err := tx.First(&current, "id = ?", function.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.ErrFunctionNotFound
+			}
+			return fmt.Errorf("failed to get function: %w", err)
+		}
+
+		function.LatestVersion = current.LatestVersion + 1
+		function.UpdatedAt = time.Now()
+
+		err := tx.Model(&models.Function{}).Where("id = ?", function.ID).Updates(map[string]interface{}{
+			"latest_version": function.LatestVersion,
+			"description":    function.Description,
+			"updated_at":     function.UpdatedAt,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update function: %w", err)
+		}
+
+		return createVersion(tx, function, version)
+	})
+}
+
+func createVersion(tx *gorm.DB, function *models.Function, version *models.FunctionVersion) error {
+	version.ID = uuid.New()
+	version.CreatedAt = time.Now()
+	version.FunctionID = function.ID
+	version.Version = function.LatestVersion
+
+	if err := tx.Create(version).Error; err != nil {
+		return fmt.Errorf("failed to publish function version: %w", err)
+	}
+	return nil
+}
+
+// GetVersion retrieves a version of a function by number
+func (s *GORMFunctionStore) GetVersion(functionID uuid.UUID, version int) (*models.FunctionVersion, error) {
+	var functionVersion models.FunctionVersion
+	err := s.db.First(&functionVersion, "function_id = ? AND version = ?", functionID, version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrFunctionVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function version: %w", err)
+	}
+	return &functionVersion, nil
+}
+
+// ListVersions returns the versions of a function, the most recent first
+func (s *GORMFunctionStore) ListVersions(functionID uuid.UUID) ([]models.FunctionVersion, error) {
+	var versions []models.FunctionVersion
+	err := s.db.Where("function_id = ?", functionID).Order("version DESC").Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list function versions: %w", err)
+	}
+	return versions, nil
+}
+
+// PutAlias creates an alias, or points an existing one to another version
+func (s *GORMFunctionStore) PutAlias(alias *models.FunctionAlias) error {
+	if alias.ID == uuid.Nil {
+		alias.ID = uuid.New()
+	}
+	alias.CreatedAt = time.Now()
+	alias.UpdatedAt = time.Now()
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "function_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"version", "description", "updated_at"}),
+	}).Create(alias).Error
+	if err != nil {
+		return fmt.Errorf("failed to save function alias: %w", err)
+	}
+
+	// the conflicting row keeps its id and creation time
+	stored, err := s.GetAlias(alias.FunctionID, alias.Name)
+	if err != nil {
+		return err
+	}
+	*alias = *stored
+	return nil
+}
+
+// GetAlias retrieves an alias of a function by name
+func (s *GORMFunctionStore) GetAlias(functionID uuid.UUID, name string) (*models.FunctionAlias, error) {
+	var alias models.FunctionAlias
+	err := s.db.First(&alias, "function_id = ? AND name = ?", functionID, name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrFunctionAliasNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function alias: %w", err)
+	}
+	return &alias, nil
+}
+
+// DeleteAlias deletes an alias of a function
+func (s *GORMFunctionStore) DeleteAlias(functionID uuid.UUID, name string) error {
+	result := s.db.Delete(&models.FunctionAlias{}, "function_id = ? AND name = ?", functionID, name)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete function alias: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrFunctionAliasNotFound
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package stores
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupFunctionTestDB(t *testing.T) (*GORMFunctionStore, func()) {
+	dbPath := "test_function_" + uuid.New().String() + ".db"
+
+	store, err := NewGORMFunctionStore(dbPath)
+	require.NoError(t, err)
+
+	cleanup := func() {
+		os.Remove(dbPath)
+	}
+
+	return store, cleanup
+}
+
+func newTestFunction(t *testing.T, store *GORMFunctionStore, orgID uuid.UUID, name string) *models.Function {
+	function := &models.Function{Name: name, OrganizationID: orgID}
+	version := &models.FunctionVersion{
+		Runtime: models.FunctionRuntime{Name: "python3"},
+		Files:   []models.LambdaFile{{Name: "main.py", Contents: "print(1)"}},
+	}
+	require.NoError(t, store.CreateFunction(function, version))
+	return function
+}
+
+func TestCreateFunction(t *testing.T) {
+	store, cleanup := setupFunctionTestDB(t)
+	defer cleanup()
+
+	orgID := uuid.New()
+	function := newTestFunction(t, store, orgID, "hello")
+	assert.Equal(t, 1, function.LatestVersion)
+
+	version, err := store.GetVersion(function.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "python3", version.Runtime.Name)
+	assert.Equal(t, "main.py", version.Files[0].Name)
+
+	// names are unique per organization only
+	err = store.CreateFunction(&models.Function{Name: "hello", OrganizationID: orgID}, &models.FunctionVersion{})
+	assert.ErrorIs(t, err, models.ErrFunctionExists)
+
+	newTestFunction(t, store, uuid.New(), "hello")
+
+	functions, err := store.ListFunctions(orgID)
+	require.NoError(t, err)
+	assert.Len(t, functions, 1)
+}
+
+func TestPublishVersion(t *testing.T) {
+	store, cleanup := setupFunctionTestDB(t)
+	defer cleanup()
+
+	function := newTestFunction(t, store, uuid.New(), "hello")
+
+	for i := 0; i < 2; i++ {
+		version := &models.FunctionVersion{
+			Runtime: models.FunctionRuntime{Name: "python3"},
+			Files:   []models.LambdaFile{{Name: "main.py", Contents: "print(2)"}},
+		}
+		require.NoError(t, store.PublishVersion(function, version))
+		assert.Equal(t, i+2, version.Version)
+	}
+
+	stored, err := store.GetFunction(function.OrganizationID, "hello")
+	require.NoError(t, err)
+	assert.Equal(t, 3, stored.LatestVersion)
+
+	versions, err := store.ListVersions(function.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, 3, versions[0].Version)
+
+	// the first version is left untouched
+	first, err := store.GetVersion(function.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "print(1)", first.Files[0].Contents)
+
+	_, err = store.GetVersion(function.ID, 4)
+	assert.ErrorIs(t, err, models.ErrFunctionVersionNotFound)
+}
+
+func TestFunctionAliases(t *testing.T) {
+	store, cleanup := setupFunctionTestDB(t)
+	defer cleanup()
+
+	function := newTestFunction(t, store, uuid.New(), "hello")
+
+	alias := &models.FunctionAlias{FunctionID: function.ID, Name: "prod", Version: 1}
+	require.NoError(t, store.PutAlias(alias))
+	id := alias.ID
+
+	// moving an alias keeps its identity
+	moved := &models.FunctionAlias{FunctionID: function.ID, Name: "prod", Version: 2}
+	require.NoError(t, store.PutAlias(moved))
+	assert.Equal(t, id, moved.ID)
+	assert.Equal(t, 2, moved.Version)
+
+	stored, err := store.GetFunction(function.OrganizationID, "hello")
+	require.NoError(t, err)
+	require.Len(t, stored.Aliases, 1)
+	assert.Equal(t, 2, stored.Aliases[0].Version)
+
+	require.NoError(t, store.DeleteAlias(function.ID, "prod"))
+	assert.ErrorIs(t, store.DeleteAlias(function.ID, "prod"), models.ErrFunctionAliasNotFound)
+}
+
+func TestDeleteFunction(t *testing.T) {
+	store, cleanup := setupFunctionTestDB(t)
+	defer cleanup()
+
+	function := newTestFunction(t, store, uuid.New(), "hello")
+	require.NoError(t, store.PutAlias(&models.FunctionAlias{FunctionID: function.ID, Name: "prod", Version: 1}))
+
+	require.NoError(t, store.DeleteFunction(function.ID))
+
+	_, err := store.GetFunction(function.OrganizationID, "hello")
+	assert.ErrorIs(t, err, models.ErrFunctionNotFound)
+
+	versions, err := store.ListVersions(function.ID)
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+
+	assert.ErrorIs(t, store.DeleteFunction(function.ID), models.ErrFunctionNotFound)
+}
+
+func TestLayerVersions(t *testing.T) {
+	store, cleanup := setupFunctionTestDB(t)
+	defer cleanup()
+
+	orgID := uuid.New()
+	for i := 0; i < 2; i++ {
+		layer := &models.Layer{Name: "utils", OrganizationID: orgID}
+		version := &models.LayerVersion{Files: []models.LambdaFile{{Name: "utils.py", Contents: "x = " + strconv.Itoa(i)}}}
+		require.NoError(t, store.PublishLayerVersion(layer, version))
+		assert.Equal(t, i+1, version.Version)
+		assert.Equal(t, i+1, layer.LatestVersion)
+	}
+
+	layers, err := store.ListLayers(orgID)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	assert.Equal(t, 2, layers[0].LatestVersion)
+
+	// the listing leaves the files out
+	versions, err := store.ListLayerVersions(layers[0].ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Empty(t, versions[0].Files)
+
+	first, err := store.GetLayerVersion(layers[0].ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "x = 0", first.Files[0].Contents)
+
+	_, err = store.GetLayer(uuid.New(), "utils")
+	assert.ErrorIs(t, err, models.ErrLayerNotFound)
+
+	require.NoError(t, store.DeleteLayer(layers[0].ID))
+	_, err = store.GetLayerVersion(layers[0].ID, 1)
+	assert.ErrorIs(t, err, models.ErrLayerVersionNotFound)
+	assert.ErrorIs(t, store.DeleteLayer(layers[0].ID), models.ErrLayerNotFound)
+}
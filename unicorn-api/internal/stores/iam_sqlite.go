@@ -271,9 +271,13 @@ func (s *GORMIAMStore) GetAccountsByOrganizationID(orgID string) ([]models.Accou
 	return accounts, nil
 }
 
+// AdminOrganizationName is the name of the organization seeded with the admin user, its
+// members administer the API
+const AdminOrganizationName = "admin-org"
+
 // SeedAdmin seeds the database with an admin organization, role, and user if not present
 func (s *GORMIAMStore) SeedAdmin(cfg *config.Config) error {
-	orgName := "admin-org"
+	orgName := AdminOrganizationName
 	roleName := "admin"
 	email := "admin@unicorn.local"
 	password := "admin123"
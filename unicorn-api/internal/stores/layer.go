@@ -0,0 +1,124 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LayerStore abstracts DB operations for the layers shared by the functions of an organization
+type LayerStore interface {
+	PublishLayerVersion(layer *models.Layer, version *models.LayerVersion) error
+	GetLayer(orgID uuid.UUID, name string) (*models.Layer, error)
+	ListLayers(orgID uuid.UUID) ([]models.Layer, error)
+	DeleteLayer(layerID uuid.UUID) error
+	GetLayerVersion(layerID uuid.UUID, version int) (*models.LayerVersion, error)
+	ListLayerVersions(layerID uuid.UUID) ([]models.LayerVersion, error)
+}
+
+// PublishLayerVersion stores the next version of a layer of an organization, creating the
+// layer with version 1 when it doesn't exist
+func (s *GORMFunctionStore) PublishLayerVersion(layer *models.Layer, version *models.LayerVersion) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.Layer
+		err := tx.First(&current, "organization_id = ? AND name = ?", layer.OrganizationID, layer.Name).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			current = models.Layer{
+				ID:             uuid.New(),
+				CreatedAt:      time.Now(),
+				Name:           layer.Name,
+				OrganizationID: layer.OrganizationID,
+			}
+		case err != nil:
+			return fmt.Errorf("failed to get layer: %w", err)
+		}
+
+		current.LatestVersion++
+		current.UpdatedAt = time.Now()
+		if layer.Description != "" {
+			current.Description = layer.Description
+		}
+		if err := tx.Save(&current).Error; err != nil {
+			return fmt.Errorf("failed to save layer: %w", err)
+		}
+		*layer = current
+
+		version.ID = uuid.New()
+		version.CreatedAt = time.Now()
+		version.LayerID = layer.ID
+		version.Version = layer.LatestVersion
+		if err := tx.Create(version).Error; err != nil {
+			return fmt.Errorf("failed to publish layer version: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetLayer retrieves a layer of an organization by name
+func (s *GORMFunctionStore) GetLayer(orgID uuid.UUID, name string) (*models.Layer, error) {
+	var layer models.Layer
+	err := s.db.First(&layer, "organization_id = ? AND name = ?", orgID, name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrLayerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layer: %w", err)
+	}
+	return &layer, nil
+}
+
+// ListLayers returns the layers of an organization, sorted by name
+func (s *GORMFunctionStore) ListLayers(orgID uuid.UUID) ([]models.Layer, error) {
+	var layers []models.Layer
+	if err := s.db.Where("organization_id = ?", orgID).Order("name").Find(&layers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list layers: %w", err)
+	}
+	return layers, nil
+}
+
+// DeleteLayer deletes a layer with all its versions
+func (s *GORMFunctionStore) DeleteLayer(layerID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.LayerVersion{}, "layer_id = ?", layerID).Error; err != nil {
+			return fmt.Errorf("failed to delete layer versions: %w", err)
+		}
+
+		result := tx.Delete(&models.Layer{}, "id = ?", layerID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete layer: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrLayerNotFound
+		}
+		return nil
+	})
+}
+
+// GetLayerVersion retrieves a version of a layer by number, with its files
+func (s *GORMFunctionStore) GetLayerVersion(layerID uuid.UUID, version int) (*models.LayerVersion, error) {
+	var layerVersion models.LayerVersion
+	err := s.db.First(&layerVersion, "layer_id = ? AND version = ?", layerID, version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrLayerVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layer version: %w", err)
+	}
+	return &layerVersion, nil
+}
+
+// ListLayerVersions returns the versions of a layer without their files, the most recent first
+func (s *GORMFunctionStore) ListLayerVersions(layerID uuid.UUID) ([]models.LayerVersion, error) {
+	var versions []models.LayerVersion
+	err := s.db.Omit("Files").Where("layer_id = ?", layerID).Order("version DESC").Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list layer versions: %w", err)
+	}
+	return versions, nil
+}
@@ -30,6 +30,9 @@ type MonitoringStore interface {
 	GetResourceUsageHistoryByOrganization(orgID string, start, end time.Time) ([]models.ResourceUsageHistory, error)
 	GetMonthlyUsageHistory(orgID string, year int, month int) ([]models.ResourceUsageHistory, error)
 
+	// Lambda metering
+	RecordLambdaUsage(usage *models.LambdaUsage) error
+
 	// Billing Period Management
 	CreateBillingPeriod(period *models.BillingPeriod) error
 	UpdateBillingPeriod(period *models.BillingPeriod) error
@@ -216,6 +219,80 @@ func (s *GORMMonitoringStore) CreateResourceUsageHistory(history *models.Resourc
 	return nil
 }
 
+// RecordLambdaUsage adds an invocation to the running usage of its account and memory class,
+// and to their usage history of the month, which the monthly billing reads
+func (s *GORMMonitoringStore) RecordLambdaUsage(usage *models.LambdaUsage) error {
+	resourceID := fmt.Sprintf("%s/%dmb", usage.AccountID, usage.MemoryClass)
+	resourceName := fmt.Sprintf("lambda %d MB", usage.MemoryClass)
+	seconds := usage.BilledDuration.Seconds()
+
+	periodStart := time.Date(usage.Time.Year(), usage.Time.Month(), 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.AddDate(0, 1, 0).Add(-time.Second)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.ResourceUsage
+		created := models.ResourceUsage{
+			ID:                uuid.New(),
+			CreatedAt:         usage.Time,
+			AccountID:         usage.AccountID,
+			OrganizationID:    usage.OrganizationID,
+			ResourceType:      models.ResourceTypeLambda,
+			ResourceID:        resourceID,
+			ResourceName:      resourceName,
+			Status:            models.ResourceStatusActive,
+			CostPerHour:       usage.CostPerHour,
+			Currency:          "USD",
+			ResourceCreatedAt: usage.Time,
+		}
+		if err := tx.Where("resource_id = ? AND resource_type = ?", resourceID, models.ResourceTypeLambda).
+			Attrs(created).FirstOrCreate(&current).Error; err != nil {
+			return fmt.Errorf("failed to get lambda usage: %w", err)
+		}
+
+		// increments in SQL, the invocations of an account are metered concurrently
+		err := tx.Model(&models.ResourceUsage{}).Where("id = ?", current.ID).Updates(map[string]interface{}{
+			"request_count":   gorm.Expr("request_count + ?", 1),
+			"execution_time":  gorm.Expr("execution_time + ?", seconds),
+			"total_cost":      gorm.Expr("total_cost + ?", usage.Cost),
+			"last_active_at":  usage.Time,
+			"last_updated_at": usage.Time,
+			"updated_at":      usage.Time,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update lambda usage: %w", err)
+		}
+
+		var history models.ResourceUsageHistory
+		createdHistory := models.ResourceUsageHistory{
+			ID:             uuid.New(),
+			CreatedAt:      usage.Time,
+			AccountID:      usage.AccountID,
+			OrganizationID: usage.OrganizationID,
+			ResourceType:   models.ResourceTypeLambda,
+			ResourceID:     resourceID,
+			ResourceName:   resourceName,
+			Currency:       "USD",
+			PeriodStart:    periodStart,
+			PeriodEnd:      periodEnd,
+			DurationHours:  periodEnd.Sub(periodStart).Hours(),
+		}
+		if err := tx.Where("resource_id = ? AND resource_type = ? AND period_start = ?", resourceID, models.ResourceTypeLambda, periodStart).
+			Attrs(createdHistory).FirstOrCreate(&history).Error; err != nil {
+			return fmt.Errorf("failed to get lambda usage history: %w", err)
+		}
+
+		err = tx.Model(&models.ResourceUsageHistory{}).Where("id = ?", history.ID).Updates(map[string]interface{}{
+			"total_requests":       gorm.Expr("total_requests + ?", 1),
+			"total_execution_time": gorm.Expr("total_execution_time + ?", seconds),
+			"total_cost":           gorm.Expr("total_cost + ?", usage.Cost),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update lambda usage history: %w", err)
+		}
+		return nil
+	})
+}
+
 // GetResourceUsageHistoryByResource retrieves usage history for a specific resource
 func (s *GORMMonitoringStore) GetResourceUsageHistoryByResource(resourceID string, resourceType models.ResourceType, start, end time.Time) ([]models.ResourceUsageHistory, error) {
 	var history []models.ResourceUsageHistory
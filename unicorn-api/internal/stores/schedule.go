@@ -0,0 +1,249 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// ScheduleStore abstracts DB operations for the schedules, their run history and the lease
+// electing the replica running them
+type ScheduleStore interface {
+	CreateSchedule(schedule *models.Schedule) error
+	GetSchedule(orgID uuid.UUID, name string) (*models.Schedule, error)
+	ListSchedules(orgID uuid.UUID) ([]models.Schedule, error)
+	UpdateSchedule(schedule *models.Schedule) error
+	DeleteSchedule(scheduleID uuid.UUID) error
+	RetargetContainer(oldID, newID string) error
+
+	ListDueSchedules(now time.Time) ([]models.Schedule, error)
+	ClaimOccurrence(scheduleID uuid.UUID, due time.Time, next *time.Time, now time.Time) (bool, error)
+
+	CreateRun(run *models.ScheduleRun) error
+	UpdateRun(run *models.ScheduleRun) error
+	ListRuns(scheduleID uuid.UUID, limit int) ([]models.ScheduleRun, error)
+	PruneRuns(scheduleID uuid.UUID, keep int) error
+
+	AcquireLease(name, holder string, now time.Time, duration time.Duration) (bool, error)
+	ReleaseLease(name, holder string) error
+}
+
+// GORMScheduleStore implements ScheduleStore using GORM for SQLite
+type GORMScheduleStore struct {
+	db *gorm.DB
+}
+
+// NewGORMScheduleStore creates a new GORMScheduleStore
+func NewGORMScheduleStore(dataSourceName string) (*GORMScheduleStore, error) {
+	db, err := gorm.Open(sqlite.Open(dataSourceName), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database with GORM: %w", err)
+	}
+
+	err = db.AutoMigrate(&models.Schedule{}, &models.ScheduleRun{}, &models.SchedulerLease{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to auto migrate schedule schema: %w", err)
+	}
+
+	return &GORMScheduleStore{db: db}, nil
+}
+
+// CreateSchedule creates a schedule, its name must be unique in its organization
+func (s *GORMScheduleStore) CreateSchedule(schedule *models.Schedule) error {
+	if schedule.ID == uuid.Nil {
+		schedule.ID = uuid.New()
+	}
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = time.Now()
+
+	var count int64
+	s.db.Model(&models.Schedule{}).Where("organization_id = ? AND name = ?", schedule.OrganizationID, schedule.Name).Count(&count)
+	if count > 0 {
+		return models.ErrScheduleExists
+	}
+
+	if err := s.db.Create(schedule).Error; err != nil {
+		return fmt.Errorf("failed to create schedule: %w", err)
+	}
+	return nil
+}
+
+// GetSchedule retrieves a schedule of an organization by name
+func (s *GORMScheduleStore) GetSchedule(orgID uuid.UUID, name string) (*models.Schedule, error) {
+	var schedule models.Schedule
+	err := s.db.First(&schedule, "organization_id = ? AND name = ?", orgID, name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// ListSchedules returns the schedules of an organization, sorted by name
+func (s *GORMScheduleStore) ListSchedules(orgID uuid.UUID) ([]models.Schedule, error) {
+	var schedules []models.Schedule
+	if err := s.db.Where("organization_id = ?", orgID).Order("name").Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// UpdateSchedule saves the settings and next occurrence of a schedule
+func (s *GORMScheduleStore) UpdateSchedule(schedule *models.Schedule) error {
+	schedule.UpdatedAt = time.Now()
+
+	result := s.db.Model(schedule).Select("description", "expression", "timezone", "jitter_seconds",
+		"catch_up", "enabled", "target", "next_run_at", "updated_at").Updates(schedule)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update schedule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrScheduleNotFound
+	}
+	return nil
+}
+
+// RetargetContainer points the compute targets of the schedules at the container replacing another
+func (s *GORMScheduleStore) RetargetContainer(oldID, newID string) error {
+	var schedules []models.Schedule
+	if err := s.db.Where("target LIKE ?", "%"+oldID+"%").Find(&schedules).Error; err != nil {
+		return fmt.Errorf("failed to list the schedules of container: %w", err)
+	}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+		if schedule.Target.Type != models.ScheduleTargetCompute || schedule.Target.ContainerID != oldID {
+			continue
+		}
+		schedule.Target.ContainerID = newID
+		schedule.UpdatedAt = time.Now()
+		if err := s.db.Model(schedule).Select("target", "updated_at").Updates(schedule).Error; err != nil {
+			return fmt.Errorf("failed to retarget schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteSchedule deletes a schedule with its run history
+func (s *GORMScheduleStore) DeleteSchedule(scheduleID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.ScheduleRun{}, "schedule_id = ?", scheduleID).Error; err != nil {
+			return fmt.Errorf("failed to delete schedule runs: %w", err)
+		}
+
+		result := tx.Delete(&models.Schedule{}, "id = ?", scheduleID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete schedule: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrScheduleNotFound
+		}
+		return nil
+	})
+}
+
+// ListDueSchedules returns the enabled schedules of all the organizations whose next occurrence
+// is past, the oldest first
+func (s *GORMScheduleStore) ListDueSchedules(now time.Time) ([]models.Schedule, error) {
+	var schedules []models.Schedule
+	err := s.db.Where("enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now.UTC()).
+		Order("next_run_at").Find(&schedules).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// ClaimOccurrence moves a schedule from its due occurrence to the next one. It returns false
+// when the schedule no longer waits for that occurrence: another replica claimed it, or the
+// schedule was changed in the meantime.
+func (s *GORMScheduleStore) ClaimOccurrence(scheduleID uuid.UUID, due time.Time, next *time.Time, now time.Time) (bool, error) {
+	result := s.db.Model(&models.Schedule{}).
+		Where("id = ? AND enabled = ? AND next_run_at = ?", scheduleID, true, due.UTC()).
+		Updates(map[string]interface{}{"next_run_at": next, "last_run_at": now.UTC()})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim schedule occurrence: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CreateRun adds a run to the history of a schedule
+func (s *GORMScheduleStore) CreateRun(run *models.ScheduleRun) error {
+	if run.ID == uuid.Nil {
+		run.ID = uuid.New()
+	}
+
+	if err := s.db.Create(run).Error; err != nil {
+		return fmt.Errorf("failed to create schedule run: %w", err)
+	}
+	return nil
+}
+
+// UpdateRun saves the status and result of a run
+func (s *GORMScheduleStore) UpdateRun(run *models.ScheduleRun) error {
+	if err := s.db.Save(run).Error; err != nil {
+		return fmt.Errorf("failed to update schedule run: %w", err)
+	}
+	return nil
+}
+
+// ListRuns returns the most recent runs of a schedule, the last started first
+func (s *GORMScheduleStore) ListRuns(scheduleID uuid.UUID, limit int) ([]models.ScheduleRun, error) {
+	var runs []models.ScheduleRun
+	err := s.db.Where("schedule_id = ?", scheduleID).Order("started_at DESC").Limit(limit).Find(&runs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedule runs: %w", err)
+	}
+	return runs, nil
+}
+
+// PruneRuns deletes the runs of a schedule but the most recent ones
+func (s *GORMScheduleStore) PruneRuns(scheduleID uuid.UUID, keep int) error {
+	kept := s.db.Model(&models.ScheduleRun{}).Select("id").Where("schedule_id = ?", scheduleID).
+		Order("started_at DESC").Limit(keep)
+	err := s.db.Where("schedule_id = ? AND id NOT IN (?)", scheduleID, kept).Delete(&models.ScheduleRun{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to prune schedule runs: %w", err)
+	}
+	return nil
+}
+
+// AcquireLease takes or renews a lease for a duration. It returns false while another holder
+// has a lease that didn't expire.
+func (s *GORMScheduleStore) AcquireLease(name, holder string, now time.Time, duration time.Duration) (bool, error) {
+	err := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.SchedulerLease{Name: name, ExpiresAt: time.Time{}}).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to create lease: %w", err)
+	}
+
+	result := s.db.Model(&models.SchedulerLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now.UTC()).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": now.Add(duration).UTC()})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseLease gives up a lease, another holder can take it at once
+func (s *GORMScheduleStore) ReleaseLease(name, holder string) error {
+	err := s.db.Model(&models.SchedulerLease{}).Where("name = ? AND holder = ?", name, holder).
+		Update("expires_at", time.Time{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package stores
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupScheduleTestDB(t *testing.T) (string, *GORMScheduleStore, func()) {
+	dbPath := "test_schedule_" + uuid.New().String() + ".db"
+
+	store, err := NewGORMScheduleStore(dbPath)
+	require.NoError(t, err)
+
+	cleanup := func() {
+		os.Remove(dbPath)
+	}
+
+	return dbPath, store, cleanup
+}
+
+func TestSchedulerLease(t *testing.T) {
+	dbPath, first, cleanup := setupScheduleTestDB(t)
+	defer cleanup()
+
+	// another replica of the API
+	second, err := NewGORMScheduleStore(dbPath)
+	require.NoError(t, err)
+
+	now := time.Now()
+	acquired, err := first.AcquireLease("scheduler", "replica-1", now, 30*time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = second.AcquireLease("scheduler", "replica-2", now.Add(10*time.Second), 30*time.Second)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the lease didn't expire")
+
+	acquired, err = first.AcquireLease("scheduler", "replica-1", now.Add(20*time.Second), 30*time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the holder renews its lease")
+
+	acquired, err = second.AcquireLease("scheduler", "replica-2", now.Add(40*time.Second), 30*time.Second)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the renewal extended the lease")
+
+	acquired, err = second.AcquireLease("scheduler", "replica-2", now.Add(51*time.Second), 30*time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the lease expired")
+
+	require.NoError(t, second.ReleaseLease("scheduler", "replica-2"))
+	acquired, err = first.AcquireLease("scheduler", "replica-1", now.Add(52*time.Second), 30*time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the lease was released")
+}
+
+func TestClaimScheduleOccurrence(t *testing.T) {
+	dbPath, store, cleanup := setupScheduleTestDB(t)
+	defer cleanup()
+
+	other, err := NewGORMScheduleStore(dbPath)
+	require.NoError(t, err)
+
+	due := time.Now().Add(-time.Minute).Truncate(time.Second).UTC()
+	next := due.Add(time.Hour)
+	schedule := &models.Schedule{
+		Name:           "nightly",
+		OrganizationID: uuid.New(),
+		AccountID:      uuid.New(),
+		Expression:     "rate(1 hour)",
+		Timezone:       "UTC",
+		Enabled:        true,
+		Target:         models.ScheduleTarget{Type: models.ScheduleTargetFunction, Function: "report"},
+		NextRunAt:      &due,
+	}
+	require.NoError(t, store.CreateSchedule(schedule))
+	assert.ErrorIs(t, store.CreateSchedule(&models.Schedule{Name: "nightly", OrganizationID: schedule.OrganizationID}), models.ErrScheduleExists)
+
+	schedules, err := store.ListDueSchedules(time.Now())
+	require.NoError(t, err)
+	require.Len(t, schedules, 1)
+
+	claimed, err := store.ClaimOccurrence(schedule.ID, *schedules[0].NextRunAt, &next, time.Now())
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = other.ClaimOccurrence(schedule.ID, *schedules[0].NextRunAt, &next, time.Now())
+	require.NoError(t, err)
+	assert.False(t, claimed, "an occurrence is claimed once")
+
+	schedules, err = store.ListDueSchedules(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, schedules)
+
+	saved, err := store.GetSchedule(schedule.OrganizationID, "nightly")
+	require.NoError(t, err)
+	assert.True(t, saved.NextRunAt.Equal(next))
+	assert.NotNil(t, saved.LastRunAt)
+}
+
+func TestPruneScheduleRuns(t *testing.T) {
+	_, store, cleanup := setupScheduleTestDB(t)
+	defer cleanup()
+
+	scheduleID := uuid.New()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		run := &models.ScheduleRun{
+			ScheduleID:  scheduleID,
+			ScheduledAt: start.Add(time.Duration(i) * time.Minute),
+			Trigger:     models.ScheduleRunOnTime,
+			Status:      models.ScheduleRunSucceeded,
+			StartedAt:   start.Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, store.CreateRun(run))
+	}
+
+	require.NoError(t, store.PruneRuns(scheduleID, 3))
+
+	runs, err := store.ListRuns(scheduleID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.True(t, runs[0].StartedAt.Equal(start.Add(4*time.Minute)), "the most recent first")
+	assert.True(t, runs[2].StartedAt.Equal(start.Add(2*time.Minute)))
+}
+
+func TestRetargetContainer(t *testing.T) {
+	_, store, cleanup := setupScheduleTestDB(t)
+	defer cleanup()
+
+	schedule := func(name string, target models.ScheduleTarget) *models.Schedule {
+		schedule := &models.Schedule{
+			Name:           name,
+			OrganizationID: uuid.New(),
+			AccountID:      uuid.New(),
+			Expression:     "rate(1 hour)",
+			Timezone:       "UTC",
+			Target:         target,
+		}
+		require.NoError(t, store.CreateSchedule(schedule))
+		return schedule
+	}
+	start := schedule("start", models.ScheduleTarget{Type: models.ScheduleTargetCompute, ContainerID: "old", Action: models.ScheduleComputeStart})
+	other := schedule("other", models.ScheduleTarget{Type: models.ScheduleTargetCompute, ContainerID: "old-other", Action: models.ScheduleComputeStop})
+	function := schedule("function", models.ScheduleTarget{Type: models.ScheduleTargetFunction, Function: "old"})
+
+	require.NoError(t, store.RetargetContainer("old", "new"))
+
+	target := func(schedule *models.Schedule) models.ScheduleTarget {
+		stored, err := store.GetSchedule(schedule.OrganizationID, schedule.Name)
+		require.NoError(t, err)
+		return stored.Target
+	}
+	assert.Equal(t, "new", target(start).ContainerID)
+	assert.Equal(t, models.ScheduleComputeStart, target(start).Action)
+	assert.Equal(t, "old-other", target(other).ContainerID, "only the container replaced is retargeted")
+	assert.Equal(t, "old", target(function).Function)
+}
@@ -0,0 +1,196 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// StorageEventStore abstracts DB operations for the bucket notifications and their deliveries
+type StorageEventStore interface {
+	CreateNotification(notification *models.BucketNotification) error
+	ListNotifications(bucketID uuid.UUID) ([]models.BucketNotification, error)
+	DeleteNotification(bucketID, notificationID uuid.UUID) error
+
+	GetNotification(notificationID uuid.UUID) (*models.BucketNotification, error)
+
+	CreateDelivery(delivery *models.StorageEventDelivery) error
+	UpdateDelivery(delivery *models.StorageEventDelivery) error
+	ListDeliveries(bucketID uuid.UUID, status models.StorageEventDeliveryStatus) ([]models.StorageEventDelivery, error)
+
+	ClaimDeliveries(holder string, now time.Time, duration time.Duration, limit int) ([]models.StorageEventDelivery, error)
+	RenewDeliveries(holder string, now time.Time, duration time.Duration) error
+	ReleaseDeliveries(holder string) error
+}
+
+// GORMStorageEventStore implements StorageEventStore using GORM for SQLite
+type GORMStorageEventStore struct {
+	db *gorm.DB
+}
+
+// NewGORMStorageEventStore creates a new GORMStorageEventStore
+func NewGORMStorageEventStore(dataSourceName string) (*GORMStorageEventStore, error) {
+	db, err := gorm.Open(sqlite.Open(dataSourceName), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database with GORM: %w", err)
+	}
+
+	err = db.AutoMigrate(&models.BucketNotification{}, &models.StorageEventDelivery{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to auto migrate storage event schema: %w", err)
+	}
+
+	return &GORMStorageEventStore{db: db}, nil
+}
+
+// CreateNotification adds a notification to a bucket
+func (s *GORMStorageEventStore) CreateNotification(notification *models.BucketNotification) error {
+	if notification.ID == uuid.Nil {
+		notification.ID = uuid.New()
+	}
+	notification.CreatedAt = time.Now()
+	notification.UpdatedAt = time.Now()
+
+	if err := s.db.Create(notification).Error; err != nil {
+		return fmt.Errorf("failed to create bucket notification: %w", err)
+	}
+	return nil
+}
+
+// ListNotifications returns the notifications of a bucket, the oldest first
+func (s *GORMStorageEventStore) ListNotifications(bucketID uuid.UUID) ([]models.BucketNotification, error) {
+	var notifications []models.BucketNotification
+	err := s.db.Where("bucket_id = ?", bucketID).Order("created_at").Find(&notifications).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bucket notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// GetNotification returns a notification by its ID
+func (s *GORMStorageEventStore) GetNotification(notificationID uuid.UUID) (*models.BucketNotification, error) {
+	var notification models.BucketNotification
+	err := s.db.First(&notification, "id = ?", notificationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrBucketNotificationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket notification: %w", err)
+	}
+	return &notification, nil
+}
+
+// DeleteNotification deletes a notification of a bucket, its deliveries are kept
+func (s *GORMStorageEventStore) DeleteNotification(bucketID, notificationID uuid.UUID) error {
+	result := s.db.Delete(&models.BucketNotification{}, "id = ? AND bucket_id = ?", notificationID, bucketID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete bucket notification: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrBucketNotificationNotFound
+	}
+	return nil
+}
+
+// CreateDelivery records an event to deliver to the function of a notification
+func (s *GORMStorageEventStore) CreateDelivery(delivery *models.StorageEventDelivery) error {
+	if delivery.ID == uuid.Nil {
+		delivery.ID = uuid.New()
+	}
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = time.Now()
+
+	if err := s.db.Create(delivery).Error; err != nil {
+		return fmt.Errorf("failed to create storage event delivery: %w", err)
+	}
+	return nil
+}
+
+// UpdateDelivery saves the status and attempts of a delivery
+func (s *GORMStorageEventStore) UpdateDelivery(delivery *models.StorageEventDelivery) error {
+	delivery.UpdatedAt = time.Now()
+
+	err := s.db.Model(&models.StorageEventDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":     delivery.Status,
+		"attempts":   delivery.Attempts,
+		"last_error": delivery.LastError,
+		"updated_at": delivery.UpdatedAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update storage event delivery: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the deliveries of a bucket, the most recent first,
+// filtered by status unless it is empty
+func (s *GORMStorageEventStore) ListDeliveries(bucketID uuid.UUID, status models.StorageEventDeliveryStatus) ([]models.StorageEventDelivery, error) {
+	query := s.db.Where("bucket_id = ?", bucketID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.StorageEventDelivery
+	if err := query.Order("created_at DESC").Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list storage event deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// ClaimDeliveries takes up to limit pending deliveries released or left by an expired holder,
+// the oldest first. Each one is claimed with its lease, so a delivery is only taken by one holder.
+func (s *GORMStorageEventStore) ClaimDeliveries(holder string, now time.Time, duration time.Duration, limit int) ([]models.StorageEventDelivery, error) {
+	var candidates []models.StorageEventDelivery
+	err := s.db.Where("status = ? AND lease_expires_at < ?", models.StorageEventDeliveryPending, now.UTC()).
+		Order("created_at").Limit(limit).Find(&candidates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage event deliveries to claim: %w", err)
+	}
+
+	claimed := make([]models.StorageEventDelivery, 0, len(candidates))
+	for _, delivery := range candidates {
+		result := s.db.Model(&models.StorageEventDelivery{}).
+			Where("id = ? AND status = ? AND lease_expires_at < ?", delivery.ID, models.StorageEventDeliveryPending, now.UTC()).
+			Updates(map[string]interface{}{"holder": holder, "lease_expires_at": now.Add(duration).UTC()})
+		if result.Error != nil {
+			return claimed, fmt.Errorf("failed to claim storage event delivery: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			delivery.Holder = holder
+			delivery.LeaseExpiresAt = now.Add(duration).UTC()
+			claimed = append(claimed, delivery)
+		}
+	}
+	return claimed, nil
+}
+
+// RenewDeliveries extends the lease of the pending deliveries of a holder
+func (s *GORMStorageEventStore) RenewDeliveries(holder string, now time.Time, duration time.Duration) error {
+	err := s.db.Model(&models.StorageEventDelivery{}).
+		Where("holder = ? AND status = ?", holder, models.StorageEventDeliveryPending).
+		Update("lease_expires_at", now.Add(duration).UTC()).Error
+	if err != nil {
+		return fmt.Errorf("failed to renew storage event deliveries: %w", err)
+	}
+	return nil
+}
+
+// ReleaseDeliveries gives up the pending deliveries of a holder, another holder can claim them at once
+func (s *GORMStorageEventStore) ReleaseDeliveries(holder string) error {
+	err := s.db.Model(&models.StorageEventDelivery{}).
+		Where("holder = ? AND status = ?", holder, models.StorageEventDeliveryPending).
+		Update("lease_expires_at", time.Time{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release storage event deliveries: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package stores
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStorageEventTestDB(t *testing.T) (*GORMStorageEventStore, func()) {
+	dbPath := "test_storage_events_" + uuid.New().String() + ".db"
+
+	store, err := NewGORMStorageEventStore(dbPath)
+	require.NoError(t, err)
+
+	cleanup := func() {
+		os.Remove(dbPath)
+	}
+
+	return store, cleanup
+}
+
+func TestStorageEventDeliveryLeases(t *testing.T) {
+	store, cleanup := setupStorageEventTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	delivery := func(holder string, leaseExpiresAt time.Time) *models.StorageEventDelivery {
+		delivery := &models.StorageEventDelivery{
+			NotificationID: uuid.New(),
+			BucketID:       uuid.New(),
+			Status:         models.StorageEventDeliveryPending,
+			Holder:         holder,
+			LeaseExpiresAt: leaseExpiresAt.UTC(),
+		}
+		require.NoError(t, store.CreateDelivery(delivery))
+		return delivery
+	}
+
+	held := delivery("replica-1", now.Add(time.Minute))
+	expired := delivery("replica-2", now.Add(-time.Minute))
+	done := delivery("replica-2", now.Add(-time.Minute))
+	done.Status = models.StorageEventDeliverySucceeded
+	require.NoError(t, store.UpdateDelivery(done))
+
+	claimed, err := store.ClaimDeliveries("replica-3", now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1, "only the pending deliveries of an expired holder are taken over")
+	assert.Equal(t, expired.ID, claimed[0].ID)
+
+	claimed, err = store.ClaimDeliveries("replica-4", now, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "a claimed delivery is leased")
+
+	// the holder renews its deliveries, then gives them up
+	require.NoError(t, store.RenewDeliveries("replica-1", now.Add(2*time.Minute), time.Minute))
+	claimed, err = store.ClaimDeliveries("replica-4", now.Add(2*time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, expired.ID, claimed[0].ID, "the renewed deliveries are kept")
+
+	require.NoError(t, store.ReleaseDeliveries("replica-1"))
+	claimed, err = store.ClaimDeliveries("replica-4", now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, held.ID, claimed[0].ID, "the released deliveries are claimed at once")
+}
@@ -14,11 +14,17 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// StorageEventSink receives the changes of the files of the buckets
+type StorageEventSink interface {
+	Publish(event models.StorageEvent)
+}
+
 // GORMStorageStore implements storage operations using GORM for SQLite
 // and writes file contents to disk.
 type GORMStorageStore struct {
 	db          *gorm.DB
 	storagePath string
+	events      StorageEventSink
 }
 
 // NewGORMStorageStore creates a new GORMStorageStore
@@ -94,6 +100,7 @@ func (s *GORMStorageStore) SaveFile(bucketID uuid.UUID, fileHeader string, conte
 		os.Remove(filePath)
 		return nil, fmt.Errorf("failed to save file metadata: %w", err)
 	}
+	s.publish(models.StorageEventFileCreated, fileModel)
 	return fileModel, nil
 }
 
@@ -120,6 +127,7 @@ func (s *GORMStorageStore) DeleteFile(bucketID, fileID uuid.UUID) error {
 	if err := s.db.Delete(&models.File{}, "id = ? AND storage_bucket_id = ?", fileID, bucketID).Error; err != nil {
 		return fmt.Errorf("failed to delete file metadata: %w", err)
 	}
+	s.publish(models.StorageEventFileDeleted, file)
 	return nil
 }
 
@@ -137,3 +145,23 @@ func (s *GORMStorageStore) ListBucketsByUser(userID uuid.UUID) ([]models.Storage
 func (s *GORMStorageStore) StoragePath() string {
 	return s.storagePath
 }
+
+// SetEventSink makes the store publish the files created and deleted to a sink
+func (s *GORMStorageStore) SetEventSink(sink StorageEventSink) {
+	s.events = sink
+}
+
+func (s *GORMStorageStore) publish(eventType models.StorageEventType, file *models.File) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(models.StorageEvent{
+		Type:        eventType,
+		BucketID:    file.StorageBucketID,
+		FileID:      file.ID,
+		Name:        file.Name,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+		Time:        time.Now(),
+	})
+}
@@ -0,0 +1,274 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"unicorn-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// WorkflowStore abstracts DB operations for the workflows, their executions and their history
+type WorkflowStore interface {
+	CreateWorkflow(workflow *models.Workflow) error
+	GetWorkflow(orgID uuid.UUID, name string) (*models.Workflow, error)
+	ListWorkflows(orgID uuid.UUID) ([]models.Workflow, error)
+	UpdateWorkflow(workflow *models.Workflow) error
+	DeleteWorkflow(workflowID uuid.UUID) error
+
+	CreateExecution(execution *models.WorkflowExecution) error
+	UpdateExecution(execution *models.WorkflowExecution) error
+	GetExecution(executionID uuid.UUID) (*models.WorkflowExecution, error)
+	ListExecutions(workflowID uuid.UUID, status models.WorkflowExecutionStatus) ([]models.WorkflowExecution, error)
+	ClaimExecutions(holder string, now time.Time, duration time.Duration) ([]models.WorkflowExecution, error)
+	RenewExecutions(holder string, now time.Time, duration time.Duration) error
+	ReleaseExecutions(holder string) error
+	RequestCancellation(executionID uuid.UUID) error
+	ListCancelRequested(holder string) ([]uuid.UUID, error)
+
+	AddEvent(event *models.WorkflowEvent) error
+}
+
+// GORMWorkflowStore implements WorkflowStore using GORM for SQLite
+type GORMWorkflowStore struct {
+	db *gorm.DB
+}
+
+// NewGORMWorkflowStore creates a new GORMWorkflowStore
+func NewGORMWorkflowStore(dataSourceName string) (*GORMWorkflowStore, error) {
+	db, err := gorm.Open(sqlite.Open(dataSourceName), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database with GORM: %w", err)
+	}
+
+	err = db.AutoMigrate(&models.Workflow{}, &models.WorkflowExecution{}, &models.WorkflowEvent{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to auto migrate workflow schema: %w", err)
+	}
+
+	return &GORMWorkflowStore{db: db}, nil
+}
+
+// CreateWorkflow creates a workflow, its name must be unique in its organization.
+// The check isn't done in a transaction: the executions write their history at any time, and
+// SQLite doesn't wait for them to upgrade a read transaction. The unique index still guards
+// against two workflows created at once.
+func (s *GORMWorkflowStore) CreateWorkflow(workflow *models.Workflow) error {
+	if workflow.ID == uuid.Nil {
+		workflow.ID = uuid.New()
+	}
+	workflow.CreatedAt = time.Now()
+	workflow.UpdatedAt = time.Now()
+
+	var count int64
+	s.db.Model(&models.Workflow{}).Where("organization_id = ? AND name = ?", workflow.OrganizationID, workflow.Name).Count(&count)
+	if count > 0 {
+		return models.ErrWorkflowExists
+	}
+
+	if err := s.db.Create(workflow).Error; err != nil {
+		return fmt.Errorf("failed to create workflow: %w", err)
+	}
+	return nil
+}
+
+// GetWorkflow retrieves a workflow of an organization by name
+func (s *GORMWorkflowStore) GetWorkflow(orgID uuid.UUID, name string) (*models.Workflow, error) {
+	var workflow models.Workflow
+	err := s.db.First(&workflow, "organization_id = ? AND name = ?", orgID, name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+	return &workflow, nil
+}
+
+// ListWorkflows returns the workflows of an organization, sorted by name
+func (s *GORMWorkflowStore) ListWorkflows(orgID uuid.UUID) ([]models.Workflow, error) {
+	var workflows []models.Workflow
+	if err := s.db.Where("organization_id = ?", orgID).Order("name").Find(&workflows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list workflows: %w", err)
+	}
+	return workflows, nil
+}
+
+// UpdateWorkflow saves the description and definition of a workflow
+func (s *GORMWorkflowStore) UpdateWorkflow(workflow *models.Workflow) error {
+	workflow.UpdatedAt = time.Now()
+
+	result := s.db.Model(workflow).Select("description", "definition", "updated_at").Updates(workflow)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update workflow: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrWorkflowNotFound
+	}
+	return nil
+}
+
+// DeleteWorkflow deletes a workflow with its executions and their history
+func (s *GORMWorkflowStore) DeleteWorkflow(workflowID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		executions := tx.Model(&models.WorkflowExecution{}).Select("id").Where("workflow_id = ?", workflowID)
+		if err := tx.Delete(&models.WorkflowEvent{}, "execution_id IN (?)", executions).Error; err != nil {
+			return fmt.Errorf("failed to delete workflow history: %w", err)
+		}
+		if err := tx.Delete(&models.WorkflowExecution{}, "workflow_id = ?", workflowID).Error; err != nil {
+			return fmt.Errorf("failed to delete workflow executions: %w", err)
+		}
+
+		result := tx.Delete(&models.Workflow{}, "id = ?", workflowID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete workflow: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrWorkflowNotFound
+		}
+		return nil
+	})
+}
+
+// CreateExecution records the start of an execution of a workflow
+func (s *GORMWorkflowStore) CreateExecution(execution *models.WorkflowExecution) error {
+	if execution.ID == uuid.Nil {
+		execution.ID = uuid.New()
+	}
+	execution.CreatedAt = time.Now()
+	execution.UpdatedAt = time.Now()
+
+	if err := s.db.Omit("History").Create(execution).Error; err != nil {
+		return fmt.Errorf("failed to create workflow execution: %w", err)
+	}
+	return nil
+}
+
+// UpdateExecution saves the status and result of an execution
+func (s *GORMWorkflowStore) UpdateExecution(execution *models.WorkflowExecution) error {
+	execution.UpdatedAt = time.Now()
+
+	if err := s.db.Omit("History").Save(execution).Error; err != nil {
+		return fmt.Errorf("failed to update workflow execution: %w", err)
+	}
+	return nil
+}
+
+// GetExecution retrieves an execution with its history, in the order of the events
+func (s *GORMWorkflowStore) GetExecution(executionID uuid.UUID) (*models.WorkflowExecution, error) {
+	var execution models.WorkflowExecution
+	err := s.db.Preload("History", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&execution, "id = ?", executionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrWorkflowExecutionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow execution: %w", err)
+	}
+	return &execution, nil
+}
+
+// ListExecutions returns the executions of a workflow without their history, the most
+// recent first, optionally filtered by status
+func (s *GORMWorkflowStore) ListExecutions(workflowID uuid.UUID, status models.WorkflowExecutionStatus) ([]models.WorkflowExecution, error) {
+	query := s.db.Where("workflow_id = ?", workflowID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var executions []models.WorkflowExecution
+	if err := query.Order("created_at DESC").Find(&executions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list workflow executions: %w", err)
+	}
+	return executions, nil
+}
+
+// ClaimExecutions takes over the running executions whose holder let its lease expire, each
+// one is claimed by a single holder
+func (s *GORMWorkflowStore) ClaimExecutions(holder string, now time.Time, duration time.Duration) ([]models.WorkflowExecution, error) {
+	var candidates []models.WorkflowExecution
+	err := s.db.Where("status = ? AND lease_expires_at < ?", models.WorkflowExecutionRunning, now.UTC()).
+		Order("created_at").Find(&candidates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workflow executions to claim: %w", err)
+	}
+
+	claimed := make([]models.WorkflowExecution, 0, len(candidates))
+	for _, execution := range candidates {
+		result := s.db.Model(&models.WorkflowExecution{}).
+			Where("id = ? AND status = ? AND lease_expires_at < ?", execution.ID, models.WorkflowExecutionRunning, now.UTC()).
+			Updates(map[string]interface{}{"holder": holder, "lease_expires_at": now.Add(duration).UTC()})
+		if result.Error != nil {
+			return claimed, fmt.Errorf("failed to claim workflow execution: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			execution.Holder = holder
+			execution.LeaseExpiresAt = now.Add(duration).UTC()
+			claimed = append(claimed, execution)
+		}
+	}
+	return claimed, nil
+}
+
+// RenewExecutions extends the lease of the running executions of a holder
+func (s *GORMWorkflowStore) RenewExecutions(holder string, now time.Time, duration time.Duration) error {
+	err := s.db.Model(&models.WorkflowExecution{}).
+		Where("holder = ? AND status = ?", holder, models.WorkflowExecutionRunning).
+		Update("lease_expires_at", now.Add(duration).UTC()).Error
+	if err != nil {
+		return fmt.Errorf("failed to renew workflow executions: %w", err)
+	}
+	return nil
+}
+
+// ReleaseExecutions gives up the running executions of a holder, another holder can claim them at once
+func (s *GORMWorkflowStore) ReleaseExecutions(holder string) error {
+	err := s.db.Model(&models.WorkflowExecution{}).
+		Where("holder = ? AND status = ?", holder, models.WorkflowExecutionRunning).
+		Update("lease_expires_at", time.Time{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release workflow executions: %w", err)
+	}
+	return nil
+}
+
+// RequestCancellation asks the holder of a running execution to cancel it
+func (s *GORMWorkflowStore) RequestCancellation(executionID uuid.UUID) error {
+	err := s.db.Model(&models.WorkflowExecution{}).
+		Where("id = ? AND status = ?", executionID, models.WorkflowExecutionRunning).
+		Update("cancel_requested", true).Error
+	if err != nil {
+		return fmt.Errorf("failed to request the cancellation of workflow execution: %w", err)
+	}
+	return nil
+}
+
+// ListCancelRequested returns the running executions of a holder asked to be cancelled
+func (s *GORMWorkflowStore) ListCancelRequested(holder string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := s.db.Model(&models.WorkflowExecution{}).
+		Where("holder = ? AND status = ? AND cancel_requested", holder, models.WorkflowExecutionRunning).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the workflow executions to cancel: %w", err)
+	}
+	return ids, nil
+}
+
+// AddEvent appends an event to the history of an execution
+func (s *GORMWorkflowStore) AddEvent(event *models.WorkflowEvent) error {
+	event.CreatedAt = time.Now()
+
+	if err := s.db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to add workflow event: %w", err)
+	}
+	return nil
+}
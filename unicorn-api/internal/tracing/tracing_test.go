@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSetupWithEndpoint(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "unicorn-api", "http://localhost:4318")
+	require.NoError(t, err, "the service resource must merge with the SDK defaults")
+
+	provider, ok := otel.GetTracerProvider().(*trace.TracerProvider)
+	require.True(t, ok, "the SDK tracer provider is installed")
+	assert.NotNil(t, provider)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, shutdown(ctx))
+}
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "unicorn-api", "")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}